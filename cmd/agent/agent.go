@@ -34,6 +34,36 @@ type StreamConfig struct {
 	ActiveOnly    bool     // Only stream frames during active gameplay
 	ExcludePaused bool     // Exclude paused frames (only with ActiveOnly)
 	IdleFPS       int      // Frame rate for non-gametime frames
+
+	// Events stream delivery
+	BatchWindow    time.Duration // Group frames into one message per window (0 = disabled)
+	BatchMaxFrames int           // Maximum frames per batch
+	BatchMaxBytes  int           // Maximum envelope bytes per batch
+	Compression    string        // none, deflate or zstd
+	FastCatchUp    bool          // Drain the disk buffer in large compressed batches
+
+	// Adaptive streaming rate
+	AdaptiveFPS        []int         // Streaming FPS caps to step through when the link falls behind
+	AdaptiveMaxLatency time.Duration // Send latency that triggers a step down
+}
+
+// batchConfig returns the WebSocket batching settings.
+func (c StreamConfig) batchConfig() agent.BatchConfig {
+	return agent.BatchConfig{
+		Window:      c.BatchWindow,
+		MaxFrames:   c.BatchMaxFrames,
+		MaxBytes:    c.BatchMaxBytes,
+		Compression: c.Compression,
+		FastCatchUp: c.FastCatchUp,
+	}
+}
+
+// adaptiveRateConfig returns the adaptive streaming rate settings.
+func (c StreamConfig) adaptiveRateConfig() agent.AdaptiveRateConfig {
+	return agent.AdaptiveRateConfig{
+		Levels:     c.AdaptiveFPS,
+		MaxLatency: c.AdaptiveMaxLatency,
+	}
 }
 
 func newAgentCommand() *cobra.Command {
@@ -52,6 +82,15 @@ func newAgentCommand() *cobra.Command {
 		activeOnly    bool
 		excludePaused bool
 		idleFPS       int
+
+		batchWindow    time.Duration
+		batchMaxFrames int
+		batchMaxBytes  int
+		compression    string
+		fastCatchUp    bool
+
+		adaptiveFPS        []int
+		adaptiveMaxLatency time.Duration
 	)
 
 	cmd := &cobra.Command{
@@ -74,7 +113,13 @@ Targets are specified as host:port or host:startPort-endPort for port ranges.`,
   agent stream --all-frames --fps 30 --exclude-bones 127.0.0.1:6721
 
   # Only stream Echo Arena matches during active gameplay
-  agent stream --include-modes echo_arena --active-only 127.0.0.1:6721`,
+  agent stream --include-modes echo_arena --active-only 127.0.0.1:6721
+
+  # Send zstd-compressed batches every 250ms over a high-latency link
+  agent stream --format none --events-stream --batch-window 250ms --compression zstd --fast-catchup 127.0.0.1:6721
+
+  # Record locally at full rate, but stream at 30, 15 or 5 FPS as the link degrades
+  agent stream --fps 60 --events-stream --adaptive-fps 30,15,5 127.0.0.1:6721`,
 		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			streamCfg := StreamConfig{
@@ -92,6 +137,15 @@ Targets are specified as host:port or host:startPort-endPort for port ranges.`,
 				ActiveOnly:    activeOnly,
 				ExcludePaused: excludePaused,
 				IdleFPS:       idleFPS,
+
+				BatchWindow:    batchWindow,
+				BatchMaxFrames: batchMaxFrames,
+				BatchMaxBytes:  batchMaxBytes,
+				Compression:    compression,
+				FastCatchUp:    fastCatchUp,
+
+				AdaptiveFPS:        adaptiveFPS,
+				AdaptiveMaxLatency: adaptiveMaxLatency,
 			}
 			return runAgent(cmd, args, streamCfg)
 		},
@@ -117,6 +171,15 @@ Targets are specified as host:port or host:startPort-endPort for port ranges.`,
 	cmd.Flags().BoolVar(&excludePaused, "exclude-paused", false, "Exclude paused frames (only effective with --active-only)")
 	cmd.Flags().IntVar(&idleFPS, "idle-fps", 1, "Frame rate for non-gametime frames (lobby, paused, etc.)")
 
+	// Stream delivery options
+	cmd.Flags().DurationVar(&batchWindow, "batch-window", 0, "Group frames into one message per time window (e.g., 250ms; 0 = one message per frame)")
+	cmd.Flags().IntVar(&batchMaxFrames, "batch-max-frames", 50, "Send a batch early once it holds this many frames")
+	cmd.Flags().IntVar(&batchMaxBytes, "batch-max-bytes", 1024*1024, "Send a batch early once it reaches this many bytes")
+	cmd.Flags().StringVar(&compression, "compression", "none", "Stream compression: none, deflate (permessage-deflate) or zstd (batches only)")
+	cmd.Flags().BoolVar(&fastCatchUp, "fast-catchup", false, "Send the disk backlog in large compressed batches after reconnecting")
+	cmd.Flags().IntSliceVar(&adaptiveFPS, "adaptive-fps", nil, "Streaming FPS levels to step down through when the events link falls behind (e.g., 30,15,5)")
+	cmd.Flags().DurationVar(&adaptiveMaxLatency, "adaptive-max-latency", 500*time.Millisecond, "Average send time that triggers an adaptive FPS step down")
+
 	return cmd
 }
 
@@ -168,6 +231,19 @@ func runAgent(cmd *cobra.Command, args []string, streamCfg StreamConfig) error {
 	if err := cfg.ValidateAgentConfig(); err != nil {
 		return err
 	}
+	if err := cfg.ValidateTransportConfig(); err != nil {
+		return fmt.Errorf("invalid transport configuration: %w", err)
+	}
+	if streamCfg.EventsStream {
+		batchCfg := streamCfg.batchConfig()
+		if err := batchCfg.Validate(); err != nil {
+			return fmt.Errorf("invalid stream delivery options: %w", err)
+		}
+		adaptiveCfg := streamCfg.adaptiveRateConfig()
+		if err := adaptiveCfg.Validate(); err != nil {
+			return fmt.Errorf("invalid adaptive FPS options: %w", err)
+		}
+	}
 
 	logger.Info("Starting agent",
 		zap.Int("frequency", cfg.Agent.Frequency),
@@ -181,6 +257,10 @@ func runAgent(cmd *cobra.Command, args []string, streamCfg StreamConfig) error {
 		zap.Bool("active_only", streamCfg.ActiveOnly),
 		zap.Bool("exclude_paused", streamCfg.ExcludePaused),
 		zap.Int("idle_fps", streamCfg.IdleFPS),
+		zap.Duration("batch_window", streamCfg.BatchWindow),
+		zap.String("compression", streamCfg.Compression),
+		zap.Bool("fast_catchup", streamCfg.FastCatchUp),
+		zap.Ints("adaptive_fps", streamCfg.AdaptiveFPS),
 		zap.Any("targets", targets))
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -224,6 +304,12 @@ func startAgent(ctx context.Context, logger *zap.Logger, targets map[string][]in
 		},
 	}
 
+	// Outbound connections to the events API use the shared transport settings.
+	// Configuration was validated by runAgent, so errors cannot occur here.
+	tlsConfig, _ := cfg.Transport.TLSConfig()
+	proxy, _ := cfg.Transport.Proxy()
+	wsDialer := agent.NewWebSocketDialer(tlsConfig, proxy)
+
 	sessions := make(map[string]agent.FrameWriter)
 	interval := time.Second / time.Duration(cfg.Agent.Frequency)
 	cycleTicker := time.NewTicker(100 * time.Millisecond)
@@ -292,28 +378,21 @@ OuterLoop:
 						continue
 					}
 
-					switch format {
-					case "echoreplay", "replay":
-						filename = agent.EchoReplaySessionFilename(time.Now(), meta.SessionUUID)
-						outputPath = filepath.Join(cfg.Agent.OutputDirectory, filename)
-						replayWriter := agent.NewFrameDataLogSession(ctx, logger, outputPath, meta.SessionUUID)
-						go replayWriter.ProcessFrames()
-						writers = append(writers, replayWriter)
-					case "nevrcap":
-						filename = agent.NevrCapSessionFilename(time.Now(), meta.SessionUUID)
-						outputPath = filepath.Join(cfg.Agent.OutputDirectory, filename)
-						nevrcapWriter := agent.NewNevrCapLogSession(ctx, logger, outputPath, meta.SessionUUID)
-						go nevrcapWriter.ProcessFrames()
-						writers = append(writers, nevrcapWriter)
-					case "tape":
-						fallthrough
-					default:
-						filename = agent.TapeSessionFilename(time.Now(), meta.SessionUUID)
-						outputPath = filepath.Join(cfg.Agent.OutputDirectory, filename)
-						tapeWriter := agent.NewTapeLogSession(ctx, logger, outputPath, meta.SessionUUID)
-						go tapeWriter.ProcessFrames()
-						writers = append(writers, tapeWriter)
-					}
+					var fileWriter agent.FrameWriter
+					fileWriter, outputPath = newSessionFileWriter(ctx, logger, format, cfg.Agent.OutputDirectory, meta.SessionUUID)
+					filename = filepath.Base(outputPath)
+					writers = append(writers, fileWriter)
+				}
+
+				pollerCfg := agent.PollerConfig{
+					AllFrames:     streamCfg.AllFrames,
+					FPS:           streamCfg.FPS,
+					IncludeModes:  streamCfg.IncludeModes,
+					ExcludeModes:  streamCfg.ExcludeModes,
+					ExcludeBones:  streamCfg.ExcludeBones,
+					ActiveOnly:    streamCfg.ActiveOnly,
+					ExcludePaused: streamCfg.ExcludePaused,
+					IdleFPS:       streamCfg.IdleFPS,
 				}
 
 				logger = logger.With(zap.String("session_uuid", meta.SessionUUID))
@@ -326,6 +405,27 @@ OuterLoop:
 					wsURL := streamCfg.EventsURL
 					token := resolveJWTToken(streamCfg.JWTToken, cfg.Agent.JWTToken)
 					wsWriter := agent.NewWebSocketWriter(baseLogger, wsURL, token)
+					wsWriter.SetDialer(wsDialer)
+					if err := wsWriter.SetBatching(streamCfg.batchConfig()); err != nil {
+						logger.Error("Invalid stream delivery options", zap.Error(err))
+					}
+					if err := wsWriter.SetAdaptiveRate(streamCfg.adaptiveRateConfig()); err != nil {
+						logger.Error("Invalid adaptive FPS options", zap.Error(err))
+					}
+
+					// Allow the server to adjust this session and start local recordings
+					sessionUUID := meta.SessionUUID
+					sessionLogger := logger
+					controller := agent.NewSessionController(logger, sessionUUID, pollerCfg, func(format string) (agent.FrameWriter, string, error) {
+						if err := os.MkdirAll(cfg.Agent.OutputDirectory, 0755); err != nil {
+							return nil, "", fmt.Errorf("failed to create output directory: %w", err)
+						}
+						writer, path := newSessionFileWriter(ctx, sessionLogger, format, cfg.Agent.OutputDirectory, sessionUUID)
+						return writer, path, nil
+					})
+					wsWriter.SetCommandHandler(controller)
+					pollerCfg.Controller = controller
+
 					if err := wsWriter.Connect(); err != nil {
 						logger.Error("Failed to connect WebSocket writer", zap.Error(err))
 					} else {
@@ -347,16 +447,6 @@ OuterLoop:
 				}
 
 				sessions[baseURL] = session
-				pollerCfg := agent.PollerConfig{
-					AllFrames:     streamCfg.AllFrames,
-					FPS:           streamCfg.FPS,
-					IncludeModes:  streamCfg.IncludeModes,
-					ExcludeModes:  streamCfg.ExcludeModes,
-					ExcludeBones:  streamCfg.ExcludeBones,
-					ActiveOnly:    streamCfg.ActiveOnly,
-					ExcludePaused: streamCfg.ExcludePaused,
-					IdleFPS:       streamCfg.IdleFPS,
-				}
 				go agent.NewHTTPFramePoller(session.Context(), logger, client, baseURL, interval, session, pollerCfg)
 
 				logger.Info("Added new frame client",
@@ -378,6 +468,30 @@ OuterLoop:
 	logger.Info("Closed sessions")
 }
 
+// newSessionFileWriter creates and starts a file writer for the given format,
+// returning it with the path it writes to. Unknown formats fall back to tape.
+func newSessionFileWriter(ctx context.Context, logger *zap.Logger, format, outputDir, sessionUUID string) (agent.FrameWriter, string) {
+	switch format {
+	case "echoreplay", "replay":
+		outputPath := filepath.Join(outputDir, agent.EchoReplaySessionFilename(time.Now(), sessionUUID))
+		replayWriter := agent.NewFrameDataLogSession(ctx, logger, outputPath, sessionUUID)
+		go replayWriter.ProcessFrames()
+		return replayWriter, outputPath
+	case "nevrcap":
+		outputPath := filepath.Join(outputDir, agent.NevrCapSessionFilename(time.Now(), sessionUUID))
+		nevrcapWriter := agent.NewNevrCapLogSession(ctx, logger, outputPath, sessionUUID)
+		go nevrcapWriter.ProcessFrames()
+		return nevrcapWriter, outputPath
+	case "tape":
+		fallthrough
+	default:
+		outputPath := filepath.Join(outputDir, agent.TapeSessionFilename(time.Now(), sessionUUID))
+		tapeWriter := agent.NewTapeLogSession(ctx, logger, outputPath, sessionUUID)
+		go tapeWriter.ProcessFrames()
+		return tapeWriter, outputPath
+	}
+}
+
 func parseHostPort(s string) (string, []int, error) {
 	components := strings.Split(s, ":")
 	if len(components) != 2 {
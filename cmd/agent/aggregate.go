@@ -0,0 +1,692 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	aggregateFormat    string
+	aggregateJobs      int
+	aggregateGlob      string
+	aggregateCachePath string
+	aggregateNoCache   bool
+)
+
+func newAggregateCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "aggregate <directory>",
+		Short: "Roll up match results and player stats across many recordings",
+		Long: `The aggregate command reads every recording in a directory and its
+subdirectories (.tape, .echoreplay, .nevrcap and their uncompressed
+variants), computes the result of each match and the box score of each
+player, and rolls them up across matches:
+
+  - career totals for every player, with per-match averages
+  - win, loss and draw records
+  - per-map splits, for players and for the maps themselves
+
+Players are matched across recordings by account ID, or by name for
+recordings without one. Each recording is one match; the winner is the team
+that won more rounds, a round going to the team leading when it ended.
+
+Files are processed in parallel (--jobs). The result of each file is cached
+in ` + aggregateCacheFileName + ` in the directory, so a rerun only reads
+recordings that are new or changed since the last run.`,
+		Example: `  # Season standings as a text table
+  agent aggregate recordings/season-3
+
+  # Everything as JSON for a website
+  agent aggregate recordings/season-3 --format json > season.json
+
+  # Career and per-map rows as CSV, only .tape files, on 8 workers
+  agent aggregate recordings/ --glob '*.tape' --jobs 8 --format csv`,
+		Args: cobra.ExactArgs(1),
+		RunE: runAggregate,
+	}
+
+	cmd.Flags().StringVar(&aggregateFormat, "format", "text", "Output format: text, json or csv")
+	cmd.Flags().IntVarP(&aggregateJobs, "jobs", "j", 0, "Number of files to process in parallel (0 = number of CPUs)")
+	cmd.Flags().StringVarP(&aggregateGlob, "glob", "g", "", "Glob pattern to match file names (e.g., '*.tape')")
+	cmd.Flags().StringVar(&aggregateCachePath, "cache", "", "Cache file of per-file results (default <directory>/"+aggregateCacheFileName+")")
+	cmd.Flags().BoolVar(&aggregateNoCache, "no-cache", false, "Process every file and do not read or write the cache")
+
+	return cmd
+}
+
+func runAggregate(cmd *cobra.Command, args []string) error {
+	switch {
+	case aggregateFormat != "text" && aggregateFormat != "json" && aggregateFormat != "csv":
+		return fmt.Errorf("unsupported format: %s (must be text, json or csv)", aggregateFormat)
+	case aggregateJobs < 0:
+		return fmt.Errorf("jobs must not be negative, got %d", aggregateJobs)
+	}
+	if aggregateGlob != "" {
+		if _, err := filepath.Match(aggregateGlob, ""); err != nil {
+			return fmt.Errorf("invalid glob pattern: %w", err)
+		}
+	}
+
+	dir := args[0]
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("cannot access input directory: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	files, err := findRecordings(dir, aggregateGlob)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no recordings found in %s", dir)
+	}
+
+	var cache *aggregateCache
+	if !aggregateNoCache {
+		path := aggregateCachePath
+		if path == "" {
+			path = filepath.Join(dir, aggregateCacheFileName)
+		}
+		if cache, err = loadAggregateCache(path); err != nil {
+			return err
+		}
+	}
+
+	jobs := aggregateJobs
+	if jobs == 0 {
+		jobs = runtime.NumCPU()
+	}
+	results := summarizeMatches(files, jobs, cache)
+
+	if cache != nil {
+		// Not fatal: the files are simply read again on the next run
+		if err := cache.Save(); err != nil {
+			logger.Warn("Failed to save aggregate cache", zap.Error(err))
+		}
+	}
+
+	season := aggregateSeason(dir, results)
+	return writeSeasonStats(os.Stdout, season, aggregateFormat)
+}
+
+// findRecordings lists the recordings under dir whose names match glob (all
+// recordings if glob is empty), in lexical order.
+func findRecordings(dir, glob string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !isReplayFile(path) {
+			return nil
+		}
+		if glob != "" {
+			if matched, _ := filepath.Match(glob, d.Name()); !matched {
+				return nil
+			}
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", dir, err)
+	}
+	return files, nil
+}
+
+// matchResult is the outcome of summarizing one recording.
+type matchResult struct {
+	File    string
+	Summary *MatchSummary
+	Cached  bool
+	Err     error
+}
+
+// summarizeMatches summarizes files using up to workers goroutines, taking
+// unchanged files from cache (which may be nil). Results are returned in the
+// same order as files; a failure in one file never affects the others.
+func summarizeMatches(files []string, workers int, cache *aggregateCache) []matchResult {
+	results := make([]matchResult, len(files))
+	var pending []int
+	for i, file := range files {
+		results[i].File = file
+		if cache != nil {
+			if summary := cache.Lookup(file); summary != nil {
+				results[i].Summary = summary
+				results[i].Cached = true
+				continue
+			}
+		}
+		pending = append(pending, i)
+	}
+	logger.Debug("Aggregating recordings",
+		zap.Int("files", len(files)),
+		zap.Int("cached", len(files)-len(pending)))
+
+	workers = max(1, min(workers, len(pending)))
+	jobCh := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobCh {
+				results[i].Summary, results[i].Err = summarizeMatchSafely(files[i])
+				if results[i].Err != nil {
+					logger.Warn("Failed to read recording", zap.String("file", files[i]), zap.Error(results[i].Err))
+					continue
+				}
+				if cache != nil {
+					if err := cache.Store(files[i], results[i].Summary); err != nil {
+						logger.Warn("Failed to cache result", zap.String("file", files[i]), zap.Error(err))
+					}
+				}
+			}
+		}()
+	}
+	for _, i := range pending {
+		jobCh <- i
+	}
+	close(jobCh)
+	wg.Wait()
+	return results
+}
+
+// summarizeMatchSafely recovers from panics in a malformed recording.
+func summarizeMatchSafely(filename string) (summary *MatchSummary, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while reading recording: %v", r)
+		}
+	}()
+	return summarizeMatch(filename)
+}
+
+// MatchSummary is the result of one recording: the score and the box score
+// of every player. Times are in seconds.
+type MatchSummary struct {
+	File         string         `json:"file"`
+	SessionID    string         `json:"session_id,omitempty"`
+	Map          string         `json:"map,omitempty"`
+	MatchType    string         `json:"match_type,omitempty"`
+	Start        time.Time      `json:"start"`
+	Duration     float64        `json:"duration"`
+	PlayingTime  float64        `json:"playing_time"`
+	Frames       int            `json:"frames"`
+	Rounds       int            `json:"rounds"`
+	BluePoints   int            `json:"blue_points"`
+	OrangePoints int            `json:"orange_points"`
+	BlueRounds   int            `json:"blue_rounds"`
+	OrangeRounds int            `json:"orange_rounds"`
+	Winner       string         `json:"winner,omitempty"`
+	Players      []*PlayerStats `json:"players"`
+}
+
+// result returns "win", "loss" or "draw" for a team.
+func (m *MatchSummary) result(team string) string {
+	switch m.Winner {
+	case "":
+		return "draw"
+	case team:
+		return "win"
+	}
+	return "loss"
+}
+
+// matchScore follows the score round by round. Points restart every round,
+// so the last score seen in a round is its final score.
+type matchScore struct {
+	rounds [][2]int // blue and orange points, by round - 1
+}
+
+func (s *matchScore) add(round, blue, orange int) {
+	if round < 1 {
+		return
+	}
+	for len(s.rounds) < round {
+		s.rounds = append(s.rounds, [2]int{})
+	}
+	s.rounds[round-1] = [2]int{blue, orange}
+}
+
+// finish fills in the points, rounds won and winner of a summary.
+func (s *matchScore) finish(m *MatchSummary) {
+	m.Rounds = len(s.rounds)
+	for _, r := range s.rounds {
+		m.BluePoints += r[0]
+		m.OrangePoints += r[1]
+		switch leadingTeam(r[0], r[1]) {
+		case "blue":
+			m.BlueRounds++
+		case "orange":
+			m.OrangeRounds++
+		}
+	}
+	m.Winner = leadingTeam(m.BlueRounds, m.OrangeRounds)
+}
+
+// summarizeMatch reads a recording into a match summary.
+func summarizeMatch(filename string) (*MatchSummary, error) {
+	source, err := openV1FrameSource(filename, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	summary := &MatchSummary{File: filename}
+	builder := newBoxScoreBuilder(filename)
+	var (
+		rounds      roundTracker
+		score       matchScore
+		first, last time.Time
+	)
+	for {
+		frame, err := source.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read frame: %w", err)
+		}
+
+		session := frame.GetSession()
+		status := session.GetGameStatus()
+		rounds.track(status)
+		if summary.SessionID == "" {
+			summary.SessionID = session.GetSessionId()
+		}
+		if summary.Map == "" {
+			summary.Map = session.GetMapName()
+		}
+		if summary.MatchType == "" {
+			summary.MatchType = session.GetMatchType()
+		}
+		if session != nil {
+			score.add(rounds.round, int(session.GetBluePoints()), int(session.GetOrangePoints()))
+		}
+
+		ts := frame.GetTimestamp().AsTime()
+		if frame.GetTimestamp() != nil {
+			if first.IsZero() {
+				first = ts
+			}
+			last = ts
+		}
+		builder.addFrame(ts, true, status == "playing", framePlayerSamples(frame))
+	}
+
+	box := builder.finish(nil)
+	if box.Frames == 0 {
+		return nil, errors.New("recording has no frames")
+	}
+	summary.Frames = box.Frames
+	summary.PlayingTime = box.PlayingTime
+	summary.Players = box.Players
+	summary.Start = first
+	summary.Duration = round2(last.Sub(first).Seconds())
+	score.finish(summary)
+	return summary, nil
+}
+
+// PlayerTotals are a player's results and stats summed over matches, with
+// per-match averages of the counters and times.
+type PlayerTotals struct {
+	Matches int     `json:"matches"`
+	Wins    int     `json:"wins"`
+	Losses  int     `json:"losses"`
+	Draws   int     `json:"draws"`
+	WinPct  float64 `json:"win_pct"`
+	StatLine
+	PerMatch map[string]float64 `json:"per_match"`
+
+	speedSum float64 // Average speed weighted by time played
+}
+
+// perMatchFields are the columns averaged per match, in output order.
+var perMatchFields = append(slices.Clip(boxScoreCounters), "possession_time", "time_played")
+
+func (t *PlayerTotals) add(p *PlayerStats, result string) {
+	t.Matches++
+	switch result {
+	case "win":
+		t.Wins++
+	case "loss":
+		t.Losses++
+	default:
+		t.Draws++
+	}
+	for i, c := range t.counts() {
+		*c += *p.counts()[i]
+	}
+	t.PossessionTime += p.PossessionTime
+	t.TimePlayed += p.TimePlayed
+	t.speedSum += p.AvgSpeed * p.TimePlayed
+}
+
+func (t *PlayerTotals) finish() {
+	if t.TimePlayed > 0 {
+		t.AvgSpeed = t.speedSum / t.TimePlayed
+	}
+	t.StatLine.finish()
+	if t.Matches == 0 {
+		return
+	}
+	t.WinPct = round2(float64(t.Wins) / float64(t.Matches) * 100)
+	t.PerMatch = make(map[string]float64, len(perMatchFields))
+	for i, c := range t.counts() {
+		t.PerMatch[boxScoreCounters[i]] = round2(float64(*c) / float64(t.Matches))
+	}
+	t.PerMatch["possession_time"] = round2(t.PossessionTime / float64(t.Matches))
+	t.PerMatch["time_played"] = round2(t.TimePlayed / float64(t.Matches))
+}
+
+// CareerStats are one player's totals across all matches, and split by map.
+type CareerStats struct {
+	Name      string `json:"name"`
+	AccountID string `json:"account_id,omitempty"`
+	PlayerTotals
+	Maps []*MapSplit `json:"maps"`
+
+	maps     map[string]*MapSplit
+	lastSeen time.Time // Start of the latest match, whose name is kept
+}
+
+// MapSplit is a player's totals on one map.
+type MapSplit struct {
+	Map string `json:"map"`
+	PlayerTotals
+}
+
+// MapSummary are the results of all matches on one map.
+type MapSummary struct {
+	Map         string  `json:"map"`
+	Matches     int     `json:"matches"`
+	BlueWins    int     `json:"blue_wins"`
+	OrangeWins  int     `json:"orange_wins"`
+	Draws       int     `json:"draws"`
+	AvgPoints   float64 `json:"avg_points"`   // Points scored by both teams per match
+	AvgDuration float64 `json:"avg_duration"` // Seconds per recording
+
+	totalPoints  int
+	totalSeconds float64
+}
+
+// AggregateFailure is a recording that could not be read.
+type AggregateFailure struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+// SeasonStats is the `agent aggregate` output.
+type SeasonStats struct {
+	Directory string             `json:"directory"`
+	Files     int                `json:"files"`
+	Cached    int                `json:"cached"`
+	Matches   []*MatchSummary    `json:"matches"`
+	Players   []*CareerStats     `json:"players"`
+	Maps      []*MapSummary      `json:"maps"`
+	Failed    []AggregateFailure `json:"failed,omitempty"`
+}
+
+// unknownMap names the map of recordings that do not record one.
+const unknownMap = "unknown"
+
+// aggregateSeason rolls the match summaries up into career and map totals.
+// Match files are listed relative to dir.
+func aggregateSeason(dir string, results []matchResult) *SeasonStats {
+	season := &SeasonStats{
+		Directory: dir,
+		Files:     len(results),
+		Matches:   []*MatchSummary{},
+		Players:   []*CareerStats{},
+		Maps:      []*MapSummary{},
+	}
+	players := make(map[string]*CareerStats)
+	maps := make(map[string]*MapSummary)
+
+	for _, r := range results {
+		file := r.File
+		if rel, err := filepath.Rel(dir, r.File); err == nil {
+			file = filepath.ToSlash(rel)
+		}
+		if r.Err != nil {
+			season.Failed = append(season.Failed, AggregateFailure{File: file, Error: r.Err.Error()})
+			continue
+		}
+		if r.Cached {
+			season.Cached++
+		}
+		match := r.Summary
+		match.File = file
+		season.Matches = append(season.Matches, match)
+
+		mapName := match.Map
+		if mapName == "" {
+			mapName = unknownMap
+		}
+		ms := maps[mapName]
+		if ms == nil {
+			ms = &MapSummary{Map: mapName}
+			maps[mapName] = ms
+		}
+		ms.Matches++
+		switch match.Winner {
+		case "blue":
+			ms.BlueWins++
+		case "orange":
+			ms.OrangeWins++
+		default:
+			ms.Draws++
+		}
+		ms.totalPoints += match.BluePoints + match.OrangePoints
+		ms.totalSeconds += match.Duration
+
+		for _, p := range match.Players {
+			key := careerKey(p)
+			career := players[key]
+			if career == nil {
+				career = &CareerStats{maps: make(map[string]*MapSplit)}
+				players[key] = career
+			}
+			// The most recent match has the current name
+			if career.Name == "" || !match.Start.Before(career.lastSeen) {
+				career.Name = p.Name
+				career.lastSeen = match.Start
+			}
+			if p.AccountID != "" {
+				career.AccountID = p.AccountID
+			}
+			result := match.result(p.Team)
+			career.add(p, result)
+
+			split := career.maps[mapName]
+			if split == nil {
+				split = &MapSplit{Map: mapName}
+				career.maps[mapName] = split
+			}
+			split.add(p, result)
+		}
+	}
+
+	slices.SortFunc(season.Matches, func(a, b *MatchSummary) int {
+		if c := a.Start.Compare(b.Start); c != 0 {
+			return c
+		}
+		return strings.Compare(a.File, b.File)
+	})
+
+	for _, career := range players {
+		career.finish()
+		for _, split := range career.maps {
+			split.finish()
+			career.Maps = append(career.Maps, split)
+		}
+		slices.SortFunc(career.Maps, func(a, b *MapSplit) int { return strings.Compare(a.Map, b.Map) })
+		season.Players = append(season.Players, career)
+	}
+	slices.SortFunc(season.Players, func(a, b *CareerStats) int {
+		if a.Wins != b.Wins {
+			return b.Wins - a.Wins
+		}
+		if a.Goals != b.Goals {
+			return b.Goals - a.Goals
+		}
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+
+	for _, ms := range maps {
+		ms.AvgPoints = round2(float64(ms.totalPoints) / float64(ms.Matches))
+		ms.AvgDuration = round2(ms.totalSeconds / float64(ms.Matches))
+		season.Maps = append(season.Maps, ms)
+	}
+	slices.SortFunc(season.Maps, func(a, b *MapSummary) int { return strings.Compare(a.Map, b.Map) })
+	return season
+}
+
+// careerKey identifies a player across matches, like playerSample.key.
+func careerKey(p *PlayerStats) string {
+	return playerSample{Name: p.Name, AccountID: p.AccountID}.key()
+}
+
+// writeSeasonStats writes the season as a text table, JSON or CSV.
+func writeSeasonStats(w io.Writer, season *SeasonStats, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(season)
+	case "csv":
+		return writeSeasonCSV(w, season)
+	default:
+		writeSeasonText(w, season)
+		return nil
+	}
+}
+
+var seasonRecordColumns = []string{"GP", "W", "L", "D", "W%"}
+
+var perMatchColumns = []string{"G/GP", "A/GP", "SV/GP", "STN/GP"}
+
+func recordColumns(t PlayerTotals) []string {
+	return []string{
+		strconv.Itoa(t.Matches), strconv.Itoa(t.Wins), strconv.Itoa(t.Losses), strconv.Itoa(t.Draws),
+		fmt.Sprintf("%.1f", t.WinPct),
+	}
+}
+
+func writeSeasonText(w io.Writer, season *SeasonStats) {
+	fmt.Fprintf(w, "=== Season stats for %s ===\n", season.Directory)
+	fmt.Fprintf(w, "Recordings: %d (%d matches, %d from cache, %d failed)\n", season.Files, len(season.Matches), season.Cached, len(season.Failed))
+
+	fmt.Fprintln(w, "\nMatches:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "DATE\tFILE\tMAP\tROUNDS\tBLUE\tORANGE\tWINNER\t")
+	for _, m := range season.Matches {
+		date := "-"
+		if !m.Start.IsZero() {
+			date = m.Start.UTC().Format("2006-01-02 15:04")
+		}
+		winner := m.Winner
+		if winner == "" {
+			winner = "draw"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\t%d\t%s\t\n", date, m.File, valueOr(m.Map, unknownMap), m.Rounds, m.BluePoints, m.OrangePoints, winner)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w, "\nPlayers:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "PLAYER\t%s\t%s\t%s\t\n", strings.Join(seasonRecordColumns, "\t"), strings.Join(boxScoreColumns, "\t"), strings.Join(perMatchColumns, "\t"))
+	for _, p := range season.Players {
+		perMatch := []string{
+			fmt.Sprintf("%.2f", p.PerMatch["goals"]), fmt.Sprintf("%.2f", p.PerMatch["assists"]),
+			fmt.Sprintf("%.2f", p.PerMatch["saves"]), fmt.Sprintf("%.2f", p.PerMatch["stuns"]),
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t\n", p.Name, strings.Join(recordColumns(p.PlayerTotals), "\t"),
+			strings.Join(statColumns(p.StatLine), "\t"), strings.Join(perMatch, "\t"))
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w, "\nMaps:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "MAP\tMATCHES\tBLUE WINS\tORANGE WINS\tDRAWS\tAVG POINTS\tAVG LENGTH\t")
+	for _, m := range season.Maps {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%.2f\t%s\t\n", m.Map, m.Matches, m.BlueWins, m.OrangeWins, m.Draws, m.AvgPoints, formatStatTime(m.AvgDuration))
+	}
+	tw.Flush()
+
+	if len(season.Failed) > 0 {
+		fmt.Fprintln(w, "\nFailed recordings:")
+		for _, f := range season.Failed {
+			fmt.Fprintf(w, "  %s: %s\n", f.File, f.Error)
+		}
+	}
+
+	fmt.Fprintln(w, "\nPOSS and TIME are min:sec of playing time; SPD is the average speed in m/s.")
+	fmt.Fprintln(w, "Per-map player splits are included in the JSON and CSV output.")
+}
+
+func valueOr(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+// writeSeasonCSV writes one row per player career and per player and map.
+func writeSeasonCSV(w io.Writer, season *SeasonStats) error {
+	cw := csv.NewWriter(w)
+	header := []string{
+		"scope", "map", "name", "account_id", "matches", "wins", "losses", "draws", "win_pct",
+		"goals", "assists", "saves", "stuns", "steals", "blocks", "interceptions", "passes", "shots_taken",
+		"shooting_pct", "possession_time", "time_played", "avg_speed",
+	}
+	for _, field := range perMatchFields {
+		header = append(header, field+"_per_match")
+	}
+	cw.Write(header)
+
+	row := func(scope, mapName string, p *CareerStats, t PlayerTotals) []string {
+		s := t.StatLine
+		record := []string{
+			scope, mapName, p.Name, p.AccountID,
+			strconv.Itoa(t.Matches), strconv.Itoa(t.Wins), strconv.Itoa(t.Losses), strconv.Itoa(t.Draws),
+			strconv.FormatFloat(t.WinPct, 'f', -1, 64),
+			strconv.Itoa(s.Goals), strconv.Itoa(s.Assists), strconv.Itoa(s.Saves), strconv.Itoa(s.Stuns),
+			strconv.Itoa(s.Steals), strconv.Itoa(s.Blocks), strconv.Itoa(s.Interceptions), strconv.Itoa(s.Passes),
+			strconv.Itoa(s.ShotsTaken), strconv.FormatFloat(s.ShootingPct, 'f', -1, 64),
+			strconv.FormatFloat(s.PossessionTime, 'f', -1, 64), strconv.FormatFloat(s.TimePlayed, 'f', -1, 64),
+			strconv.FormatFloat(s.AvgSpeed, 'f', -1, 64),
+		}
+		for _, field := range perMatchFields {
+			record = append(record, strconv.FormatFloat(t.PerMatch[field], 'f', -1, 64))
+		}
+		return record
+	}
+	for _, p := range season.Players {
+		cw.Write(row("career", "", p, p.PlayerTotals))
+		for _, split := range p.Maps {
+			cw.Write(row("map", split.Map, p, split.PlayerTotals))
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// aggregateCacheFileName is the name of the per-file results cache of
+// `agent aggregate`, kept in the directory being aggregated.
+const aggregateCacheFileName = ".nevr-aggregate-cache.json"
+
+// aggregateCacheEntry holds the summary of one recording and what it was
+// computed from.
+type aggregateCacheEntry struct {
+	Source       string        `json:"source"`
+	SourceSHA256 string        `json:"source_sha256"`
+	SourceSize   int64         `json:"source_size"`
+	SourceMTime  time.Time     `json:"source_mtime"`
+	AgentVersion string        `json:"agent_version"`
+	Summary      *MatchSummary `json:"summary"`
+}
+
+// aggregateCache remembers the match summary of every recording it has
+// processed, so reruns only read new or changed files. Like the conversion
+// manifest, a file whose mtime changed but whose checksum did not is still
+// current. Entries from another agent version are recomputed, since the
+// summary may have changed.
+type aggregateCache struct {
+	mu   sync.Mutex
+	path string
+
+	Version int                             `json:"version"`
+	Entries map[string]*aggregateCacheEntry `json:"entries"` // keyed by absolute source path
+}
+
+// loadAggregateCache reads the cache at path, or returns an empty one if
+// there is none yet.
+func loadAggregateCache(path string) (*aggregateCache, error) {
+	c := &aggregateCache{
+		path:    path,
+		Version: 1,
+		Entries: make(map[string]*aggregateCacheEntry),
+	}
+	if err := readStateFile(path, c); err != nil {
+		return nil, fmt.Errorf("failed to read aggregate cache %s: %w", path, err)
+	}
+	if c.Entries == nil {
+		c.Entries = make(map[string]*aggregateCacheEntry)
+	}
+	return c, nil
+}
+
+// Lookup returns the cached summary of source, or nil if it has none or the
+// file changed since.
+func (c *aggregateCache) Lookup(source string) *MatchSummary {
+	c.mu.Lock()
+	entry := c.Entries[manifestKey(source)]
+	c.mu.Unlock()
+	if entry == nil || entry.Summary == nil || entry.AgentVersion != version {
+		return nil
+	}
+
+	modTime, ok := fileUnchanged(source, entry.SourceSize, entry.SourceMTime, entry.SourceSHA256)
+	if !ok {
+		return nil
+	}
+	c.mu.Lock()
+	entry.SourceMTime = modTime
+	c.mu.Unlock()
+	return entry.Summary
+}
+
+// Store records the summary of source.
+func (c *aggregateCache) Store(source string, summary *MatchSummary) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	sum, _, err := fileSHA256(source)
+	if err != nil {
+		return err
+	}
+
+	key := manifestKey(source)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Entries[key] = &aggregateCacheEntry{
+		Source:       key,
+		SourceSHA256: sum,
+		SourceSize:   info.Size(),
+		SourceMTime:  info.ModTime(),
+		AgentVersion: version,
+		Summary:      summary,
+	}
+	return nil
+}
+
+// Save writes the cache, dropping the entries of recordings that no longer
+// exist. Entries of files outside this run, such as those a --glob left
+// out, are kept.
+func (c *aggregateCache) Save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.Entries {
+		if _, err := os.Stat(key); errors.Is(err, os.ErrNotExist) {
+			delete(c.Entries, key)
+		}
+	}
+
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode aggregate cache: %w", err)
+	}
+	if err := writeStateFile(c.path, data); err != nil {
+		return fmt.Errorf("failed to write aggregate cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMatchScore(t *testing.T) {
+	var s matchScore
+	s.add(0, 5, 5) // Before the first round, ignored
+	s.add(1, 2, 0)
+	s.add(1, 4, 2)
+	s.add(2, 0, 3)
+	s.add(3, 1, 0)
+	s.add(3, 1, 1)
+
+	m := &MatchSummary{}
+	s.finish(m)
+	if m.Rounds != 3 || m.BluePoints != 5 || m.OrangePoints != 6 {
+		t.Errorf("rounds %d, points %d-%d; want 3 rounds, 5-6", m.Rounds, m.BluePoints, m.OrangePoints)
+	}
+	if m.BlueRounds != 1 || m.OrangeRounds != 1 || m.Winner != "" {
+		t.Errorf("rounds won %d-%d, winner %q; want a 1-1 draw", m.BlueRounds, m.OrangeRounds, m.Winner)
+	}
+}
+
+func seasonPlayer(name, id, team string, goals, saves int, timePlayed, speed float64) *PlayerStats {
+	p := &PlayerStats{Name: name, AccountID: id, Team: team}
+	p.Goals, p.Saves, p.ShotsTaken = goals, saves, goals*2
+	p.TimePlayed, p.AvgSpeed = timePlayed, speed
+	return p
+}
+
+func TestAggregateSeason(t *testing.T) {
+	day := time.Date(2025, 9, 1, 20, 0, 0, 0, time.UTC)
+	results := []matchResult{
+		{File: "league/week2/b.tape", Summary: &MatchSummary{
+			Map: "mpl_arena_a", Start: day.Add(7 * 24 * time.Hour), Duration: 600, BluePoints: 3, OrangePoints: 9, Winner: "orange",
+			Players: []*PlayerStats{
+				seasonPlayer("Alpha2", "1", "orange", 3, 1, 300, 4),
+				seasonPlayer("Bravo", "2", "blue", 1, 0, 300, 2),
+			},
+		}, Cached: true},
+		{File: "league/week1/a.echoreplay", Summary: &MatchSummary{
+			Map: "mpl_arena_a", Start: day, Duration: 500, BluePoints: 10, OrangePoints: 4, Winner: "blue",
+			Players: []*PlayerStats{
+				seasonPlayer("Alpha", "1", "blue", 2, 0, 100, 2),
+				seasonPlayer("Bravo", "2", "orange", 0, 3, 200, 3),
+			},
+		}},
+		{File: "league/week1/c.nevrcap", Summary: &MatchSummary{
+			Start: day.Add(time.Hour), Duration: 300,
+			Players: []*PlayerStats{seasonPlayer("Charlie", "", "blue", 0, 0, 60, 1)},
+		}},
+		{File: "league/broken.tape", Err: errors.New("failed to read frame: bad data")},
+	}
+
+	season := aggregateSeason("league", results)
+	if season.Files != 4 || season.Cached != 1 || len(season.Matches) != 3 {
+		t.Fatalf("files %d, cached %d, matches %d", season.Files, season.Cached, len(season.Matches))
+	}
+	if season.Matches[0].File != "week1/a.echoreplay" || season.Matches[2].File != "week2/b.tape" {
+		t.Errorf("matches not in date order: %s, %s", season.Matches[0].File, season.Matches[2].File)
+	}
+	if len(season.Failed) != 1 || season.Failed[0].File != "broken.tape" {
+		t.Errorf("failed = %+v", season.Failed)
+	}
+
+	if len(season.Players) != 3 {
+		t.Fatalf("got %d players, want 3", len(season.Players))
+	}
+	alpha := season.Players[0]
+	if alpha.Name != "Alpha2" || alpha.AccountID != "1" {
+		t.Errorf("first player = %s (%s), want the latest name Alpha2", alpha.Name, alpha.AccountID)
+	}
+	if alpha.Matches != 2 || alpha.Wins != 2 || alpha.WinPct != 100 || alpha.Goals != 5 || alpha.ShootingPct != 50 {
+		t.Errorf("alpha = %+v", alpha.PlayerTotals)
+	}
+	// Speed is weighted by time played: (2*100 + 4*300) / 400
+	if alpha.TimePlayed != 400 || alpha.AvgSpeed != 3.5 || alpha.PerMatch["goals"] != 2.5 || alpha.PerMatch["time_played"] != 200 {
+		t.Errorf("alpha time %v, speed %v, per match %v", alpha.TimePlayed, alpha.AvgSpeed, alpha.PerMatch)
+	}
+
+	bravo := season.Players[1]
+	if bravo.Name != "Bravo" || bravo.Wins != 0 || bravo.Losses != 2 || bravo.Saves != 3 {
+		t.Errorf("bravo = %s %+v", bravo.Name, bravo.PlayerTotals)
+	}
+	charlie := season.Players[2]
+	if charlie.Name != "Charlie" || charlie.Draws != 1 || len(charlie.Maps) != 1 || charlie.Maps[0].Map != unknownMap {
+		t.Errorf("charlie = %s %+v, maps %+v", charlie.Name, charlie.PlayerTotals, charlie.Maps)
+	}
+
+	if len(season.Maps) != 2 {
+		t.Fatalf("maps = %+v", season.Maps)
+	}
+	arena := season.Maps[0]
+	if arena.Map != "mpl_arena_a" || arena.Matches != 2 || arena.BlueWins != 1 || arena.OrangeWins != 1 || arena.AvgPoints != 13 || arena.AvgDuration != 550 {
+		t.Errorf("arena = %+v", arena)
+	}
+}
+
+func TestAggregateCache(t *testing.T) {
+	dir := t.TempDir()
+	recording := filepath.Join(dir, "match.tape")
+	other := filepath.Join(dir, "other.tape")
+	writeTestFile(t, recording, "frames")
+	writeTestFile(t, other, "more frames")
+	cachePath := filepath.Join(dir, aggregateCacheFileName)
+
+	cache, err := loadAggregateCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cache.Lookup(recording) != nil {
+		t.Fatal("empty cache returned a summary")
+	}
+	if err := cache.Store(recording, &MatchSummary{Map: "arena", Winner: "blue"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Store(other, &MatchSummary{Map: "arena"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A rerun that skips other.tape, as with --glob, keeps its entry
+	cache, err = loadAggregateCache(cachePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary := cache.Lookup(recording); summary == nil || summary.Winner != "blue" {
+		t.Fatalf("cached summary = %+v", summary)
+	}
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+	cache, _ = loadAggregateCache(cachePath)
+	if cache.Lookup(other) == nil || len(cache.Entries) != 2 {
+		t.Errorf("entries after a partial run = %d, want both files", len(cache.Entries))
+	}
+
+	// Deleting other.tape drops it from the cache
+	os.Remove(other)
+	if err := cache.Save(); err != nil {
+		t.Fatal(err)
+	}
+	cache, _ = loadAggregateCache(cachePath)
+	if _, ok := cache.Entries[manifestKey(other)]; ok || len(cache.Entries) != 1 {
+		t.Errorf("entries after deleting other.tape = %d, want only match.tape", len(cache.Entries))
+	}
+
+	// Touching the file keeps the entry; changing it does not
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(recording, later, later)
+	if cache.Lookup(recording) == nil {
+		t.Error("touched but unchanged file missed the cache")
+	}
+	writeTestFile(t, recording, "FRAMES")
+	if cache.Lookup(recording) != nil {
+		t.Error("changed file hit the cache")
+	}
+}
+
+func TestFindRecordings(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.tape", "week1/b.echoreplay", "week1/c.tape", "notes.txt"} {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		writeTestFile(t, path, "x")
+	}
+
+	files, err := findRecordings(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		rel, _ := filepath.Rel(dir, f)
+		names = append(names, filepath.ToSlash(rel))
+	}
+	if !slices.Equal(names, []string{"a.tape", "week1/b.echoreplay", "week1/c.tape"}) {
+		t.Errorf("files = %v", names)
+	}
+
+	files, _ = findRecordings(dir, "*.tape")
+	if len(files) != 2 {
+		t.Errorf("glob matched %d files, want 2", len(files))
+	}
+}
+
+func TestWriteSeasonStats(t *testing.T) {
+	results := []matchResult{{File: "s/a.tape", Summary: &MatchSummary{
+		Map: "arena", Start: time.Date(2025, 9, 1, 20, 0, 0, 0, time.UTC), Duration: 420, BluePoints: 7, OrangePoints: 2, Rounds: 1, Winner: "blue",
+		Players: []*PlayerStats{seasonPlayer("Alpha", "1", "blue", 2, 1, 120, 3)},
+	}}}
+	season := aggregateSeason("s", results)
+
+	var text bytes.Buffer
+	if err := writeSeasonStats(&text, season, "text"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"=== Season stats for s ===",
+		"Recordings: 1 (1 matches, 0 from cache, 0 failed)",
+		"2025-09-01 20:00  a.tape  arena  1",
+		"Alpha   1   1  0  0  100.0",
+		"arena  1        1          0            0      9.00        7:00",
+	} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text output missing %q:\n%s", want, text.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := writeSeasonStats(&out, season, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("got %d csv rows, want header, career and map", len(rows))
+	}
+	header := rows[0]
+	if header[0] != "scope" || header[len(header)-1] != "time_played_per_match" {
+		t.Errorf("header = %v", header)
+	}
+	if rows[1][0] != "career" || rows[1][2] != "Alpha" || rows[2][0] != "map" || rows[2][1] != "arena" {
+		t.Errorf("rows = %v", rows[1:])
+	}
+	if goals := rows[1][slices.Index(header, "goals_per_match")]; goals != "2" {
+		t.Errorf("goals per match = %s, want 2", goals)
+	}
+}
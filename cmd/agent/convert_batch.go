@@ -0,0 +1,323 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/echotools/nevr-agent/v4/internal/config"
+	"github.com/schollz/progressbar/v3"
+	"go.uber.org/zap"
+)
+
+// convertJob is a single file scheduled for conversion.
+type convertJob struct {
+	index  int
+	input  string
+	output string
+	size   int64
+}
+
+// convertResult records the outcome of converting one file.
+type convertResult struct {
+	Input      string
+	Output     string
+	Stats      *ConversionStats
+	Skipped    bool
+	Err        error
+	Category   string // error category, set with Err
+	Validation string // round-trip result, set with --validate
+	Duration   time.Duration
+}
+
+// planConversions resolves the output path of every input file. Files that
+// cannot be converted (no output path, output collides with another input,
+// or output exists without --overwrite) get a result straight away; the rest
+// are returned as jobs. With a manifest, existing outputs are only skipped
+// if the manifest records them as complete conversions of the current input.
+func planConversions(files []string, manifest *conversionManifest) ([]convertJob, []convertResult) {
+	results := make([]convertResult, len(files))
+	var jobs []convertJob
+	outputs := make(map[string]string, len(files))
+
+	for i, inputFile := range files {
+		results[i] = convertResult{Input: inputFile}
+
+		outputFile, err := determineOutputFileForInput(inputFile)
+		if err != nil {
+			results[i].Err = fmt.Errorf("failed to determine output file: %w", err)
+			results[i].Category = categoryOutput
+			continue
+		}
+		results[i].Output = outputFile
+
+		// Two inputs with the same name in different directories would be
+		// written to the same output by concurrent workers
+		key := filepath.Clean(outputFile)
+		if other, ok := outputs[key]; ok {
+			results[i].Err = fmt.Errorf("output %s is already produced by %s", outputFile, other)
+			results[i].Category = categoryOutput
+			continue
+		}
+		outputs[key] = inputFile
+
+		if manifest != nil {
+			if !cfg.Converter.Overwrite && manifest.UpToDate(inputFile, outputFile) {
+				if cfg.Converter.Verbose {
+					logger.Info("Skipping up-to-date file", zap.String("output", outputFile))
+				}
+				results[i].Skipped = true
+				continue
+			}
+		} else if _, err := os.Stat(outputFile); err == nil && !cfg.Converter.Overwrite {
+			if cfg.Converter.Verbose {
+				logger.Info("Skipping existing file (use --overwrite to overwrite)",
+					zap.String("output", outputFile))
+			}
+			results[i].Skipped = true
+			continue
+		}
+
+		job := convertJob{index: i, input: inputFile, output: outputFile}
+		if info, err := os.Stat(inputFile); err == nil {
+			job.size = info.Size()
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, results
+}
+
+// runConversions converts files using up to workers goroutines. Results are
+// returned in the same order as files. A failure in one file never affects
+// the others. Successful conversions are recorded in manifest, which may be
+// nil.
+func runConversions(files []string, workers int, showProgress bool, manifest *conversionManifest) []convertResult {
+	jobs, results := planConversions(files, manifest)
+	if len(jobs) == 0 {
+		return results
+	}
+
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+
+	var totalBytes int64
+	for _, job := range jobs {
+		totalBytes += job.size
+	}
+
+	// The per-file frame counter is only useful when a single file is converted
+	singleFile := len(files) == 1
+	progress := newBatchProgress(consoleOutput(), len(jobs), totalBytes, showProgress && !singleFile, !singleFile)
+
+	jobCh := make(chan convertJob)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				result := convertOne(job, showProgress && singleFile, manifest)
+				results[job.index] = result
+				progress.complete(result, job.size)
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		jobCh <- job
+	}
+	close(jobCh)
+	wg.Wait()
+
+	progress.finish()
+	return results
+}
+
+// convertOne converts and optionally validates a single file. Panics are
+// recovered and reported as errors, and partial output is removed when the
+// conversion itself fails.
+func convertOne(job convertJob, showProgress bool, manifest *conversionManifest) (result convertResult) {
+	result = convertResult{Input: job.input, Output: job.output}
+	start := time.Now()
+	converted := false
+
+	defer func() {
+		if r := recover(); r != nil {
+			result.Err = fmt.Errorf("panic during conversion: %v", r)
+			result.Category = categoryPanic
+		}
+		if result.Err != nil && !converted {
+			os.Remove(job.output)
+		}
+		result.Duration = time.Since(start)
+	}()
+
+	if cfg.Converter.Verbose {
+		logger.Info("Converting file",
+			zap.String("file", job.input),
+			zap.String("output", job.output))
+	}
+
+	stats, err := convertFile(job.input, job.output, showProgress)
+	if err != nil {
+		result.Err = err
+		result.Category = classifyConversionError(err)
+		return result
+	}
+	converted = true
+	result.Stats = stats
+
+	if cfg.Converter.Validate {
+		// Round trip through the format being converted to
+		if err := validateRoundTrip(job.input, getFileFormat(job.output)); err != nil {
+			result.Err = fmt.Errorf("validation failed: %w", err)
+			result.Category = categoryValidation
+			result.Validation = validationError
+			var diff *RoundTripError
+			if errors.As(err, &diff) {
+				result.Validation = validationFailed
+			}
+			return result
+		}
+		result.Validation = validationPassed
+		logger.Info("Validation passed", zap.String("input", job.input))
+	}
+
+	if manifest != nil {
+		// Not fatal: the file is simply converted again on the next run
+		if err := manifest.Record(job.input, job.output); err != nil {
+			logger.Warn("Failed to record conversion in manifest",
+				zap.String("input", job.input),
+				zap.Error(err))
+		}
+	}
+
+	return result
+}
+
+// batchProgress reports aggregate progress across all files of a batch,
+// either as a byte-based progress bar with ETA or as one line per file.
+type batchProgress struct {
+	mu      sync.Mutex
+	out     io.Writer
+	bar     *progressbar.ProgressBar
+	printer bool
+	total   int
+	done    int
+}
+
+func newBatchProgress(out io.Writer, totalFiles int, totalBytes int64, showBar, printLines bool) *batchProgress {
+	p := &batchProgress{out: out, total: totalFiles, printer: printLines}
+	if showBar {
+		p.bar = progressbar.NewOptions64(totalBytes,
+			progressbar.OptionSetWriter(out),
+			progressbar.OptionEnableColorCodes(true),
+			progressbar.OptionShowBytes(true),
+			progressbar.OptionSetWidth(40),
+			progressbar.OptionSetDescription(p.describe()),
+			progressbar.OptionSetPredictTime(true),
+			progressbar.OptionThrottle(100*time.Millisecond),
+			progressbar.OptionSetTheme(progressbar.Theme{
+				Saucer:        "[green]=[reset]",
+				SaucerHead:    "[green]>[reset]",
+				SaucerPadding: " ",
+				BarStart:      "[",
+				BarEnd:        "]",
+			}),
+			progressbar.OptionShowElapsedTimeOnFinish(),
+		)
+	}
+	return p
+}
+
+func (p *batchProgress) describe() string {
+	return fmt.Sprintf("[cyan]Converting %d/%d files[reset]", p.done, p.total)
+}
+
+func (p *batchProgress) complete(result convertResult, size int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.done++
+	if p.bar != nil {
+		p.bar.Describe(p.describe())
+		p.bar.Add64(size)
+		return
+	}
+	if !p.printer {
+		return
+	}
+
+	if result.Err != nil {
+		fmt.Fprintf(p.out, "Failed %d/%d: %s: %v\n", p.done, p.total, filepath.Base(result.Input), result.Err)
+	} else {
+		fmt.Fprintf(p.out, "Converted %d/%d: %s (%s)\n", p.done, p.total, filepath.Base(result.Input), result.Duration.Round(time.Millisecond))
+	}
+}
+
+func (p *batchProgress) finish() {
+	if p.bar != nil {
+		p.bar.Finish()
+		fmt.Fprintln(p.out) // New line after progress bar
+	}
+}
+
+// printConversionSummary writes a table with one row per file and a totals row.
+func printConversionSummary(w io.Writer, results []convertResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tSTATUS\tFRAMES\tINPUT\tOUTPUT\tRATIO\tTIME")
+
+	var frames int
+	var inputSize, outputSize int64
+	var elapsed time.Duration
+	for _, r := range results {
+		status := "ok"
+		switch {
+		case r.Err != nil:
+			status = "failed"
+		case r.Skipped:
+			status = "skipped"
+		}
+
+		row := []any{filepath.Base(r.Input), status, "-", "-", "-", "-", "-"}
+		if r.Stats != nil {
+			row[2] = r.Stats.FrameCount
+			row[3] = config.FormatByteSize(r.Stats.InputSize)
+			row[4] = config.FormatByteSize(r.Stats.OutputSize)
+			if r.Stats.InputSize > 0 {
+				row[5] = fmt.Sprintf("%.1f%%", float64(r.Stats.OutputSize)/float64(r.Stats.InputSize)*100)
+			}
+			frames += r.Stats.FrameCount
+			inputSize += r.Stats.InputSize
+			outputSize += r.Stats.OutputSize
+		}
+		if r.Duration > 0 {
+			row[6] = r.Duration.Round(time.Millisecond)
+			elapsed += r.Duration
+		}
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", row...)
+	}
+
+	ratio := "-"
+	if inputSize > 0 {
+		ratio = fmt.Sprintf("%.1f%%", float64(outputSize)/float64(inputSize)*100)
+	}
+	fmt.Fprintf(tw, "TOTAL\t\t%d\t%s\t%s\t%s\t%s\n", frames, config.FormatByteSize(inputSize), config.FormatByteSize(outputSize), ratio, elapsed.Round(time.Millisecond))
+	tw.Flush()
+
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(w, "%s: %v\n", r.Input, r.Err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlanConversions(t *testing.T) {
+	useTestConfig(t)
+	dir := t.TempDir()
+	cfg.Converter.OutputDir = filepath.Join(dir, "out")
+	cfg.Converter.Format = "echoreplay"
+
+	files := []string{
+		filepath.Join(dir, "a", "match.echoreplay"),
+		filepath.Join(dir, "b", "match.echoreplay"),
+		filepath.Join(dir, "a", "existing.echoreplay"),
+		filepath.Join(dir, "a", "new.echoreplay"),
+	}
+	for _, f := range files {
+		writeTestFile(t, f, "data")
+	}
+	writeTestFile(t, filepath.Join(cfg.Converter.OutputDir, "existing_converted.echoreplay"), "old")
+
+	jobs, results := planConversions(files, nil)
+
+	if len(jobs) != 2 || jobs[0].input != files[0] || jobs[1].input != files[3] {
+		t.Fatalf("jobs = %+v", jobs)
+	}
+	if jobs[0].size != 4 {
+		t.Errorf("job size = %d, want 4", jobs[0].size)
+	}
+	if results[1].Err == nil || !strings.Contains(results[1].Err.Error(), files[0]) {
+		t.Errorf("expected collision error, got %v", results[1].Err)
+	}
+	if !results[2].Skipped {
+		t.Error("existing output should be skipped without --overwrite")
+	}
+
+	cfg.Converter.Overwrite = true
+	if jobs, _ := planConversions(files, nil); len(jobs) != 3 {
+		t.Errorf("with overwrite: %d jobs, want 3", len(jobs))
+	}
+}
+
+func TestRunConversions_Parallel(t *testing.T) {
+	useTestConfig(t)
+	dir := t.TempDir()
+	cfg.Converter.OutputDir = filepath.Join(dir, "out")
+	cfg.Converter.Format = "echoreplay"
+
+	var files []string
+	for i := range 20 {
+		f := filepath.Join(dir, fmt.Sprintf("rec_%02d.echoreplay", i))
+		writeTestFile(t, f, strings.Repeat("x", i+1))
+		files = append(files, f)
+	}
+
+	results := runConversions(files, 4, false, nil)
+	if len(results) != len(files) {
+		t.Fatalf("got %d results, want %d", len(results), len(files))
+	}
+	for i, r := range results {
+		if r.Input != files[i] {
+			t.Errorf("result %d is for %s, want %s", i, r.Input, files[i])
+		}
+		if r.Err != nil {
+			t.Errorf("%s: %v", r.Input, r.Err)
+			continue
+		}
+		data, err := os.ReadFile(r.Output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) != i+1 || r.Stats.OutputSize != int64(i+1) {
+			t.Errorf("%s: output size %d, stats %+v", r.Output, len(data), r.Stats)
+		}
+	}
+}
+
+func TestPrintConversionSummary(t *testing.T) {
+	results := []convertResult{
+		{Input: "/r/a.echoreplay", Stats: &ConversionStats{FrameCount: 100, InputSize: 2048, OutputSize: 1024}},
+		{Input: "/r/b.echoreplay", Skipped: true},
+		{Input: "/r/c.echoreplay", Err: errors.New("corrupt zip")},
+	}
+
+	var buf bytes.Buffer
+	printConversionSummary(&buf, results)
+	out := buf.String()
+
+	for _, want := range []string{"FILE", "a.echoreplay", "50.0%", "2.0KiB", "skipped", "failed", "TOTAL", "/r/c.echoreplay: corrupt zip"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("summary missing %q:\n%s", want, out)
+		}
+	}
+}
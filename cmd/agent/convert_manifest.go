@@ -0,0 +1,282 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// manifestFileName is the name of the incremental conversion manifest in the
+// output directory.
+const manifestFileName = ".nevr-convert-manifest.json"
+
+// manifestSaveInterval throttles manifest writes while a batch is running.
+// The manifest is always saved when the batch finishes.
+const manifestSaveInterval = 5 * time.Second
+
+// manifestEntry records a completed conversion of one source file.
+type manifestEntry struct {
+	Source           string    `json:"source"`
+	SourceSHA256     string    `json:"source_sha256"`
+	SourceSize       int64     `json:"source_size"`
+	SourceModTime    time.Time `json:"source_mtime"`
+	Output           string    `json:"output"` // relative to the manifest directory
+	OutputSHA256     string    `json:"output_sha256"`
+	OutputSize       int64     `json:"output_size"`
+	OutputModTime    time.Time `json:"output_mtime"`
+	Options          string    `json:"options"`
+	ConverterVersion string    `json:"converter_version"`
+	ConvertedAt      time.Time `json:"converted_at"`
+}
+
+// conversionManifest tracks which sources in an output directory have been
+// converted, so reruns only process new, changed or incomplete files. Entries
+// are only added after an output is complete, so an interrupted run leaves
+// its partial outputs unrecorded and they are redone.
+type conversionManifest struct {
+	mu       sync.Mutex
+	path     string
+	dir      string
+	options  string
+	lastSave time.Time
+
+	Version int                       `json:"version"`
+	Entries map[string]*manifestEntry `json:"entries"` // keyed by absolute source path
+}
+
+// loadConversionManifest reads the manifest in dir, or returns an empty one
+// if there is none yet. options fingerprints the settings that affect output
+// contents; entries made with other settings are treated as stale.
+func loadConversionManifest(dir, options string) (*conversionManifest, error) {
+	m := &conversionManifest{
+		path:    filepath.Join(dir, manifestFileName),
+		dir:     dir,
+		options: options,
+		Version: 1,
+		Entries: make(map[string]*manifestEntry),
+	}
+
+	if err := readStateFile(m.path, m); err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", m.path, err)
+	}
+	if m.Entries == nil {
+		m.Entries = make(map[string]*manifestEntry)
+	}
+	return m, nil
+}
+
+// conversionOptions fingerprints the converter settings that change output.
+func conversionOptions() string {
+	return fmt.Sprintf("format=%s exclude_bones=%t fps=%d interpolate=%t repair=%t repair_timestamps=%s",
+		cfg.Converter.Format, cfg.Converter.ExcludeBones, cfg.Converter.FPS, cfg.Converter.Interpolate,
+		cfg.Converter.Repair, cfg.Converter.RepairTimestamps)
+}
+
+func manifestKey(source string) string {
+	if abs, err := filepath.Abs(source); err == nil {
+		return abs
+	}
+	return filepath.Clean(source)
+}
+
+// UpToDate reports whether output is a complete conversion of the current
+// contents of source. Files are only hashed when their mtime changed, and a
+// file whose mtime changed but whose checksum did not is still up to date.
+func (m *conversionManifest) UpToDate(source, output string) bool {
+	m.mu.Lock()
+	entry := m.Entries[manifestKey(source)]
+	m.mu.Unlock()
+	if entry == nil || entry.Options != m.options || entry.ConverterVersion != version {
+		return false
+	}
+	if entry.Output != m.relative(output) {
+		return false
+	}
+
+	sourceTime, ok := fileUnchanged(source, entry.SourceSize, entry.SourceModTime, entry.SourceSHA256)
+	if !ok {
+		return false
+	}
+	outputTime, ok := fileUnchanged(output, entry.OutputSize, entry.OutputModTime, entry.OutputSHA256)
+	if !ok {
+		return false
+	}
+	m.mu.Lock()
+	entry.SourceModTime, entry.OutputModTime = sourceTime, outputTime
+	m.mu.Unlock()
+	return true
+}
+
+// Record adds a completed conversion and saves the manifest if the last save
+// was long enough ago.
+func (m *conversionManifest) Record(source, output string) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	sourceSum, _, err := fileSHA256(source)
+	if err != nil {
+		return err
+	}
+	outputInfo, err := os.Stat(output)
+	if err != nil {
+		return err
+	}
+	outputSum, outputSize, err := fileSHA256(output)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Entries[manifestKey(source)] = &manifestEntry{
+		Source:           manifestKey(source),
+		SourceSHA256:     sourceSum,
+		SourceSize:       info.Size(),
+		SourceModTime:    info.ModTime(),
+		Output:           m.relative(output),
+		OutputSHA256:     outputSum,
+		OutputSize:       outputSize,
+		OutputModTime:    outputInfo.ModTime(),
+		Options:          m.options,
+		ConverterVersion: version,
+		ConvertedAt:      time.Now().UTC(),
+	}
+	if time.Since(m.lastSave) >= manifestSaveInterval {
+		return m.save()
+	}
+	return nil
+}
+
+// Prune removes the outputs of recorded sources under root that no longer
+// exist, and returns the removed output paths.
+func (m *conversionManifest) Prune(root string) ([]string, error) {
+	root = manifestKey(root)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var pruned []string
+	for key, entry := range m.Entries {
+		if key != root && !strings.HasPrefix(key, root+string(filepath.Separator)) {
+			continue
+		}
+		if _, err := os.Stat(key); !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		output := filepath.Join(m.dir, entry.Output)
+		if err := os.Remove(output); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return pruned, fmt.Errorf("failed to prune %s: %w", output, err)
+		}
+		delete(m.Entries, key)
+		pruned = append(pruned, output)
+	}
+	return pruned, nil
+}
+
+// Save writes the manifest.
+func (m *conversionManifest) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.save()
+}
+
+func (m *conversionManifest) save() error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := writeStateFile(m.path, data); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	m.lastSave = time.Now()
+	return nil
+}
+
+func (m *conversionManifest) relative(output string) string {
+	if rel, err := filepath.Rel(m.dir, output); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(output)
+}
+
+// fileUnchanged reports whether path still has the recorded size and checksum.
+// The checksum is only computed when the mtime differs from modTime. It
+// returns the current mtime, to be recorded when the file is unchanged.
+func fileUnchanged(path string, size int64, modTime time.Time, sum string) (time.Time, bool) {
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != size {
+		return time.Time{}, false
+	}
+	if info.ModTime().Equal(modTime) {
+		return modTime, true
+	}
+	current, _, err := fileSHA256(path)
+	if err != nil || current != sum {
+		return time.Time{}, false
+	}
+	return info.ModTime(), true
+}
+
+// readStateFile decodes the JSON state file at path into v. A missing file
+// is not an error and leaves v as it is.
+func readStateFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeStateFile writes data to a temporary file and renames it over path,
+// so an interrupted save never leaves a truncated state file behind.
+func writeStateFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex SHA-256 checksum and size of a file.
+func fileSHA256(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(h, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// pruneOutputs removes outputs whose sources under the input directory have
+// been deleted, logging each one.
+func pruneOutputs(manifest *conversionManifest) (int, error) {
+	pruned, err := manifest.Prune(cfg.Converter.InputFile)
+	for _, output := range pruned {
+		logger.Info("Pruned output of deleted source", zap.String("output", output))
+	}
+	return len(pruned), err
+}
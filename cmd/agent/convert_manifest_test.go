@@ -0,0 +1,180 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConversionManifest_UpToDate(t *testing.T) {
+	useTestConfig(t)
+	dir := t.TempDir()
+	outDir := filepath.Join(dir, "out")
+	source := filepath.Join(dir, "in", "match.echoreplay")
+	output := filepath.Join(outDir, "match.tape")
+	writeTestFile(t, source, "source data")
+	writeTestFile(t, output, "converted data")
+
+	manifest, err := loadConversionManifest(outDir, "format=tape")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.UpToDate(source, output) {
+		t.Error("unrecorded output must not be up to date")
+	}
+	if err := manifest.Record(source, output); err != nil {
+		t.Fatal(err)
+	}
+	if err := manifest.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reload from disk as a rerun would
+	manifest, err = loadConversionManifest(outDir, "format=tape")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !manifest.UpToDate(source, output) {
+		t.Fatal("recorded output should be up to date")
+	}
+
+	// Touching the source without changing it keeps the output
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(source, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if !manifest.UpToDate(source, output) {
+		t.Error("touched but unchanged source should be up to date")
+	}
+
+	// An output with its recorded size and mtime is not hashed again
+	key := manifestKey(source)
+	recorded := manifest.Entries[key].OutputSHA256
+	manifest.Entries[key].OutputSHA256 = "not checked"
+	if !manifest.UpToDate(source, output) {
+		t.Error("output with unchanged size and mtime should be up to date without hashing")
+	}
+	// Once its mtime changes, it is hashed
+	if err := os.Chtimes(output, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.UpToDate(source, output) {
+		t.Error("touched output with a different checksum should not be up to date")
+	}
+	manifest.Entries[key].OutputSHA256 = recorded
+	if !manifest.UpToDate(source, output) {
+		t.Error("touched but unchanged output should be up to date")
+	}
+
+	// Different settings invalidate the entry
+	other, _ := loadConversionManifest(outDir, "format=nevrcap")
+	if other.UpToDate(source, output) {
+		t.Error("entry from other settings should be stale")
+	}
+
+	// A truncated output is redone
+	writeTestFile(t, output, "conv")
+	if manifest.UpToDate(source, output) {
+		t.Error("truncated output should not be up to date")
+	}
+	writeTestFile(t, output, "converted data")
+
+	// A changed source is redone
+	writeTestFile(t, source, "source data, longer")
+	if manifest.UpToDate(source, output) {
+		t.Error("changed source should not be up to date")
+	}
+}
+
+func TestConversionOptions_Repair(t *testing.T) {
+	useTestConfig(t)
+	base := conversionOptions()
+
+	cfg.Converter.Repair = true
+	repaired := conversionOptions()
+	cfg.Converter.RepairTimestamps = "clamp"
+	clamped := conversionOptions()
+	cfg.Converter.RepairTimestamps = "interpolate"
+
+	if base == repaired || repaired == clamped || conversionOptions() != repaired {
+		t.Errorf("options do not follow the repair settings: %q, %q, %q", base, repaired, clamped)
+	}
+}
+
+func TestConversionManifest_Prune(t *testing.T) {
+	useTestConfig(t)
+	dir := t.TempDir()
+	inDir := filepath.Join(dir, "in")
+	outDir := filepath.Join(dir, "out")
+
+	kept := filepath.Join(inDir, "kept.echoreplay")
+	deleted := filepath.Join(inDir, "deleted.echoreplay")
+	elsewhere := filepath.Join(dir, "other", "deleted.nevrcap")
+	for i, source := range []string{kept, deleted, elsewhere} {
+		output := filepath.Join(outDir, filepath.Base(source)+".tape")
+		writeTestFile(t, source, "data")
+		writeTestFile(t, output, string(rune('a'+i)))
+	}
+
+	manifest, err := loadConversionManifest(outDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, source := range []string{kept, deleted, elsewhere} {
+		if err := manifest.Record(source, filepath.Join(outDir, filepath.Base(source)+".tape")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Remove(deleted)
+	os.Remove(elsewhere)
+
+	pruned, err := manifest.Prune(inDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 || pruned[0] != filepath.Join(outDir, "deleted.echoreplay.tape") {
+		t.Fatalf("pruned = %v", pruned)
+	}
+	if _, err := os.Stat(pruned[0]); !os.IsNotExist(err) {
+		t.Error("pruned output still exists")
+	}
+	// Sources outside the input directory are left alone
+	if _, err := os.Stat(filepath.Join(outDir, "deleted.nevrcap.tape")); err != nil {
+		t.Error("output of a source outside the input directory was pruned")
+	}
+	if len(manifest.Entries) != 2 {
+		t.Errorf("manifest has %d entries, want 2", len(manifest.Entries))
+	}
+}
+
+func TestPlanConversions_Incremental(t *testing.T) {
+	useTestConfig(t)
+	dir := t.TempDir()
+	cfg.Converter.OutputDir = filepath.Join(dir, "out")
+	cfg.Converter.Format = "echoreplay"
+
+	done := filepath.Join(dir, "done.echoreplay")
+	partial := filepath.Join(dir, "partial.echoreplay")
+	writeTestFile(t, done, "done")
+	writeTestFile(t, partial, "partial")
+	writeTestFile(t, filepath.Join(cfg.Converter.OutputDir, "done_converted.echoreplay"), "done")
+	// Left behind by an interrupted run, never recorded
+	writeTestFile(t, filepath.Join(cfg.Converter.OutputDir, "partial_converted.echoreplay"), "par")
+
+	manifest, err := loadConversionManifest(cfg.Converter.OutputDir, conversionOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manifest.Record(done, filepath.Join(cfg.Converter.OutputDir, "done_converted.echoreplay")); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, results := planConversions([]string{done, partial}, manifest)
+	if !results[0].Skipped {
+		t.Error("recorded conversion should be skipped")
+	}
+	if len(jobs) != 1 || jobs[0].input != partial {
+		t.Errorf("jobs = %+v, want the partial output redone", jobs)
+	}
+}
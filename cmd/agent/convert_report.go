@@ -0,0 +1,248 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Exit codes of the convert command. Usage and configuration errors exit
+// with 1 like every other command.
+const (
+	exitConversionPartial = 2 // some files converted, some failed
+	exitConversionFailed  = 3 // no file could be converted
+	exitValidationFailed  = 4 // every file converted, but a round trip differed
+)
+
+// Error categories in conversion reports.
+const (
+	categoryInputNotFound = "input_not_found"
+	categoryPermission    = "permission_denied"
+	categoryCorruptInput  = "corrupt_input"
+	categoryUnsupported   = "unsupported"
+	categoryOutput        = "output_conflict"
+	categoryValidation    = "validation"
+	categoryPanic         = "panic"
+	categoryConversion    = "conversion"
+)
+
+// Validation results in conversion reports.
+const (
+	validationPassed = "passed"
+	validationFailed = "failed" // the round trip changed the data
+	validationError  = "error"  // the round trip itself could not be run
+)
+
+var errUnsupportedConversion = errors.New("unsupported conversion")
+
+// exitCodeError carries a specific process exit code up to main.
+type exitCodeError struct {
+	code int
+	err  error
+}
+
+func (e *exitCodeError) Error() string { return e.err.Error() }
+
+func (e *exitCodeError) Unwrap() error { return e.err }
+
+// classifyConversionError maps a conversion error to a report category.
+func classifyConversionError(err error) string {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return categoryInputNotFound
+	case errors.Is(err, fs.ErrPermission):
+		return categoryPermission
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, zip.ErrFormat), errors.Is(err, zip.ErrChecksum):
+		return categoryCorruptInput
+	case errors.Is(err, errUnsupportedConversion):
+		return categoryUnsupported
+	}
+	return categoryConversion
+}
+
+// ConversionReport is the machine-readable result of a convert run.
+type ConversionReport struct {
+	Files    []FileReport  `json:"files"`
+	Summary  ReportSummary `json:"summary"`
+	ExitCode int           `json:"exit_code"`
+}
+
+// FileReport describes the outcome for one input file.
+type FileReport struct {
+	Input          string          `json:"input"`
+	Output         string          `json:"output,omitempty"`
+	Status         string          `json:"status"` // ok, skipped, failed
+	InputSize      int64           `json:"input_size"`
+	OutputSize     int64           `json:"output_size"`
+	Frames         int             `json:"frames"`
+	DurationMS     int64           `json:"duration_ms"`
+	Validation     string          `json:"validation,omitempty"`
+	ValidationDiff *RoundTripError `json:"validation_diff,omitempty"`
+	Repair         *RepairReport   `json:"repair,omitempty"`
+	Error          string          `json:"error,omitempty"`
+	ErrorCategory  string          `json:"error_category,omitempty"`
+}
+
+// ReportSummary totals a conversion report.
+type ReportSummary struct {
+	Total            int    `json:"total"`
+	Converted        int    `json:"converted"`
+	Skipped          int    `json:"skipped"`
+	Failed           int    `json:"failed"`
+	ValidationFailed int    `json:"validation_failed"`
+	Pruned           int    `json:"pruned,omitempty"`
+	Frames           int    `json:"frames"`
+	InputSize        int64  `json:"input_size"`
+	OutputSize       int64  `json:"output_size"`
+	Duration         string `json:"duration"`
+}
+
+func newConversionReport(results []convertResult, elapsed time.Duration) *ConversionReport {
+	report := &ConversionReport{Files: make([]FileReport, 0, len(results))}
+	summary := &report.Summary
+	summary.Total = len(results)
+	summary.Duration = elapsed.Round(time.Millisecond).String()
+
+	for _, r := range results {
+		file := newFileReport(r)
+		if r.Stats != nil {
+			summary.Frames += r.Stats.FrameCount
+			summary.InputSize += r.Stats.InputSize
+			summary.OutputSize += r.Stats.OutputSize
+		}
+
+		switch {
+		case r.Err != nil && r.Category == categoryValidation:
+			summary.ValidationFailed++
+		case r.Err != nil:
+			summary.Failed++
+		case r.Skipped:
+			summary.Skipped++
+		default:
+			summary.Converted++
+		}
+		report.Files = append(report.Files, file)
+	}
+
+	report.ExitCode = report.exitCode()
+	return report
+}
+
+// newFileReport describes the outcome of one conversion.
+func newFileReport(r convertResult) FileReport {
+	file := FileReport{
+		Input:         r.Input,
+		Output:        r.Output,
+		Status:        "ok",
+		DurationMS:    r.Duration.Milliseconds(),
+		Validation:    r.Validation,
+		ErrorCategory: r.Category,
+	}
+	if r.Stats != nil {
+		file.InputSize = r.Stats.InputSize
+		file.OutputSize = r.Stats.OutputSize
+		file.Frames = r.Stats.FrameCount
+		if r.Stats.Repair != nil && r.Stats.Repair.Repaired() {
+			file.Repair = r.Stats.Repair
+		}
+	}
+	var diff *RoundTripError
+	if errors.As(r.Err, &diff) {
+		file.ValidationDiff = diff
+	}
+
+	switch {
+	case r.Err != nil:
+		file.Status = "failed"
+		file.Error = r.Err.Error()
+	case r.Skipped:
+		file.Status = "skipped"
+	}
+	return file
+}
+
+// exitCode is 0 unless a file failed. Conversion failures take precedence
+// over validation failures.
+func (r *ConversionReport) exitCode() int {
+	s := r.Summary
+	switch {
+	case s.Failed > 0 && s.Converted+s.ValidationFailed == 0:
+		return exitConversionFailed
+	case s.Failed > 0:
+		return exitConversionPartial
+	case s.ValidationFailed > 0:
+		return exitValidationFailed
+	}
+	return 0
+}
+
+// Err returns an error carrying the report's exit code, or nil on success.
+func (r *ConversionReport) Err() error {
+	s := r.Summary
+	var err error
+	switch r.ExitCode {
+	case 0:
+		return nil
+	case exitValidationFailed:
+		err = fmt.Errorf("validation failed for %d of %d files", s.ValidationFailed, s.Total)
+	default:
+		err = fmt.Errorf("conversion completed with %d failures", s.Failed+s.ValidationFailed)
+	}
+	return &exitCodeError{code: r.ExitCode, err: err}
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *ConversionReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(r); err != nil {
+		return fmt.Errorf("failed to encode conversion report: %w", err)
+	}
+	return nil
+}
+
+// Write saves the report as JSON to path.
+func (r *ConversionReport) Write(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := r.WriteJSON(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// emitConversionReport prints the report as JSON on stdout with --report json
+// and saves it with --report-file.
+func emitConversionReport(report *ConversionReport) error {
+	if cfg.Converter.Report == "json" {
+		if err := report.WriteJSON(os.Stdout); err != nil {
+			return err
+		}
+	}
+	if path := cfg.Converter.ReportFile; path != "" {
+		if err := report.Write(path); err != nil {
+			return fmt.Errorf("failed to write report file: %w", err)
+		}
+		logger.Info("Conversion report written", zap.String("path", path))
+	}
+	return nil
+}
+
+// consoleOutput is where the convert command prints progress: stdout, unless
+// stdout carries a JSON report.
+func consoleOutput() io.Writer {
+	if cfg.Converter.Report == "json" {
+		return os.Stderr
+	}
+	return os.Stdout
+}
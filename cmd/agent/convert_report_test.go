@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/echotools/nevr-agent/v4/internal/jsondiff"
+)
+
+func TestConversionReport_ExitCode(t *testing.T) {
+	ok := convertResult{Input: "a", Stats: &ConversionStats{FrameCount: 10}}
+	failed := convertResult{Input: "b", Err: errors.New("boom"), Category: categoryConversion}
+	invalid := convertResult{Input: "c", Stats: &ConversionStats{}, Err: errors.New("diff"), Category: categoryValidation, Validation: validationFailed}
+	skipped := convertResult{Input: "d", Skipped: true}
+
+	tests := []struct {
+		name    string
+		results []convertResult
+		want    int
+	}{
+		{"all converted", []convertResult{ok, skipped}, 0},
+		{"partial failure", []convertResult{ok, failed}, exitConversionPartial},
+		{"total failure", []convertResult{failed, failed, skipped}, exitConversionFailed},
+		{"validation failure", []convertResult{ok, invalid}, exitValidationFailed},
+		{"conversion failure wins", []convertResult{invalid, failed}, exitConversionPartial},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := newConversionReport(tt.results, 0)
+			if report.ExitCode != tt.want {
+				t.Errorf("exit code = %d, want %d (summary %+v)", report.ExitCode, tt.want, report.Summary)
+			}
+			err := report.Err()
+			var exitErr *exitCodeError
+			if tt.want == 0 {
+				if err != nil {
+					t.Errorf("Err() = %v, want nil", err)
+				}
+			} else if !errors.As(err, &exitErr) || exitErr.code != tt.want {
+				t.Errorf("Err() = %v, want exit code %d", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConversionReport_JSON(t *testing.T) {
+	diff := &RoundTripError{Via: "tape"}
+	diff.add(3, []jsondiff.Difference{{Path: "session.game_clock", Kind: jsondiff.KindValue, A: 300.0, B: 299.0}})
+	results := []convertResult{
+		{Input: "a.nevrcap", Output: "a.tape", Stats: &ConversionStats{FrameCount: 5, InputSize: 100, OutputSize: 40}, Validation: validationPassed},
+		{Input: "b.nevrcap", Output: "b.tape", Stats: &ConversionStats{FrameCount: 7}, Err: fmt.Errorf("validation failed: %w", diff), Category: categoryValidation, Validation: validationFailed},
+	}
+
+	var buf bytes.Buffer
+	if err := newConversionReport(results, 0).WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Files []struct {
+			Status         string `json:"status"`
+			Frames         int    `json:"frames"`
+			Validation     string `json:"validation"`
+			ErrorCategory  string `json:"error_category"`
+			ValidationDiff *struct {
+				FirstDifferences []struct {
+					Frame int    `json:"frame"`
+					Path  string `json:"path"`
+				} `json:"first_differences"`
+			} `json:"validation_diff"`
+		} `json:"files"`
+		Summary  ReportSummary `json:"summary"`
+		ExitCode int           `json:"exit_code"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid report JSON: %v\n%s", err, buf.String())
+	}
+	if decoded.ExitCode != exitValidationFailed || decoded.Summary.Frames != 12 || decoded.Summary.InputSize != 100 {
+		t.Errorf("exit code %d, summary %+v", decoded.ExitCode, decoded.Summary)
+	}
+	b := decoded.Files[1]
+	if b.Status != "failed" || b.Validation != validationFailed || b.ErrorCategory != categoryValidation {
+		t.Errorf("file b = %+v", b)
+	}
+	if b.ValidationDiff == nil || len(b.ValidationDiff.FirstDifferences) != 1 || b.ValidationDiff.FirstDifferences[0].Path != "session.game_clock" {
+		t.Errorf("validation diff = %s", buf.String())
+	}
+}
+
+func TestClassifyConversionError(t *testing.T) {
+	_, notFound := os.Open("/nonexistent/file.echoreplay")
+	tests := map[error]string{
+		fmt.Errorf("failed to open: %w", notFound):                  categoryInputNotFound,
+		fmt.Errorf("failed to read frame: %w", io.ErrUnexpectedEOF): categoryCorruptInput,
+		fmt.Errorf("%w from tape to csv", errUnsupportedConversion): categoryUnsupported,
+		errors.New("something else"):                                categoryConversion,
+	}
+	for err, want := range tests {
+		if got := classifyConversionError(err); got != want {
+			t.Errorf("classifyConversionError(%v) = %q, want %q", err, got, want)
+		}
+	}
+}
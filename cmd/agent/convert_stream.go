@@ -0,0 +1,196 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// stdioPath is the --input/--output value that selects stdin or stdout.
+const stdioPath = "-"
+
+// isStreamConversion reports whether the converter reads stdin or writes stdout.
+func isStreamConversion() bool {
+	return cfg.Converter.InputFile == stdioPath || cfg.Converter.OutputFile == stdioPath
+}
+
+// validateStreamConversion rejects flags that need real input or output files.
+func validateStreamConversion() error {
+	switch {
+	case cfg.Converter.Recursive || cfg.Converter.Glob != "":
+		return fmt.Errorf("--recursive and --glob cannot be used with stdin or stdout")
+	case cfg.Converter.Validate:
+		return fmt.Errorf("--validate cannot be used with stdin or stdout")
+	case cfg.Converter.FPS > 0:
+		return fmt.Errorf("--fps cannot be used with stdin or stdout")
+	case cfg.Converter.Incremental:
+		return fmt.Errorf("--incremental cannot be used with stdin or stdout")
+	case cfg.Converter.Repair:
+		return fmt.Errorf("--repair cannot be used with stdin or stdout")
+	case cfg.Converter.InputFile == stdioPath && cfg.Converter.OutputFile == "":
+		return fmt.Errorf("reading from stdin requires --output (a file or - for stdout)")
+	}
+	return nil
+}
+
+// convertStream converts between stdin/stdout and files through the v1 frame
+// pipeline. Either side may be a stream; formats come from --input-format and
+// --format, falling back to the file extension for the side that is a file.
+// .tape frames are written to .tape output as stored.
+func convertStream(stdin io.Reader, stdout io.Writer) (*ConversionStats, error) {
+	inputFile, outputFile := cfg.Converter.InputFile, cfg.Converter.OutputFile
+
+	inputFormat := cfg.Converter.InputFormat
+	if inputFormat == "" || inputFormat == "auto" {
+		inputFormat = detectInputFormat(inputFile)
+	}
+
+	outputFormat := cfg.Converter.Format
+	if outputFormat == "" || outputFormat == "auto" {
+		outputFormat = getFileFormat(outputFile)
+	}
+
+	if outputFile != stdioPath && !cfg.Converter.Overwrite {
+		if _, err := os.Stat(outputFile); err == nil {
+			return nil, fmt.Errorf("output file already exists: %s (use --overwrite to replace)", outputFile)
+		}
+	}
+
+	var lossReport *LossReport
+	if inputFormat == "tape" && outputFormat != "tape" {
+		lossReport = newLossReport(inputFile, outputFile)
+	}
+
+	var source *eventFrameSource
+	var err error
+	if inputFile == stdioPath {
+		source, err = openEventStreamSource(stdin, inputFormat, lossReport)
+	} else {
+		source, err = openEventFrameSource(inputFile, lossReport)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	var sink *v1FrameSink
+	if outputFile == stdioPath {
+		sink, err = newV1StreamSink(stdout, outputFormat, source.Header())
+	} else {
+		sink, err = newV1FrameSink(outputFile, outputFormat, source.Header())
+	}
+	if err != nil {
+		return nil, err
+	}
+	sink.UseTapeHeader(source.TapeHeader())
+
+	stats := &ConversionStats{}
+	if inputFile != stdioPath {
+		if info, err := os.Stat(inputFile); err == nil {
+			stats.InputSize = info.Size()
+		}
+	}
+
+	for {
+		read, err := source.ReadFrame()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			sink.Abort()
+			return nil, fmt.Errorf("failed to read frame: %w", err)
+		}
+		if cfg.Converter.ExcludeBones {
+			read.Frame.PlayerBones = nil
+		}
+		if err := sink.WriteEventFrame(read); err != nil {
+			sink.Abort()
+			return nil, err
+		}
+	}
+
+	if sink.Frames() == 0 {
+		return nil, fmt.Errorf("input contains no frames")
+	}
+	if err := sink.Close(); err != nil {
+		return nil, err
+	}
+	stats.FrameCount = sink.Frames()
+
+	if outputFile != stdioPath {
+		if info, err := os.Stat(outputFile); err == nil {
+			stats.OutputSize = info.Size()
+		}
+	}
+
+	if lossReport != nil {
+		if outputFile == stdioPath {
+			logLossReport(lossReport)
+		} else {
+			saveLossReport(lossReport, outputFile)
+		}
+	}
+
+	logger.Debug("Stream conversion finished",
+		zap.String("from", inputFormat),
+		zap.String("to", outputFormat),
+		zap.Int("frames", stats.FrameCount))
+
+	return stats, nil
+}
+
+// runStreamConversion runs a single stdin/stdout conversion. Logging moves to
+// stderr when stdout carries the output.
+func runStreamConversion() error {
+	if err := validateStreamConversion(); err != nil {
+		return err
+	}
+
+	if cfg.Converter.OutputFile == stdioPath || cfg.Converter.Report == "json" {
+		if err := logToStderr(); err != nil {
+			return err
+		}
+	}
+
+	result := convertResult{Input: cfg.Converter.InputFile, Output: cfg.Converter.OutputFile}
+	start := time.Now()
+	result.Stats, result.Err = convertStream(os.Stdin, os.Stdout)
+	result.Duration = time.Since(start)
+
+	if result.Err != nil {
+		result.Category = classifyConversionError(result.Err)
+		logger.Error("Conversion failed",
+			zap.String("input", result.Input),
+			zap.String("category", result.Category),
+			zap.Error(result.Err))
+	} else {
+		logger.Info("Conversion completed",
+			zap.String("input", result.Input),
+			zap.String("output", result.Output),
+			zap.Int("frames", result.Stats.FrameCount))
+	}
+
+	report := newConversionReport([]convertResult{result}, result.Duration)
+	if err := emitConversionReport(report); err != nil {
+		return err
+	}
+	return report.Err()
+}
+
+// logToStderr rebuilds the logger so that stdout only carries command output.
+func logToStderr() error {
+	if cfg.LogToStderr {
+		return nil
+	}
+	cfg.LogToStderr = true
+	stderrLogger, err := cfg.NewLogger()
+	if err != nil {
+		return fmt.Errorf("failed to create logger: %w", err)
+	}
+	logger = stderrLogger
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	capturepb "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v2"
+	"github.com/echotools/nevr-agent/v4/internal/agent"
+	"github.com/echotools/tape/pkg/codec"
+	"github.com/echotools/tape/pkg/conversion"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestValidateStreamConversion(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func()
+		wantErr bool
+	}{
+		{"stdin to stdout", func() {}, false},
+		{"recursive", func() { cfg.Converter.Recursive = true }, true},
+		{"validate", func() { cfg.Converter.Validate = true }, true},
+		{"fps", func() { cfg.Converter.FPS = 30 }, true},
+		{"stdin without output", func() { cfg.Converter.OutputFile = "" }, true},
+		{"file to stdout", func() { cfg.Converter.InputFile = "game.nevrcap" }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useTestConfig(t)
+			cfg.Converter.InputFile, cfg.Converter.OutputFile = "-", "-"
+			tt.setup()
+			if err := validateStreamConversion(); (err != nil) != tt.wantErr {
+				t.Errorf("validateStreamConversion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConvertStream_NevrcapStdinToStdout(t *testing.T) {
+	useTestConfig(t)
+	cfg.Converter.InputFile, cfg.Converter.InputFormat = "-", "nevrcap"
+	cfg.Converter.OutputFile, cfg.Converter.Format = "-", "nevrcap"
+	cfg.Converter.ExcludeBones = true
+
+	var in bytes.Buffer
+	writer, err := agent.NewLegacyStreamWriter(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteHeader(&telemetry.TelemetryHeader{Metadata: map[string]string{"source": "test"}}); err != nil {
+		t.Fatal(err)
+	}
+	for _, frame := range testV1Frames(5) {
+		if err := writer.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	stats, err := convertStream(&in, &out)
+	if err != nil {
+		t.Fatalf("convertStream() error = %v", err)
+	}
+	if stats.FrameCount != 5 {
+		t.Errorf("converted %d frames, want 5", stats.FrameCount)
+	}
+
+	reader, err := agent.NewLegacyStreamReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	header, err := reader.ReadHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.GetMetadata()["source"] != "test" {
+		t.Errorf("header metadata = %v, want it carried over", header.GetMetadata())
+	}
+	for i := 0; ; i++ {
+		frame, err := reader.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			if i != 5 {
+				t.Errorf("read %d frames, want 5", i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.GetPlayerBones() != nil {
+			t.Errorf("frame %d kept bone data with --exclude-bones", i)
+		}
+	}
+}
+
+func TestConvertStream_TapeStdinToStdoutKeepsFrames(t *testing.T) {
+	useTestConfig(t)
+	cfg.Converter.InputFile, cfg.Converter.InputFormat = "-", "tape"
+	cfg.Converter.OutputFile, cfg.Converter.Format = "-", "tape"
+	dir := t.TempDir()
+
+	// A player and an event without a v1 form
+	frames := testV1Frames(5)
+	header := conversion.MapHeaderFromSession(&telemetry.TelemetryHeader{CreatedAt: frames[0].GetTimestamp()}, frames[0].GetSession())
+	header.GetEchoArena().ClientName = "recorder"
+	input := filepath.Join(dir, "in.tape")
+	writer, err := codec.NewWriter(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteHeader(header); err != nil {
+		t.Fatal(err)
+	}
+	mapper := conversion.FrameMapper{BaseTime: frames[0].GetTimestamp().AsTime()}
+	var natives []*capturepb.CaptureFrame
+	for _, frame := range frames {
+		native := mapper.MapFrame(frame)
+		arena := native.GetEchoArena()
+		arena.Players = append(arena.Players, &capturepb.PlayerState{Slot: 9, DisplayName: "observer"})
+		arena.Events = []*capturepb.EchoEvent{{Event: &capturepb.EchoEvent_GenericEvent{GenericEvent: &capturepb.GenericEvent{Name: "custom"}}}}
+		natives = append(natives, native)
+		if err := writer.WriteFrame(native); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	in, err := os.ReadFile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if _, err := convertStream(bytes.NewReader(in), &out); err != nil {
+		t.Fatalf("convertStream() error = %v", err)
+	}
+	output := filepath.Join(dir, "out.tape")
+	if err := os.WriteFile(output, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := codec.NewReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	gotHeader, err := reader.ReadHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := gotHeader.GetEchoArena().GetClientName(); got != "recorder" {
+		t.Errorf("header client name = %q, want recorder", got)
+	}
+	for i, want := range natives {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !proto.Equal(frame, want) {
+			t.Errorf("frame %d = %v, want %v", i, frame, want)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+// watchedFile is a replay file seen in the watched directory.
+type watchedFile struct {
+	size        int64
+	modTime     time.Time
+	stableSince time.Time // first poll at which size and mtime were as above
+	handled     bool      // converted, skipped or failed since it last changed
+}
+
+// folderWatcher polls a directory for replay files that have stopped growing.
+// Polling works on every filesystem, including network mounts where inotify
+// events are not delivered.
+type folderWatcher struct {
+	dir     string
+	settle  time.Duration
+	exclude []string // absolute directories that are never scanned
+	now     func() time.Time
+	files   map[string]*watchedFile
+}
+
+func newFolderWatcher(dir string, settle time.Duration, exclude ...string) *folderWatcher {
+	w := &folderWatcher{
+		dir:    dir,
+		settle: settle,
+		now:    time.Now,
+		files:  make(map[string]*watchedFile),
+	}
+	for _, path := range exclude {
+		if path != "" {
+			w.exclude = append(w.exclude, manifestKey(path))
+		}
+	}
+	return w
+}
+
+// poll scans the directory and returns the files that are ready to convert:
+// unchanged in size and mtime for at least the settle time, and not handled
+// since they last changed. A file is never ready on the poll that first sees
+// it, so a file still being written has at least one poll interval to grow.
+func (w *folderWatcher) poll() ([]string, error) {
+	paths, err := findReplayFiles(w.dir, w.excluded)
+	if err != nil {
+		return nil, err
+	}
+
+	now := w.now()
+	seen := make(map[string]bool, len(paths))
+	var ready []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue // removed since the walk
+		}
+		seen[path] = true
+
+		f := w.files[path]
+		if f == nil || f.size != info.Size() || !f.modTime.Equal(info.ModTime()) {
+			w.files[path] = &watchedFile{size: info.Size(), modTime: info.ModTime(), stableSince: now}
+			continue
+		}
+		if !f.handled && now.Sub(f.stableSince) >= w.settle {
+			ready = append(ready, path)
+		}
+	}
+
+	// Forget files that were moved away or deleted
+	for path := range w.files {
+		if !seen[path] {
+			delete(w.files, path)
+		}
+	}
+
+	slices.Sort(ready)
+	return ready, nil
+}
+
+// markHandled stops a file from being returned again until it changes.
+func (w *folderWatcher) markHandled(path string) {
+	if f := w.files[path]; f != nil {
+		f.handled = true
+	}
+}
+
+func (w *folderWatcher) excluded(dir string) bool {
+	return slices.Contains(w.exclude, manifestKey(dir))
+}
+
+// runWatch converts replay files as they appear in the watched directory
+// until the process is interrupted. A batch in progress is finished first.
+func runWatch(cmd *cobra.Command) error {
+	// A JSON report on stdout needs stdout to itself
+	if cfg.Converter.Report == "json" {
+		if err := logToStderr(); err != nil {
+			return err
+		}
+	}
+	cmd.SilenceUsage = true
+
+	if err := os.MkdirAll(cfg.Converter.OutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	if cfg.Converter.AfterConvert == "move" {
+		if err := os.MkdirAll(cfg.Converter.ProcessedDir, 0755); err != nil {
+			return fmt.Errorf("failed to create processed directory: %w", err)
+		}
+	}
+
+	var manifest *conversionManifest
+	if cfg.Converter.Incremental {
+		var err error
+		manifest, err = loadConversionManifest(cfg.Converter.OutputDir, conversionOptions())
+		if err != nil {
+			return err
+		}
+	}
+
+	jobs := cfg.Converter.Jobs
+	if jobs == 0 {
+		jobs = runtime.NumCPU()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	watcher := newFolderWatcher(cfg.Converter.Watch, cfg.Converter.Settle,
+		cfg.Converter.OutputDir, cfg.Converter.ProcessedDir)
+
+	logger.Info("Watching for replay files",
+		zap.String("dir", cfg.Converter.Watch),
+		zap.String("output_dir", cfg.Converter.OutputDir),
+		zap.String("after_convert", cfg.Converter.AfterConvert),
+		zap.Duration("poll_interval", cfg.Converter.PollInterval),
+		zap.Duration("settle", cfg.Converter.Settle))
+
+	ticker := time.NewTicker(cfg.Converter.PollInterval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	var results []convertResult
+	for {
+		ready, err := watcher.poll()
+		if err != nil {
+			logger.Warn("Failed to scan watched directory", zap.Error(err))
+		} else if len(ready) > 0 {
+			results = append(results, convertWatchBatch(watcher, ready, jobs, manifest)...)
+
+			// The report file always covers everything since the watch started
+			if path := cfg.Converter.ReportFile; path != "" {
+				if err := newConversionReport(results, time.Since(start)).Write(path); err != nil {
+					logger.Error("Failed to write report file", zap.Error(err))
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			report := newConversionReport(results, time.Since(start))
+			logger.Info("Stopped watching",
+				zap.Int("successful", report.Summary.Converted),
+				zap.Int("failed", report.Summary.Failed),
+				zap.Int("validation_failed", report.Summary.ValidationFailed),
+				zap.Int("skipped", report.Summary.Skipped))
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// convertWatchBatch converts the ready files, reports each outcome and then
+// moves or deletes the sources that converted successfully. Failed sources
+// are left in place and retried once they change.
+func convertWatchBatch(watcher *folderWatcher, files []string, jobs int, manifest *conversionManifest) []convertResult {
+	results := runConversions(files, jobs, false, manifest)
+	if manifest != nil {
+		if err := manifest.Save(); err != nil {
+			logger.Error("Failed to save manifest", zap.Error(err))
+		}
+	}
+
+	for _, r := range results {
+		watcher.markHandled(r.Input)
+
+		switch {
+		case r.Err != nil:
+			logger.Error("Conversion failed",
+				zap.String("input", r.Input),
+				zap.String("category", r.Category),
+				zap.Error(r.Err))
+		case r.Skipped:
+			logger.Info("Skipping file with existing output (use --overwrite to overwrite)",
+				zap.String("input", r.Input),
+				zap.String("output", r.Output))
+		default:
+			fields := []zap.Field{zap.String("input", r.Input), zap.String("output", r.Output)}
+			if r.Stats != nil {
+				fields = append(fields, zap.Int("frames", r.Stats.FrameCount))
+			}
+			logger.Info("Conversion completed", fields...)
+
+			if err := finishSource(r.Input); err != nil {
+				logger.Error("Failed to clean up converted source",
+					zap.String("input", r.Input),
+					zap.String("after_convert", cfg.Converter.AfterConvert),
+					zap.Error(err))
+			}
+		}
+
+		// One JSON object per line, so the stream can be consumed while the
+		// watch is running
+		if cfg.Converter.Report == "json" {
+			if err := json.NewEncoder(os.Stdout).Encode(newFileReport(r)); err != nil {
+				logger.Error("Failed to write report", zap.Error(err))
+			}
+		}
+	}
+	return results
+}
+
+// finishSource applies the after-convert action to a converted source.
+func finishSource(path string) error {
+	switch cfg.Converter.AfterConvert {
+	case "delete":
+		return os.Remove(path)
+	case "move":
+		dest, err := processedPath(path)
+		if err != nil {
+			return err
+		}
+		if err := moveFile(path, dest); err != nil {
+			return err
+		}
+		if cfg.Converter.Verbose {
+			logger.Info("Moved converted source", zap.String("input", path), zap.String("dest", dest))
+		}
+	}
+	return nil
+}
+
+// processedPath returns where a converted source is moved to. Subdirectories
+// of the watched directory are kept, and a numeric suffix is added rather
+// than replacing an earlier file of the same name.
+func processedPath(path string) (string, error) {
+	rel, err := filepath.Rel(cfg.Converter.Watch, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(path)
+	}
+	dest := filepath.Join(cfg.Converter.ProcessedDir, rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", fmt.Errorf("failed to create processed directory: %w", err)
+	}
+
+	ext := filepath.Ext(dest)
+	stem := strings.TrimSuffix(dest, ext)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(dest); errors.Is(err, os.ErrNotExist) {
+			return dest, nil
+		}
+		dest = stem + "_" + strconv.Itoa(i) + ext
+	}
+}
+
+// moveFile renames src to dst, copying across filesystems when a rename is
+// not possible.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Remove(src)
+}
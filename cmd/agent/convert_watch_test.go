@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFolderWatcher_WaitsForFilesToSettle(t *testing.T) {
+	useTestConfig(t)
+	dir := t.TempDir()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	w := newFolderWatcher(dir, 5*time.Second)
+	w.now = func() time.Time { return now }
+
+	path := filepath.Join(dir, "game.echoreplay")
+	writeTestFile(t, path, "partial")
+	writeTestFile(t, filepath.Join(dir, "notes.txt"), "ignored")
+
+	poll := func() []string {
+		t.Helper()
+		ready, err := w.poll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ready
+	}
+
+	if ready := poll(); len(ready) != 0 {
+		t.Fatalf("first poll returned %v, want nothing until the file settles", ready)
+	}
+
+	// Still growing
+	now = now.Add(3 * time.Second)
+	writeTestFile(t, path, "partial plus more")
+	if ready := poll(); len(ready) != 0 {
+		t.Fatalf("poll of a growing file returned %v", ready)
+	}
+
+	now = now.Add(3 * time.Second)
+	if ready := poll(); len(ready) != 0 {
+		t.Fatalf("poll before settle time returned %v", ready)
+	}
+
+	now = now.Add(3 * time.Second)
+	if ready := poll(); !slices.Equal(ready, []string{path}) {
+		t.Fatalf("poll after settle time = %v, want [%s]", ready, path)
+	}
+
+	w.markHandled(path)
+	now = now.Add(10 * time.Second)
+	if ready := poll(); len(ready) != 0 {
+		t.Fatalf("handled file returned again: %v", ready)
+	}
+
+	// A handled file that changes is picked up again once it settles
+	writeTestFile(t, path, "rewritten after a failed conversion")
+	poll()
+	now = now.Add(5 * time.Second)
+	if ready := poll(); !slices.Equal(ready, []string{path}) {
+		t.Fatalf("poll of a changed file = %v, want [%s]", ready, path)
+	}
+
+	os.Remove(path)
+	poll()
+	if len(w.files) != 0 {
+		t.Errorf("watcher still tracks %d deleted files", len(w.files))
+	}
+}
+
+func TestFolderWatcher_SkipsExcludedDirectories(t *testing.T) {
+	useTestConfig(t)
+	cfg.Converter.Recursive = true
+	dir := t.TempDir()
+	processed := filepath.Join(dir, "processed")
+
+	writeTestFile(t, filepath.Join(dir, "sub", "a.nevrcap"), "a")
+	writeTestFile(t, filepath.Join(processed, "b.nevrcap"), "b")
+
+	w := newFolderWatcher(dir, 0, processed)
+	w.poll()
+	ready, err := w.poll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "sub", "a.nevrcap")}
+	if !slices.Equal(ready, want) {
+		t.Errorf("poll() = %v, want %v", ready, want)
+	}
+}
+
+func TestFinishSource_MoveKeepsExistingFiles(t *testing.T) {
+	useTestConfig(t)
+	dir := t.TempDir()
+	cfg.Converter.Watch = dir
+	cfg.Converter.ProcessedDir = filepath.Join(dir, "processed")
+	cfg.Converter.AfterConvert = "move"
+
+	writeTestFile(t, filepath.Join(cfg.Converter.ProcessedDir, "game.nevrcap"), "earlier")
+	source := filepath.Join(dir, "game.nevrcap")
+	writeTestFile(t, source, "new")
+
+	if err := finishSource(source); err != nil {
+		t.Fatalf("finishSource() error = %v", err)
+	}
+	if _, err := os.Stat(source); !os.IsNotExist(err) {
+		t.Errorf("source still exists after move")
+	}
+	data, err := os.ReadFile(filepath.Join(cfg.Converter.ProcessedDir, "game_1.nevrcap"))
+	if err != nil || string(data) != "new" {
+		t.Errorf("moved file = %q, %v, want it next to the earlier one", data, err)
+	}
+	data, _ = os.ReadFile(filepath.Join(cfg.Converter.ProcessedDir, "game.nevrcap"))
+	if string(data) != "earlier" {
+		t.Errorf("earlier processed file was replaced: %q", data)
+	}
+}
+
+func TestFinishSource_Delete(t *testing.T) {
+	useTestConfig(t)
+	cfg.Converter.AfterConvert = "delete"
+	source := filepath.Join(t.TempDir(), "game.tape")
+	writeTestFile(t, source, "data")
+
+	if err := finishSource(source); err != nil {
+		t.Fatalf("finishSource() error = %v", err)
+	}
+	if _, err := os.Stat(source); !os.IsNotExist(err) {
+		t.Errorf("source still exists after delete")
+	}
+}
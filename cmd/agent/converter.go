@@ -1,16 +1,12 @@
 package main
 
 import (
-	"archive/zip"
-	"bufio"
-	"bytes"
-	"crypto/sha256"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 
@@ -24,6 +20,7 @@ import (
 
 var (
 	convInputFile    string
+	convInputFormat  string
 	convOutputFile   string
 	convOutputDir    string
 	convFormat       string
@@ -34,15 +31,39 @@ var (
 	convRecursive    bool
 	convGlob         string
 	convValidate     bool
+	convTolerance    float64
+	convFieldTols    []string
+	convReport       string
+	convReportFile   string
+	convIncremental  bool
+	convPrune        bool
+	convJobs         int
+	convFPS          int
+	convInterpolate  bool
+	convWatch        string
+	convPollInterval time.Duration
+	convSettle       time.Duration
+	convAfter        string
+	convProcessedDir string
+	convRepair       bool
+	convRepairTimes  string
 )
 
 func newConverterCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "convert",
-		Short: "Convert replay files to .tape format",
+		Short: "Convert replay files between .tape, .echoreplay and .nevrcap formats",
 		Long: `The convert command converts replay files to the .tape v2 format.
-Supports .echoreplay (zip) and .nevrcap (zstd) as input formats.
-Auto mode converts to .tape by default.`,
+Supports .echoreplay (zip) and .nevrcap (zstd) as input formats, and their
+.echoreplay.uncompressed and .nevrcap.uncompressed variants. Input formats are
+detected from file contents, so renamed or extensionless files convert too.
+Auto mode converts to .tape by default.
+
+.tape files can be converted back to .echoreplay (the auto default) or .nevrcap.
+Capture v2 fields without a v1 equivalent are listed in a <output>.loss.json report.
+
+Exit codes: 0 success, 1 usage or configuration error, 2 some files failed,
+3 every file failed, 4 all files converted but round-trip validation failed.`,
 		Example: `  # Convert echoreplay to tape (default)
   agent convert --input game.echoreplay
 
@@ -70,14 +91,53 @@ Auto mode converts to .tape by default.`,
   # Combine recursive and glob
   agent convert --input ./recordings --recursive --glob "rec_*.echoreplay"
 
+  # Convert a directory using 8 parallel workers with a combined progress bar
+  agent convert --input ./recordings --recursive --jobs 8 --progress
+
+  # Convert a tape recording back to echoreplay
+  agent convert --input game.tape
+
+  # Convert a tape recording to nevrcap
+  agent convert --input game.tape --format nevrcap
+
+  # Downsample a 60 Hz recording to 15 FPS for archiving
+  agent convert --input game.echoreplay --format tape --fps 15
+
+  # Upsample a low-rate recording to 60 FPS with interpolated frames
+  agent convert --input game.echoreplay --format nevrcap --fps 60 --interpolate
+
+  # Pipe a recording from another host and store it as tape
+  ssh host cat game.nevrcap | agent convert --input - --input-format nevrcap --output game.tape
+
+  # Write echoreplay to stdout for another tool
+  agent convert --input game.tape --output - --format echoreplay > game.echoreplay
+
+  # Re-run over an archive, converting only new or changed recordings and
+  # removing outputs of deleted ones
+  agent convert --input ./recordings --recursive --output-dir ./tape --incremental --prune
+
+  # Convert an archive in CI and keep a machine-readable report
+  agent convert --input ./recordings --recursive --report json > report.json
+
+  # Convert recordings dropped into a folder, moving each source to
+  # ./incoming/processed once it has converted
+  agent convert --watch ./incoming --output-dir ./tape --after move
+
+  # Salvage an old recording with truncated lines and bad timestamps
+  agent convert --input old.echoreplay --repair
+
   # Validate data integrity via round-trip conversion
-  agent convert --input game.echoreplay --validate`,
+  agent convert --input game.echoreplay --validate
+
+  # Validate a nevrcap -> tape -> nevrcap round trip, allowing small position drift
+  agent convert --input game.nevrcap --validate --field-tolerance position=1e-4`,
 		RunE: runConverter,
 	}
 
 	// Converter-specific flags
-	cmd.Flags().StringVarP(&convInputFile, "input", "i", "", "Input file path (.echoreplay or .nevrcap) (required)")
-	cmd.Flags().StringVarP(&convOutputFile, "output", "o", "", "Output file path (optional, format detected from extension)")
+	cmd.Flags().StringVarP(&convInputFile, "input", "i", "", "Input file or directory (.echoreplay, .nevrcap, .tape or an .uncompressed variant), or - for stdin (required unless --watch)")
+	cmd.Flags().StringVar(&convInputFormat, "input-format", "auto", "Input format: auto, tape, echoreplay, nevrcap (required with --input -)")
+	cmd.Flags().StringVarP(&convOutputFile, "output", "o", "", "Output file path (optional, format detected from extension), or - for stdout")
 	cmd.Flags().StringVar(&convOutputDir, "output-dir", "./", "Output directory for converted files")
 	cmd.Flags().StringVarP(&convFormat, "format", "f", "auto", "Output format: auto, tape, echoreplay, nevrcap")
 	cmd.Flags().BoolVarP(&convVerbose, "verbose", "v", false, "Enable verbose logging")
@@ -86,9 +146,23 @@ Auto mode converts to .tape by default.`,
 	cmd.Flags().BoolVar(&convExcludeBones, "exclude-bones", false, "Exclude player bone data from frames")
 	cmd.Flags().BoolVarP(&convRecursive, "recursive", "r", false, "Recursively search directories for files to convert")
 	cmd.Flags().StringVarP(&convGlob, "glob", "g", "", "Glob pattern to match files (e.g., '*.echoreplay')")
-	cmd.Flags().BoolVar(&convValidate, "validate", false, "Validate data integrity via round-trip conversion (echoreplay only)")
-
-	cmd.MarkFlagRequired("input")
+	cmd.Flags().BoolVar(&convValidate, "validate", false, "Validate data integrity via round-trip conversion through the output format (tape by default)")
+	cmd.Flags().Float64Var(&convTolerance, "tolerance", 1e-6, "With --validate, absolute or relative difference allowed between numbers")
+	cmd.Flags().StringSliceVar(&convFieldTols, "field-tolerance", nil, "With --validate, tolerance for a named field, e.g. position=1e-4 (repeatable)")
+	cmd.Flags().StringVar(&convReport, "report", "text", "Result format on stdout: text (log lines and summary table) or json")
+	cmd.Flags().StringVar(&convReportFile, "report-file", "", "Also write the JSON conversion report to this file")
+	cmd.Flags().BoolVar(&convIncremental, "incremental", false, "Only convert new or changed inputs, tracked in a manifest in the output directory")
+	cmd.Flags().BoolVar(&convPrune, "prune", false, "With --incremental, delete outputs whose sources no longer exist")
+	cmd.Flags().BoolVar(&convRepair, "repair", false, "Skip undecodable frames, drop duplicates and fix timestamps and session IDs instead of failing")
+	cmd.Flags().StringVar(&convRepairTimes, "repair-timestamps", "interpolate", "With --repair, how to fix timestamps that are missing or go backwards: interpolate or clamp")
+	cmd.Flags().IntVarP(&convJobs, "jobs", "j", 1, "Number of files to convert in parallel (0 = number of CPUs)")
+	cmd.Flags().IntVar(&convFPS, "fps", 0, "Resample to this frame rate (0 = keep every frame)")
+	cmd.Flags().BoolVar(&convInterpolate, "interpolate", false, "With --fps, interpolate frames when the recording has fewer frames than the target rate")
+	cmd.Flags().StringVar(&convWatch, "watch", "", "Keep running and convert files as they appear in this directory")
+	cmd.Flags().DurationVar(&convPollInterval, "poll-interval", 2*time.Second, "With --watch, how often to scan the directory")
+	cmd.Flags().DurationVar(&convSettle, "settle", 5*time.Second, "With --watch, how long a file must stop growing before it is converted")
+	cmd.Flags().StringVar(&convAfter, "after", "keep", "With --watch, what to do with converted sources: keep, move or delete")
+	cmd.Flags().StringVar(&convProcessedDir, "processed-dir", "", "With --after move, where sources are moved (default <watch>/processed)")
 
 	return cmd
 }
@@ -96,6 +170,7 @@ Auto mode converts to .tape by default.`,
 func runConverter(cmd *cobra.Command, args []string) error {
 	// Use flag values directly
 	cfg.Converter.InputFile = convInputFile
+	cfg.Converter.InputFormat = convInputFormat
 	cfg.Converter.OutputFile = convOutputFile
 	cfg.Converter.OutputDir = convOutputDir
 	cfg.Converter.Format = convFormat
@@ -105,11 +180,48 @@ func runConverter(cmd *cobra.Command, args []string) error {
 	cfg.Converter.Recursive = convRecursive
 	cfg.Converter.Glob = convGlob
 	cfg.Converter.Validate = convValidate
+	cfg.Converter.Tolerance = convTolerance
+	if len(convFieldTols) > 0 {
+		fieldTolerances, err := parseFieldTolerances(convFieldTols)
+		if err != nil {
+			return err
+		}
+		cfg.Converter.FieldTolerances = fieldTolerances
+	}
+	cfg.Converter.Report = convReport
+	cfg.Converter.ReportFile = convReportFile
+	cfg.Converter.Incremental = convIncremental
+	cfg.Converter.Prune = convPrune
+	cfg.Converter.Jobs = convJobs
+	cfg.Converter.FPS = convFPS
+	cfg.Converter.Interpolate = convInterpolate
+	cfg.Converter.Repair = convRepair
+	cfg.Converter.RepairTimestamps = convRepairTimes
+	cfg.Converter.Watch = convWatch
+	cfg.Converter.PollInterval = convPollInterval
+	cfg.Converter.Settle = convSettle
+	cfg.Converter.AfterConvert = convAfter
+	cfg.Converter.ProcessedDir = convProcessedDir
+	if cfg.Converter.ProcessedDir == "" && cfg.Converter.Watch != "" {
+		cfg.Converter.ProcessedDir = filepath.Join(cfg.Converter.Watch, "processed")
+	}
 
 	if cfg.Converter.Validate && cfg.Converter.ExcludeBones {
 		return fmt.Errorf("--validate cannot be used with --exclude-bones (would cause validation to fail)")
 	}
 
+	if cfg.Converter.Validate && cfg.Converter.FPS > 0 {
+		return fmt.Errorf("--validate cannot be used with --fps (resampled output is not expected to round-trip)")
+	}
+
+	if cfg.Converter.Validate && cfg.Converter.Repair {
+		return fmt.Errorf("--validate cannot be used with --repair (repaired output differs from the input by design)")
+	}
+
+	if cfg.Converter.Incremental && cfg.Converter.OutputFile != "" {
+		return fmt.Errorf("--incremental cannot be used with --output (the manifest lives in --output-dir)")
+	}
+
 	if cfg.Converter.OutputFile != "" && (cfg.Converter.Recursive || cfg.Converter.Glob != "") {
 		return fmt.Errorf("--output cannot be used with --recursive or --glob (output files will be auto-generated)")
 	}
@@ -119,82 +231,91 @@ func runConverter(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
+	if cfg.Converter.Watch != "" {
+		return runWatch(cmd)
+	}
+
+	if isStreamConversion() {
+		return runStreamConversion()
+	}
+
+	// A JSON report on stdout needs stdout to itself
+	if cfg.Converter.Report == "json" {
+		if err := logToStderr(); err != nil {
+			return err
+		}
+	}
+
+	// From here on, failures are reported per file rather than as usage errors
+	cmd.SilenceUsage = true
+
 	// Discover files to convert
 	files, err := discoverFiles()
 	if err != nil {
 		return fmt.Errorf("failed to discover files: %w", err)
 	}
 
+	var manifest *conversionManifest
+	pruned := 0
+	if cfg.Converter.Incremental {
+		if err := os.MkdirAll(cfg.Converter.OutputDir, 0755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+		manifest, err = loadConversionManifest(cfg.Converter.OutputDir, conversionOptions())
+		if err != nil {
+			return err
+		}
+		if cfg.Converter.Prune {
+			if pruned, err = pruneOutputs(manifest); err != nil {
+				return err
+			}
+			if err := manifest.Save(); err != nil {
+				return err
+			}
+		}
+	}
+
 	if len(files) == 0 {
+		if pruned > 0 {
+			return nil
+		}
 		return fmt.Errorf("no files found to convert")
 	}
 
+	jobs := cfg.Converter.Jobs
+	if jobs == 0 {
+		jobs = runtime.NumCPU()
+	}
+
 	if cfg.Converter.Verbose {
 		logger.Info("Found files to convert",
-			zap.Int("count", len(files)))
+			zap.Int("count", len(files)),
+			zap.Int("jobs", jobs))
 	}
 
 	// Convert all discovered files
-	successCount := 0
-	failCount := 0
 	startTime := time.Now()
-
-	for i, inputFile := range files {
-		if cfg.Converter.Verbose {
-			logger.Info("Converting file",
-				zap.Int("progress", i+1),
-				zap.Int("total", len(files)),
-				zap.String("file", inputFile))
-		} else if len(files) > 1 {
-			fmt.Printf("Converting %d/%d: %s\n", i+1, len(files), filepath.Base(inputFile))
-		}
-
-		// Determine output file for this input
-		outputFile, err := determineOutputFileForInput(inputFile)
-		if err != nil {
-			logger.Error("Failed to determine output file",
-				zap.String("input", inputFile),
-				zap.Error(err))
-			failCount++
-			continue
-		}
-
-		// Check if output file exists
-		if _, err := os.Stat(outputFile); err == nil && !cfg.Converter.Overwrite {
-			if cfg.Converter.Verbose {
-				logger.Info("Skipping existing file (use --overwrite to overwrite)",
-					zap.String("output", outputFile))
-			}
-			continue
+	results := runConversions(files, jobs, convShowProgress, manifest)
+	if manifest != nil {
+		if err := manifest.Save(); err != nil {
+			logger.Error("Failed to save manifest", zap.Error(err))
 		}
+	}
 
-		// Perform conversion
-		stats, err := convertFile(inputFile, outputFile, convShowProgress && len(files) == 1)
-		if err != nil {
+	for _, result := range results {
+		if result.Err != nil && (len(files) == 1 || cfg.Converter.Verbose) {
 			logger.Error("Conversion failed",
-				zap.String("input", inputFile),
-				zap.Error(err))
-			failCount++
-			continue
-		}
-
-		successCount++
-
-		if cfg.Converter.Validate {
-			if err := validateRoundTrip(inputFile); err != nil {
-				logger.Error("Validation failed",
-					zap.String("input", inputFile),
-					zap.Error(err))
-				failCount++
-				successCount--
-				continue
-			}
-			logger.Info("Validation passed", zap.String("input", inputFile))
+				zap.String("input", result.Input),
+				zap.String("category", result.Category),
+				zap.Error(result.Err))
 		}
+	}
 
-		if cfg.Converter.Verbose || len(files) == 1 {
+	if len(files) == 1 {
+		if result := results[0]; result.Stats != nil && result.Err == nil {
+			stats := result.Stats
 			logger.Info("Conversion completed",
-				zap.String("output", outputFile),
+				zap.String("output", result.Output),
 				zap.Int("frames", stats.FrameCount),
 				zap.Int64("input_size", stats.InputSize),
 				zap.Int64("output_size", stats.OutputSize))
@@ -204,27 +325,33 @@ func runConverter(cmd *cobra.Command, args []string) error {
 				logger.Info("Compression ratio", zap.Float64("ratio", compressionRatio))
 			}
 		}
+	} else if cfg.Converter.Report != "json" {
+		printConversionSummary(os.Stdout, results)
 	}
 
 	// Report summary
 	duration := time.Since(startTime)
+	report := newConversionReport(results, duration)
+	report.Summary.Pruned = pruned
 	logger.Info("Batch conversion completed",
-		zap.Int("successful", successCount),
-		zap.Int("failed", failCount),
+		zap.Int("successful", report.Summary.Converted),
+		zap.Int("failed", report.Summary.Failed),
+		zap.Int("validation_failed", report.Summary.ValidationFailed),
+		zap.Int("skipped", report.Summary.Skipped),
 		zap.Int("total", len(files)),
 		zap.Duration("duration", duration))
 
-	if failCount > 0 {
-		return fmt.Errorf("conversion completed with %d failures", failCount)
+	if err := emitConversionReport(report); err != nil {
+		return err
 	}
-
-	return nil
+	return report.Err()
 }
 
 type ConversionStats struct {
 	FrameCount int
 	InputSize  int64
 	OutputSize int64
+	Repair     *RepairReport // set with --repair
 }
 
 func convertFile(inputFile, outputFile string, showProgress bool) (*ConversionStats, error) {
@@ -236,8 +363,11 @@ func convertFile(inputFile, outputFile string, showProgress bool) (*ConversionSt
 	}
 
 	// Determine input and output formats
-	inputFormat := getFileFormat(inputFile)
+	inputFormat := detectInputFormat(inputFile)
 	outputFormat := getFileFormat(outputFile)
+	if inputFormat == "unknown" {
+		return nil, fmt.Errorf("%w: cannot detect the format of %s", errUnsupportedConversion, inputFile)
+	}
 
 	if cfg.Converter.Verbose {
 		logger.Info("Converting",
@@ -245,6 +375,19 @@ func convertFile(inputFile, outputFile string, showProgress bool) (*ConversionSt
 			zap.String("to", outputFormat))
 	}
 
+	// Resampling reads and writes every format through the v1 frame pipeline
+	if cfg.Converter.FPS > 0 {
+		return convertResampled(inputFile, outputFile, outputFormat)
+	}
+
+	// Repair, uncompressed variants and v1 files whose extension does not
+	// match their contents go through the v1 frame pipeline, which reads by
+	// content. Tape readers read by content too, so tape input stays on the
+	// native path whatever its name and tape → tape keeps its events.
+	if cfg.Converter.Repair || (inputFormat != "tape" && inputFormat != getFileFormat(inputFile)) {
+		return convertViaV1(inputFile, outputFile, outputFormat)
+	}
+
 	// Perform conversion with progress support
 	if (inputFormat == "echoreplay" || inputFormat == "nevrcap") && outputFormat == "tape" {
 		result, err := conversion.ConvertFile(inputFile, outputFile)
@@ -258,25 +401,22 @@ func convertFile(inputFile, outputFile string, showProgress bool) (*ConversionSt
 		return stats, nil
 	}
 
+	if inputFormat == "tape" && (outputFormat == "echoreplay" || outputFormat == "nevrcap") {
+		return convertTapeToV1(inputFile, outputFile, outputFormat)
+	}
+
+	// Legacy conversions count frames while converting so each file is read once
+	var frameCount int
+	var err error
 	if inputFormat == "echoreplay" && outputFormat == "nevrcap" {
-		if showProgress || cfg.Converter.ExcludeBones {
-			if err := convertEchoReplayToNevrcapWithProgress(inputFile, outputFile); err != nil {
-				return nil, err
-			}
-		} else {
-			if err := convertEchoReplayToNevrcap(inputFile, outputFile); err != nil {
-				return nil, err
-			}
+		frameCount, err = convertEchoReplayToNevrcapWithProgress(inputFile, outputFile, showProgress)
+		if err != nil {
+			return nil, err
 		}
 	} else if inputFormat == "nevrcap" && outputFormat == "echoreplay" {
-		if showProgress || cfg.Converter.ExcludeBones {
-			if err := convertNevrcapToEchoReplayWithProgress(inputFile, outputFile); err != nil {
-				return nil, err
-			}
-		} else {
-			if err := conversion.ConvertNevrcapToEchoReplay(inputFile, outputFile); err != nil {
-				return nil, err
-			}
+		frameCount, err = convertNevrcapToEchoReplayWithProgress(inputFile, outputFile, showProgress)
+		if err != nil {
+			return nil, err
 		}
 	} else if inputFormat == outputFormat {
 		// Same format, just copy (or re-write if excluding bones)
@@ -285,18 +425,14 @@ func convertFile(inputFile, outputFile string, showProgress bool) (*ConversionSt
 		}
 		return copyFile(inputFile, outputFile)
 	} else {
-		return nil, fmt.Errorf("unsupported conversion from %s to %s", inputFormat, outputFormat)
+		return nil, fmt.Errorf("%w from %s to %s", errUnsupportedConversion, inputFormat, outputFormat)
 	}
 
 	// Get output file size
 	if outputInfo, err := os.Stat(outputFile); err == nil {
 		stats.OutputSize = outputInfo.Size()
 	}
-
-	// Count frames
-	if frameCount, err := countFrames(outputFile); err == nil {
-		stats.FrameCount = frameCount
-	}
+	stats.FrameCount = frameCount
 
 	return stats, nil
 }
@@ -333,58 +469,30 @@ func convertEchoReplayToNevrcap(inputFile, outputFile string) error {
 }
 
 // convertEchoReplayToNevrcapWithProgress converts with optional progress bar
-func convertEchoReplayToNevrcapWithProgress(inputFile, outputFile string) error {
+// and returns the number of frames written.
+func convertEchoReplayToNevrcapWithProgress(inputFile, outputFile string, showProgress bool) (int, error) {
 	reader, err := codec.NewEchoReplayReader(inputFile)
 	if err != nil {
-		return fmt.Errorf("failed to open input file: %w", err)
+		return 0, fmt.Errorf("failed to open input file: %w", err)
 	}
 	defer reader.Close()
 
 	writer, err := agent.NewLegacyWriter(outputFile)
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		return 0, fmt.Errorf("failed to create output file: %w", err)
 	}
 	defer writer.Close()
 
-	// Count total frames first for progress bar (only if showing progress)
-	totalFrames := 0
-	var bar *progressbar.ProgressBar
-	if convShowProgress {
-		countReader, err := codec.NewEchoReplayReader(inputFile)
-		if err == nil {
-			for {
-				if _, err := countReader.ReadFrame(); err != nil {
-					break
-				}
-				totalFrames++
-			}
-			countReader.Close()
-		}
-
-		bar = progressbar.NewOptions(totalFrames,
-			progressbar.OptionEnableColorCodes(true),
-			progressbar.OptionShowBytes(false),
-			progressbar.OptionSetWidth(40),
-			progressbar.OptionSetDescription("[cyan]Converting[reset]"),
-			progressbar.OptionSetTheme(progressbar.Theme{
-				Saucer:        "[green]=[reset]",
-				SaucerHead:    "[green]>[reset]",
-				SaucerPadding: " ",
-				BarStart:      "[",
-				BarEnd:        "]",
-			}),
-			progressbar.OptionShowCount(),
-			progressbar.OptionShowElapsedTimeOnFinish(),
-		)
-	}
+	bar := newFrameProgressBar(showProgress)
 
+	frameCount := 0
 	for {
 		frame, err := reader.ReadFrame()
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			return fmt.Errorf("failed to read frame: %w", err)
+			return frameCount, fmt.Errorf("failed to read frame: %w", err)
 		}
 
 		// Exclude bones if configured
@@ -393,8 +501,9 @@ func convertEchoReplayToNevrcapWithProgress(inputFile, outputFile string) error
 		}
 
 		if err := writer.WriteFrame(frame); err != nil {
-			return fmt.Errorf("failed to write frame: %w", err)
+			return frameCount, fmt.Errorf("failed to write frame: %w", err)
 		}
+		frameCount++
 
 		if bar != nil {
 			bar.Add(1)
@@ -402,71 +511,42 @@ func convertEchoReplayToNevrcapWithProgress(inputFile, outputFile string) error
 	}
 
 	if bar != nil {
+		bar.Finish()
 		fmt.Println() // New line after progress bar
 	}
-	return nil
+	return frameCount, nil
 }
 
 // convertNevrcapToEchoReplayWithProgress converts with optional progress bar
-func convertNevrcapToEchoReplayWithProgress(inputFile, outputFile string) error {
+// and returns the number of frames written.
+func convertNevrcapToEchoReplayWithProgress(inputFile, outputFile string, showProgress bool) (int, error) {
 	reader, err := codec.NewLegacyReader(inputFile)
 	if err != nil {
-		return fmt.Errorf("failed to open input file: %w", err)
+		return 0, fmt.Errorf("failed to open input file: %w", err)
 	}
 	defer reader.Close()
 
 	// Skip header
 	if _, err := reader.ReadHeader(); err != nil {
-		return fmt.Errorf("failed to read header: %w", err)
+		return 0, fmt.Errorf("failed to read header: %w", err)
 	}
 
 	writer, err := codec.NewEchoReplayWriter(outputFile)
 	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
+		return 0, fmt.Errorf("failed to create output file: %w", err)
 	}
 	defer writer.Close()
 
-	// Count total frames first for progress bar (only if showing progress)
-	totalFrames := 0
-	var bar *progressbar.ProgressBar
-	if convShowProgress {
-		countReader, err := codec.NewLegacyReader(inputFile)
-		if err == nil {
-			if _, err := countReader.ReadHeader(); err == nil {
-				for {
-					if _, err := countReader.ReadFrame(); err != nil {
-						break
-					}
-					totalFrames++
-				}
-			}
-			countReader.Close()
-		}
-
-		bar = progressbar.NewOptions(totalFrames,
-			progressbar.OptionEnableColorCodes(true),
-			progressbar.OptionShowBytes(false),
-			progressbar.OptionSetWidth(40),
-			progressbar.OptionSetDescription("[cyan]Converting[reset]"),
-			progressbar.OptionSetTheme(progressbar.Theme{
-				Saucer:        "[green]=[reset]",
-				SaucerHead:    "[green]>[reset]",
-				SaucerPadding: " ",
-				BarStart:      "[",
-				BarEnd:        "]",
-			}),
-			progressbar.OptionShowCount(),
-			progressbar.OptionShowElapsedTimeOnFinish(),
-		)
-	}
+	bar := newFrameProgressBar(showProgress)
 
+	frameCount := 0
 	for {
 		frame, err := reader.ReadFrame()
 		if err != nil {
 			if err == io.EOF {
 				break
 			}
-			return fmt.Errorf("failed to read frame: %w", err)
+			return frameCount, fmt.Errorf("failed to read frame: %w", err)
 		}
 
 		// Exclude bones if configured
@@ -475,8 +555,9 @@ func convertNevrcapToEchoReplayWithProgress(inputFile, outputFile string) error
 		}
 
 		if err := writer.WriteFrame(frame); err != nil {
-			return fmt.Errorf("failed to write frame: %w", err)
+			return frameCount, fmt.Errorf("failed to write frame: %w", err)
 		}
+		frameCount++
 
 		if bar != nil {
 			bar.Add(1)
@@ -484,9 +565,29 @@ func convertNevrcapToEchoReplayWithProgress(inputFile, outputFile string) error
 	}
 
 	if bar != nil {
+		bar.Finish()
 		fmt.Println() // New line after progress bar
 	}
-	return nil
+	return frameCount, nil
+}
+
+// newFrameProgressBar returns a frame counter for single-file conversions,
+// or nil when progress is disabled. The total is not known up front because
+// counting frames would require a second pass over the input.
+func newFrameProgressBar(showProgress bool) *progressbar.ProgressBar {
+	if !showProgress {
+		return nil
+	}
+	return progressbar.NewOptions(-1,
+		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionShowBytes(false),
+		progressbar.OptionSetWidth(40),
+		progressbar.OptionSetDescription("[cyan]Converting[reset]"),
+		progressbar.OptionShowCount(),
+		progressbar.OptionShowIts(),
+		progressbar.OptionSetItsString("frames"),
+		progressbar.OptionShowElapsedTimeOnFinish(),
+	)
 }
 
 func getFileFormat(filename string) string {
@@ -611,6 +712,47 @@ func convertSameFormat(inputFile, outputFile, format string) (*ConversionStats,
 			stats.FrameCount++
 		}
 
+	case "tape":
+		reader, err := codec.NewReader(inputFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open input file: %w", err)
+		}
+		defer reader.Close()
+
+		header, err := reader.ReadHeader()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read header: %w", err)
+		}
+
+		writer, err := codec.NewWriter(outputFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer writer.Close()
+		if err := writer.WriteHeader(header); err != nil {
+			return nil, fmt.Errorf("failed to write header: %w", err)
+		}
+
+		for {
+			frame, err := reader.ReadFrame()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, fmt.Errorf("failed to read frame: %w", err)
+			}
+
+			// Exclude bones if configured
+			if arena := frame.GetEchoArena(); arena != nil && cfg.Converter.ExcludeBones {
+				arena.Bones = nil
+			}
+
+			if err := writer.WriteFrame(frame); err != nil {
+				return nil, fmt.Errorf("failed to write frame: %w", err)
+			}
+			stats.FrameCount++
+		}
+
 	default:
 		return nil, fmt.Errorf("unsupported format: %s", format)
 	}
@@ -712,6 +854,13 @@ func discoverFiles() ([]string, error) {
 		return []string{inputPath}, nil
 	}
 
+	return findReplayFiles(inputPath, nil)
+}
+
+// findReplayFiles lists the replay files in dir, descending into
+// subdirectories with --recursive and filtering by --glob. Directories for
+// which skip returns true are not scanned.
+func findReplayFiles(dir string, skip func(path string) bool) ([]string, error) {
 	var files []string
 
 	walkFunc := func(path string, info os.FileInfo, err error) error {
@@ -720,14 +869,13 @@ func discoverFiles() ([]string, error) {
 		}
 
 		if info.IsDir() {
-			if !cfg.Converter.Recursive && path != inputPath {
+			if path != dir && (!cfg.Converter.Recursive || (skip != nil && skip(path))) {
 				return filepath.SkipDir
 			}
 			return nil
 		}
 
-		lowerPath := strings.ToLower(path)
-		if !strings.HasSuffix(lowerPath, ".echoreplay") && !strings.HasSuffix(lowerPath, ".nevrcap") && !strings.HasSuffix(lowerPath, ".tape") {
+		if !isReplayFile(path) {
 			return nil
 		}
 
@@ -745,7 +893,7 @@ func discoverFiles() ([]string, error) {
 		return nil
 	}
 
-	if err := filepath.Walk(inputPath, walkFunc); err != nil {
+	if err := filepath.Walk(dir, walkFunc); err != nil {
 		return nil, fmt.Errorf("error walking directory: %w", err)
 	}
 
@@ -761,35 +909,27 @@ func determineOutputFileForInput(inputFile string) (string, error) {
 		return cfg.Converter.OutputFile, nil
 	}
 
+	inputFormat := compressedFormat(detectInputFormat(inputFile))
 	targetFormat := cfg.Converter.Format
 	if targetFormat == "auto" {
-		if strings.HasSuffix(strings.ToLower(inputFile), ".echoreplay") {
-			targetFormat = "tape"
-		} else if strings.HasSuffix(strings.ToLower(inputFile), ".nevrcap") {
+		switch inputFormat {
+		case "echoreplay", "nevrcap":
 			targetFormat = "tape"
-		} else {
+		case "tape":
+			targetFormat = "echoreplay"
+		default:
 			return "", fmt.Errorf("cannot auto-detect target format for input file: %s", inputFile)
 		}
 	}
 
-	inputBase := filepath.Base(inputFile)
+	stem := inputStem(inputFile)
 	var outputName string
 
 	switch targetFormat {
-	case "tape":
-		ext := filepath.Ext(inputBase)
-		outputName = strings.TrimSuffix(inputBase, ext) + ".tape"
-	case "echoreplay":
-		if strings.HasSuffix(strings.ToLower(inputBase), ".nevrcap") {
-			outputName = strings.TrimSuffix(inputBase, ".nevrcap") + ".echoreplay"
-		} else {
-			outputName = strings.TrimSuffix(inputBase, ".echoreplay") + "_converted.echoreplay"
-		}
-	case "nevrcap":
-		if strings.HasSuffix(strings.ToLower(inputBase), ".echoreplay") {
-			outputName = strings.TrimSuffix(inputBase, ".echoreplay") + ".nevrcap"
-		} else {
-			outputName = strings.TrimSuffix(inputBase, ".nevrcap") + "_converted.nevrcap"
+	case "tape", "echoreplay", "nevrcap":
+		outputName = stem + "." + targetFormat
+		if inputFormat == targetFormat {
+			outputName = stem + "_converted." + targetFormat
 		}
 	default:
 		return "", fmt.Errorf("unsupported target format: %s", targetFormat)
@@ -801,207 +941,3 @@ func determineOutputFileForInput(inputFile string) (string, error) {
 
 	return filepath.Join(cfg.Converter.OutputDir, outputName), nil
 }
-
-func validateRoundTrip(inputFile string) error {
-	if !strings.HasSuffix(strings.ToLower(inputFile), ".echoreplay") {
-		return fmt.Errorf("validation only supports .echoreplay files")
-	}
-
-	logger.Info("Starting round-trip validation", zap.String("file", inputFile))
-
-	tempDir, err := os.MkdirTemp("", "nevr-validate-*")
-	if err != nil {
-		return fmt.Errorf("failed to create temp directory: %w", err)
-	}
-	defer os.RemoveAll(tempDir)
-
-	tempNevrcap := filepath.Join(tempDir, "temp.nevrcap")
-	tempEchoreplay := filepath.Join(tempDir, "temp.echoreplay")
-
-	logger.Info("Converting to nevrcap", zap.String("temp", tempNevrcap))
-	if err := convertEchoReplayToNevrcap(inputFile, tempNevrcap); err != nil {
-		return fmt.Errorf("failed to convert to nevrcap: %w", err)
-	}
-
-	logger.Info("Converting back to echoreplay", zap.String("temp", tempEchoreplay))
-	if err := conversion.ConvertNevrcapToEchoReplay(tempNevrcap, tempEchoreplay); err != nil {
-		return fmt.Errorf("failed to convert back to echoreplay: %w", err)
-	}
-
-	logger.Info("Reading original raw JSON frames")
-	originalFrames, err := readRawJSONFrames(inputFile)
-	if err != nil {
-		return fmt.Errorf("failed to read original frames: %w", err)
-	}
-
-	logger.Info("Reading round-trip raw JSON frames")
-	roundtripFrames, err := readRawJSONFrames(tempEchoreplay)
-	if err != nil {
-		return fmt.Errorf("failed to read round-trip frames: %w", err)
-	}
-
-	logger.Info("Comparing frames",
-		zap.Int("original_count", len(originalFrames)),
-		zap.Int("roundtrip_count", len(roundtripFrames)))
-
-	if len(originalFrames) != len(roundtripFrames) {
-		return fmt.Errorf("frame count mismatch: original=%d, roundtrip=%d",
-			len(originalFrames), len(roundtripFrames))
-	}
-
-	for i := range originalFrames {
-		if err := compareJSONFrames(i, originalFrames[i], roundtripFrames[i]); err != nil {
-			return fmt.Errorf("frame %d mismatch: %w", i, err)
-		}
-	}
-
-	logger.Info("Round-trip validation successful",
-		zap.Int("frames_validated", len(originalFrames)))
-
-	return nil
-}
-
-type rawJSONFrame struct {
-	timestamp   string
-	sessionJSON []byte
-	bonesJSON   []byte
-}
-
-func readRawJSONFrames(filename string) ([]*rawJSONFrame, error) {
-	zipReader, err := zip.OpenReader(filename)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open echoreplay file: %w", err)
-	}
-	defer zipReader.Close()
-
-	var replayFile *zip.File
-	baseFilename := filepath.Base(filename)
-
-	for _, file := range zipReader.File {
-		if file.Name == baseFilename {
-			replayFile = file
-			break
-		}
-	}
-
-	if replayFile == nil {
-		for _, file := range zipReader.File {
-			if filepath.Ext(file.Name) == ".echoreplay" {
-				replayFile = file
-				break
-			}
-		}
-	}
-
-	if replayFile == nil {
-		return nil, fmt.Errorf("no .echoreplay file found in zip")
-	}
-
-	reader, err := replayFile.Open()
-	if err != nil {
-		return nil, err
-	}
-	defer reader.Close()
-
-	scanner := bufio.NewScanner(reader)
-	const maxScannerBuffer = 10 * 1024 * 1024
-	scanner.Buffer(make([]byte, 64*1024), maxScannerBuffer)
-
-	var frames []*rawJSONFrame
-
-	for scanner.Scan() {
-		line := scanner.Bytes()
-		parts := bytes.Split(line, []byte("\t"))
-		if len(parts) < 2 {
-			continue
-		}
-
-		frame := &rawJSONFrame{
-			timestamp:   string(parts[0]),
-			sessionJSON: make([]byte, len(parts[1])),
-		}
-		copy(frame.sessionJSON, parts[1])
-
-		if len(parts) > 2 && len(parts[2]) > 0 {
-			bonesData := parts[2]
-			if bonesData[0] == ' ' {
-				bonesData = bonesData[1:]
-			}
-			if len(bonesData) > 0 {
-				frame.bonesJSON = make([]byte, len(bonesData))
-				copy(frame.bonesJSON, bonesData)
-			}
-		}
-
-		frames = append(frames, frame)
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("scanner error: %w", err)
-	}
-
-	return frames, nil
-}
-
-func compareJSONFrames(frameNum int, original, roundtrip *rawJSONFrame) error {
-	if original.timestamp != roundtrip.timestamp {
-		return fmt.Errorf("timestamp mismatch: %q != %q", original.timestamp, roundtrip.timestamp)
-	}
-
-	if err := compareNormalizedJSON("session", original.sessionJSON, roundtrip.sessionJSON); err != nil {
-		if cfg.Converter.Verbose {
-			logger.Error("Session JSON mismatch",
-				zap.Int("frame", frameNum),
-				zap.Error(err))
-		}
-		return err
-	}
-
-	if (original.bonesJSON == nil) != (roundtrip.bonesJSON == nil) {
-		return fmt.Errorf("bones presence mismatch: original=%v, roundtrip=%v",
-			original.bonesJSON != nil, roundtrip.bonesJSON != nil)
-	}
-
-	if original.bonesJSON != nil {
-		if err := compareNormalizedJSON("bones", original.bonesJSON, roundtrip.bonesJSON); err != nil {
-			if cfg.Converter.Verbose {
-				logger.Error("Bones JSON mismatch",
-					zap.Int("frame", frameNum),
-					zap.Error(err))
-			}
-			return err
-		}
-	}
-
-	return nil
-}
-
-func compareNormalizedJSON(fieldName string, json1, json2 []byte) error {
-	var obj1, obj2 interface{}
-
-	if err := json.Unmarshal(json1, &obj1); err != nil {
-		return fmt.Errorf("failed to parse original %s JSON: %w", fieldName, err)
-	}
-
-	if err := json.Unmarshal(json2, &obj2); err != nil {
-		return fmt.Errorf("failed to parse roundtrip %s JSON: %w", fieldName, err)
-	}
-
-	normalized1, err := json.Marshal(obj1)
-	if err != nil {
-		return fmt.Errorf("failed to normalize original %s JSON: %w", fieldName, err)
-	}
-
-	normalized2, err := json.Marshal(obj2)
-	if err != nil {
-		return fmt.Errorf("failed to normalize roundtrip %s JSON: %w", fieldName, err)
-	}
-
-	if !bytes.Equal(normalized1, normalized2) {
-		hash1 := sha256.Sum256(normalized1)
-		hash2 := sha256.Sum256(normalized2)
-		return fmt.Errorf("%s JSON differs (hash: %x vs %x)", fieldName, hash1[:8], hash2[:8])
-	}
-
-	return nil
-}
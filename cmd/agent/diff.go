@@ -0,0 +1,645 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/echotools/nevr-agent/v4/internal/jsondiff"
+	"github.com/spf13/cobra"
+)
+
+var (
+	diffAlign          string
+	diffMaxSkew        time.Duration
+	diffTolerance      float64
+	diffFieldTols      []string
+	diffIgnore         []string
+	diffMaxDifferences int
+	diffFormat         string
+)
+
+// exitRecordingsDiffer is the exit code of `agent diff` when the recordings
+// differ.
+const exitRecordingsDiffer = 2
+
+// Frame alignment modes.
+const (
+	alignTimestamp = "timestamp" // wall-clock timestamps within --max-skew
+	alignClock     = "clock"     // round and game clock within --max-skew
+	alignFrame     = "frame"     // position in the file
+)
+
+// maxReportedRanges caps the runs of unmatched frames listed in a diff.
+const maxReportedRanges = 1000
+
+// maxListedFields is how many of the most divergent fields the text summary lists.
+const maxListedFields = 15
+
+func newDiffCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff <recording-a> <recording-b>",
+		Short: "Compare two recordings frame by frame",
+		Long: `The diff command compares two recordings of the same match frame by frame,
+such as recordings made by two agents or a converted file and its source.
+The recordings may be in different formats, for example an .echoreplay
+against a .tape; .tape frames are compared in their v1 form.
+
+Frames are paired with --align:
+  timestamp  Wall-clock timestamps at most --max-skew apart (default)
+  clock      Same round and game clock, at most --max-skew apart. For
+             recordings whose machine clocks disagree.
+  frame      Position in the file, for conversions that keep every frame
+
+Frames that cannot be paired are reported as missing (only in a) or extra
+(only in b). Paired frames are compared field by field; numbers within
+--tolerance (absolute or relative) or a --field-tolerance for that field
+are equal. Event lists are compared by event type. Fields named in --ignore
+are skipped wherever they appear.
+
+The diff ends with a summary of divergence statistics: matched, missing and
+extra frames, frames and fields that differ, the timestamp skew between
+paired frames and the most divergent fields. The command exits with status 2
+if the recordings differ.`,
+		Example: `  # Check a conversion against its source
+  agent diff match.echoreplay match.tape --align frame
+
+  # Compare the recordings of two agents by game clock, allowing small numeric drift
+  agent diff agent1.nevrcap agent2.nevrcap --align clock --max-skew 50ms --tolerance 0.02
+
+  # Looser tolerance for positions only, as JSON
+  agent diff a.tape b.tape --field-tolerance position=0.01 --format json`,
+		Args: cobra.ExactArgs(2),
+		RunE: runDiff,
+	}
+
+	cmd.Flags().StringVar(&diffAlign, "align", alignTimestamp, "Frame alignment: timestamp, clock or frame")
+	cmd.Flags().DurationVar(&diffMaxSkew, "max-skew", 10*time.Millisecond, "Largest timestamp or game clock difference between paired frames")
+	cmd.Flags().Float64Var(&diffTolerance, "tolerance", 1e-6, "Absolute or relative difference allowed between numbers")
+	cmd.Flags().StringSliceVar(&diffFieldTols, "field-tolerance", nil, "Per-field tolerance as name=value (repeatable)")
+	cmd.Flags().StringSliceVar(&diffIgnore, "ignore", []string{"frame_index", "timestamp"}, "Field names to skip")
+	cmd.Flags().IntVar(&diffMaxDifferences, "max-differences", 50, "Differences to list (the summary counts all)")
+	cmd.Flags().StringVar(&diffFormat, "format", "text", "Output format: text or json")
+
+	return cmd
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	switch {
+	case diffAlign != alignTimestamp && diffAlign != alignClock && diffAlign != alignFrame:
+		return fmt.Errorf("unknown alignment %q (must be timestamp, clock or frame)", diffAlign)
+	case diffMaxSkew < 0:
+		return fmt.Errorf("max skew must not be negative, got %v", diffMaxSkew)
+	case diffTolerance < 0:
+		return fmt.Errorf("tolerance must not be negative, got %g", diffTolerance)
+	case diffMaxDifferences < 0:
+		return fmt.Errorf("max differences must not be negative, got %d", diffMaxDifferences)
+	case diffFormat != "text" && diffFormat != "json":
+		return fmt.Errorf("unsupported format: %s (must be text or json)", diffFormat)
+	}
+	fieldTolerances, err := parseFieldTolerances(diffFieldTols)
+	if err != nil {
+		return err
+	}
+	for _, name := range args {
+		if _, err := os.Stat(name); err != nil {
+			return fmt.Errorf("cannot access input file: %w", err)
+		}
+	}
+
+	opts := diffOptions{
+		Align:       diffAlign,
+		MaxSkew:     diffMaxSkew,
+		Compare:     jsondiff.Options{Tolerance: diffTolerance, FieldTolerances: fieldTolerances},
+		Ignore:      splitList(diffIgnore),
+		MaxReported: diffMaxDifferences,
+	}
+	result, err := diffRecordings(args[0], args[1], opts)
+	if err != nil {
+		return err
+	}
+	if err := writeRecordingDiff(os.Stdout, result, diffFormat); err != nil {
+		return err
+	}
+	if result.Differs() {
+		return &exitCodeError{
+			code: exitRecordingsDiffer,
+			err:  fmt.Errorf("recordings differ: %d frames only in a, %d only in b, %d paired frames differ", result.Missing, result.Extra, result.FramesDiffering),
+		}
+	}
+	return nil
+}
+
+// diffOptions are the settings of one comparison.
+type diffOptions struct {
+	Align       string
+	MaxSkew     time.Duration
+	Compare     jsondiff.Options
+	Ignore      []string
+	MaxReported int
+}
+
+// diffFrame is one frame prepared for comparison.
+type diffFrame struct {
+	Position  int
+	Timestamp time.Time
+	Round     int
+	Clock     float64
+	Doc       []byte   // frame JSON without events
+	Events    []string // event type names
+}
+
+// RecordingDiff is the result of comparing two recordings.
+type RecordingDiff struct {
+	A               string                `json:"a"`
+	B               string                `json:"b"`
+	FormatA         string                `json:"format_a"`
+	FormatB         string                `json:"format_b"`
+	Align           string                `json:"align"`
+	FramesA         int                   `json:"frames_a"`
+	FramesB         int                   `json:"frames_b"`
+	Matched         int                   `json:"matched"`
+	Missing         int                   `json:"missing"` // frames only in a
+	Extra           int                   `json:"extra"`   // frames only in b
+	MissingRanges   []FrameRun            `json:"missing_ranges"`
+	ExtraRanges     []FrameRun            `json:"extra_ranges"`
+	FramesDiffering int                   `json:"frames_differing"` // paired frames with field or event differences
+	FieldDiffs      int                   `json:"field_differences"`
+	EventDiffs      int                   `json:"event_differences"` // paired frames whose event lists differ
+	MeanSkew        float64               `json:"mean_skew_seconds"`
+	MaxSkew         float64               `json:"max_skew_seconds"`
+	Fields          []FieldDivergence     `json:"fields"`
+	Differences     []PairedDifference    `json:"differences"`
+	Events          []EventListDifference `json:"events"`
+
+	skewTotal time.Duration
+	fields    map[string]*FieldDivergence
+	maxList   int
+}
+
+// FrameRun is a run of consecutive frames, by position, found in only one
+// recording.
+type FrameRun struct {
+	First int `json:"first"`
+	Last  int `json:"last"`
+}
+
+// FieldDivergence counts the differences of one field across all frames.
+// Array indices in Path are collapsed to [].
+type FieldDivergence struct {
+	Path     string  `json:"path"`
+	Count    int     `json:"count"`
+	MaxDelta float64 `json:"max_delta,omitempty"` // largest numeric difference
+}
+
+// PairedDifference is a field-level difference between two paired frames.
+type PairedDifference struct {
+	FrameA int `json:"frame_a"`
+	FrameB int `json:"frame_b"`
+	jsondiff.Difference
+}
+
+// EventListDifference lists the events of a paired frame found in only one
+// recording.
+type EventListDifference struct {
+	FrameA int      `json:"frame_a"`
+	FrameB int      `json:"frame_b"`
+	OnlyA  []string `json:"only_a,omitempty"`
+	OnlyB  []string `json:"only_b,omitempty"`
+}
+
+// Differs reports whether the recordings differ in any way.
+func (d *RecordingDiff) Differs() bool {
+	return d.Missing > 0 || d.Extra > 0 || d.FramesDiffering > 0
+}
+
+func newRecordingDiff(a, b, align string, maxList int) *RecordingDiff {
+	return &RecordingDiff{
+		A:             filepath.Base(a),
+		B:             filepath.Base(b),
+		Align:         align,
+		MissingRanges: []FrameRun{},
+		ExtraRanges:   []FrameRun{},
+		Fields:        []FieldDivergence{},
+		Differences:   []PairedDifference{},
+		Events:        []EventListDifference{},
+		fields:        make(map[string]*FieldDivergence),
+		maxList:       maxList,
+	}
+}
+
+// addRun extends the last run if position follows it, or starts a new one.
+func addRun(runs []FrameRun, position int) []FrameRun {
+	if n := len(runs); n > 0 && runs[n-1].Last == position-1 {
+		runs[n-1].Last = position
+		return runs
+	}
+	if len(runs) == maxReportedRanges {
+		return runs
+	}
+	return append(runs, FrameRun{First: position, Last: position})
+}
+
+func (d *RecordingDiff) missing(a *diffFrame) {
+	d.Missing++
+	d.MissingRanges = addRun(d.MissingRanges, a.Position)
+}
+
+func (d *RecordingDiff) extra(b *diffFrame) {
+	d.Extra++
+	d.ExtraRanges = addRun(d.ExtraRanges, b.Position)
+}
+
+// pair records the comparison of two paired frames.
+func (d *RecordingDiff) pair(a, b *diffFrame, diffs []jsondiff.Difference) {
+	d.Matched++
+	if !a.Timestamp.IsZero() && !b.Timestamp.IsZero() {
+		skew := a.Timestamp.Sub(b.Timestamp)
+		if skew < 0 {
+			skew = -skew
+		}
+		d.skewTotal += skew
+		d.MaxSkew = max(d.MaxSkew, skew.Seconds())
+	}
+
+	onlyA, onlyB := eventListDifference(a.Events, b.Events)
+	if len(diffs) == 0 && len(onlyA) == 0 && len(onlyB) == 0 {
+		return
+	}
+	d.FramesDiffering++
+
+	for _, diff := range diffs {
+		d.FieldDiffs++
+		path := collapseIndices(diff.Path)
+		field := d.fields[path]
+		if field == nil {
+			field = &FieldDivergence{Path: path}
+			d.fields[path] = field
+		}
+		field.Count++
+		if delta, ok := numericDelta(diff); ok {
+			field.MaxDelta = max(field.MaxDelta, delta)
+		}
+		if len(d.Differences) < d.maxList {
+			d.Differences = append(d.Differences, PairedDifference{FrameA: a.Position, FrameB: b.Position, Difference: diff})
+		}
+	}
+
+	if len(onlyA) > 0 || len(onlyB) > 0 {
+		d.EventDiffs++
+		if len(d.Events) < d.maxList {
+			d.Events = append(d.Events, EventListDifference{FrameA: a.Position, FrameB: b.Position, OnlyA: onlyA, OnlyB: onlyB})
+		}
+	}
+}
+
+// finish derives the summary statistics.
+func (d *RecordingDiff) finish() {
+	if d.Matched > 0 {
+		d.MeanSkew = d.skewTotal.Seconds() / float64(d.Matched)
+	}
+	for _, field := range d.fields {
+		d.Fields = append(d.Fields, *field)
+	}
+	slices.SortFunc(d.Fields, func(a, b FieldDivergence) int {
+		if a.Count != b.Count {
+			return b.Count - a.Count
+		}
+		return strings.Compare(a.Path, b.Path)
+	})
+}
+
+var arrayIndex = regexp.MustCompile(`\[\d+\]`)
+
+// collapseIndices replaces array indices in a difference path with [].
+func collapseIndices(path string) string {
+	return arrayIndex.ReplaceAllString(path, "[]")
+}
+
+// numericDelta returns the absolute difference of a numeric value difference.
+func numericDelta(d jsondiff.Difference) (float64, bool) {
+	a, aOK := d.A.(float64)
+	b, bOK := d.B.(float64)
+	if d.Kind != jsondiff.KindValue || !aOK || !bOK {
+		return 0, false
+	}
+	return math.Abs(a - b), true
+}
+
+// eventListDifference returns the events, by type, that only one list has.
+// Repeated events count separately.
+func eventListDifference(a, b []string) (onlyA, onlyB []string) {
+	counts := make(map[string]int)
+	for _, name := range a {
+		counts[name]++
+	}
+	for _, name := range b {
+		counts[name]--
+	}
+	for _, name := range slices.Sorted(maps.Keys(counts)) {
+		for n := counts[name]; n > 0; n-- {
+			onlyA = append(onlyA, name)
+		}
+		for n := counts[name]; n < 0; n++ {
+			onlyB = append(onlyB, name)
+		}
+	}
+	return onlyA, onlyB
+}
+
+// ignoredPath reports whether any field named in a path is in ignore.
+func ignoredPath(path string, ignore []string) bool {
+	for _, part := range strings.Split(collapseIndices(path), ".") {
+		if slices.Contains(ignore, strings.TrimSuffix(part, "[]")) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareAligned orders two frames for alignment: negative if a comes first,
+// positive if b does, and zero if they pair.
+func compareAligned(a, b *diffFrame, align string, maxSkew time.Duration) int {
+	switch align {
+	case alignFrame:
+		return a.Position - b.Position
+
+	case alignClock:
+		if a.Round != b.Round {
+			return a.Round - b.Round
+		}
+		// The game clock counts down
+		delta := b.Clock - a.Clock
+		if math.Abs(delta) <= maxSkew.Seconds() {
+			return 0
+		}
+		if delta < 0 {
+			return -1
+		}
+		return 1
+
+	default:
+		delta := a.Timestamp.Sub(b.Timestamp)
+		switch {
+		case delta < -maxSkew:
+			return -1
+		case delta > maxSkew:
+			return 1
+		}
+		return 0
+	}
+}
+
+// alignFrames walks two frame streams in order, pairing frames and reporting
+// the ones found in only one of them.
+func alignFrames(a, b diffFrameReader, opts diffOptions, result *RecordingDiff) error {
+	next := func(r diffFrameReader, count *int) (*diffFrame, error) {
+		frame, err := r.next()
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		*count++
+		return frame, nil
+	}
+
+	fa, err := next(a, &result.FramesA)
+	if err != nil {
+		return fmt.Errorf("%s: %w", result.A, err)
+	}
+	fb, err := next(b, &result.FramesB)
+	if err != nil {
+		return fmt.Errorf("%s: %w", result.B, err)
+	}
+
+	for fa != nil || fb != nil {
+		order := 0
+		switch {
+		case fb == nil:
+			order = -1
+		case fa == nil:
+			order = 1
+		default:
+			order = compareAligned(fa, fb, opts.Align, opts.MaxSkew)
+		}
+
+		if order == 0 {
+			diffs, err := jsondiff.CompareJSON(fa.Doc, fb.Doc, "", opts.Compare)
+			if err != nil {
+				return fmt.Errorf("frame %d: %w", fa.Position, err)
+			}
+			diffs = slices.DeleteFunc(diffs, func(d jsondiff.Difference) bool {
+				return ignoredPath(d.Path, opts.Ignore)
+			})
+			result.pair(fa, fb, diffs)
+		}
+		if order <= 0 {
+			if order < 0 {
+				result.missing(fa)
+			}
+			if fa, err = next(a, &result.FramesA); err != nil {
+				return fmt.Errorf("%s: %w", result.A, err)
+			}
+		}
+		if order >= 0 {
+			if order > 0 {
+				result.extra(fb)
+			}
+			if fb, err = next(b, &result.FramesB); err != nil {
+				return fmt.Errorf("%s: %w", result.B, err)
+			}
+		}
+	}
+	return nil
+}
+
+// diffRecordings compares two recordings.
+func diffRecordings(a, b string, opts diffOptions) (*RecordingDiff, error) {
+	result := newRecordingDiff(a, b, opts.Align, opts.MaxReported)
+	result.FormatA, result.FormatB = detectInputFormat(a), detectInputFormat(b)
+
+	ra, err := openDiffFrameReader(a)
+	if err != nil {
+		return nil, err
+	}
+	defer ra.Close()
+	rb, err := openDiffFrameReader(b)
+	if err != nil {
+		return nil, err
+	}
+	defer rb.Close()
+
+	if err := alignFrames(ra, rb, opts, result); err != nil {
+		return nil, err
+	}
+	result.finish()
+	return result, nil
+}
+
+// diffFrameReader yields the frames of a recording prepared for comparison.
+// next returns io.EOF after the last frame.
+type diffFrameReader interface {
+	next() (*diffFrame, error)
+}
+
+// v1DiffReader prepares the frames of any format for comparison.
+type v1DiffReader struct {
+	source   *eventFrameSource
+	rounds   roundTracker
+	clock    float64
+	position int
+}
+
+func openDiffFrameReader(filename string) (*v1DiffReader, error) {
+	source, err := openEventFrameSource(filename, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &v1DiffReader{source: source}, nil
+}
+
+func (r *v1DiffReader) next() (*diffFrame, error) {
+	read, err := r.source.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+	frame := read.Frame
+
+	doc, err := roundTripMarshaler.Marshal(frame)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal frame %d: %w", r.position, err)
+	}
+
+	// Frames without a readable game clock keep the last one
+	r.rounds.track(frame.GetSession().GetGameStatus())
+	if clock, err := parseGameClock(frame.GetSession().GetGameClockDisplay()); err == nil {
+		r.clock = clock
+	}
+
+	d := &diffFrame{
+		Position: r.position,
+		Round:    r.rounds.round,
+		Clock:    r.clock,
+		Doc:      doc,
+		Events:   read.Types,
+	}
+	if frame.GetTimestamp() != nil {
+		d.Timestamp = frame.GetTimestamp().AsTime()
+	}
+	r.position++
+	return d, nil
+}
+
+func (r *v1DiffReader) Close() error {
+	return r.source.Close()
+}
+
+// writeRecordingDiff prints the diff as text or JSON.
+func writeRecordingDiff(w io.Writer, d *RecordingDiff, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(d)
+	}
+
+	fmt.Fprintf(w, "=== %s (%s) vs %s (%s), aligned by %s ===\n", d.A, d.FormatA, d.B, d.FormatB, d.Align)
+
+	if len(d.Differences) > 0 {
+		fmt.Fprintln(w, "\nField differences:")
+		for _, diff := range d.Differences {
+			fmt.Fprintf(w, "  frame %d/%d  %s\n", diff.FrameA, diff.FrameB, describeFieldDifference(diff.Difference))
+		}
+		if more := d.FieldDiffs - len(d.Differences); more > 0 {
+			fmt.Fprintf(w, "  ... and %d more\n", more)
+		}
+	}
+
+	if len(d.Events) > 0 {
+		fmt.Fprintln(w, "\nEvent differences:")
+		for _, e := range d.Events {
+			var parts []string
+			if len(e.OnlyA) > 0 {
+				parts = append(parts, "only in a: "+strings.Join(e.OnlyA, ", "))
+			}
+			if len(e.OnlyB) > 0 {
+				parts = append(parts, "only in b: "+strings.Join(e.OnlyB, ", "))
+			}
+			fmt.Fprintf(w, "  frame %d/%d  %s\n", e.FrameA, e.FrameB, strings.Join(parts, "; "))
+		}
+		if more := d.EventDiffs - len(d.Events); more > 0 {
+			fmt.Fprintf(w, "  ... and %d more\n", more)
+		}
+	}
+
+	writeRuns := func(title string, runs []FrameRun) {
+		if len(runs) == 0 {
+			return
+		}
+		fmt.Fprintf(w, "\n%s:\n", title)
+		for i, run := range runs {
+			if i == d.maxList {
+				fmt.Fprintf(w, "  ... and %d more runs\n", len(runs)-i)
+				break
+			}
+			if run.First == run.Last {
+				fmt.Fprintf(w, "  frame %d\n", run.First)
+			} else {
+				fmt.Fprintf(w, "  frames %d-%d (%d)\n", run.First, run.Last, run.Last-run.First+1)
+			}
+		}
+	}
+	writeRuns("Frames only in a", d.MissingRanges)
+	writeRuns("Frames only in b", d.ExtraRanges)
+
+	fmt.Fprintln(w, "\nSummary:")
+	fmt.Fprintf(w, "  Frames:           a %d, b %d, paired %d%s\n", d.FramesA, d.FramesB, d.Matched, percentOf(d.Matched, max(d.FramesA, d.FramesB)))
+	fmt.Fprintf(w, "  Only in a:        %d frames in %d runs\n", d.Missing, len(d.MissingRanges))
+	fmt.Fprintf(w, "  Only in b:        %d frames in %d runs\n", d.Extra, len(d.ExtraRanges))
+	fmt.Fprintf(w, "  Differing:        %d paired frames%s, %d field differences, %d event list differences\n",
+		d.FramesDiffering, percentOf(d.FramesDiffering, d.Matched), d.FieldDiffs, d.EventDiffs)
+	if d.Matched > 0 {
+		fmt.Fprintf(w, "  Timestamp skew:   mean %v, max %v\n", secondsDuration(d.MeanSkew), secondsDuration(d.MaxSkew))
+	}
+	if len(d.Fields) > 0 {
+		fmt.Fprintln(w, "  Most divergent fields:")
+		for _, field := range d.Fields[:min(len(d.Fields), maxListedFields)] {
+			delta := ""
+			if field.MaxDelta > 0 {
+				delta = fmt.Sprintf("  max delta %g", field.MaxDelta)
+			}
+			fmt.Fprintf(w, "    %-50s %8d%s\n", field.Path, field.Count, delta)
+		}
+	}
+	if !d.Differs() {
+		fmt.Fprintln(w, "\nRecordings match.")
+	}
+	return nil
+}
+
+// describeFieldDifference renders a difference with a and b named after the
+// two recordings.
+func describeFieldDifference(d jsondiff.Difference) string {
+	switch d.Kind {
+	case jsondiff.KindMissing:
+		return fmt.Sprintf("%s: only in a (%s)", d.Path, formatDiffValue(d.A))
+	case jsondiff.KindExtra:
+		return fmt.Sprintf("%s: only in b (%s)", d.Path, formatDiffValue(d.B))
+	case jsondiff.KindLength:
+		return fmt.Sprintf("%s: array length a=%v b=%v", d.Path, d.A, d.B)
+	}
+	if delta, ok := numericDelta(d); ok {
+		return fmt.Sprintf("%s: a=%s b=%s (delta %g)", d.Path, formatDiffValue(d.A), formatDiffValue(d.B), delta)
+	}
+	return fmt.Sprintf("%s: a=%s b=%s", d.Path, formatDiffValue(d.A), formatDiffValue(d.B))
+}
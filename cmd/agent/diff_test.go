@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/echotools/nevr-agent/v4/internal/jsondiff"
+)
+
+// sliceDiffReader serves prepared frames.
+type sliceDiffReader struct {
+	frames []*diffFrame
+}
+
+func (r *sliceDiffReader) next() (*diffFrame, error) {
+	if len(r.frames) == 0 {
+		return nil, io.EOF
+	}
+	frame := r.frames[0]
+	r.frames = r.frames[1:]
+	return frame, nil
+}
+
+// diffFrames builds frames at the given millisecond offsets, with the disc x
+// position from discX.
+func diffFrames(offsetsMs []int, discX func(i int) float64) []*diffFrame {
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	frames := make([]*diffFrame, len(offsetsMs))
+	for i, ms := range offsetsMs {
+		frames[i] = &diffFrame{
+			Position:  i,
+			Timestamp: start.Add(time.Duration(ms) * time.Millisecond),
+			Round:     1,
+			Clock:     300 - float64(ms)/1000,
+			Doc:       fmt.Appendf(nil, `{"frame_index": %d, "session": {"disc": {"position": [%g, 0, 0]}}}`, i, discX(i)),
+		}
+	}
+	return frames
+}
+
+func runAlign(t *testing.T, a, b []*diffFrame, opts diffOptions) *RecordingDiff {
+	t.Helper()
+	if opts.MaxReported == 0 {
+		opts.MaxReported = 50
+	}
+	result := newRecordingDiff("a.echoreplay", "b.tape", opts.Align, opts.MaxReported)
+	if err := alignFrames(&sliceDiffReader{a}, &sliceDiffReader{b}, opts, result); err != nil {
+		t.Fatal(err)
+	}
+	result.finish()
+	return result
+}
+
+func TestAlignFrames_Timestamp(t *testing.T) {
+	same := func(int) float64 { return 1 }
+	// b is missing the frames at 66 and 100 ms, has an extra one at 120 ms
+	// and is recorded 2 ms later
+	a := diffFrames([]int{0, 33, 66, 100, 133}, same)
+	b := diffFrames([]int{2, 35, 120, 135}, same)
+
+	result := runAlign(t, a, b, diffOptions{Align: alignTimestamp, MaxSkew: 5 * time.Millisecond, Ignore: []string{"frame_index"}})
+	if result.FramesA != 5 || result.FramesB != 4 || result.Matched != 3 {
+		t.Errorf("frames a %d, b %d, matched %d", result.FramesA, result.FramesB, result.Matched)
+	}
+	if !slices.Equal(result.MissingRanges, []FrameRun{{2, 3}}) || result.Missing != 2 {
+		t.Errorf("missing = %d %v", result.Missing, result.MissingRanges)
+	}
+	if !slices.Equal(result.ExtraRanges, []FrameRun{{2, 2}}) || result.Extra != 1 {
+		t.Errorf("extra = %d %v", result.Extra, result.ExtraRanges)
+	}
+	if result.FramesDiffering != 0 {
+		t.Errorf("paired frames differ: %+v", result.Differences)
+	}
+	if result.MaxSkew != 0.002 || result.MeanSkew != 0.002 {
+		t.Errorf("skew mean %v, max %v; want 2ms", result.MeanSkew, result.MaxSkew)
+	}
+	if !result.Differs() {
+		t.Error("Differs() = false with missing frames")
+	}
+}
+
+func TestAlignFrames_FieldAndEventDifferences(t *testing.T) {
+	a := diffFrames([]int{0, 10, 20}, func(i int) float64 { return float64(i) })
+	b := diffFrames([]int{0, 10, 20}, func(i int) float64 { return float64(i) + 0.5*float64(i%2) })
+	a[2].Events = []string{"DiscThrown", "GoalScored"}
+	b[2].Events = []string{"GoalScored", "PlayerSave"}
+
+	result := runAlign(t, a, b, diffOptions{Align: alignFrame, Compare: jsondiff.Options{Tolerance: 1e-6}, Ignore: []string{"frame_index"}})
+	if result.Matched != 3 || result.FramesDiffering != 2 || result.FieldDiffs != 1 || result.EventDiffs != 1 {
+		t.Fatalf("matched %d, differing %d, fields %d, events %d", result.Matched, result.FramesDiffering, result.FieldDiffs, result.EventDiffs)
+	}
+	if d := result.Differences[0]; d.FrameA != 1 || d.Path != "session.disc.position[0]" {
+		t.Errorf("difference = %+v", d)
+	}
+	if want := []FieldDivergence{{Path: "session.disc.position[]", Count: 1, MaxDelta: 0.5}}; !slices.Equal(result.Fields, want) {
+		t.Errorf("fields = %+v, want %+v", result.Fields, want)
+	}
+	if e := result.Events[0]; e.FrameA != 2 || !slices.Equal(e.OnlyA, []string{"DiscThrown"}) || !slices.Equal(e.OnlyB, []string{"PlayerSave"}) {
+		t.Errorf("event difference = %+v", e)
+	}
+
+	// A field tolerance hides the position drift
+	tolerant := diffOptions{Align: alignFrame, Compare: jsondiff.Options{FieldTolerances: map[string]float64{"position": 0.5}}, Ignore: []string{"frame_index"}}
+	a = diffFrames([]int{0, 10, 20}, func(i int) float64 { return float64(i) })
+	b = diffFrames([]int{0, 10, 20}, func(i int) float64 { return float64(i) + 0.5*float64(i%2) })
+	if result := runAlign(t, a, b, tolerant); result.Differs() {
+		t.Errorf("differences within the field tolerance: %+v", result.Differences)
+	}
+}
+
+func TestAlignFrames_IgnoredFields(t *testing.T) {
+	same := func(int) float64 { return 0 }
+	a := diffFrames([]int{0, 10}, same)
+	b := diffFrames([]int{0, 10}, same)
+	b[1].Doc = []byte(`{"frame_index": 7, "session": {"disc": {"position": [0, 0, 0]}}}`)
+
+	if result := runAlign(t, a, b, diffOptions{Align: alignFrame, Ignore: []string{"frame_index"}}); result.Differs() {
+		t.Errorf("ignored field reported: %+v", result.Differences)
+	}
+	if result := runAlign(t, diffFrames([]int{0, 10}, same), b, diffOptions{Align: alignFrame}); result.FieldDiffs != 1 {
+		t.Errorf("field differences = %d, want 1 without --ignore", result.FieldDiffs)
+	}
+}
+
+func TestCompareAligned_Clock(t *testing.T) {
+	skew := 50 * time.Millisecond
+	tests := []struct {
+		aRound, bRound int
+		aClock, bClock float64
+		want           int
+	}{
+		{1, 1, 120.00, 120.03, 0},
+		{1, 1, 120.0, 119.5, -1}, // a is earlier in the round
+		{1, 1, 119.5, 120.0, 1},
+		{1, 2, 10, 300, -1},
+		{3, 2, 300, 10, 1},
+	}
+	for _, tt := range tests {
+		a := &diffFrame{Round: tt.aRound, Clock: tt.aClock}
+		b := &diffFrame{Round: tt.bRound, Clock: tt.bClock}
+		got := compareAligned(a, b, alignClock, skew)
+		if (got < 0) != (tt.want < 0) || (got > 0) != (tt.want > 0) {
+			t.Errorf("compareAligned(round %d %v, round %d %v) = %d, want sign of %d", tt.aRound, tt.aClock, tt.bRound, tt.bClock, got, tt.want)
+		}
+	}
+}
+
+func TestEventListDifference(t *testing.T) {
+	onlyA, onlyB := eventListDifference(
+		[]string{"DiscCaught", "DiscCaught", "GoalScored"},
+		[]string{"GoalScored", "DiscCaught", "PlayerStun"},
+	)
+	if !slices.Equal(onlyA, []string{"DiscCaught"}) || !slices.Equal(onlyB, []string{"PlayerStun"}) {
+		t.Errorf("only a %v, only b %v", onlyA, onlyB)
+	}
+}
+
+func TestIgnoredPath(t *testing.T) {
+	ignore := []string{"frame_index", "ping"}
+	for path, want := range map[string]bool{
+		"frame_index":                          true,
+		"session.teams[0].players[2].ping":     true,
+		"session.teams[0].players[2].position": false,
+		"session.ping_history[3]":              false,
+	} {
+		if got := ignoredPath(path, ignore); got != want {
+			t.Errorf("ignoredPath(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestWriteRecordingDiff_Text(t *testing.T) {
+	a := diffFrames([]int{0, 10, 20, 30}, func(i int) float64 { return float64(i) })
+	b := diffFrames([]int{0, 10, 30}, func(i int) float64 { return float64(i) * 2 })
+	result := runAlign(t, a, b, diffOptions{Align: alignTimestamp, Ignore: []string{"frame_index"}})
+
+	var out bytes.Buffer
+	if err := writeRecordingDiff(&out, result, "text"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"a.echoreplay (", "aligned by timestamp",
+		"frame 1/1  session.disc.position[0]: a=1 b=2 (delta 1)",
+		"Frames only in a:\n  frame 2\n",
+		"a 4, b 3, paired 3 (75.0%)",
+		"Only in a:        1 frames in 1 runs",
+		"session.disc.position[]",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
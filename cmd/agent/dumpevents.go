@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -22,6 +21,12 @@ import (
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+var (
+	showFilterFlags  showFilterOptions
+	showReportFormat string
+	showCheckFlags   eventCheckOptions
+)
+
 func newDumpEventsCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "show <replay-file> [output-format]",
@@ -37,8 +42,49 @@ Supported file formats:
 
 Output formats:
   json     - JSON format (default)
+  jsonl    - One compact JSON object per line
   text     - Human-readable text format
-  summary  - Event summary statistics`,
+  summary  - Event summary statistics
+  stats    - Per-player and per-team box score (see --format)
+  timeline - Play-by-play grouped by round, keyed to the game clock (see --format)
+  check    - Re-detect events and compare them with the stored events (see below)
+
+Filters can be combined and an event is shown only if it matches all of them:
+  --type      Event types, e.g. GoalScored,PlayerSave
+  --player    Player display name or account ID
+  --team      blue, orange or spectator
+  --round     Round number, counted from 1 like ` + "`agent slice`" + `
+  --frames    Zero-based frame range, inclusive (e.g. 1200:4800, 1200:, :4800)
+  --clock     Game clock window, e.g. 5:00-2:30 (the clock counts down)
+  --status    Game statuses, e.g. playing,score
+
+Player and team filters match events that refer to a player by name, account
+ID or slot, resolved against the team lists of the event's frame. Summary
+statistics count only the events that pass the filters.
+
+The stats box score lists goals, assists, saves, stuns, steals, blocks,
+interceptions, passes, shots taken, shooting percentage, possession time, time
+played and average speed, read from the per-player data in every frame. The
+frame filters (--frames, --round, --clock, --status) select the frames counted,
+and --player and --team select the rows listed.
+
+The timeline lists each event with the game clock, the score at the time, the
+team and the players involved (thrower, catcher, scorer, stunned player, ...),
+followed by details such as throw speed or goal distance. Each round ends with
+its result, and the timeline with the match result.
+
+The check mode runs the current event detector over the recording's frames and
+compares its output with the events stored in the recording, or with a golden
+file given by --golden (a JSON array or JSON lines with event_type and
+frame_index, as written by the json and jsonl modes or by --write-golden).
+Events of the same type on the same frame match; unmatched events at most
+--tolerance frames apart are reported as shifted, and the rest as missing
+(in the reference only) or added (detected only). The command exits with
+status 2 if anything differs. Only --type and --frames apply to check output.
+.echoreplay files store no events and need --golden.
+
+--format selects text, json or csv (stats only) for stats, timeline and check
+output.`,
 		Example: `  # Output events as JSON (default)
   agent show game.echoreplay
 
@@ -46,11 +92,42 @@ Output formats:
   agent show game.nevrcap text
 
   # Show event summary statistics
-  agent show game.echoreplay summary`,
+  agent show game.echoreplay summary
+
+  # Goals and saves by one player in round 2, one JSON object per line
+  agent show game.tape jsonl --type GoalScored,PlayerSave --player Echo --round 2
+
+  # Orange team events in the last minute of game clock
+  agent show game.echoreplay text --team orange --clock 1:00-0:00
+
+  # Box score of round 2 as CSV
+  agent show game.tape stats --round 2 --format csv > round2.csv
+
+  # Printable play-by-play of goals, saves and stuns
+  agent show game.echoreplay timeline --type GoalScored,PlayerSave,PlayerStun
+
+  # Check the detector against the events recorded in a capture
+  agent show game.nevrcap check --tolerance 2
+
+  # Save a golden event file, then check a later detector build against it
+  agent show game.echoreplay check --write-golden game.events.jsonl
+  agent show game.echoreplay check --golden game.events.jsonl`,
 		Args: cobra.RangeArgs(1, 2),
 		RunE: runDumpEvents,
 	}
 
+	cmd.Flags().StringSliceVar(&showFilterFlags.Types, "type", nil, "Event types to show (comma-separated)")
+	cmd.Flags().StringVar(&showFilterFlags.Player, "player", "", "Only events involving this player (display name or account ID)")
+	cmd.Flags().StringVar(&showFilterFlags.Team, "team", "", "Only events involving this team (blue, orange, spectator)")
+	cmd.Flags().IntVar(&showFilterFlags.Round, "round", 0, "Only events in this round (1-based)")
+	cmd.Flags().StringVar(&showFilterFlags.Frames, "frames", "", "Frame range START:END, zero-based and inclusive")
+	cmd.Flags().StringVar(&showFilterFlags.Clock, "clock", "", "Game clock window START-END, e.g. 5:00-2:30")
+	cmd.Flags().StringSliceVar(&showFilterFlags.Statuses, "status", nil, "Game statuses to show (comma-separated)")
+	cmd.Flags().StringVar(&showReportFormat, "format", "text", "Format of stats, timeline and check output: text, json or csv (stats only)")
+	cmd.Flags().StringVar(&showCheckFlags.Golden, "golden", "", "Golden event file to check against instead of the stored events")
+	cmd.Flags().StringVar(&showCheckFlags.WriteGolden, "write-golden", "", "Write the re-detected events to this golden file instead of checking")
+	cmd.Flags().IntVar(&showCheckFlags.Tolerance, "tolerance", 0, "Frames an event may move and still count as shifted rather than missing and added")
+
 	return cmd
 }
 
@@ -80,8 +157,44 @@ func runDumpEvents(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("file must have .tape, .echoreplay, .nevrcap (or .uncompressed variants) extension, got: %s", filename)
 	}
 
+	// Validate output format up front; filtered runs may never reach an event
+	switch outputFormat {
+	case "json", "jsonl", "text", "summary", "stats", "timeline", "check":
+	default:
+		return fmt.Errorf("unsupported output format: %s", outputFormat)
+	}
+
+	filter, err := newEventFilter(showFilterFlags)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case showReportFormat == "csv" && (outputFormat == "timeline" || outputFormat == "check"):
+		return fmt.Errorf("csv format is only supported for stats output")
+	case showReportFormat != "text" && showReportFormat != "json" && showReportFormat != "csv":
+		return fmt.Errorf("unsupported format: %s (must be text, json or csv)", showReportFormat)
+	}
+
+	if outputFormat == "stats" {
+		if filter.types != nil {
+			return fmt.Errorf("--type does not apply to stats output")
+		}
+		score, err := buildBoxScore(filename, filter)
+		if err != nil {
+			return err
+		}
+		return writeBoxScore(os.Stdout, score, showReportFormat)
+	}
+
+	if outputFormat == "check" {
+		opts := showCheckFlags
+		opts.Format = showReportFormat
+		return runEventCheck(filename, filter, opts)
+	}
+
 	// Process the file and output events
-	return processReplayFile(filename, outputFormat)
+	return processReplayFile(filename, outputFormat, filter)
 }
 
 // frameReader is a common interface for reading frames from different file formats
@@ -90,9 +203,9 @@ type frameReader interface {
 	Close() error
 }
 
-func processReplayFile(filename, outputFormat string) error {
+func processReplayFile(filename, outputFormat string, filter *eventFilter) error {
 	if strings.HasSuffix(strings.ToLower(filename), ".tape") {
-		return processTapeFile(filename, outputFormat)
+		return processTapeFile(filename, outputFormat, filter)
 	}
 
 	// Open the replay file based on extension
@@ -123,27 +236,43 @@ func processReplayFile(filename, outputFormat string) error {
 
 	// Statistics for summary mode
 	eventStats := make(map[string]int)
+	timeline := newTimelineBuilder(filename)
 	frameCount := 0
 	var startTime, endTime *timestamppb.Timestamp
 
 	var (
 		frameMu         sync.RWMutex
 		currentFrame    *telemetry.LobbySessionStateFrame
+		currentRound    int
+		rounds          roundTracker
 		eventsWG        sync.WaitGroup
 		eventErrChan    = make(chan error, 1)
 		eventHandlerErr error
 	)
 
-	handleEvent := func(event *telemetry.LobbySessionEvent, frame *telemetry.LobbySessionStateFrame) error {
+	handleEvent := func(event *telemetry.LobbySessionEvent, frame *telemetry.LobbySessionStateFrame, round int) error {
+		if !filter.match(showEvent{
+			typeName:   getEventTypeName(event),
+			event:      event,
+			frameIndex: int(frame.GetFrameIndex()),
+			frame:      frame,
+			round:      round,
+		}) {
+			return nil
+		}
+
 		switch outputFormat {
-		case "json":
-			return outputEventJSON(event, frame)
+		case "json", "jsonl":
+			return outputEventJSON(event, frame, outputFormat)
 		case "text":
 			outputEventText(event, frame)
 			return nil
 		case "summary":
 			updateEventStats(event, eventStats)
 			return nil
+		case "timeline":
+			timeline.add(getEventTypeName(event), event, frame, round)
+			return nil
 		default:
 			return fmt.Errorf("unsupported output format: %s", outputFormat)
 		}
@@ -155,10 +284,11 @@ func processReplayFile(filename, outputFormat string) error {
 		for events := range detector.EventsChan() {
 			frameMu.RLock()
 			frameSnapshot := currentFrame
+			roundSnapshot := currentRound
 			frameMu.RUnlock()
 
 			for _, event := range events {
-				if err := handleEvent(event, frameSnapshot); err != nil {
+				if err := handleEvent(event, frameSnapshot, roundSnapshot); err != nil {
 					select {
 					case eventErrChan <- err:
 					default:
@@ -214,8 +344,11 @@ func processReplayFile(filename, outputFormat string) error {
 			startTime = frame.Timestamp
 		}
 
+		rounds.track(frame.GetSession().GetGameStatus())
+
 		frameMu.Lock()
 		currentFrame = frame
+		currentRound = rounds.round
 		frameMu.Unlock()
 
 		// Queue frame for async detection
@@ -231,14 +364,17 @@ func processReplayFile(filename, outputFormat string) error {
 	}
 
 	// Output summary if requested
-	if outputFormat == "summary" {
+	switch outputFormat {
+	case "summary":
 		outputSummary(eventStats, frameCount, startTime.AsTime(), endTime.AsTime(), filename)
+	case "timeline":
+		return writeTimeline(os.Stdout, timeline.finish(), showReportFormat)
 	}
 
 	return nil
 }
 
-func outputEventJSON(event *telemetry.LobbySessionEvent, frame *telemetry.LobbySessionStateFrame) error {
+func outputEventJSON(event *telemetry.LobbySessionEvent, frame *telemetry.LobbySessionStateFrame, outputFormat string) error {
 	// Create a structured output with event and frame context
 	output := map[string]any{
 		"event_type": getEventTypeName(event),
@@ -255,8 +391,16 @@ func outputEventJSON(event *telemetry.LobbySessionEvent, frame *telemetry.LobbyS
 		}
 	}
 
+	return encodeEventJSON(output, outputFormat)
+}
+
+// encodeEventJSON writes one event to stdout, indented for "json" and on a
+// single line for "jsonl".
+func encodeEventJSON(output map[string]any, outputFormat string) error {
 	encoder := json.NewEncoder(os.Stdout)
-	encoder.SetIndent("", "  ")
+	if outputFormat == "json" {
+		encoder.SetIndent("", "  ")
+	}
 	return encoder.Encode(output)
 }
 
@@ -406,9 +550,7 @@ func getEventTypeName(event *telemetry.LobbySessionEvent) string {
 
 // uncompressedEchoReplayReader reads uncompressed echoreplay files (plain text format)
 type uncompressedEchoReplayReader struct {
-	file    *os.File
-	scanner *bufio.Scanner
-	codec   *codec.EchoReplay
+	source *echoReplayLineSource
 }
 
 func newUncompressedEchoReplayReader(filename string) (*uncompressedEchoReplayReader, error) {
@@ -417,34 +559,21 @@ func newUncompressedEchoReplayReader(filename string) (*uncompressedEchoReplayRe
 		return nil, err
 	}
 
-	return &uncompressedEchoReplayReader{
-		file:    file,
-		scanner: bufio.NewScanner(file),
-	}, nil
+	return &uncompressedEchoReplayReader{source: newEchoReplayLineSource(file, nil)}, nil
 }
 
 func (r *uncompressedEchoReplayReader) ReadFrameTo(frame *telemetry.LobbySessionStateFrame) (bool, error) {
-	// EchoReplay format is tab-separated: timestamp\tsession_json\t player_bones_json
-	// This is a simplified parser - for full support would need to reuse codec parsing
-	if !r.scanner.Scan() {
-		if err := r.scanner.Err(); err != nil {
-			return false, err
-		}
-		return false, io.EOF
-	}
-
-	// Create a temporary codec for parsing if needed
-	if r.codec == nil {
-		// Use the codec's internal parsing via a workaround
-		// For now, return that we read a frame but it may not be fully parsed
-		return true, fmt.Errorf("uncompressed echoreplay parsing not fully implemented")
+	decoded, err := r.source.ReadFrame()
+	if err != nil {
+		return false, err
 	}
-
+	proto.Reset(frame)
+	proto.Merge(frame, decoded)
 	return true, nil
 }
 
 func (r *uncompressedEchoReplayReader) Close() error {
-	return r.file.Close()
+	return r.source.Close()
 }
 
 // uncompressedNevrCapReader reads uncompressed nevrcap files (raw protobuf without zstd)
@@ -537,7 +666,7 @@ func (r *uncompressedNevrCapReader) Close() error {
 	return r.file.Close()
 }
 
-func processTapeFile(filename, outputFormat string) error {
+func processTapeFile(filename, outputFormat string, filter *eventFilter) error {
 	reader, err := codec.NewReader(filename)
 	if err != nil {
 		return fmt.Errorf("processTapeFile: open reader: %w", err)
@@ -550,9 +679,17 @@ func processTapeFile(filename, outputFormat string) error {
 	}
 
 	eventStats := make(map[string]int)
+	timeline := newTimelineBuilder(filename)
 	frameCount := 0
 	var firstTimestampMs, lastTimestampMs uint32
 
+	// Filters on frame state and the timeline see the same v1 session view as v1 inputs
+	var mapper *tapeFrameMapper
+	var rounds roundTracker
+	if filter.needsFrame() || outputFormat == "timeline" {
+		mapper = newTapeFrameMapper(header, newLossReport(filename, ""))
+	}
+
 	for {
 		frame, err := reader.ReadFrame()
 		if err != nil {
@@ -568,6 +705,12 @@ func processTapeFile(filename, outputFormat string) error {
 			firstTimestampMs = frame.GetTimestampOffsetMs()
 		}
 
+		var v1Frame *telemetry.LobbySessionStateFrame
+		if mapper != nil {
+			v1Frame = mapper.mapFrame(frame)
+			rounds.track(v1Frame.GetSession().GetGameStatus())
+		}
+
 		ea := frame.GetEchoArena()
 		if ea == nil {
 			continue
@@ -575,9 +718,18 @@ func processTapeFile(filename, outputFormat string) error {
 
 		for _, evt := range ea.GetEvents() {
 			eventType := getV2EventTypeName(evt)
+			if !filter.match(showEvent{
+				typeName:   eventType,
+				event:      evt,
+				frameIndex: int(frame.GetFrameIndex()),
+				frame:      v1Frame,
+				round:      rounds.round,
+			}) {
+				continue
+			}
 
 			switch outputFormat {
-			case "json":
+			case "json", "jsonl":
 				output := map[string]any{
 					"event_type":   eventType,
 					"event_data":   evt,
@@ -585,9 +737,7 @@ func processTapeFile(filename, outputFormat string) error {
 					"timestamp_ms": frame.GetTimestampOffsetMs(),
 					"game_status":  ea.GetGameStatus().String(),
 				}
-				encoder := json.NewEncoder(os.Stdout)
-				encoder.SetIndent("", "  ")
-				if err := encoder.Encode(output); err != nil {
+				if err := encodeEventJSON(output, outputFormat); err != nil {
 					return fmt.Errorf("processTapeFile: encode json: %w", err)
 				}
 			case "text":
@@ -598,14 +748,19 @@ func processTapeFile(filename, outputFormat string) error {
 					ea.GetGameStatus().String())
 			case "summary":
 				eventStats[eventType]++
+			case "timeline":
+				timeline.add(eventType, evt, v1Frame, rounds.round)
 			default:
 				return fmt.Errorf("processTapeFile: unsupported output format: %s", outputFormat)
 			}
 		}
 	}
 
-	if outputFormat == "summary" {
+	switch outputFormat {
+	case "summary":
 		outputTapeSummary(eventStats, frameCount, lastTimestampMs-firstTimestampMs, header, filename)
+	case "timeline":
+		return writeTimeline(os.Stdout, timeline.finish(), showReportFormat)
 	}
 
 	return nil
@@ -0,0 +1,625 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	capturepb "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v2"
+	"github.com/echotools/nevr-agent/v4/internal/agent"
+	"github.com/echotools/tape/pkg/codec"
+	"github.com/echotools/tape/pkg/conversion"
+	"google.golang.org/protobuf/proto"
+)
+
+// v1FrameSource reads v1 frames from any supported replay format.
+type v1FrameSource interface {
+	// Header returns the capture header, or nil if the format has none.
+	Header() *telemetry.TelemetryHeader
+	// ReadFrame returns io.EOF after the last frame.
+	ReadFrame() (*telemetry.LobbySessionStateFrame, error)
+	Close() error
+}
+
+// openV1FrameSource opens a .echoreplay, .nevrcap or .tape file. Fields of
+// .tape frames without a v1 equivalent are recorded in report, which may be nil.
+func openV1FrameSource(filename string, report *LossReport) (v1FrameSource, error) {
+	switch detectInputFormat(filename) {
+	case "echoreplay":
+		reader, err := codec.NewEchoReplayReader(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open echoreplay file: %w", err)
+		}
+		return &echoReplaySource{reader: reader}, nil
+
+	case "nevrcap":
+		reader, err := codec.NewLegacyReader(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open nevrcap file: %w", err)
+		}
+		header, err := reader.ReadHeader()
+		if err != nil {
+			reader.Close()
+			return nil, fmt.Errorf("failed to read nevrcap header: %w", err)
+		}
+		return &nevrcapSource{reader: reader, header: header}, nil
+
+	case "tape":
+		return newTapeV1Reader(filename, report)
+
+	case echoReplayUncompressed:
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open echoreplay file: %w", err)
+		}
+		return newEchoReplayLineSource(file, nil), nil
+
+	case nevrcapUncompressed:
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open nevrcap file: %w", err)
+		}
+		reader := agent.NewUncompressedLegacyStreamReader(file)
+		header, err := reader.ReadHeader()
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to read nevrcap header: %w", err)
+		}
+		return &nevrcapSource{reader: reader, header: header, file: file}, nil
+
+	default:
+		return nil, fmt.Errorf("%w: unsupported file format: %s", errUnsupportedConversion, filename)
+	}
+}
+
+// eventFrame is a v1 frame with the events stored in it moved out of the
+// frame.
+type eventFrame struct {
+	Frame  *telemetry.LobbySessionStateFrame
+	Events []proto.Message
+	Types  []string // event type names, parallel to Events
+
+	// V1Events are the events in v1 form: the stored events of v1 formats, or
+	// those mapped from the capture events of a .tape file. Not every capture
+	// event has a v1 form.
+	V1Events []*telemetry.LobbySessionEvent
+
+	// Native is the frame as stored in a .tape file, nil for other formats.
+	Native *capturepb.CaptureFrame
+}
+
+// eventFrameSource reads v1 frames from any supported format together with
+// their stored events. Capture v2 events have no v1 form, so for .tape files
+// they are taken from the native frames before mapping.
+type eventFrameSource struct {
+	source v1FrameSource
+	tape   *codec.Reader
+	header *capturepb.CaptureHeader
+	mapper *tapeFrameMapper
+	spool  string // removed on close
+}
+
+// openEventFrameSource opens a recording of any supported format. Fields of
+// .tape frames without a v1 equivalent are recorded in report, which may be nil.
+func openEventFrameSource(filename string, report *LossReport) (*eventFrameSource, error) {
+	if detectInputFormat(filename) != "tape" {
+		source, err := openV1FrameSource(filename, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &eventFrameSource{source: source}, nil
+	}
+
+	reader, err := codec.NewReader(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tape file: %w", err)
+	}
+	header, err := reader.ReadHeader()
+	if err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("failed to read tape header: %w", err)
+	}
+	if report == nil {
+		report = newLossReport(filename, "")
+	}
+	return &eventFrameSource{tape: reader, header: header, mapper: newTapeFrameMapper(header, report)}, nil
+}
+
+// Header returns the capture header in v1 form, or nil if the format has none.
+func (s *eventFrameSource) Header() *telemetry.TelemetryHeader {
+	if s.tape != nil {
+		return s.mapper.v1Header(s.header)
+	}
+	return s.source.Header()
+}
+
+// TapeHeader returns the header of a .tape file, or nil for other formats.
+func (s *eventFrameSource) TapeHeader() *capturepb.CaptureHeader {
+	return s.header
+}
+
+// ReadFrame returns io.EOF after the last frame.
+func (s *eventFrameSource) ReadFrame() (*eventFrame, error) {
+	read := &eventFrame{}
+	if s.tape != nil {
+		native, err := s.tape.ReadFrame()
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range native.GetEchoArena().GetEvents() {
+			read.Events = append(read.Events, event)
+			read.Types = append(read.Types, getV2EventTypeName(event))
+		}
+		read.Frame = s.mapper.mapFrame(native)
+		read.V1Events = read.Frame.Events
+		read.Native = native
+	} else {
+		frame, err := s.source.ReadFrame()
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range frame.GetEvents() {
+			read.Events = append(read.Events, event)
+			read.Types = append(read.Types, getEventTypeName(event))
+		}
+		read.Frame = frame
+		read.V1Events = frame.Events
+	}
+	read.Frame.Events = nil
+	return read, nil
+}
+
+func (s *eventFrameSource) Close() error {
+	if s.spool != "" {
+		defer os.Remove(s.spool)
+	}
+	if s.tape != nil {
+		return s.tape.Close()
+	}
+	return s.source.Close()
+}
+
+// openEventStreamSource reads frames of the given format together with their
+// stored events from a stream such as stdin. .tape is spooled to a temporary
+// file so that its native frames can be read.
+func openEventStreamSource(r io.Reader, format string, report *LossReport) (*eventFrameSource, error) {
+	if format != "tape" {
+		source, err := openV1StreamSource(r, format)
+		if err != nil {
+			return nil, err
+		}
+		return &eventFrameSource{source: source}, nil
+	}
+
+	spool, err := spoolStream(r, format)
+	if err != nil {
+		return nil, err
+	}
+	source, err := openEventFrameSource(spool, report)
+	if err != nil {
+		os.Remove(spool)
+		return nil, err
+	}
+	source.spool = spool
+	return source, nil
+}
+
+// openV1StreamSource reads .nevrcap or .echoreplay frames from a stream such
+// as stdin. nevrcap is decoded as it arrives; echoreplay (a zip archive,
+// indexed at the end) is spooled to a temporary file first.
+func openV1StreamSource(r io.Reader, format string) (v1FrameSource, error) {
+	switch format {
+	case "nevrcap":
+		reader, err := agent.NewLegacyStreamReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open nevrcap stream: %w", err)
+		}
+		header, err := reader.ReadHeader()
+		if err != nil {
+			reader.Close()
+			return nil, fmt.Errorf("failed to read nevrcap header: %w", err)
+		}
+		return &nevrcapSource{reader: reader, header: header}, nil
+
+	case "echoreplay":
+		spool, err := spoolStream(r, format)
+		if err != nil {
+			return nil, err
+		}
+		source, err := openV1FrameSource(spool, nil)
+		if err != nil {
+			os.Remove(spool)
+			return nil, err
+		}
+		return &spooledSource{v1FrameSource: source, spool: spool}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported input format: %s", format)
+	}
+}
+
+// spoolStream copies r to a temporary file with the extension for format and
+// returns its path.
+func spoolStream(r io.Reader, format string) (string, error) {
+	file, err := os.CreateTemp("", "agent-stdin-*."+format)
+	if err != nil {
+		return "", fmt.Errorf("failed to create spool file: %w", err)
+	}
+	_, copyErr := io.Copy(file, r)
+	if err := errors.Join(copyErr, file.Close()); err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("failed to spool input: %w", err)
+	}
+	return file.Name(), nil
+}
+
+// spooledSource removes its spool file when closed.
+type spooledSource struct {
+	v1FrameSource
+	spool string
+}
+
+func (s *spooledSource) Close() error {
+	err := s.v1FrameSource.Close()
+	os.Remove(s.spool)
+	return err
+}
+
+type echoReplaySource struct {
+	reader *codec.EchoReplay
+}
+
+func (s *echoReplaySource) Header() *telemetry.TelemetryHeader { return nil }
+
+func (s *echoReplaySource) ReadFrame() (*telemetry.LobbySessionStateFrame, error) {
+	return s.reader.ReadFrame()
+}
+
+func (s *echoReplaySource) Close() error { return s.reader.Close() }
+
+// openEchoReplayEntry opens the frame log inside an .echoreplay archive: the
+// entry named like the archive, or else the first .echoreplay entry.
+func openEchoReplayEntry(filename string) (io.ReadCloser, error) {
+	zipReader, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open echoreplay file: %w", err)
+	}
+
+	var replayFile *zip.File
+	baseFilename := filepath.Base(filename)
+
+	for _, file := range zipReader.File {
+		if file.Name == baseFilename {
+			replayFile = file
+			break
+		}
+	}
+
+	if replayFile == nil {
+		for _, file := range zipReader.File {
+			if filepath.Ext(file.Name) == ".echoreplay" {
+				replayFile = file
+				break
+			}
+		}
+	}
+
+	if replayFile == nil {
+		zipReader.Close()
+		return nil, fmt.Errorf("no .echoreplay file found in zip")
+	}
+
+	reader, err := replayFile.Open()
+	if err != nil {
+		zipReader.Close()
+		return nil, err
+	}
+	return &zipEntryReader{ReadCloser: reader, archive: zipReader}, nil
+}
+
+// zipEntryReader closes the archive along with the entry.
+type zipEntryReader struct {
+	io.ReadCloser
+	archive *zip.ReadCloser
+}
+
+func (r *zipEntryReader) Close() error {
+	return errors.Join(r.ReadCloser.Close(), r.archive.Close())
+}
+
+// legacyFrameReader is implemented by codec.LegacyReader and
+// agent.LegacyStreamReader.
+type legacyFrameReader interface {
+	ReadFrame() (*telemetry.LobbySessionStateFrame, error)
+	Close() error
+}
+
+type nevrcapSource struct {
+	reader legacyFrameReader
+	header *telemetry.TelemetryHeader
+	file   io.Closer // underlying file, for readers that do not close it
+}
+
+func (s *nevrcapSource) Header() *telemetry.TelemetryHeader { return s.header }
+
+func (s *nevrcapSource) ReadFrame() (*telemetry.LobbySessionStateFrame, error) {
+	return s.reader.ReadFrame()
+}
+
+func (s *nevrcapSource) Close() error {
+	err := s.reader.Close()
+	if s.file != nil {
+		err = errors.Join(err, s.file.Close())
+	}
+	return err
+}
+
+// v1FrameSink writes v1 frames to a .echoreplay, .nevrcap or .tape file, or
+// to a stream in one of those formats.
+//
+// The output file is created when the first frame arrives so that the header
+// creation time and the tape base time match the first frame written. Nothing
+// is created if no frame is ever written.
+type v1FrameSink struct {
+	filename string
+	out      io.Writer // set for stream sinks instead of filename
+	format   string
+	header   *telemetry.TelemetryHeader
+
+	writeFrame func(*telemetry.LobbySessionStateFrame) error
+	closeFn    func() error
+	frames     int
+
+	// Stored .tape header and frame being written, kept as they are in .tape
+	// output instead of being mapped back from v1
+	nativeHeader *capturepb.CaptureHeader
+	native       *capturepb.CaptureFrame
+}
+
+// newV1FrameSink returns a sink for filename in the given format. The header
+// is optional; its capture ID and metadata are carried over to formats that
+// store a header.
+func newV1FrameSink(filename, format string, header *telemetry.TelemetryHeader) (*v1FrameSink, error) {
+	switch format {
+	case "echoreplay", "nevrcap", "tape":
+	default:
+		return nil, fmt.Errorf("unsupported output format: %s", format)
+	}
+	if header != nil {
+		header = proto.Clone(header).(*telemetry.TelemetryHeader)
+	}
+	return &v1FrameSink{filename: filename, format: format, header: header}, nil
+}
+
+// newV1StreamSink returns a sink that writes the given format to w, such as
+// stdout. Closing the sink does not close w.
+func newV1StreamSink(w io.Writer, format string, header *telemetry.TelemetryHeader) (*v1FrameSink, error) {
+	sink, err := newV1FrameSink("", format, header)
+	if err != nil {
+		return nil, err
+	}
+	sink.out = w
+	return sink, nil
+}
+
+// Frames returns the number of frames written so far.
+func (s *v1FrameSink) Frames() int {
+	return s.frames
+}
+
+func (s *v1FrameSink) WriteFrame(frame *telemetry.LobbySessionStateFrame) error {
+	if s.writeFrame == nil {
+		if err := s.open(frame); err != nil {
+			return err
+		}
+	}
+	if err := s.writeFrame(frame); err != nil {
+		return fmt.Errorf("failed to write frame: %w", err)
+	}
+	s.frames++
+	return nil
+}
+
+// WriteEventFrame writes a frame read by an eventFrameSource together with its
+// events. Frames of a .tape source are written to .tape output as stored, with
+// only their index and time offset moved to the output; other outputs get the
+// frame and its events in v1 form.
+func (s *v1FrameSink) WriteEventFrame(read *eventFrame) error {
+	read.Frame.Events = read.V1Events
+	s.native = read.Native
+	defer func() { s.native = nil }()
+	return s.WriteFrame(read.Frame)
+}
+
+// UseTapeHeader makes .tape output start with the header of a .tape source
+// instead of one mapped from the v1 header. The first header set before the
+// first frame is written wins.
+func (s *v1FrameSink) UseTapeHeader(header *capturepb.CaptureHeader) {
+	if header != nil && s.nativeHeader == nil && s.writeFrame == nil {
+		s.nativeHeader = proto.Clone(header).(*capturepb.CaptureHeader)
+	}
+}
+
+// tapeHeader returns the header for .tape output. A stored header keeps its
+// fields; its creation time, capture ID and the metadata added to the v1
+// header follow the output.
+func (s *v1FrameSink) tapeHeader(header *telemetry.TelemetryHeader, first *telemetry.LobbySessionStateFrame) *capturepb.CaptureHeader {
+	if s.nativeHeader == nil {
+		return conversion.MapHeaderFromSession(header, first.GetSession())
+	}
+	native := s.nativeHeader
+	native.CaptureId = header.GetCaptureId()
+	native.CreatedAt = header.GetCreatedAt()
+	if native.Metadata == nil {
+		native.Metadata = make(map[string]string)
+	}
+	for k, v := range header.GetMetadata() {
+		// converted_from is added by the v1 mapping of the source header
+		if k != "converted_from" {
+			native.Metadata[k] = v
+		}
+	}
+	return native
+}
+
+// tapeFrame returns a frame for .tape output: the stored frame being written,
+// if there is one, or else the frame mapped from v1.
+func (s *v1FrameSink) tapeFrame(mapper *conversion.FrameMapper, frame *telemetry.LobbySessionStateFrame) *capturepb.CaptureFrame {
+	mapped := mapper.MapFrame(frame)
+	if s.native == nil {
+		return mapped
+	}
+	native := proto.Clone(s.native).(*capturepb.CaptureFrame)
+	native.FrameIndex = mapped.GetFrameIndex()
+	native.TimestampOffsetMs = mapped.GetTimestampOffsetMs()
+	if arena := native.GetEchoArena(); arena != nil && frame.GetPlayerBones() == nil {
+		arena.Bones = nil
+	}
+	return native
+}
+
+func (s *v1FrameSink) open(first *telemetry.LobbySessionStateFrame) error {
+	header := s.header
+	if header == nil {
+		header = &telemetry.TelemetryHeader{}
+	}
+	if header.GetCaptureId() == "" {
+		header.CaptureId = first.GetSession().GetSessionId()
+	}
+	header.CreatedAt = first.GetTimestamp()
+
+	if s.out != nil {
+		return s.openStream(header, first)
+	}
+
+	switch s.format {
+	case "echoreplay":
+		writer, err := codec.NewEchoReplayWriter(s.filename)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		s.writeFrame, s.closeFn = writer.WriteFrame, writer.Close
+
+	case "nevrcap":
+		writer, err := agent.NewLegacyWriter(s.filename)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			writer.Close()
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+		s.writeFrame, s.closeFn = writer.WriteFrame, writer.Close
+
+	case "tape":
+		writer, err := codec.NewWriter(s.filename)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		if err := writer.WriteHeader(s.tapeHeader(header, first)); err != nil {
+			writer.Close()
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+		mapper := conversion.FrameMapper{BaseTime: first.GetTimestamp().AsTime()}
+		s.writeFrame = func(frame *telemetry.LobbySessionStateFrame) error {
+			return writer.WriteFrame(s.tapeFrame(&mapper, frame))
+		}
+		s.closeFn = writer.Close
+	}
+	return nil
+}
+
+func (s *v1FrameSink) openStream(header *telemetry.TelemetryHeader, first *telemetry.LobbySessionStateFrame) error {
+	switch s.format {
+	case "echoreplay":
+		name := header.GetCaptureId()
+		if name == "" {
+			name = "stream"
+		}
+		writer, err := agent.NewEchoReplayStreamWriter(s.out, name+".echoreplay")
+		if err != nil {
+			return fmt.Errorf("failed to create output stream: %w", err)
+		}
+		s.writeFrame, s.closeFn = writer.WriteFrame, writer.Close
+
+	case "nevrcap":
+		writer, err := agent.NewLegacyStreamWriter(s.out)
+		if err != nil {
+			return fmt.Errorf("failed to create output stream: %w", err)
+		}
+		if err := writer.WriteHeader(header); err != nil {
+			writer.Close()
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+		s.writeFrame, s.closeFn = writer.WriteFrame, writer.Close
+
+	case "tape":
+		// The tape writer needs a file, so write one and copy it out on close
+		file, err := os.CreateTemp("", "agent-stdout-*.tape")
+		if err != nil {
+			return fmt.Errorf("failed to create spool file: %w", err)
+		}
+		spool := file.Name()
+		file.Close()
+
+		writer, err := codec.NewWriter(spool)
+		if err != nil {
+			os.Remove(spool)
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		if err := writer.WriteHeader(s.tapeHeader(header, first)); err != nil {
+			writer.Close()
+			os.Remove(spool)
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+		mapper := conversion.FrameMapper{BaseTime: first.GetTimestamp().AsTime()}
+		s.writeFrame = func(frame *telemetry.LobbySessionStateFrame) error {
+			return writer.WriteFrame(s.tapeFrame(&mapper, frame))
+		}
+		s.closeFn = func() error {
+			defer os.Remove(spool)
+			if err := writer.Close(); err != nil {
+				return err
+			}
+			return copyToStream(s.out, spool)
+		}
+	}
+	return nil
+}
+
+func copyToStream(w io.Writer, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// Close flushes and closes the output file, if one was created.
+func (s *v1FrameSink) Close() error {
+	if s.closeFn == nil {
+		return nil
+	}
+	closeFn := s.closeFn
+	s.closeFn = nil
+	if err := closeFn(); err != nil {
+		return fmt.Errorf("failed to close output file: %w", err)
+	}
+	return nil
+}
+
+// Abort closes the sink and removes any partially written output.
+func (s *v1FrameSink) Abort() {
+	if s.closeFn != nil {
+		s.Close()
+		if s.out == nil {
+			os.Remove(s.filename)
+		}
+	}
+}
@@ -0,0 +1,640 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	capturepb "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v2"
+	"github.com/echotools/tape/pkg/events"
+	"github.com/echotools/tape/pkg/processing"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	heatmapOutputDir  string
+	heatmapMaps       []string
+	heatmapFrom       time.Duration
+	heatmapTo         time.Duration
+	heatmapFrames     string
+	heatmapRound      int
+	heatmapClock      string
+	heatmapStatuses   []string
+	heatmapProjection string
+	heatmapBounds     string
+	heatmapResolution float64
+	heatmapBlur       float64
+	heatmapOverwrite  bool
+)
+
+// heatmapKinds are the maps `agent heatmap` can draw.
+var heatmapKinds = []string{"combined", "teams", "players", "disc", "shots"}
+
+func newHeatmapCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "heatmap <recording>",
+		Short: "Draw PNG heatmaps of player and disc positions",
+		Long: `The heatmap command draws PNG heatmaps of where players and the disc were
+during a recording. Input may be any of .echoreplay, .nevrcap or .tape.
+
+Maps (--maps, all by default):
+  combined   All players on both teams        → combined.png
+  teams      One map per team                 → team_blue.png, team_orange.png
+  players    One map per player               → player_<name>.png
+  disc       Disc positions                   → disc.png
+  shots      Where each shot was taken from   → shots.png
+
+Frames are selected like ` + "`agent slice`" + ` (--from/--to, --frames, --round,
+--clock) and by game status (--status, "playing" by default; "any" keeps every
+frame). Player positions are body positions, falling back to the head.
+
+The arena is projected onto the image plane with --projection:
+  top    Looking down on the arena, goals at the top and bottom (x, z)
+  side   Looking from the side wall, goals left and right (z, y)
+  end    Looking from behind a goal (x, y)
+--bounds overrides the projected area as MIN_U,MAX_U,MIN_V,MAX_V in meters, and
+--resolution sets the pixels per meter.`,
+		Example: `  # All maps for a match
+  agent heatmap scrim.echoreplay
+
+  # Team maps for round 2 from the side, at 20 pixels per meter
+  agent heatmap scrim.tape --maps teams --round 2 --projection side --resolution 20
+
+  # Shot map for the first 5 minutes, written to ./maps
+  agent heatmap scrim.nevrcap --maps shots --to 5m -o ./maps`,
+		Args: cobra.ExactArgs(1),
+		RunE: runHeatmap,
+	}
+
+	cmd.Flags().StringVarP(&heatmapOutputDir, "output-dir", "o", "", "Output directory (default: <input>_heatmaps next to the input)")
+	cmd.Flags().StringSliceVar(&heatmapMaps, "maps", heatmapKinds, "Maps to draw: combined, teams, players, disc, shots")
+	cmd.Flags().DurationVar(&heatmapFrom, "from", 0, "Start offset from the first frame")
+	cmd.Flags().DurationVar(&heatmapTo, "to", 0, "End offset from the first frame (0 = end of recording)")
+	cmd.Flags().StringVar(&heatmapFrames, "frames", "", "Frame range START:END, zero-based and inclusive")
+	cmd.Flags().IntVar(&heatmapRound, "round", 0, "Round number (1-based)")
+	cmd.Flags().StringVar(&heatmapClock, "clock", "", "Game clock window START-END, e.g. 5:00-2:30")
+	cmd.Flags().StringSliceVar(&heatmapStatuses, "status", []string{"playing"}, `Game statuses to include ("any" for all frames)`)
+	cmd.Flags().StringVar(&heatmapProjection, "projection", "top", "Arena projection: top, side or end")
+	cmd.Flags().StringVar(&heatmapBounds, "bounds", "", "Projected area MIN_U,MAX_U,MIN_V,MAX_V in meters (default: the arena)")
+	cmd.Flags().Float64Var(&heatmapResolution, "resolution", 10, "Pixels per meter")
+	cmd.Flags().Float64Var(&heatmapBlur, "blur", 0.5, "Smoothing radius in meters (0 = none)")
+	cmd.Flags().BoolVar(&heatmapOverwrite, "overwrite", false, "Overwrite existing images")
+
+	return cmd
+}
+
+// arenaProjection maps arena positions onto an image plane. U runs left to
+// right and V bottom to top; axes index x, y, z.
+type arenaProjection struct {
+	UAxis, VAxis int
+	MinU, MaxU   float64
+	MinV, MaxV   float64
+}
+
+// arenaProjections cover the Echo Arena: side walls at x ±16 m, goals near
+// z ±36 m and the playable height from about -4 to 8 m.
+var arenaProjections = map[string]arenaProjection{
+	"top":  {UAxis: 0, VAxis: 2, MinU: -16, MaxU: 16, MinV: -40, MaxV: 40},
+	"side": {UAxis: 2, VAxis: 1, MinU: -40, MaxU: 40, MinV: -4, MaxV: 8},
+	"end":  {UAxis: 0, VAxis: 1, MinU: -16, MaxU: 16, MinV: -4, MaxV: 8},
+}
+
+// newArenaProjection returns the named projection, with its bounds replaced
+// by MIN_U,MAX_U,MIN_V,MAX_V if bounds is set.
+func newArenaProjection(name, bounds string) (arenaProjection, error) {
+	p, ok := arenaProjections[name]
+	if !ok {
+		return p, fmt.Errorf("unknown projection %q (must be top, side or end)", name)
+	}
+	if bounds == "" {
+		return p, nil
+	}
+	parts := strings.Split(bounds, ",")
+	if len(parts) != 4 {
+		return p, fmt.Errorf("invalid bounds %q: expected MIN_U,MAX_U,MIN_V,MAX_V", bounds)
+	}
+	var v [4]float64
+	for i, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return p, fmt.Errorf("invalid bounds %q: %w", bounds, err)
+		}
+		v[i] = f
+	}
+	if v[0] >= v[1] || v[2] >= v[3] {
+		return p, fmt.Errorf("invalid bounds %q: minimums must be below maximums", bounds)
+	}
+	p.MinU, p.MaxU, p.MinV, p.MaxV = v[0], v[1], v[2], v[3]
+	return p, nil
+}
+
+// pixel returns the image coordinates of a position, and false if it falls
+// outside the projected area.
+func (p arenaProjection) pixel(pos [3]float64, resolution float64, width, height int) (int, int, bool) {
+	u, v := pos[p.UAxis], pos[p.VAxis]
+	if u < p.MinU || u > p.MaxU || v < p.MinV || v > p.MaxV {
+		return 0, 0, false
+	}
+	x := min(int((u-p.MinU)*resolution), width-1)
+	y := min(int((p.MaxV-v)*resolution), height-1)
+	return x, y, true
+}
+
+// heatGrid counts samples per pixel.
+type heatGrid struct {
+	width, height int
+	cells         []float64
+	samples       int
+}
+
+func newHeatGrid(width, height int) *heatGrid {
+	return &heatGrid{width: width, height: height, cells: make([]float64, width*height)}
+}
+
+// heatmapSet accumulates every map for one recording.
+type heatmapSet struct {
+	projection    arenaProjection
+	resolution    float64
+	width, height int
+
+	combined *heatGrid
+	teams    map[string]*heatGrid
+	players  map[string]*heatGrid
+	disc     *heatGrid
+	shots    []shotSample
+}
+
+// shotSample is where a shot was taken from.
+type shotSample struct {
+	Player string
+	Team   string
+	Pos    [3]float64
+}
+
+// positionSample is a player's position in one frame.
+type positionSample struct {
+	Name   string
+	Team   string
+	Pos    [3]float64
+	HasPos bool
+	Shot   bool // The player took a shot in this frame
+}
+
+// framePositions are the positions read from one frame.
+type framePositions struct {
+	Players []positionSample
+	Disc    [3]float64
+	HasDisc bool
+}
+
+func newHeatmapSet(projection arenaProjection, resolution float64) *heatmapSet {
+	width := max(1, int(math.Ceil((projection.MaxU-projection.MinU)*resolution)))
+	height := max(1, int(math.Ceil((projection.MaxV-projection.MinV)*resolution)))
+	return &heatmapSet{
+		projection: projection,
+		resolution: resolution,
+		width:      width,
+		height:     height,
+		combined:   newHeatGrid(width, height),
+		teams:      make(map[string]*heatGrid),
+		players:    make(map[string]*heatGrid),
+		disc:       newHeatGrid(width, height),
+	}
+}
+
+// add adds one selected frame.
+func (s *heatmapSet) add(frame framePositions) {
+	for _, p := range frame.Players {
+		if (p.Team != "blue" && p.Team != "orange") || !p.HasPos {
+			continue
+		}
+		s.plot(s.combined, p.Pos)
+		s.plot(s.grid(s.teams, p.Team), p.Pos)
+		s.plot(s.grid(s.players, p.Name), p.Pos)
+		if p.Shot {
+			s.shots = append(s.shots, shotSample{Player: p.Name, Team: p.Team, Pos: p.Pos})
+		}
+	}
+	if frame.HasDisc {
+		s.plot(s.disc, frame.Disc)
+	}
+}
+
+func (s *heatmapSet) grid(grids map[string]*heatGrid, key string) *heatGrid {
+	g, ok := grids[key]
+	if !ok {
+		g = newHeatGrid(s.width, s.height)
+		grids[key] = g
+	}
+	return g
+}
+
+func (s *heatmapSet) plot(g *heatGrid, pos [3]float64) {
+	x, y, ok := s.projection.pixel(pos, s.resolution, g.width, g.height)
+	if !ok {
+		return
+	}
+	g.cells[y*g.width+x]++
+	g.samples++
+}
+
+var (
+	heatmapBackground = color.RGBA{24, 24, 28, 255}
+	heatmapMarkings   = color.RGBA{70, 70, 80, 255}
+	teamColors        = map[string]color.RGBA{
+		"blue":   {60, 140, 255, 255},
+		"orange": {255, 150, 30, 255},
+	}
+)
+
+// render draws a grid as a heatmap. Counts are smoothed with two box blur
+// passes of blurPx pixels and scaled by their square root, so sparsely
+// visited areas stay visible next to the hot spots.
+func (s *heatmapSet) render(g *heatGrid, blurPx int) *image.RGBA {
+	cells := slices.Clone(g.cells)
+	for range 2 {
+		cells = boxBlur(cells, g.width, g.height, blurPx)
+	}
+	peak := slices.Max(cells)
+
+	img := s.background()
+	for y := 0; y < g.height; y++ {
+		for x := 0; x < g.width; x++ {
+			value := cells[y*g.width+x]
+			if value <= 0 || peak <= 0 {
+				continue
+			}
+			img.SetRGBA(x, y, heatColor(math.Sqrt(value/peak)))
+		}
+	}
+	return img
+}
+
+// renderShots draws each shot as a dot in its team's color.
+func (s *heatmapSet) renderShots() *image.RGBA {
+	img := s.background()
+	radius := max(2, int(s.resolution*0.4))
+	for _, shot := range s.shots {
+		x, y, ok := s.projection.pixel(shot.Pos, s.resolution, s.width, s.height)
+		if !ok {
+			continue
+		}
+		c := teamColors[shot.Team]
+		for dy := -radius; dy <= radius; dy++ {
+			for dx := -radius; dx <= radius; dx++ {
+				if dx*dx+dy*dy <= radius*radius && image.Pt(x+dx, y+dy).In(img.Rect) {
+					img.SetRGBA(x+dx, y+dy, c)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// background returns an empty map with the outline of the projected area and
+// the arena center line.
+func (s *heatmapSet) background() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, s.width, s.height))
+	for i := 0; i < len(img.Pix); i += 4 {
+		img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = heatmapBackground.R, heatmapBackground.G, heatmapBackground.B, 255
+	}
+	for x := 0; x < s.width; x++ {
+		img.SetRGBA(x, 0, heatmapMarkings)
+		img.SetRGBA(x, s.height-1, heatmapMarkings)
+	}
+	for y := 0; y < s.height; y++ {
+		img.SetRGBA(0, y, heatmapMarkings)
+		img.SetRGBA(s.width-1, y, heatmapMarkings)
+	}
+
+	// The center line is at z = 0
+	p := s.projection
+	switch {
+	case p.VAxis == 2 && p.MinV < 0 && p.MaxV > 0:
+		y := int(p.MaxV * s.resolution)
+		for x := 0; x < s.width; x++ {
+			img.SetRGBA(x, y, heatmapMarkings)
+		}
+	case p.UAxis == 2 && p.MinU < 0 && p.MaxU > 0:
+		x := int(-p.MinU * s.resolution)
+		for y := 0; y < s.height; y++ {
+			img.SetRGBA(x, y, heatmapMarkings)
+		}
+	}
+	return img
+}
+
+// boxBlur averages each cell with its neighbours within radius.
+func boxBlur(cells []float64, width, height, radius int) []float64 {
+	if radius <= 0 {
+		return cells
+	}
+	tmp := make([]float64, len(cells))
+	out := make([]float64, len(cells))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum float64
+			for dx := -radius; dx <= radius; dx++ {
+				if xx := x + dx; xx >= 0 && xx < width {
+					sum += cells[y*width+xx]
+				}
+			}
+			tmp[y*width+x] = sum / float64(2*radius+1)
+		}
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum float64
+			for dy := -radius; dy <= radius; dy++ {
+				if yy := y + dy; yy >= 0 && yy < height {
+					sum += tmp[yy*width+x]
+				}
+			}
+			out[y*width+x] = sum / float64(2*radius+1)
+		}
+	}
+	return out
+}
+
+// heatColor maps t in [0, 1] from dark blue through green and yellow to red.
+func heatColor(t float64) color.RGBA {
+	stops := []color.RGBA{
+		{20, 30, 120, 255},
+		{0, 160, 200, 255},
+		{40, 200, 60, 255},
+		{250, 220, 40, 255},
+		{230, 40, 30, 255},
+	}
+	t = math.Max(0, math.Min(1, t)) * float64(len(stops)-1)
+	i := min(int(t), len(stops)-2)
+	f := t - float64(i)
+	a, b := stops[i], stops[i+1]
+	mix := func(x, y uint8) uint8 { return uint8(float64(x) + (float64(y)-float64(x))*f) }
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
+
+// readFramePositions reads player and disc positions from a frame's session,
+// and marks the players with a PlayerShotTaken event in frameEvents.
+func readFramePositions(frame *telemetry.LobbySessionStateFrame, frameEvents []proto.Message) framePositions {
+	var out framePositions
+	session := frame.GetSession()
+	if session == nil {
+		return out
+	}
+	shooters := shotSlots(frameEvents)
+	for _, p := range sessionRoster(session) {
+		sample := positionSample{Name: p.name, Team: p.team, Shot: slices.Contains(shooters, p.slot)}
+		sample.Pos, sample.HasPos = vectorPosition(p.member.GetBody().GetPosition())
+		if !sample.HasPos {
+			sample.Pos, sample.HasPos = vectorPosition(p.member.GetHead().GetPosition())
+		}
+		out.Players = append(out.Players, sample)
+	}
+	out.Disc, out.HasDisc = vectorPosition(session.GetDisc().GetPosition())
+	return out
+}
+
+// vectorPosition converts a position stored as a list of floats.
+func vectorPosition(v []float32) ([3]float64, bool) {
+	if len(v) < 3 {
+		return [3]float64{}, false
+	}
+	return [3]float64{float64(v[0]), float64(v[1]), float64(v[2])}, true
+}
+
+// shotSlots returns the player slots of the v1 and capture PlayerShotTaken
+// events in frameEvents.
+func shotSlots(frameEvents []proto.Message) []int32 {
+	var slots []int32
+	for _, event := range frameEvents {
+		switch e := event.(type) {
+		case *telemetry.LobbySessionEvent:
+			if shot := e.GetPlayerShotTaken(); shot != nil {
+				slots = append(slots, shot.GetPlayerSlot())
+			}
+		case *capturepb.EchoEvent:
+			if shot := e.GetPlayerShotTaken(); shot != nil {
+				slots = append(slots, shot.GetPlayerSlot())
+			}
+		}
+	}
+	return slots
+}
+
+// detectFrameEvents runs a synchronous detector over the next frame of a
+// recording and returns the events it found.
+func detectFrameEvents(detector *processing.Processor, frame *telemetry.LobbySessionStateFrame) []proto.Message {
+	detector.DetectEvents(frame)
+	var found []proto.Message
+	select {
+	case detected := <-detector.EventsChan():
+		for _, event := range detected {
+			found = append(found, event)
+		}
+	default:
+	}
+	return found
+}
+
+// heatmapFileName turns a player name into a safe file name.
+func heatmapFileName(prefix, name string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '_'
+	}, name)
+	if safe == "" {
+		safe = "unnamed"
+	}
+	return prefix + safe + ".png"
+}
+
+// images lists the images to write, by file name, for the selected maps.
+func (s *heatmapSet) images(kinds []string, blurPx int) map[string]*image.RGBA {
+	out := make(map[string]*image.RGBA)
+	for _, kind := range kinds {
+		switch kind {
+		case "combined":
+			out["combined.png"] = s.render(s.combined, blurPx)
+		case "teams":
+			for team, g := range s.teams {
+				out[heatmapFileName("team_", team)] = s.render(g, blurPx)
+			}
+		case "players":
+			for name, g := range s.players {
+				out[heatmapFileName("player_", name)] = s.render(g, blurPx)
+			}
+		case "disc":
+			out["disc.png"] = s.render(s.disc, blurPx)
+		case "shots":
+			out["shots.png"] = s.renderShots()
+		}
+	}
+	return out
+}
+
+func runHeatmap(cmd *cobra.Command, args []string) error {
+	inputFile := args[0]
+
+	kinds := splitList(heatmapMaps)
+	for _, kind := range kinds {
+		if !slices.Contains(heatmapKinds, kind) {
+			return fmt.Errorf("unknown map %q (valid maps: %s)", kind, strings.Join(heatmapKinds, ", "))
+		}
+	}
+	if len(kinds) == 0 {
+		return fmt.Errorf("no maps selected")
+	}
+
+	projection, err := newArenaProjection(heatmapProjection, heatmapBounds)
+	if err != nil {
+		return err
+	}
+	if heatmapResolution <= 0 || heatmapResolution > 200 {
+		return fmt.Errorf("resolution must be between 0 and 200 pixels per meter, got %v", heatmapResolution)
+	}
+	if heatmapBlur < 0 {
+		return fmt.Errorf("blur must not be negative, got %v", heatmapBlur)
+	}
+
+	first, last, err := parseFrameRange(heatmapFrames)
+	if err != nil {
+		return err
+	}
+	spec := sliceSpec{From: heatmapFrom, To: heatmapTo, FirstFrame: first, LastFrame: last, Round: heatmapRound}
+	if heatmapClock != "" {
+		if spec.ClockHigh, spec.ClockLow, err = parseClockWindow(heatmapClock); err != nil {
+			return err
+		}
+		spec.HasClock = true
+	}
+	if err := spec.Validate(); err != nil {
+		return err
+	}
+
+	statuses := make(map[string]bool)
+	for _, status := range splitList(heatmapStatuses) {
+		statuses[normalizeGameStatus(status)] = true
+	}
+	if statuses["any"] {
+		statuses = nil
+	}
+
+	if _, err := os.Stat(inputFile); err != nil {
+		return fmt.Errorf("cannot access input file: %w", err)
+	}
+	outputDir := heatmapOutputDir
+	if outputDir == "" {
+		outputDir = filepath.Join(filepath.Dir(inputFile), inputStem(inputFile)+"_heatmaps")
+	}
+
+	set, frames, err := buildHeatmaps(inputFile, projection, heatmapResolution, spec, statuses)
+	if err != nil {
+		return err
+	}
+	if set.combined.samples == 0 && set.disc.samples == 0 {
+		return fmt.Errorf("no positions found in the selected frames")
+	}
+
+	images := set.images(kinds, int(math.Round(heatmapBlur*heatmapResolution)))
+	if !heatmapOverwrite {
+		for name := range images {
+			if _, err := os.Stat(filepath.Join(outputDir, name)); err == nil {
+				return fmt.Errorf("output file already exists (use --overwrite to replace it): %s", filepath.Join(outputDir, name))
+			}
+		}
+	}
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	for _, name := range slices.Sorted(maps.Keys(images)) {
+		if err := writePNG(filepath.Join(outputDir, name), images[name]); err != nil {
+			return err
+		}
+	}
+
+	logger.Info("Heatmaps written",
+		zap.String("output_dir", outputDir),
+		zap.Int("images", len(images)),
+		zap.Int("frames", frames),
+		zap.Int("shots", len(set.shots)))
+	return nil
+}
+
+// buildHeatmaps reads a recording and accumulates positions from the frames
+// selected by spec and statuses. It returns the number of frames selected.
+func buildHeatmaps(inputFile string, projection arenaProjection, resolution float64, spec sliceSpec, statuses map[string]bool) (*heatmapSet, int, error) {
+	source, err := openEventFrameSource(inputFile, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer source.Close()
+
+	// .echoreplay files store no events, so their shots come from the detector
+	var detector *processing.Processor
+	if format := detectInputFormat(inputFile); format != "tape" && compressedFormat(format) != "nevrcap" {
+		detector = processing.NewWithDetector(events.NewWithDefaultSensors(events.WithSynchronousProcessing()))
+		defer detector.Stop()
+	}
+
+	set := newHeatmapSet(projection, resolution)
+	var current framePositions
+	var selected int
+	slicer := newFrameSlicer(spec, func(read *eventFrame) error {
+		if statuses == nil || statuses[normalizeGameStatus(read.Frame.GetSession().GetGameStatus())] {
+			set.add(current)
+			selected++
+		}
+		return nil
+	})
+
+	for {
+		read, err := source.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read frame: %w", err)
+		}
+
+		// Every frame goes through the detector, selected or not, so it sees
+		// the whole recording. The slicer emits selected frames synchronously.
+		frameEvents := read.Events
+		if detector != nil {
+			frameEvents = detectFrameEvents(detector, read.Frame)
+		}
+		current = readFramePositions(read.Frame, frameEvents)
+		if err := slicer.Push(read); err != nil {
+			return nil, 0, err
+		}
+	}
+	return set, selected, nil
+}
+
+func writePNG(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to encode %s: %w", path, err)
+	}
+	return file.Close()
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"image/png"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	enginev1 "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/engine/v1"
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	capturepb "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v2"
+	"github.com/echotools/tape/pkg/codec"
+	"github.com/echotools/tape/pkg/conversion"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestNewArenaProjection(t *testing.T) {
+	p, err := newArenaProjection("side", "")
+	if err != nil || p.UAxis != 2 || p.VAxis != 1 {
+		t.Fatalf("side projection = %+v, %v", p, err)
+	}
+
+	p, err = newArenaProjection("top", "-10, 10, -20, 20")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.MinU != -10 || p.MaxU != 10 || p.MinV != -20 || p.MaxV != 20 {
+		t.Errorf("bounds = %+v", p)
+	}
+
+	for _, tt := range []struct{ name, bounds string }{
+		{"diagonal", ""},
+		{"top", "1,2,3"},
+		{"top", "5,1,0,1"},
+		{"top", "a,b,c,d"},
+	} {
+		if _, err := newArenaProjection(tt.name, tt.bounds); err == nil {
+			t.Errorf("newArenaProjection(%q, %q) succeeded", tt.name, tt.bounds)
+		}
+	}
+}
+
+func TestArenaProjection_Pixel(t *testing.T) {
+	set := newHeatmapSet(arenaProjections["top"], 10)
+	if set.width != 320 || set.height != 800 {
+		t.Fatalf("image size = %dx%d, want 320x800", set.width, set.height)
+	}
+
+	tests := []struct {
+		pos    [3]float64
+		x, y   int
+		inside bool
+	}{
+		{[3]float64{0, 0, 0}, 160, 400, true},
+		{[3]float64{-16, 5, 40}, 0, 0, true},     // Top left corner
+		{[3]float64{16, 5, -40}, 319, 799, true}, // Bottom right edge is clamped into the image
+		{[3]float64{0, 0, 45}, 0, 0, false},
+	}
+	for _, tt := range tests {
+		x, y, ok := set.projection.pixel(tt.pos, set.resolution, set.width, set.height)
+		if ok != tt.inside || (ok && (x != tt.x || y != tt.y)) {
+			t.Errorf("pixel(%v) = %d, %d, %v; want %d, %d, %v", tt.pos, x, y, ok, tt.x, tt.y, tt.inside)
+		}
+	}
+}
+
+func TestHeatmapSet_Add(t *testing.T) {
+	set := newHeatmapSet(arenaProjections["top"], 2)
+	frame := func(shot bool) {
+		set.add(framePositions{
+			Players: []positionSample{
+				{Name: "alpha", Team: "blue", Pos: [3]float64{1, 0, 10}, HasPos: true, Shot: shot},
+				{Name: "bravo", Team: "orange", Pos: [3]float64{-1, 0, -10}, HasPos: true},
+				{Name: "coach", Team: "spectator", Pos: [3]float64{0, 0, 0}, HasPos: true},
+			},
+			Disc:    [3]float64{0, 0, 5},
+			HasDisc: true,
+		})
+	}
+
+	frame(false)
+	frame(true)
+	frame(false)
+
+	if set.combined.samples != 6 || set.disc.samples != 3 {
+		t.Errorf("combined %d, disc %d samples; want 6 and 3", set.combined.samples, set.disc.samples)
+	}
+	if got := slices.Sorted(maps.Keys(set.players)); !slices.Equal(got, []string{"alpha", "bravo"}) {
+		t.Errorf("players = %v, spectators should be skipped", got)
+	}
+	if set.teams["blue"].samples != 3 || set.teams["orange"].samples != 3 {
+		t.Errorf("team samples = %d, %d", set.teams["blue"].samples, set.teams["orange"].samples)
+	}
+	if len(set.shots) != 1 || set.shots[0].Player != "alpha" || set.shots[0].Team != "blue" {
+		t.Errorf("shots = %+v, want one by alpha", set.shots)
+	}
+}
+
+func TestReadFramePositions(t *testing.T) {
+	frame := rosterTestFrame()
+	session := frame.GetSession()
+	alpha := session.GetTeams()[0].GetPlayers()[0]
+	alpha.Body = &enginev1.Transform{Position: []float32{1, 2, 3}}
+	alpha.Head = &enginev1.Transform{Position: []float32{9, 9, 9}}
+	// bravo has no body, so the head is used
+	session.GetTeams()[1].GetPlayers()[0].Head = &enginev1.Transform{Position: []float32{-1, 1.5, -4}}
+	session.Disc = &enginev1.Disc{Position: []float32{0, 0.5, 5}}
+
+	shot := &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_PlayerShotTaken{
+		PlayerShotTaken: &telemetry.PlayerShotTaken{PlayerSlot: 1, TotalShots: 3},
+	}}
+	got := readFramePositions(frame, []proto.Message{shot})
+	want := framePositions{
+		Players: []positionSample{
+			{Name: "alpha", Team: "blue", Pos: [3]float64{1, 2, 3}, HasPos: true},
+			{Name: "bravo", Team: "orange", Pos: [3]float64{-1, 1.5, -4}, HasPos: true, Shot: true},
+		},
+		Disc:    [3]float64{0, 0.5, 5},
+		HasDisc: true,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readFramePositions() = %+v, want %+v", got, want)
+	}
+
+	// A frame without positions or shots
+	got = readFramePositions(rosterTestFrame(), nil)
+	if got.HasDisc || len(got.Players) != 2 || got.Players[0].HasPos || got.Players[1].Shot {
+		t.Errorf("readFramePositions() of an empty frame = %+v", got)
+	}
+}
+
+func TestShotSlots(t *testing.T) {
+	frameEvents := []proto.Message{
+		&telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_PlayerShotTaken{PlayerShotTaken: &telemetry.PlayerShotTaken{PlayerSlot: 2}}},
+		&telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_DiscThrown{DiscThrown: &telemetry.DiscThrown{PlayerSlot: 3}}},
+		&capturepb.EchoEvent{Event: &capturepb.EchoEvent_PlayerShotTaken{PlayerShotTaken: &capturepb.PlayerShotTaken{PlayerSlot: 5}}},
+		&capturepb.EchoEvent{Event: &capturepb.EchoEvent_PlayerGoal{PlayerGoal: &capturepb.PlayerGoal{PlayerSlot: 6}}},
+	}
+	if got := shotSlots(frameEvents); !slices.Equal(got, []int32{2, 5}) {
+		t.Errorf("shotSlots() = %v, want [2 5]", got)
+	}
+}
+
+func TestHeatmapSet_WritesImages(t *testing.T) {
+	set := newHeatmapSet(arenaProjections["end"], 4)
+	set.add(framePositions{
+		Players: []positionSample{{Name: "Player One", Team: "blue", Pos: [3]float64{2, 1, 0}, HasPos: true}},
+	})
+
+	images := set.images(heatmapKinds, 2)
+	want := []string{"combined.png", "disc.png", "player_Player_One.png", "shots.png", "team_blue.png"}
+	if got := slices.Sorted(maps.Keys(images)); !slices.Equal(got, want) {
+		t.Fatalf("images = %v, want %v", got, want)
+	}
+
+	// The visited pixel is the hottest one
+	x, y, _ := set.projection.pixel([3]float64{2, 1, 0}, set.resolution, set.width, set.height)
+	if got := images["combined.png"].RGBAAt(x, y); got != heatColor(1) {
+		t.Errorf("hot spot color = %v, want %v", got, heatColor(1))
+	}
+	if got := images["combined.png"].RGBAAt(x+10, y+10); got == heatColor(1) {
+		t.Errorf("far pixel has the hot spot color")
+	}
+
+	path := filepath.Join(t.TempDir(), "combined.png")
+	if err := writePNG(path, images["combined.png"]); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != set.width || b.Dy() != set.height {
+		t.Errorf("png size = %v, want %dx%d", b, set.width, set.height)
+	}
+}
+
+func TestHeatmapFileName(t *testing.T) {
+	tests := map[string]string{
+		"alpha":      "player_alpha.png",
+		"Dr. Disc/2": "player_Dr__Disc_2.png",
+		"":           "player_unnamed.png",
+	}
+	for name, want := range tests {
+		if got := heatmapFileName("player_", name); got != want {
+			t.Errorf("heatmapFileName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestBuildHeatmaps_ShotsFromTapeEvents(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "match.tape")
+
+	// alpha's shots_taken counter rises on every frame, but only frame 1
+	// carries a PlayerShotTaken event
+	frames := resampleTestFrames(0, 100, 200)
+	for i, frame := range frames {
+		roster := rosterTestFrame().GetSession()
+		frame.Session.Teams = roster.GetTeams()
+		alpha := roster.GetTeams()[0].GetPlayers()[0]
+		alpha.Body = &enginev1.Transform{Position: []float32{2, 1, float32(10 + i)}}
+		alpha.Stats = &enginev1.PlayerStats{ShotsTaken: int32(i)}
+	}
+	writer, err := codec.NewWriter(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteHeader(conversion.MapHeaderFromSession(&telemetry.TelemetryHeader{CreatedAt: frames[0].GetTimestamp()}, frames[0].GetSession())); err != nil {
+		t.Fatal(err)
+	}
+	mapper := conversion.FrameMapper{BaseTime: frames[0].GetTimestamp().AsTime()}
+	for i, frame := range frames {
+		native := mapper.MapFrame(frame)
+		if i == 1 {
+			native.GetEchoArena().Events = []*capturepb.EchoEvent{
+				{Event: &capturepb.EchoEvent_PlayerShotTaken{PlayerShotTaken: &capturepb.PlayerShotTaken{PlayerSlot: 0, TotalShots: 1}}},
+			}
+		}
+		if err := writer.WriteFrame(native); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	set, selected, err := buildHeatmaps(input, arenaProjections["top"], 1, sliceSpec{LastFrame: -1}, nil)
+	if err != nil {
+		t.Fatalf("buildHeatmaps() error = %v", err)
+	}
+	if selected != 3 || set.players["alpha"].samples != 3 {
+		t.Errorf("selected %d frames, %d alpha samples; want 3 and 3", selected, set.players["alpha"].samples)
+	}
+	want := []shotSample{{Player: "alpha", Team: "blue", Pos: [3]float64{2, 1, 11}}}
+	if !slices.Equal(set.shots, want) {
+		t.Errorf("shots = %+v, want %+v", set.shots, want)
+	}
+}
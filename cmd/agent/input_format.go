@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/echotools/tape/pkg/codec"
+)
+
+// Uncompressed input variants, as accepted by `agent show`. They are only
+// ever read; output is always written compressed.
+const (
+	echoReplayUncompressed = "echoreplay.uncompressed"
+	nevrcapUncompressed    = "nevrcap.uncompressed"
+)
+
+var (
+	zipMagic  = []byte("PK\x03\x04")
+	zstdMagic = []byte{0x28, 0xB5, 0x2F, 0xFD}
+)
+
+// sniffSize is how much of a file is read to recognise its format.
+const sniffSize = 4096
+
+// detectInputFormat returns the format of an input file: echoreplay, nevrcap,
+// tape, or one of the uncompressed variants. The contents decide where they
+// carry a signature (a zip archive, zstd data with or without a tape header,
+// or echoreplay text lines), so renamed and extensionless files are read
+// correctly. Otherwise the extension decides; raw uncompressed nevrcap data
+// has no signature of its own. Unrecognised files are "unknown".
+func detectInputFormat(filename string) string {
+	sniffed, readable := sniffInputFormat(filename)
+	if sniffed != "" {
+		return sniffed
+	}
+	format := extensionFormat(filename)
+	if format == "nevrcap" && readable {
+		// A .nevrcap file without zstd magic was stored uncompressed
+		return nevrcapUncompressed
+	}
+	return format
+}
+
+// extensionFormat returns the input format implied by the file name.
+func extensionFormat(filename string) string {
+	lowerFile := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(lowerFile, ".echoreplay.uncompressed"):
+		return echoReplayUncompressed
+	case strings.HasSuffix(lowerFile, ".nevrcap.uncompressed"):
+		return nevrcapUncompressed
+	}
+	return getFileFormat(filename)
+}
+
+// sniffInputFormat recognises a file by its first bytes, returning "" if the
+// contents carry no known signature. readable is false if the file could not
+// be read.
+func sniffInputFormat(filename string) (format string, readable bool) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", false
+	}
+	head := make([]byte, sniffSize)
+	n, err := io.ReadFull(file, head)
+	file.Close()
+	if n == 0 && err != nil {
+		return "", false
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, zipMagic):
+		return "echoreplay", true
+	case bytes.HasPrefix(head, zstdMagic):
+		if hasTapeHeader(filename) {
+			return "tape", true
+		}
+		return "nevrcap", true
+	case looksLikeEchoReplayText(head):
+		return echoReplayUncompressed, true
+	}
+	return "", true
+}
+
+// hasTapeHeader reports whether a zstd file starts with a tape capture header.
+// nevrcap files are zstd too, but their header carries no format version.
+func hasTapeHeader(filename string) bool {
+	reader, err := codec.NewReader(filename)
+	if err != nil {
+		return false
+	}
+	defer reader.Close()
+	header, err := reader.ReadHeader()
+	return err == nil && header.GetFormatVersion() > 0
+}
+
+// looksLikeEchoReplayText reports whether data starts with an echoreplay
+// line: a timestamp, a tab and a JSON object.
+func looksLikeEchoReplayText(data []byte) bool {
+	timestamp, rest, ok := bytes.Cut(data, []byte("\t"))
+	if !ok || len(timestamp) > 64 {
+		return false
+	}
+	if _, ok := parseEchoReplayTime(string(timestamp)); !ok {
+		return false
+	}
+	rest = bytes.TrimLeft(rest, " ")
+	return len(rest) > 0 && rest[0] == '{'
+}
+
+// compressedFormat maps an uncompressed input variant to the format it is an
+// uncompressed form of.
+func compressedFormat(format string) string {
+	return strings.TrimSuffix(format, ".uncompressed")
+}
+
+// isReplayFile reports whether a file found while scanning a directory should
+// be converted: it has a replay extension, or no extension and replay contents.
+func isReplayFile(path string) bool {
+	if extensionFormat(path) != "unknown" {
+		return true
+	}
+	if filepath.Ext(path) != "" {
+		return false
+	}
+	format, _ := sniffInputFormat(path)
+	return format != ""
+}
+
+// inputStem returns the file name without its replay extension.
+func inputStem(filename string) string {
+	base := filepath.Base(filename)
+	if strings.EqualFold(filepath.Ext(base), ".uncompressed") {
+		base = base[:len(base)-len(".uncompressed")]
+	}
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
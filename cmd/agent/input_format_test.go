@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	capturepb "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v2"
+	"github.com/echotools/tape/pkg/codec"
+	"github.com/echotools/tape/pkg/conversion"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/proto"
+)
+
+func zstdBytes(t *testing.T, data []byte) string {
+	t.Helper()
+	var buf bytes.Buffer
+	encoder, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoder.Write(data)
+	if err := encoder.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestDetectInputFormat(t *testing.T) {
+	dir := t.TempDir()
+	echoLine := "2025/06/01 12:30:05.250\t{\"sessionid\":\"abc\"}\t \n"
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    string
+	}{
+		{"zip without extension", "game", "PK\x03\x04rest of archive", "echoreplay"},
+		{"zip renamed", "game.zip", "PK\x03\x04rest of archive", "echoreplay"},
+		{"zstd renamed", "game.bin", zstdBytes(t, []byte{0x0a, 0x02, 'i', 'd'}), "nevrcap"},
+		{"echoreplay text", "game.echoreplay.uncompressed", echoLine, echoReplayUncompressed},
+		{"echoreplay text without extension", "dump", echoLine, echoReplayUncompressed},
+		{"uncompressed nevrcap by extension", "game.nevrcap.uncompressed", "\x04\x0a\x02id", nevrcapUncompressed},
+		{"nevrcap extension without zstd magic", "game.nevrcap", "\x04\x0a\x02id", nevrcapUncompressed},
+		{"unknown", "notes.txt", "just some notes", "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			writeTestFile(t, path, tt.content)
+			if got := detectInputFormat(path); got != tt.want {
+				t.Errorf("detectInputFormat(%s) = %q, want %q", tt.file, got, tt.want)
+			}
+		})
+	}
+
+	if got := detectInputFormat(filepath.Join(dir, "missing.nevrcap")); got != "nevrcap" {
+		t.Errorf("detectInputFormat of a missing .nevrcap = %q, want the extension format", got)
+	}
+}
+
+func TestInputStem(t *testing.T) {
+	tests := map[string]string{
+		"dir/game.echoreplay":              "game",
+		"game.nevrcap.uncompressed":        "game",
+		"game.echoreplay.UNCOMPRESSED":     "game",
+		"game":                             "game",
+		"rec_2025-06-01_12-00-00.nevrcap":  "rec_2025-06-01_12-00-00",
+		"archive/old.recording.echoreplay": "old.recording",
+	}
+	for input, want := range tests {
+		if got := inputStem(input); got != want {
+			t.Errorf("inputStem(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
+
+func TestDiscoverFiles_SniffsExtensionlessFiles(t *testing.T) {
+	useTestConfig(t)
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "a.echoreplay"), "PK\x03\x04")
+	writeTestFile(t, filepath.Join(dir, "b.nevrcap.uncompressed"), "\x04\x0a\x02id")
+	writeTestFile(t, filepath.Join(dir, "c"), "PK\x03\x04")
+	writeTestFile(t, filepath.Join(dir, "README"), "not a replay")
+	writeTestFile(t, filepath.Join(dir, "d.zip"), "PK\x03\x04")
+	cfg.Converter.InputFile = dir
+
+	files, err := discoverFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		names = append(names, filepath.Base(file))
+	}
+	if got := strings.Join(names, ","); got != "a.echoreplay,b.nevrcap.uncompressed,c" {
+		t.Errorf("discoverFiles() = %s", got)
+	}
+}
+
+func TestDetermineOutputFileForInput_DetectedFormat(t *testing.T) {
+	useTestConfig(t)
+	dir := t.TempDir()
+	cfg.Converter.OutputDir = filepath.Join(dir, "out")
+
+	input := filepath.Join(dir, "capture")
+	writeTestFile(t, input, "PK\x03\x04")
+	got, err := determineOutputFileForInput(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(cfg.Converter.OutputDir, "capture.tape"); got != want {
+		t.Errorf("output = %s, want %s", got, want)
+	}
+
+	cfg.Converter.Format = "nevrcap"
+	input = filepath.Join(dir, "game.nevrcap.uncompressed")
+	writeTestFile(t, input, "\x04\x0a\x02id")
+	got, err = determineOutputFileForInput(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(cfg.Converter.OutputDir, "game_converted.nevrcap"); got != want {
+		t.Errorf("output = %s, want %s", got, want)
+	}
+}
+
+func TestConvertFile_ExtensionlessTapeStaysNative(t *testing.T) {
+	useTestConfig(t)
+	dir := t.TempDir()
+	input := filepath.Join(dir, "capture")
+
+	// An event without a v1 form is lost if the file goes through v1 frames
+	frames := testV1Frames(5)
+	want := []*capturepb.EchoEvent{
+		{Event: &capturepb.EchoEvent_GenericEvent{GenericEvent: &capturepb.GenericEvent{Name: "custom"}}},
+	}
+	writer, err := codec.NewWriter(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteHeader(conversion.MapHeaderFromSession(&telemetry.TelemetryHeader{CreatedAt: frames[0].GetTimestamp()}, frames[0].GetSession())); err != nil {
+		t.Fatal(err)
+	}
+	mapper := conversion.FrameMapper{BaseTime: frames[0].GetTimestamp().AsTime()}
+	for i, frame := range frames {
+		native := mapper.MapFrame(frame)
+		if i == 2 {
+			native.GetEchoArena().Events = want
+		}
+		if err := writer.WriteFrame(native); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, excludeBones := range []bool{false, true} {
+		cfg.Converter.ExcludeBones = excludeBones
+		output := filepath.Join(dir, "out.tape")
+		stats, err := convertFile(input, output, false)
+		if err != nil {
+			t.Fatalf("convertFile(exclude bones %t) error = %v", excludeBones, err)
+		}
+		if stats.FrameCount != len(frames) {
+			t.Errorf("exclude bones %t: FrameCount = %d, want %d", excludeBones, stats.FrameCount, len(frames))
+		}
+
+		reader, err := codec.NewReader(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := reader.ReadHeader(); err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i <= 2; i++ {
+			frame, err := reader.ReadFrame()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := frame.GetEchoArena().GetEvents(); i == 2 && (len(got) != 1 || !proto.Equal(got[0], want[0])) {
+				t.Errorf("exclude bones %t: events = %v, want %v", excludeBones, got, want)
+			}
+		}
+		reader.Close()
+	}
+}
+
+func TestEchoReplayLineSource_StrictRejectsBadLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.echoreplay.uncompressed")
+	writeTestFile(t, path, "\nnot a frame\n")
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := newEchoReplayLineSource(file, nil)
+	defer source.Close()
+
+	_, err = source.ReadFrame()
+	if err == nil || errors.Is(err, io.EOF) || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("ReadFrame() error = %v, want a decode error for line 2", err)
+	}
+}
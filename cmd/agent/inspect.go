@@ -0,0 +1,605 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/echotools/tape/pkg/codec"
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/cobra"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	inspectGap    time.Duration
+	inspectFrame  int
+	inspectAt     time.Duration
+	inspectFormat string
+)
+
+// maxReportedGaps caps the timestamp gaps and session changes listed in an
+// inspect report; the totals are always counted.
+const maxReportedGaps = 1000
+
+// maxPrintedGaps caps the gaps and session changes printed in text output.
+const maxPrintedGaps = 20
+
+var inspectMarshaler = protojson.MarshalOptions{UseProtoNames: true, Multiline: true, Indent: "  "}
+
+func newInspectCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inspect <recording>",
+		Short: "Show what is inside a recording",
+		Long: `The inspect command shows the low-level contents of a recording in any of
+the supported formats (.tape, .echoreplay, .nevrcap and their uncompressed
+variants):
+
+  - the format, detected from the contents, and the tape format version
+  - the header (TelemetryHeader or CaptureHeader) with all of its metadata
+  - the frame count, frame index range, time span and frame rate
+  - the file size, uncompressed size and compression ratio
+  - timestamp gaps longer than --gap, and timestamps that run backwards
+  - session ID changes between frames
+  - how many frames carry bone data
+  - the entries of an .echoreplay archive, and the conversion manifest entry
+    if the file was written by a batch ` + "`agent convert`" + `
+
+With --frame or --at, a single frame is printed as JSON instead: frame N
+(zero-based, in file order) or the first frame at or after the offset T from
+the first frame. .tape frames are printed in their native capture v2 form.`,
+		Example: `  # Summary of a recording
+  agent inspect match.tape
+
+  # Report as JSON, listing gaps over 250ms
+  agent inspect match.echoreplay --gap 250ms --format json
+
+  # Frame 1200 as JSON
+  agent inspect match.nevrcap --frame 1200
+
+  # The frame 2 minutes into the recording
+  agent inspect match.tape --at 2m | jq .echo_arena`,
+		Args: cobra.ExactArgs(1),
+		RunE: runInspect,
+	}
+
+	cmd.Flags().DurationVar(&inspectGap, "gap", time.Second, "Report timestamp gaps longer than this")
+	cmd.Flags().IntVar(&inspectFrame, "frame", -1, "Print frame N (zero-based) as JSON")
+	cmd.Flags().DurationVar(&inspectAt, "at", 0, "Print the frame at this offset from the first frame as JSON")
+	cmd.Flags().StringVar(&inspectFormat, "format", "text", "Report format: text or json")
+
+	return cmd
+}
+
+func runInspect(cmd *cobra.Command, args []string) error {
+	filename := args[0]
+	if _, err := os.Stat(filename); err != nil {
+		return fmt.Errorf("cannot access input file: %w", err)
+	}
+
+	atSet := cmd.Flags().Changed("at")
+	switch {
+	case inspectFrame >= 0 && atSet:
+		return fmt.Errorf("--frame and --at cannot be combined")
+	case inspectFrame < -1:
+		return fmt.Errorf("frame must not be negative, got %d", inspectFrame)
+	case inspectAt < 0:
+		return fmt.Errorf("offset must not be negative, got %v", inspectAt)
+	case inspectGap <= 0:
+		return fmt.Errorf("gap threshold must be positive, got %v", inspectGap)
+	case inspectFormat != "text" && inspectFormat != "json":
+		return fmt.Errorf("unsupported format: %s (must be text or json)", inspectFormat)
+	}
+
+	if inspectFrame >= 0 || atSet {
+		selector := frameSelector{Position: inspectFrame, Offset: inspectAt, ByOffset: atSet}
+		return dumpFrame(os.Stdout, filename, selector)
+	}
+
+	info, err := inspectRecording(filename, inspectGap)
+	if err != nil {
+		return err
+	}
+	return writeRecordingInfo(os.Stdout, info, inspectFormat)
+}
+
+// RecordingInfo describes the contents of a recording.
+type RecordingInfo struct {
+	File               string          `json:"file"`
+	Format             string          `json:"format"`
+	FormatVersion      uint32          `json:"format_version,omitempty"` // tape only
+	Size               int64           `json:"size"`
+	UncompressedSize   int64           `json:"uncompressed_size,omitempty"`
+	CompressionRatio   float64         `json:"compression_ratio,omitempty"`
+	HeaderType         string          `json:"header_type,omitempty"` // TelemetryHeader or CaptureHeader
+	Header             json.RawMessage `json:"header,omitempty"`
+	Frames             int             `json:"frames"`
+	FirstFrameIndex    uint32          `json:"first_frame_index"`
+	LastFrameIndex     uint32          `json:"last_frame_index"`
+	FirstTimestamp     time.Time       `json:"first_timestamp,omitzero"`
+	LastTimestamp      time.Time       `json:"last_timestamp,omitzero"`
+	Duration           float64         `json:"duration_seconds"`
+	FrameRate          float64         `json:"frame_rate"`
+	BoneFrames         int             `json:"bone_frames"`
+	GapThreshold       float64         `json:"gap_threshold_seconds"`
+	GapCount           int             `json:"gap_count"`
+	Gaps               []TimestampGap  `json:"gaps"`
+	BackwardTimestamps int             `json:"backward_timestamps"`
+	SessionIDs         []string        `json:"session_ids"`
+	SessionChangeCount int             `json:"session_change_count"`
+	SessionChanges     []SessionChange `json:"session_changes"`
+	ArchiveEntries     []ArchiveEntry  `json:"archive_entries,omitempty"` // .echoreplay only
+	Manifest           *manifestEntry  `json:"manifest,omitempty"`
+	ManifestCurrent    bool            `json:"manifest_current,omitempty"` // the file still matches the manifest entry
+}
+
+// TimestampGap is a jump in time between two consecutive frames.
+type TimestampGap struct {
+	Frame  int     `json:"frame"`          // position of the frame after the gap
+	Offset float64 `json:"offset_seconds"` // from the first frame
+	Gap    float64 `json:"gap_seconds"`
+}
+
+// SessionChange is a frame whose session ID differs from the frame before.
+type SessionChange struct {
+	Frame int    `json:"frame"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// ArchiveEntry is a file inside an .echoreplay zip archive.
+type ArchiveEntry struct {
+	Name           string `json:"name"`
+	Size           int64  `json:"size"`
+	CompressedSize int64  `json:"compressed_size"`
+	Method         string `json:"method"`
+}
+
+// recordingScanner accumulates the frame statistics of a recording.
+type recordingScanner struct {
+	info      *RecordingInfo
+	gap       time.Duration
+	last      time.Time
+	sessionID string
+	sessions  map[string]bool
+}
+
+func newRecordingScanner(info *RecordingInfo, gap time.Duration) *recordingScanner {
+	info.GapThreshold = gap.Seconds()
+	info.Gaps = []TimestampGap{}
+	info.SessionIDs = []string{}
+	info.SessionChanges = []SessionChange{}
+	return &recordingScanner{info: info, gap: gap, sessions: make(map[string]bool)}
+}
+
+// add records one frame. ts may be zero if the frame has no timestamp.
+func (s *recordingScanner) add(frameIndex uint32, ts time.Time, sessionID string, hasBones bool) {
+	info := s.info
+	position := info.Frames
+	info.Frames++
+	if position == 0 {
+		info.FirstFrameIndex = frameIndex
+	}
+	info.LastFrameIndex = frameIndex
+	if hasBones {
+		info.BoneFrames++
+	}
+
+	if !ts.IsZero() {
+		if info.FirstTimestamp.IsZero() {
+			info.FirstTimestamp = ts
+		}
+		if !s.last.IsZero() {
+			switch delta := ts.Sub(s.last); {
+			case delta < 0:
+				info.BackwardTimestamps++
+			case delta > s.gap:
+				info.GapCount++
+				if len(info.Gaps) < maxReportedGaps {
+					info.Gaps = append(info.Gaps, TimestampGap{
+						Frame:  position,
+						Offset: ts.Sub(info.FirstTimestamp).Seconds(),
+						Gap:    delta.Seconds(),
+					})
+				}
+			}
+		}
+		if ts.After(info.LastTimestamp) {
+			info.LastTimestamp = ts
+		}
+		s.last = ts
+	}
+
+	if sessionID != "" {
+		if !s.sessions[sessionID] {
+			s.sessions[sessionID] = true
+			info.SessionIDs = append(info.SessionIDs, sessionID)
+		}
+		if s.sessionID != "" && sessionID != s.sessionID {
+			info.SessionChangeCount++
+			if len(info.SessionChanges) < maxReportedGaps {
+				info.SessionChanges = append(info.SessionChanges, SessionChange{Frame: position, From: s.sessionID, To: sessionID})
+			}
+		}
+		s.sessionID = sessionID
+	}
+}
+
+// finish derives the duration and frame rate.
+func (s *recordingScanner) finish() {
+	info := s.info
+	if !info.FirstTimestamp.IsZero() {
+		duration := info.LastTimestamp.Sub(info.FirstTimestamp)
+		info.Duration = duration.Seconds()
+		if duration > 0 && info.Frames > 1 {
+			info.FrameRate = float64(info.Frames-1) / duration.Seconds()
+		}
+	}
+}
+
+// inspectRecording reads a whole recording and describes it.
+func inspectRecording(filename string, gap time.Duration) (*RecordingInfo, error) {
+	stat, err := os.Stat(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot access input file: %w", err)
+	}
+	format := detectInputFormat(filename)
+	if format == "unknown" {
+		return nil, fmt.Errorf("%w: unsupported file format: %s", errUnsupportedConversion, filename)
+	}
+	info := &RecordingInfo{File: filename, Format: format, Size: stat.Size()}
+
+	source, err := openV1FrameSource(filename, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	// tape headers are shown in their native form rather than mapped to v1
+	var header proto.Message
+	if format == "tape" {
+		header = source.(*tapeV1Reader).header
+		info.HeaderType = "CaptureHeader"
+		info.FormatVersion = source.(*tapeV1Reader).header.GetFormatVersion()
+	} else if h := source.Header(); h != nil {
+		header = h
+		info.HeaderType = "TelemetryHeader"
+	}
+	if header != nil {
+		data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode header: %w", err)
+		}
+		info.Header = data
+	}
+
+	scanner := newRecordingScanner(info, gap)
+	for {
+		frame, err := source.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read frame %d: %w", info.Frames, err)
+		}
+		var ts time.Time
+		if frame.GetTimestamp() != nil {
+			ts = frame.GetTimestamp().AsTime()
+		}
+		bones := frame.GetPlayerBones()
+		scanner.add(frame.GetFrameIndex(), ts, frame.GetSession().GetSessionId(), bones != nil && proto.Size(bones) > 0)
+	}
+	scanner.finish()
+
+	if err := inspectStorage(filename, info); err != nil {
+		return nil, err
+	}
+	inspectManifest(filename, info)
+	return info, nil
+}
+
+// inspectStorage fills in the uncompressed size, the compression ratio and
+// the archive entries.
+func inspectStorage(filename string, info *RecordingInfo) error {
+	switch info.Format {
+	case "echoreplay":
+		archive, err := zip.OpenReader(filename)
+		if err != nil {
+			return fmt.Errorf("failed to open echoreplay file: %w", err)
+		}
+		defer archive.Close()
+		for _, file := range archive.File {
+			method := "stored"
+			if file.Method == zip.Deflate {
+				method = "deflate"
+			} else if file.Method != zip.Store {
+				method = fmt.Sprintf("method %d", file.Method)
+			}
+			info.ArchiveEntries = append(info.ArchiveEntries, ArchiveEntry{
+				Name:           file.Name,
+				Size:           int64(file.UncompressedSize64),
+				CompressedSize: int64(file.CompressedSize64),
+				Method:         method,
+			})
+			info.UncompressedSize += int64(file.UncompressedSize64)
+		}
+
+	case "nevrcap", "tape":
+		size, err := zstdContentSize(filename)
+		if err != nil {
+			return fmt.Errorf("failed to decompress %s: %w", filepath.Base(filename), err)
+		}
+		info.UncompressedSize = size
+
+	default:
+		info.UncompressedSize = info.Size
+	}
+	if info.Size > 0 {
+		info.CompressionRatio = float64(info.UncompressedSize) / float64(info.Size)
+	}
+	return nil
+}
+
+// zstdContentSize returns the decompressed size of a zstd file.
+func zstdContentSize(filename string) (int64, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	decoder, err := zstd.NewReader(file, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return 0, err
+	}
+	defer decoder.Close()
+	return io.Copy(io.Discard, decoder)
+}
+
+// inspectManifest looks up the file in the conversion manifest of its
+// directory, if there is one.
+func inspectManifest(filename string, info *RecordingInfo) {
+	dir, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return
+	}
+	manifest, err := loadConversionManifest(dir, "")
+	if err != nil {
+		return
+	}
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return
+	}
+	output := manifest.relative(path)
+	for _, entry := range manifest.Entries {
+		if entry.Output == output {
+			info.Manifest = entry
+			sum, size, err := fileSHA256(filename)
+			info.ManifestCurrent = err == nil && size == entry.OutputSize && sum == entry.OutputSHA256
+			return
+		}
+	}
+}
+
+// frameSelector picks the frame printed by --frame or --at.
+type frameSelector struct {
+	Position int           // zero-based position in the file
+	Offset   time.Duration // from the first frame
+	ByOffset bool
+}
+
+// selects reports whether the frame at position, elapsed after the first
+// frame, is the one asked for.
+func (s frameSelector) selects(position int, elapsed time.Duration) bool {
+	if s.ByOffset {
+		return elapsed >= s.Offset
+	}
+	return position == s.Position
+}
+
+func (s frameSelector) String() string {
+	if s.ByOffset {
+		return fmt.Sprintf("at %v", s.Offset)
+	}
+	return fmt.Sprintf("%d", s.Position)
+}
+
+// dumpFrame prints the selected frame as JSON. .tape frames are printed as
+// capture v2 frames, other formats as v1 frames.
+func dumpFrame(w io.Writer, filename string, selector frameSelector) error {
+	var frame proto.Message
+	var err error
+	if detectInputFormat(filename) == "tape" {
+		frame, err = findTapeFrame(filename, selector)
+	} else {
+		frame, err = findV1Frame(filename, selector)
+	}
+	if err != nil {
+		return err
+	}
+
+	data, err := inspectMarshaler.Marshal(frame)
+	if err != nil {
+		return fmt.Errorf("failed to encode frame: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+func findTapeFrame(filename string, selector frameSelector) (proto.Message, error) {
+	reader, err := codec.NewReader(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tape file: %w", err)
+	}
+	defer reader.Close()
+	if _, err := reader.ReadHeader(); err != nil {
+		return nil, fmt.Errorf("failed to read tape header: %w", err)
+	}
+
+	var firstOffset uint32
+	for position := 0; ; position++ {
+		frame, err := reader.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("no frame %s: the recording has %d frames", selector, position)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read frame %d: %w", position, err)
+		}
+		if position == 0 {
+			firstOffset = frame.GetTimestampOffsetMs()
+		}
+		elapsed := time.Duration(int64(frame.GetTimestampOffsetMs())-int64(firstOffset)) * time.Millisecond
+		if selector.selects(position, elapsed) {
+			return frame, nil
+		}
+	}
+}
+
+func findV1Frame(filename string, selector frameSelector) (proto.Message, error) {
+	source, err := openV1FrameSource(filename, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	var first time.Time
+	for position := 0; ; position++ {
+		frame, err := source.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("no frame %s: the recording has %d frames", selector, position)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read frame %d: %w", position, err)
+		}
+		ts := frame.GetTimestamp().AsTime()
+		if position == 0 {
+			first = ts
+		}
+		if selector.selects(position, ts.Sub(first)) {
+			return frame, nil
+		}
+	}
+}
+
+// writeRecordingInfo prints the report as text or JSON.
+func writeRecordingInfo(w io.Writer, info *RecordingInfo, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(info)
+	}
+
+	formatName := info.Format
+	if info.FormatVersion > 0 {
+		formatName = fmt.Sprintf("%s (format version %d)", info.Format, info.FormatVersion)
+	}
+	fmt.Fprintf(w, "File:       %s\n", info.File)
+	fmt.Fprintf(w, "Format:     %s\n", formatName)
+	fmt.Fprintf(w, "Size:       %s", formatBytes(info.Size))
+	if info.UncompressedSize != info.Size {
+		fmt.Fprintf(w, " (%s uncompressed, ratio %.2f)", formatBytes(info.UncompressedSize), info.CompressionRatio)
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "Frames:     %d", info.Frames)
+	if info.Frames > 0 {
+		fmt.Fprintf(w, " (frame index %d-%d)", info.FirstFrameIndex, info.LastFrameIndex)
+	}
+	fmt.Fprintln(w)
+	if !info.FirstTimestamp.IsZero() {
+		fmt.Fprintf(w, "Time:       %s to %s\n", info.FirstTimestamp.Format(time.RFC3339Nano), info.LastTimestamp.Format(time.RFC3339Nano))
+		fmt.Fprintf(w, "Duration:   %v (%.1f frames/s)\n", secondsDuration(info.Duration), info.FrameRate)
+	}
+	fmt.Fprintf(w, "Bones:      %d frames%s\n", info.BoneFrames, percentOf(info.BoneFrames, info.Frames))
+	fmt.Fprintf(w, "Sessions:   %d", len(info.SessionIDs))
+	if len(info.SessionIDs) > 0 {
+		fmt.Fprintf(w, " (%s)", strings.Join(info.SessionIDs, ", "))
+	}
+	fmt.Fprintln(w)
+
+	if len(info.Header) > 0 {
+		fmt.Fprintf(w, "\n%s:\n", info.HeaderType)
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, info.Header, "  ", "  "); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "  %s\n", indented.Bytes())
+	} else {
+		fmt.Fprintln(w, "\nNo header (the format has none)")
+	}
+
+	fmt.Fprintf(w, "\nTimestamp gaps over %v: %d\n", secondsDuration(info.GapThreshold), info.GapCount)
+	for i, gap := range info.Gaps {
+		if i == maxPrintedGaps {
+			fmt.Fprintf(w, "  ... %d more\n", info.GapCount-maxPrintedGaps)
+			break
+		}
+		fmt.Fprintf(w, "  frame %-8d at %-10v %v gap\n", gap.Frame, secondsDuration(gap.Offset), secondsDuration(gap.Gap))
+	}
+	if info.BackwardTimestamps > 0 {
+		fmt.Fprintf(w, "Timestamps running backwards: %d frames\n", info.BackwardTimestamps)
+	}
+
+	fmt.Fprintf(w, "Session ID changes: %d\n", info.SessionChangeCount)
+	for i, change := range info.SessionChanges {
+		if i == maxPrintedGaps {
+			fmt.Fprintf(w, "  ... %d more\n", info.SessionChangeCount-maxPrintedGaps)
+			break
+		}
+		fmt.Fprintf(w, "  frame %-8d %s → %s\n", change.Frame, change.From, change.To)
+	}
+
+	if len(info.ArchiveEntries) > 0 {
+		fmt.Fprintln(w, "\nArchive entries:")
+		for _, entry := range info.ArchiveEntries {
+			fmt.Fprintf(w, "  %-40s %10s → %10s (%s)\n", entry.Name, formatBytes(entry.Size), formatBytes(entry.CompressedSize), entry.Method)
+		}
+	}
+
+	if m := info.Manifest; m != nil {
+		state := "file matches the entry"
+		if !info.ManifestCurrent {
+			state = "file changed since"
+		}
+		fmt.Fprintf(w, "\nConversion manifest: converted from %s at %s by agent %s (%s)\n",
+			m.Source, m.ConvertedAt.Format(time.RFC3339), m.ConverterVersion, state)
+		if m.Options != "" {
+			fmt.Fprintf(w, "  options: %s\n", m.Options)
+		}
+	}
+	return nil
+}
+
+// formatBytes formats a byte count with a binary unit.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// secondsDuration converts seconds to a duration rounded to milliseconds.
+func secondsDuration(seconds float64) time.Duration {
+	return (time.Duration(seconds * float64(time.Second))).Round(time.Millisecond)
+}
+
+func percentOf(n, total int) string {
+	if total == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%.1f%%)", float64(n)/float64(total)*100)
+}
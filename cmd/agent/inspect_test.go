@@ -0,0 +1,206 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestRecordingScanner(t *testing.T) {
+	info := &RecordingInfo{}
+	s := newRecordingScanner(info, time.Second)
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	s.add(10, start, "a", true)
+	s.add(11, start.Add(100*time.Millisecond), "a", true)
+	s.add(12, start.Add(3*time.Second), "a", false)         // 2.9s gap
+	s.add(13, start.Add(2900*time.Millisecond), "b", false) // Backwards, new session
+	s.add(14, time.Time{}, "", false)                       // No timestamp or session
+	s.add(15, start.Add(4*time.Second), "a", true)          // 1.1s gap, back to the first session
+	s.finish()
+
+	if info.Frames != 6 || info.FirstFrameIndex != 10 || info.LastFrameIndex != 15 {
+		t.Errorf("frames %d, index %d-%d", info.Frames, info.FirstFrameIndex, info.LastFrameIndex)
+	}
+	if info.BoneFrames != 3 {
+		t.Errorf("bone frames = %d, want 3", info.BoneFrames)
+	}
+	if info.GapCount != 2 || info.Gaps[0].Frame != 2 || info.Gaps[0].Gap != 2.9 || info.Gaps[0].Offset != 3 || info.Gaps[1].Frame != 5 {
+		t.Errorf("gaps = %d %+v", info.GapCount, info.Gaps)
+	}
+	if info.BackwardTimestamps != 1 {
+		t.Errorf("backward timestamps = %d, want 1", info.BackwardTimestamps)
+	}
+	if strings.Join(info.SessionIDs, ",") != "a,b" || info.SessionChangeCount != 2 {
+		t.Errorf("sessions %v, %d changes", info.SessionIDs, info.SessionChangeCount)
+	}
+	if c := info.SessionChanges[1]; c.Frame != 5 || c.From != "b" || c.To != "a" {
+		t.Errorf("second session change = %+v", c)
+	}
+	if info.Duration != 4 || info.FrameRate != 1.25 {
+		t.Errorf("duration %v, rate %v; want 4 and 1.25", info.Duration, info.FrameRate)
+	}
+}
+
+func TestFrameSelector(t *testing.T) {
+	byPosition := frameSelector{Position: 3}
+	if byPosition.selects(2, time.Hour) || !byPosition.selects(3, 0) {
+		t.Error("position selector picked the wrong frame")
+	}
+	byOffset := frameSelector{Offset: 2 * time.Second, ByOffset: true}
+	if byOffset.selects(50, 1999*time.Millisecond) || !byOffset.selects(51, 2*time.Second) {
+		t.Error("offset selector picked the wrong frame")
+	}
+	if byOffset.String() != "at 2s" || byPosition.String() != "3" {
+		t.Errorf("selector names %q, %q", byOffset, byPosition)
+	}
+}
+
+func TestInspectStorage_EchoReplayArchive(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "match.echoreplay")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := zip.NewWriter(file)
+	entry, err := archive.Create("match.echoreplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.Write(bytes.Repeat([]byte("2025/03/01 12:00:00.000\t{}\n"), 200))
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	stat, _ := os.Stat(path)
+
+	info := &RecordingInfo{Format: "echoreplay", Size: stat.Size()}
+	if err := inspectStorage(path, info); err != nil {
+		t.Fatal(err)
+	}
+	if len(info.ArchiveEntries) != 1 || info.ArchiveEntries[0].Name != "match.echoreplay" || info.ArchiveEntries[0].Method != "deflate" {
+		t.Fatalf("archive entries = %+v", info.ArchiveEntries)
+	}
+	if info.UncompressedSize != 200*27 || info.CompressionRatio <= 1 {
+		t.Errorf("uncompressed %d, ratio %v", info.UncompressedSize, info.CompressionRatio)
+	}
+}
+
+func TestInspectStorage_Zstd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "match.nevrcap")
+	var compressed bytes.Buffer
+	encoder, err := zstd.NewWriter(&compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoder.Write(bytes.Repeat([]byte("frame"), 1000))
+	encoder.Close()
+	writeTestFile(t, path, compressed.String())
+
+	info := &RecordingInfo{Format: "nevrcap", Size: int64(compressed.Len())}
+	if err := inspectStorage(path, info); err != nil {
+		t.Fatal(err)
+	}
+	if info.UncompressedSize != 5000 {
+		t.Errorf("uncompressed size = %d, want 5000", info.UncompressedSize)
+	}
+	if want := 5000 / float64(compressed.Len()); info.CompressionRatio != want {
+		t.Errorf("ratio = %v, want %v", info.CompressionRatio, want)
+	}
+}
+
+func TestInspectManifest(t *testing.T) {
+	dir := t.TempDir()
+	output := filepath.Join(dir, "match.tape")
+	writeTestFile(t, output, "converted")
+	sum, size, err := fileSHA256(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := map[string]any{
+		"version": 1,
+		"entries": map[string]*manifestEntry{
+			"/recordings/match.echoreplay": {Source: "/recordings/match.echoreplay", Output: "match.tape", OutputSHA256: sum, OutputSize: size, ConverterVersion: "v4.1.0"},
+		},
+	}
+	data, _ := json.Marshal(manifest)
+	writeTestFile(t, filepath.Join(dir, manifestFileName), string(data))
+
+	info := &RecordingInfo{}
+	inspectManifest(output, info)
+	if info.Manifest == nil || info.Manifest.Source != "/recordings/match.echoreplay" || !info.ManifestCurrent {
+		t.Fatalf("manifest = %+v, current %v", info.Manifest, info.ManifestCurrent)
+	}
+
+	writeTestFile(t, output, "changed")
+	info = &RecordingInfo{}
+	inspectManifest(output, info)
+	if info.Manifest == nil || info.ManifestCurrent {
+		t.Errorf("changed file still matches the manifest entry")
+	}
+
+	info = &RecordingInfo{}
+	inspectManifest(filepath.Join(dir, "other.tape"), info)
+	if info.Manifest != nil {
+		t.Errorf("manifest entry found for an unlisted file")
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	tests := map[int64]string{
+		512:           "512 B",
+		2048:          "2.0 KiB",
+		5 << 20:       "5.0 MiB",
+		3<<30 + 1<<29: "3.5 GiB",
+	}
+	for n, want := range tests {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
+
+func TestWriteRecordingInfo_Text(t *testing.T) {
+	info := &RecordingInfo{
+		File:             "match.tape",
+		Format:           "tape",
+		FormatVersion:    2,
+		Size:             1 << 20,
+		UncompressedSize: 4 << 20,
+		CompressionRatio: 4,
+		HeaderType:       "CaptureHeader",
+		Header:           json.RawMessage(`{"capture_id":"abc","metadata":{"map":"arena"}}`),
+	}
+	s := newRecordingScanner(info, 500*time.Millisecond)
+	start := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.add(0, start, "abc", true)
+	s.add(1, start.Add(2*time.Second), "abc", false)
+	s.finish()
+
+	var out bytes.Buffer
+	if err := writeRecordingInfo(&out, info, "text"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"tape (format version 2)",
+		"1.0 MiB (4.0 MiB uncompressed, ratio 4.00)",
+		"Frames:     2 (frame index 0-1)",
+		"Bones:      1 frames (50.0%)",
+		"Sessions:   1 (abc)",
+		"CaptureHeader:",
+		`"map": "arena"`,
+		"Timestamp gaps over 500ms: 1",
+		"frame 1        at 2s         2s gap",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -81,6 +82,18 @@ serving recorded data.`,
 	convertCmd.GroupID = "main"
 	rootCmd.AddCommand(convertCmd)
 
+	sliceCmd := newSliceCommand()
+	sliceCmd.GroupID = "main"
+	rootCmd.AddCommand(sliceCmd)
+
+	heatmapCmd := newHeatmapCommand()
+	heatmapCmd.GroupID = "main"
+	rootCmd.AddCommand(heatmapCmd)
+
+	mergeCmd := newMergeCommand()
+	mergeCmd.GroupID = "main"
+	rootCmd.AddCommand(mergeCmd)
+
 	replayCmd := newReplayerCommand()
 	replayCmd.GroupID = "main"
 	rootCmd.AddCommand(replayCmd)
@@ -89,10 +102,30 @@ serving recorded data.`,
 	showCmd.GroupID = "main"
 	rootCmd.AddCommand(showCmd)
 
+	inspectCmd := newInspectCommand()
+	inspectCmd.GroupID = "main"
+	rootCmd.AddCommand(inspectCmd)
+
+	diffCmd := newDiffCommand()
+	diffCmd.GroupID = "main"
+	rootCmd.AddCommand(diffCmd)
+
+	queryCmd := newQueryCommand()
+	queryCmd.GroupID = "main"
+	rootCmd.AddCommand(queryCmd)
+
+	aggregateCmd := newAggregateCommand()
+	aggregateCmd.GroupID = "main"
+	rootCmd.AddCommand(aggregateCmd)
+
 	rootCmd.AddCommand(newVersionCheckCommand())
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		var exitErr *exitCodeError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.code)
+		}
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	mergeOutputFile   string
+	mergeOutputDir    string
+	mergeFormat       string
+	mergeGapThreshold time.Duration
+	mergeForce        bool
+	mergeOverwrite    bool
+)
+
+func newMergeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "merge <file>...",
+		Short: "Merge fragmented recordings of a session into one file",
+		Long: `The merge command joins recordings of the same session that were split
+across several files, e.g. after an agent restart or a poller timeout.
+
+Input files may be any mix of .echoreplay, .nevrcap and .tape. They are grouped
+by session ID and ordered by their first frame. Frames that overlap time already
+covered by an earlier file are dropped as duplicates. Gaps longer than
+--gap-threshold are listed in the output header metadata ("gaps") and in the
+<output>.merge.json report written next to the output. Events are kept with
+their frames, and .tape frames are written unchanged to .tape output.
+
+.echoreplay files have no header to record gaps in, so for .echoreplay output
+the merge report is the only record of them. The merge fails if it cannot be
+written.
+
+Merging files from different sessions into one output is refused unless --force
+is given. Use --output-dir instead of --output to write one merged file per session.`,
+		Example: `  # Merge three fragments of a match into one tape
+  agent merge rec_1.tape rec_2.tape rec_3.nevrcap -o match.tape
+
+  # Merge a directory of fragments into one file per session
+  agent merge ./recordings/*.echoreplay --output-dir ./merged --format nevrcap
+
+  # Merge recordings of different sessions anyway
+  agent merge a.echoreplay b.echoreplay -o both.nevrcap --force`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runMerge,
+	}
+
+	cmd.Flags().StringVarP(&mergeOutputFile, "output", "o", "", "Output file path; the format is taken from the extension")
+	cmd.Flags().StringVar(&mergeOutputDir, "output-dir", "", "Write one merged file per session into this directory")
+	cmd.Flags().StringVarP(&mergeFormat, "format", "f", "auto", "Output format for --output-dir: auto (same as the first input), tape, echoreplay, nevrcap")
+	cmd.Flags().DurationVar(&mergeGapThreshold, "gap-threshold", time.Second, "Minimum time between files that is recorded as a gap")
+	cmd.Flags().BoolVar(&mergeForce, "force", false, "Merge recordings of different sessions into one output")
+	cmd.Flags().BoolVar(&mergeOverwrite, "overwrite", false, "Overwrite existing output files")
+
+	return cmd
+}
+
+// mergeFragment describes one input file of a merge.
+type mergeFragment struct {
+	File      string
+	SessionID string
+	Start     time.Time
+	End       time.Time
+	Frames    int
+	header    *telemetry.TelemetryHeader
+}
+
+// mergeGap is a stretch of time not covered by any input file.
+type mergeGap struct {
+	After    string    `json:"after"`
+	Before   string    `json:"before"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration string    `json:"duration"`
+}
+
+// mergeSource records what was taken from one input file.
+type mergeSource struct {
+	File       string `json:"file"`
+	SessionID  string `json:"session_id"`
+	Frames     int    `json:"frames"`
+	Kept       int    `json:"kept"`
+	Duplicates int    `json:"duplicates"`
+}
+
+// MergeReport is written to <output>.merge.json.
+type MergeReport struct {
+	Output     string        `json:"output"`
+	SessionIDs []string      `json:"session_ids"`
+	Frames     int           `json:"frames"`
+	Sources    []mergeSource `json:"sources"`
+	Gaps       []mergeGap    `json:"gaps"`
+}
+
+func (r *MergeReport) Write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode merge report: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func runMerge(cmd *cobra.Command, args []string) error {
+	if (mergeOutputFile == "") == (mergeOutputDir == "") {
+		return fmt.Errorf("exactly one of --output or --output-dir must be given")
+	}
+	if mergeGapThreshold <= 0 {
+		return fmt.Errorf("--gap-threshold must be positive")
+	}
+	switch mergeFormat {
+	case "auto", "tape", "echoreplay", "nevrcap":
+	default:
+		return fmt.Errorf("unsupported output format: %s", mergeFormat)
+	}
+
+	var fragments []*mergeFragment
+	for _, file := range args {
+		fragment, err := scanFragment(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		if fragment.Frames == 0 {
+			logger.Warn("Skipping empty recording", zap.String("file", file))
+			continue
+		}
+		fragments = append(fragments, fragment)
+	}
+	if len(fragments) == 0 {
+		return fmt.Errorf("no frames found in the input files")
+	}
+
+	groups := groupFragments(fragments)
+
+	if mergeOutputFile != "" {
+		if len(groups) > 1 && !mergeForce {
+			var lines []string
+			for _, group := range groups {
+				lines = append(lines, fmt.Sprintf("  %s: %s", group[0].SessionID, strings.Join(fragmentFiles(group), ", ")))
+			}
+			return fmt.Errorf("input files belong to %d different sessions (use --force to merge them anyway, or --output-dir for one file per session):\n%s",
+				len(groups), strings.Join(lines, "\n"))
+		}
+
+		outputFormat := getFileFormat(mergeOutputFile)
+		if outputFormat == "unknown" {
+			return fmt.Errorf("output file must have a .echoreplay, .nevrcap or .tape extension: %s", mergeOutputFile)
+		}
+
+		return mergeToFile(sortFragments(fragments), mergeOutputFile, outputFormat)
+	}
+
+	if err := os.MkdirAll(mergeOutputDir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	for _, group := range groups {
+		outputFormat := mergeFormat
+		if outputFormat == "auto" {
+			outputFormat = compressedFormat(detectInputFormat(group[0].File))
+		}
+		name := group[0].SessionID
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(group[0].File), filepath.Ext(group[0].File))
+		}
+		outputFile := filepath.Join(mergeOutputDir, name+"_merged."+outputFormat)
+		if err := mergeToFile(group, outputFile, outputFormat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mergeToFile(fragments []*mergeFragment, outputFile, outputFormat string) error {
+	if _, err := os.Stat(outputFile); err == nil && !mergeOverwrite {
+		return fmt.Errorf("output file already exists (use --overwrite to replace it): %s", outputFile)
+	}
+	for _, fragment := range fragments {
+		if filepath.Clean(fragment.File) == filepath.Clean(outputFile) {
+			return fmt.Errorf("output file must differ from the input files: %s", outputFile)
+		}
+	}
+
+	report, err := mergeFragments(fragments, outputFile, outputFormat, mergeGapThreshold)
+	if err != nil {
+		return err
+	}
+
+	// Without gap markers in the header, the report is the only record of the gaps
+	unmarked := len(report.Gaps) > 0 && !gapMarkerFormats[outputFormat]
+	reportPath := outputFile + ".merge.json"
+	if err := report.Write(reportPath); err != nil {
+		if unmarked {
+			os.Remove(outputFile)
+			return fmt.Errorf("%s output cannot record gaps and the merge report could not be written: %w", outputFormat, err)
+		}
+		logger.Warn("Failed to write merge report", zap.String("path", reportPath), zap.Error(err))
+	}
+	if unmarked {
+		logger.Warn("Output format cannot record gaps; see the merge report",
+			zap.String("format", outputFormat),
+			zap.String("report", reportPath))
+	}
+
+	for _, gap := range report.Gaps {
+		logger.Warn("Gap between recordings",
+			zap.String("after", gap.After),
+			zap.String("before", gap.Before),
+			zap.String("duration", gap.Duration))
+	}
+	logger.Info("Merge completed",
+		zap.String("output", outputFile),
+		zap.Strings("sessions", report.SessionIDs),
+		zap.Int("files", len(report.Sources)),
+		zap.Int("frames", report.Frames),
+		zap.Int("gaps", len(report.Gaps)))
+	return nil
+}
+
+// scanFragment reads a recording once to find its session ID, time range and
+// frame count. These are needed up front to order the files and to put the
+// gap list in the output header.
+func scanFragment(file string) (*mergeFragment, error) {
+	source, err := openV1FrameSource(file, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	fragment := &mergeFragment{File: file, header: source.Header()}
+	for {
+		frame, err := source.ReadFrame()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to read frame %d: %w", fragment.Frames, err)
+		}
+
+		ts := frame.GetTimestamp().AsTime()
+		if fragment.Frames == 0 {
+			fragment.Start = ts
+			fragment.SessionID = frame.GetSession().GetSessionId()
+		}
+		if ts.After(fragment.End) {
+			fragment.End = ts
+		}
+		fragment.Frames++
+	}
+
+	if fragment.SessionID == "" && fragment.header != nil {
+		fragment.SessionID = fragment.header.GetCaptureId()
+	}
+	return fragment, nil
+}
+
+// sortFragments orders fragments by their first frame.
+func sortFragments(fragments []*mergeFragment) []*mergeFragment {
+	sorted := append([]*mergeFragment(nil), fragments...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if !sorted[i].Start.Equal(sorted[j].Start) {
+			return sorted[i].Start.Before(sorted[j].Start)
+		}
+		return sorted[i].File < sorted[j].File
+	})
+	return sorted
+}
+
+// groupFragments groups fragments by session ID. Each group is ordered by time
+// and the groups are ordered by their earliest fragment.
+func groupFragments(fragments []*mergeFragment) [][]*mergeFragment {
+	var groups [][]*mergeFragment
+	index := make(map[string]int)
+	for _, fragment := range sortFragments(fragments) {
+		i, ok := index[fragment.SessionID]
+		if !ok {
+			i = len(groups)
+			index[fragment.SessionID] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], fragment)
+	}
+	return groups
+}
+
+func fragmentFiles(fragments []*mergeFragment) []string {
+	files := make([]string, len(fragments))
+	for i, fragment := range fragments {
+		files[i] = fragment.File
+	}
+	return files
+}
+
+// planGaps returns the gaps longer than threshold between time-ordered fragments.
+func planGaps(fragments []*mergeFragment, threshold time.Duration) []mergeGap {
+	var gaps []mergeGap
+	var covered time.Time
+	var last string
+	for i, fragment := range fragments {
+		if i > 0 && fragment.Start.Sub(covered) > threshold {
+			gaps = append(gaps, mergeGap{
+				After:    filepath.Base(last),
+				Before:   filepath.Base(fragment.File),
+				Start:    covered,
+				End:      fragment.Start,
+				Duration: fragment.Start.Sub(covered).String(),
+			})
+		}
+		if i == 0 || fragment.End.After(covered) {
+			covered = fragment.End
+			last = fragment.File
+		}
+	}
+	return gaps
+}
+
+// gapMarkerFormats are the output formats whose header can record gaps.
+var gapMarkerFormats = map[string]bool{"nevrcap": true, "tape": true}
+
+// mergeFragments writes the time-ordered fragments to outputFile as one
+// recording. A frame is dropped as a duplicate unless it is later than every
+// frame already written.
+func mergeFragments(fragments []*mergeFragment, outputFile, outputFormat string, gapThreshold time.Duration) (*MergeReport, error) {
+	report := &MergeReport{
+		Output: outputFile,
+		Gaps:   planGaps(fragments, gapThreshold),
+	}
+
+	header := &telemetry.TelemetryHeader{}
+	for _, fragment := range fragments {
+		if fragment.header != nil {
+			header = fragment.header
+			break
+		}
+	}
+	if header.Metadata == nil {
+		header.Metadata = make(map[string]string)
+	}
+	header.CaptureId = fragments[0].SessionID
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, fragment := range fragments {
+		names = append(names, filepath.Base(fragment.File))
+		if !seen[fragment.SessionID] {
+			seen[fragment.SessionID] = true
+			report.SessionIDs = append(report.SessionIDs, fragment.SessionID)
+		}
+	}
+	header.Metadata["merged_from"] = strings.Join(names, ",")
+	if len(report.Gaps) > 0 {
+		gaps, err := json.Marshal(report.Gaps)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode gaps: %w", err)
+		}
+		header.Metadata["gaps"] = string(gaps)
+	}
+
+	sink, err := newV1FrameSink(outputFile, outputFormat, header)
+	if err != nil {
+		return nil, err
+	}
+
+	var lossReport *LossReport
+	var lastWritten time.Time
+	for _, fragment := range fragments {
+		if detectInputFormat(fragment.File) == "tape" && outputFormat != "tape" && lossReport == nil {
+			lossReport = newLossReport(fragment.File, outputFile)
+		}
+
+		source := mergeSource{File: fragment.File, SessionID: fragment.SessionID}
+		if err := mergeFragmentFrames(fragment.File, lossReport, sink, &lastWritten, &source); err != nil {
+			sink.Abort()
+			return nil, fmt.Errorf("%s: %w", fragment.File, err)
+		}
+		report.Sources = append(report.Sources, source)
+
+		if source.Duplicates > 0 {
+			logger.Info("Dropped overlapping frames",
+				zap.String("file", fragment.File),
+				zap.Int("duplicates", source.Duplicates))
+		}
+	}
+
+	if err := sink.Close(); err != nil {
+		return nil, err
+	}
+	report.Frames = sink.Frames()
+
+	if lossReport != nil {
+		saveLossReport(lossReport, outputFile)
+	}
+	return report, nil
+}
+
+// mergeFragmentFrames appends the frames of file that are later than
+// lastWritten to sink, together with their events.
+func mergeFragmentFrames(file string, lossReport *LossReport, sink *v1FrameSink, lastWritten *time.Time, source *mergeSource) error {
+	reader, err := openEventFrameSource(file, lossReport)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	sink.UseTapeHeader(reader.TapeHeader())
+
+	for {
+		read, err := reader.ReadFrame()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("failed to read frame %d: %w", source.Frames, err)
+		}
+		source.Frames++
+
+		ts := read.Frame.GetTimestamp().AsTime()
+		if !lastWritten.IsZero() && !ts.After(*lastWritten) {
+			source.Duplicates++
+			continue
+		}
+
+		read.Frame.FrameIndex = uint32(sink.Frames())
+		if err := sink.WriteEventFrame(read); err != nil {
+			return err
+		}
+		*lastWritten = ts
+		source.Kept++
+	}
+}
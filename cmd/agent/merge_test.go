@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	capturepb "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v2"
+	"github.com/echotools/tape/pkg/codec"
+	"github.com/echotools/tape/pkg/conversion"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGroupFragments(t *testing.T) {
+	fragments := []*mergeFragment{
+		{File: "b2", SessionID: "b", Start: testFrameBase.Add(30 * time.Second)},
+		{File: "a2", SessionID: "a", Start: testFrameBase.Add(20 * time.Second)},
+		{File: "b1", SessionID: "b", Start: testFrameBase.Add(10 * time.Second)},
+		{File: "a1", SessionID: "a", Start: testFrameBase},
+	}
+
+	groups := groupFragments(fragments)
+	if len(groups) != 2 {
+		t.Fatalf("got %d groups, want 2", len(groups))
+	}
+	if got := fragmentFiles(groups[0]); len(got) != 2 || got[0] != "a1" || got[1] != "a2" {
+		t.Errorf("group 0 = %v, want [a1 a2]", got)
+	}
+	if got := fragmentFiles(groups[1]); len(got) != 2 || got[0] != "b1" || got[1] != "b2" {
+		t.Errorf("group 1 = %v, want [b1 b2]", got)
+	}
+}
+
+func TestPlanGaps(t *testing.T) {
+	at := func(s int) time.Time { return testFrameBase.Add(time.Duration(s) * time.Second) }
+	fragments := []*mergeFragment{
+		{File: "one", Start: at(0), End: at(100)},
+		{File: "two", Start: at(90), End: at(200)},    // overlaps
+		{File: "three", Start: at(120), End: at(150)}, // contained in two
+		{File: "four", Start: at(230), End: at(300)},  // 30s gap after two
+		{File: "five", Start: at(300), End: at(400)},  // contiguous
+	}
+
+	gaps := planGaps(fragments, time.Second)
+	if len(gaps) != 1 {
+		t.Fatalf("got %d gaps, want 1: %+v", len(gaps), gaps)
+	}
+	gap := gaps[0]
+	if gap.After != "two" || gap.Before != "four" || !gap.Start.Equal(at(200)) || gap.Duration != "30s" {
+		t.Errorf("unexpected gap: %+v", gap)
+	}
+}
+
+func writeEchoReplayFragment(t *testing.T, path string, from, to int) {
+	t.Helper()
+	writer, err := codec.NewEchoReplayWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := testV1Frames(to, withInterval(100*time.Millisecond), withStatuses("playing"))
+	for i, frame := range frames[from:] {
+		frame.FrameIndex = uint32(i)
+		if err := writer.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMergeFragments(t *testing.T) {
+	useTestConfig(t)
+	dir := t.TempDir()
+
+	// Frames 0-49, 40-79 (overlapping), then 120-149 after a 4s gap
+	files := []string{
+		filepath.Join(dir, "part2.echoreplay"),
+		filepath.Join(dir, "part1.echoreplay"),
+		filepath.Join(dir, "part3.echoreplay"),
+	}
+	writeEchoReplayFragment(t, files[1], 0, 50)
+	writeEchoReplayFragment(t, files[0], 40, 80)
+	writeEchoReplayFragment(t, files[2], 120, 150)
+
+	var fragments []*mergeFragment
+	for _, file := range files {
+		fragment, err := scanFragment(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fragments = append(fragments, fragment)
+	}
+	groups := groupFragments(fragments)
+	if len(groups) != 1 {
+		t.Fatalf("got %d sessions, want 1", len(groups))
+	}
+
+	output := filepath.Join(dir, "merged.nevrcap")
+	report, err := mergeFragments(groups[0], output, "nevrcap", time.Second)
+	if err != nil {
+		t.Fatalf("mergeFragments() error = %v", err)
+	}
+	if report.Frames != 110 {
+		t.Errorf("merged %d frames, want 110", report.Frames)
+	}
+	if report.Sources[1].Duplicates != 10 {
+		t.Errorf("sources = %+v", report.Sources)
+	}
+	if len(report.Gaps) != 1 || report.Gaps[0].Duration != "4.1s" {
+		t.Errorf("gaps = %+v", report.Gaps)
+	}
+
+	reader, err := codec.NewLegacyReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	header, err := reader.ReadHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gaps []mergeGap
+	if err := json.Unmarshal([]byte(header.GetMetadata()["gaps"]), &gaps); err != nil || len(gaps) != 1 {
+		t.Errorf("header gaps = %q (%v)", header.GetMetadata()["gaps"], err)
+	}
+
+	var last time.Time
+	for i := 0; ; i++ {
+		frame, err := reader.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ts := frame.GetTimestamp().AsTime()
+		if frame.GetFrameIndex() != uint32(i) || !ts.After(last) {
+			t.Fatalf("frame %d: index %d at %v after %v", i, frame.GetFrameIndex(), ts, last)
+		}
+		last = ts
+	}
+}
+
+func scanTestFragments(t *testing.T, files ...string) []*mergeFragment {
+	t.Helper()
+	var fragments []*mergeFragment
+	for _, file := range files {
+		fragment, err := scanFragment(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fragments = append(fragments, fragment)
+	}
+	return sortFragments(fragments)
+}
+
+func TestMergeToFile_EchoReplayGapsInReport(t *testing.T) {
+	useTestConfig(t)
+	prevThreshold := mergeGapThreshold
+	mergeGapThreshold = time.Second
+	t.Cleanup(func() { mergeGapThreshold = prevThreshold })
+	dir := t.TempDir()
+
+	first := filepath.Join(dir, "part1.echoreplay")
+	second := filepath.Join(dir, "part2.echoreplay")
+	writeEchoReplayFragment(t, first, 0, 50)
+	writeEchoReplayFragment(t, second, 120, 150)
+	fragments := scanTestFragments(t, first, second)
+
+	// echoreplay has no header, so the gap is only in the merge report
+	output := filepath.Join(dir, "merged.echoreplay")
+	if err := mergeToFile(fragments, output, "echoreplay"); err != nil {
+		t.Fatalf("mergeToFile() error = %v", err)
+	}
+	if frames, err := countFrames(output); err != nil || frames != 80 {
+		t.Errorf("output has %d frames (%v), want 80", frames, err)
+	}
+	data, err := os.ReadFile(output + ".merge.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report MergeReport
+	if err := json.Unmarshal(data, &report); err != nil || len(report.Gaps) != 1 {
+		t.Errorf("report gaps = %+v (%v), want one", report.Gaps, err)
+	}
+
+	// Without the report the gap would be lost, so the merge fails
+	blocked := filepath.Join(dir, "blocked.echoreplay")
+	if err := os.Mkdir(blocked+".merge.json", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := mergeToFile(fragments, blocked, "echoreplay"); err == nil {
+		t.Error("mergeToFile() succeeded without a merge report")
+	}
+	if _, err := os.Stat(blocked); !os.IsNotExist(err) {
+		t.Errorf("output kept without a merge report: %v", err)
+	}
+}
+
+func TestMergeFragments_TapeKeepsNativeFrames(t *testing.T) {
+	useTestConfig(t)
+	dir := t.TempDir()
+
+	// Two tape fragments, the second with events and a player that have no
+	// v1 form
+	frames := testV1Frames(20)
+	var natives []*capturepb.CaptureFrame
+	writeFragment := func(path string, frames []*telemetry.LobbySessionStateFrame) {
+		writer, err := codec.NewWriter(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := conversion.MapHeaderFromSession(&telemetry.TelemetryHeader{CreatedAt: frames[0].GetTimestamp()}, frames[0].GetSession())
+		if err := writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		mapper := conversion.FrameMapper{BaseTime: frames[0].GetTimestamp().AsTime()}
+		for _, frame := range frames {
+			native := mapper.MapFrame(frame)
+			if frame.GetFrameIndex() == 15 {
+				arena := native.GetEchoArena()
+				arena.Events = []*capturepb.EchoEvent{
+					{Event: &capturepb.EchoEvent_PlayerGoal{PlayerGoal: &capturepb.PlayerGoal{PlayerSlot: 1, TotalGoals: 3}}},
+					{Event: &capturepb.EchoEvent_GenericEvent{GenericEvent: &capturepb.GenericEvent{Name: "custom"}}},
+				}
+				arena.Players = append(arena.Players, &capturepb.PlayerState{Slot: 9, DisplayName: "observer"})
+			}
+			natives = append(natives, native)
+			if err := writer.WriteFrame(native); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first := filepath.Join(dir, "part1.tape")
+	second := filepath.Join(dir, "part2.tape")
+	writeFragment(first, frames[:10])
+	writeFragment(second, frames[10:])
+
+	output := filepath.Join(dir, "merged.tape")
+	if _, err := mergeFragments(scanTestFragments(t, first, second), output, "tape", time.Second); err != nil {
+		t.Fatalf("mergeFragments() error = %v", err)
+	}
+	if _, err := os.Stat(output + ".loss.json"); !os.IsNotExist(err) {
+		t.Errorf("tape → tape merge wrote a loss report: %v", err)
+	}
+
+	reader, err := codec.NewReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if _, err := reader.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+	// Frames of the second fragment are rebased to the start of the first
+	base := frames[0].GetTimestamp().AsTime()
+	for i := range frames {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := proto.Clone(natives[i]).(*capturepb.CaptureFrame)
+		want.TimestampOffsetMs = uint32(frames[i].GetTimestamp().AsTime().Sub(base).Milliseconds())
+		if !proto.Equal(frame, want) {
+			t.Errorf("frame %d = %v, want %v", i, frame, want)
+		}
+	}
+}
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	queryWhere  string
+	querySelect string
+	queryFormat string
+	queryLimit  int
+)
+
+// defaultQuerySelect is printed for each matching frame when --select is not given.
+const defaultQuerySelect = "file, frame, frame_index, timestamp, game_status, game_clock_display"
+
+func newQueryCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "query <recording>...",
+		Short: "Select frames from recordings with an expression",
+		Long: `The query command evaluates an expression against every frame of one or
+more recordings in any supported format and prints the selected fields of
+the frames that match, as JSON lines or CSV. Frames are read and printed one
+at a time, so queries over long recordings start producing output at once.
+
+Each frame is seen as:
+  file, frame          The recording and the zero-based frame position in it
+  frame_index          The frame index stored in the recording
+  timestamp, elapsed   The wall-clock timestamp and seconds since the first frame
+  round                The round number, counted from the game status
+  session              The session, as in echoreplay JSON. Its fields are also
+                       available directly: game_status, game_clock_display, ...
+  players              All players of all teams, each with team ("blue",
+                       "orange" or "spectator") and speed added
+  disc                 The disc, with speed added
+  events               The events stored in the frame, each with its type
+  event_types          The event type names
+  bones                The player bones, when the recording has them
+
+Expressions support field access (disc.position[1]), arithmetic
+(+ - * / %), comparisons (== != < <= > >=, string comparisons ignore case),
+regular expression matches (name =~ "^ab"), membership (game_status in
+["playing", "score"]), && || ! and the functions:
+  any(list, cond) all(list, cond) count(list[, cond]) filter(list, cond)
+  map(list, expr) sum/min/max(list[, expr]) len(x) abs(x) length(vector)
+  distance(a, b) lower(s) contains(s, substring)
+Inside a list function a leading dot refers to the element, as in
+any(players, .stunned) or max(players, .speed). Missing fields are null.
+
+--select takes a comma-separated list of expressions, each optionally named
+with "as": --select 'frame, disc.speed as speed, count(players, .stunned) as stunned'.`,
+		Example: `  # Frames where the disc is fast during play
+  agent query match.tape --where 'disc.speed > 20 && game_status == "playing"'
+
+  # Frames with a stunned player, as CSV
+  agent query *.echoreplay --where 'any(players, .stunned)' --select 'file, frame, game_clock_display, map(filter(players, .stunned), .display_name) as stunned' --format csv
+
+  # Goals and who scored them
+  agent query match.nevrcap --where '"GoalScored" in event_types' --select 'frame, round, filter(events, .type == "GoalScored")'
+
+  # The first 10 frames where a blue player is above 3 m/s
+  agent query match.tape --where 'any(players, .team == "blue" && .speed > 3)' --limit 10`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runQuery,
+	}
+
+	cmd.Flags().StringVar(&queryWhere, "where", "", "Only frames for which this expression is true (default all frames)")
+	cmd.Flags().StringVar(&querySelect, "select", defaultQuerySelect, "Comma-separated expressions to print, each optionally followed by 'as name'")
+	cmd.Flags().StringVar(&queryFormat, "format", "jsonl", "Output format: jsonl or csv")
+	cmd.Flags().IntVar(&queryLimit, "limit", 0, "Stop after this many matching frames (0 for no limit)")
+
+	return cmd
+}
+
+func runQuery(cmd *cobra.Command, args []string) error {
+	switch {
+	case queryFormat != "jsonl" && queryFormat != "csv":
+		return fmt.Errorf("unsupported format: %s (must be jsonl or csv)", queryFormat)
+	case queryLimit < 0:
+		return fmt.Errorf("limit must not be negative, got %d", queryLimit)
+	}
+
+	q := &frameQuery{}
+	if strings.TrimSpace(queryWhere) != "" {
+		where, err := compileExpr(queryWhere)
+		if err != nil {
+			return fmt.Errorf("--where: %w", err)
+		}
+		q.where = where
+	}
+	columns, err := parseQuerySelect(querySelect)
+	if err != nil {
+		return fmt.Errorf("--select: %w", err)
+	}
+	q.columns = columns
+
+	for _, name := range args {
+		if _, err := os.Stat(name); err != nil {
+			return fmt.Errorf("cannot access input file: %w", err)
+		}
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	writer := newQueryWriter(out, queryFormat, q.names())
+
+	matched := 0
+	for _, name := range args {
+		n, err := q.run(name, writer, queryLimit-matched)
+		matched += n
+		if err != nil {
+			return err
+		}
+		if queryLimit > 0 && matched >= queryLimit {
+			break
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write results: %w", err)
+	}
+	logger.Debug("Query finished", zap.Int("files", len(args)), zap.Int("matched", matched))
+	return nil
+}
+
+// queryColumn is one --select expression and the name it is printed under.
+type queryColumn struct {
+	Name string
+	Expr *Expr
+}
+
+// parseQuerySelect splits a --select list at the commas outside brackets and
+// strings and compiles each expression.
+func parseQuerySelect(list string) ([]queryColumn, error) {
+	var columns []queryColumn
+	for _, part := range splitTopLevel(list) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		source, name := part, part
+		if i := strings.LastIndex(part, " as "); i > 0 && isQueryName(strings.TrimSpace(part[i+4:])) {
+			source, name = strings.TrimSpace(part[:i]), strings.TrimSpace(part[i+4:])
+		}
+		expr, err := compileExpr(source)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, queryColumn{Name: name, Expr: expr})
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("no fields selected")
+	}
+	return columns, nil
+}
+
+// splitTopLevel splits s at commas that are not inside (), [] or a string.
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+func isQueryName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// frameQuery filters frames and evaluates the selected columns.
+type frameQuery struct {
+	where   *Expr
+	columns []queryColumn
+}
+
+func (q *frameQuery) names() []string {
+	names := make([]string, len(q.columns))
+	for i, c := range q.columns {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// uses reports whether the query looks up the named top-level field.
+func (q *frameQuery) uses(name string) bool {
+	if q.where != nil && q.where.Uses(name) {
+		return true
+	}
+	for _, c := range q.columns {
+		if c.Expr.Uses(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// eval returns the selected values for a frame view, or false if the frame
+// does not match.
+func (q *frameQuery) eval(view map[string]any) ([]any, bool) {
+	if q.where != nil && !q.where.Match(view) {
+		return nil, false
+	}
+	values := make([]any, len(q.columns))
+	for i, c := range q.columns {
+		values[i] = c.Expr.Eval(view)
+	}
+	return values, true
+}
+
+// run queries one recording and writes the matching frames, stopping after
+// limit matches if limit is positive. It returns the number of matches.
+func (q *frameQuery) run(filename string, w queryWriter, limit int) (int, error) {
+	source, err := openEventFrameSource(filename, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	// Bones are large; they are only decoded when the query refers to them
+	withBones := q.uses("bones")
+	var (
+		rounds  roundTracker
+		start   time.Time
+		matched int
+	)
+	for position := 0; ; position++ {
+		read, err := source.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			return matched, nil
+		}
+		if err != nil {
+			return matched, fmt.Errorf("failed to read frame %d of %s: %w", position, filename, err)
+		}
+		frame := read.Frame
+		if !withBones {
+			frame.PlayerBones = nil
+		}
+		rounds.track(frame.GetSession().GetGameStatus())
+
+		elapsed := 0.0
+		if ts := frame.GetTimestamp(); ts != nil {
+			if start.IsZero() {
+				start = ts.AsTime()
+			}
+			elapsed = ts.AsTime().Sub(start).Seconds()
+		}
+
+		doc, err := decodeQueryJSON(frame)
+		if err != nil {
+			return matched, fmt.Errorf("failed to decode frame %d of %s: %w", position, filename, err)
+		}
+		events := make([]map[string]any, 0, len(read.Events))
+		for i, event := range read.Events {
+			fields, err := decodeQueryJSON(event)
+			if err != nil {
+				return matched, fmt.Errorf("failed to decode event in frame %d of %s: %w", position, filename, err)
+			}
+			events = append(events, queryEvent(read.Types[i], fields))
+		}
+
+		view := queryFrameView(doc, events, queryFrameInfo{File: filename, Position: position, Round: rounds.round, Elapsed: elapsed})
+		values, ok := q.eval(view)
+		if !ok {
+			continue
+		}
+		if err := w.Write(values); err != nil {
+			return matched, fmt.Errorf("failed to write results: %w", err)
+		}
+		matched++
+		if limit > 0 && matched >= limit {
+			return matched, nil
+		}
+	}
+}
+
+// decodeQueryJSON renders a message as echoreplay-style JSON and decodes it
+// into the generic values the expression language works on.
+func decodeQueryJSON(m proto.Message) (map[string]any, error) {
+	data, err := roundTripMarshaler.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// queryFrameInfo is what a frame view knows beyond the frame itself.
+type queryFrameInfo struct {
+	File     string
+	Position int
+	Round    int
+	Elapsed  float64
+}
+
+// queryFrameView builds the view expressions are evaluated against from a
+// decoded frame and its decoded events.
+func queryFrameView(doc map[string]any, events []map[string]any, info queryFrameInfo) map[string]any {
+	view := make(map[string]any)
+	session, _ := doc["session"].(map[string]any)
+	for key, value := range session {
+		view[key] = value
+	}
+
+	var players []any
+	teams, _ := session["teams"].([]any)
+	for i, t := range teams {
+		team, _ := t.(map[string]any)
+		teamName := ""
+		if i < len(teamNames) {
+			teamName = teamNames[i]
+		}
+		list, _ := team["players"].([]any)
+		for _, p := range list {
+			player, ok := p.(map[string]any)
+			if !ok {
+				continue
+			}
+			player = withSpeed(player)
+			player["team"] = teamName
+			player["team_index"] = float64(i)
+			players = append(players, player)
+		}
+	}
+	if players == nil {
+		players = []any{}
+	}
+
+	var disc any
+	if d, ok := session["disc"].(map[string]any); ok {
+		disc = withSpeed(d)
+	}
+
+	eventList := make([]any, len(events))
+	types := make([]any, len(events))
+	for i, event := range events {
+		eventList[i] = event
+		types[i] = event["type"]
+	}
+
+	view["file"] = info.File
+	view["frame"] = float64(info.Position)
+	view["frame_index"] = doc["frame_index"]
+	view["timestamp"] = doc["timestamp"]
+	view["elapsed"] = info.Elapsed
+	view["round"] = float64(info.Round)
+	view["session"] = session
+	view["players"] = players
+	view["disc"] = disc
+	view["events"] = eventList
+	view["event_types"] = types
+	view["bones"] = doc["player_bones"]
+	return view
+}
+
+// withSpeed returns a copy of an entity with the length of its velocity
+// added as "speed".
+func withSpeed(entity map[string]any) map[string]any {
+	out := make(map[string]any, len(entity)+1)
+	for key, value := range entity {
+		out[key] = value
+	}
+	if v, ok := vectorValue(entity["velocity"]); ok {
+		out["speed"] = vectorNorm(v)
+	}
+	return out
+}
+
+// queryEvent flattens a decoded event: the fields of its oneof payload are
+// lifted next to the event's own fields, and "type" holds the type name.
+func queryEvent(typeName string, fields map[string]any) map[string]any {
+	out := make(map[string]any, len(fields)+1)
+	payloadKey := snakeCase(typeName)
+	for key, value := range fields {
+		if key == payloadKey {
+			if payload, ok := value.(map[string]any); ok {
+				for k, v := range payload {
+					out[k] = v
+				}
+				continue
+			}
+		}
+		out[key] = value
+	}
+	out["type"] = typeName
+	return out
+}
+
+// snakeCase converts an event type name such as GoalScored to its field
+// name, goal_scored.
+func snakeCase(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// queryWriter prints query results one row at a time.
+type queryWriter interface {
+	Write(values []any) error
+	Flush() error
+}
+
+func newQueryWriter(w io.Writer, format string, names []string) queryWriter {
+	if format == "csv" {
+		return &csvQueryWriter{w: csv.NewWriter(w), names: names}
+	}
+	return &jsonlQueryWriter{w: w, names: names}
+}
+
+// jsonlQueryWriter prints one JSON object per row with the keys in --select
+// order.
+type jsonlQueryWriter struct {
+	w     io.Writer
+	names []string
+	buf   []byte
+}
+
+func (j *jsonlQueryWriter) Write(values []any) error {
+	j.buf = append(j.buf[:0], '{')
+	for i, value := range values {
+		if i > 0 {
+			j.buf = append(j.buf, ',')
+		}
+		key, _ := json.Marshal(j.names[i])
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		j.buf = append(j.buf, key...)
+		j.buf = append(j.buf, ':')
+		j.buf = append(j.buf, data...)
+	}
+	j.buf = append(j.buf, '}', '\n')
+	_, err := j.w.Write(j.buf)
+	return err
+}
+
+func (j *jsonlQueryWriter) Flush() error { return nil }
+
+// csvQueryWriter prints a header row and then one row per frame. Lists and
+// objects are written as compact JSON.
+type csvQueryWriter struct {
+	w      *csv.Writer
+	names  []string
+	header bool
+}
+
+func (c *csvQueryWriter) Write(values []any) error {
+	if !c.header {
+		if err := c.w.Write(c.names); err != nil {
+			return err
+		}
+		c.header = true
+	}
+	record := make([]string, len(values))
+	for i, value := range values {
+		record[i] = csvQueryValue(value)
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvQueryWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+func csvQueryValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,894 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The query expression language evaluates over a frame view decoded from
+// JSON: nil, bool, float64, string, []any and map[string]any.
+//
+//	expr    = or
+//	or      = and { "||" and }
+//	and     = compare { "&&" compare }
+//	compare = sum [ ("==" | "!=" | "<" | "<=" | ">" | ">=" | "=~" | "in") sum ]
+//	sum     = product { ("+" | "-") product }
+//	product = unary { ("*" | "/" | "%") unary }
+//	unary   = ("!" | "-") unary | postfix
+//	postfix = primary { "." name | "[" expr "]" }
+//	primary = number | string | "true" | "false" | "null" | "[" [ expr { "," expr } ] "]"
+//	        | name "(" [ expr { "," expr } ] ")" | name | "." [ name ] | "(" expr ")"
+//
+// A bare name looks up the frame view; a leading dot refers to the current
+// element inside list functions such as any(players, .stunned). Missing
+// fields and operations on the wrong types evaluate to null rather than
+// failing, so one odd frame does not stop a query.
+
+// exprNode is a parsed expression.
+type exprNode interface {
+	eval(env *exprEnv) any
+}
+
+// exprEnv is the evaluation context: the frame view and the element bound by
+// the innermost list function.
+type exprEnv struct {
+	root map[string]any
+	elem any
+}
+
+// Expr is a compiled query expression.
+type Expr struct {
+	source string
+	root   exprNode
+}
+
+// compileExpr parses an expression.
+func compileExpr(source string) (*Expr, error) {
+	tokens, err := lexExpr(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", source, err)
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, fmt.Errorf("invalid expression %q: unexpected %s at offset %d", source, tok, tok.pos)
+	}
+	return &Expr{source: source, root: node}, nil
+}
+
+// Eval evaluates the expression against a frame view.
+func (e *Expr) Eval(root map[string]any) any {
+	return e.root.eval(&exprEnv{root: root})
+}
+
+// Match evaluates the expression as a condition.
+func (e *Expr) Match(root map[string]any) bool {
+	return truthy(e.Eval(root))
+}
+
+// Uses reports whether the expression looks up the named top-level field.
+func (e *Expr) Uses(name string) bool {
+	return nodeUses(e.root, name)
+}
+
+func (e *Expr) String() string { return e.source }
+
+// Tokens
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokNumber
+	tokString
+	tokName
+	tokOp
+)
+
+type exprToken struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  int
+}
+
+func (t exprToken) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of expression"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// exprOperators are matched longest first.
+var exprOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ",", "."}
+
+func lexExpr(source string) ([]exprToken, error) {
+	var tokens []exprToken
+	for i := 0; i < len(source); {
+		c := rune(source[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+
+		case c >= '0' && c <= '9':
+			start := i
+			for i < len(source) && (isDigit(source[i]) || source[i] == '.' || source[i] == 'e' || source[i] == 'E' ||
+				((source[i] == '-' || source[i] == '+') && (source[i-1] == 'e' || source[i-1] == 'E'))) {
+				i++
+			}
+			n, err := strconv.ParseFloat(source[start:i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q at offset %d", source[start:i], start)
+			}
+			tokens = append(tokens, exprToken{kind: tokNumber, text: source[start:i], num: n, pos: start})
+
+		case c == '"' || c == '\'':
+			start := i
+			i++
+			var b strings.Builder
+			for ; i < len(source) && rune(source[i]) != c; i++ {
+				if source[i] == '\\' && i+1 < len(source) {
+					i++
+				}
+				b.WriteByte(source[i])
+			}
+			if i == len(source) {
+				return nil, fmt.Errorf("unterminated string at offset %d", start)
+			}
+			i++
+			tokens = append(tokens, exprToken{kind: tokString, text: b.String(), pos: start})
+
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(source) && (source[i] == '_' || isDigit(source[i]) || unicode.IsLetter(rune(source[i]))) {
+				i++
+			}
+			tokens = append(tokens, exprToken{kind: tokName, text: source[start:i], pos: start})
+
+		default:
+			op := ""
+			for _, candidate := range exprOperators {
+				if strings.HasPrefix(source[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character %q at offset %d", c, i)
+			}
+			tokens = append(tokens, exprToken{kind: tokOp, text: op, pos: i})
+			i += len(op)
+		}
+	}
+	return append(tokens, exprToken{kind: tokEOF, pos: len(source)}), nil
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// Parser
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+}
+
+func (p *exprParser) peek() exprToken { return p.tokens[p.pos] }
+
+func (p *exprParser) next() exprToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// accept consumes the next token if it is one of the given operators or
+// keywords.
+func (p *exprParser) accept(ops ...string) (string, bool) {
+	tok := p.peek()
+	if (tok.kind == tokOp || tok.kind == tokName) && slices.Contains(ops, tok.text) {
+		p.pos++
+		return tok.text, true
+	}
+	return "", false
+}
+
+func (p *exprParser) expect(op string) error {
+	if _, ok := p.accept(op); !ok {
+		tok := p.peek()
+		return fmt.Errorf("expected %q, got %s at offset %d", op, tok, tok.pos)
+	}
+	return nil
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("||"); !ok {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{op: "||", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		if _, ok := p.accept("&&"); !ok {
+			return left, nil
+		}
+		right, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{op: "&&", left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseCompare() (exprNode, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := p.accept("==", "!=", "<", "<=", ">", ">=", "=~", "in")
+	if !ok {
+		return left, nil
+	}
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if op == "=~" {
+		lit, ok := right.(*literalNode)
+		pattern, isString := lit.value().(string)
+		if !ok || !isString {
+			return nil, fmt.Errorf("=~ needs a string pattern")
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		return &matchNode{left: left, re: re}, nil
+	}
+	return &binaryNode{op: op, left: left, right: right}, nil
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("+", "-")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseProduct() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op, ok := p.accept("*", "/", "%")
+		if !ok {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryNode{op: op, left: left, right: right}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if op, ok := p.accept("!", "-"); ok {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op: op, operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.peek().kind == tokOp && p.peek().text == ".":
+			p.next()
+			name := p.next()
+			if name.kind != tokName {
+				return nil, fmt.Errorf("expected a field name after '.', got %s at offset %d", name, name.pos)
+			}
+			node = &fieldNode{target: node, name: name.text}
+		case p.peek().kind == tokOp && p.peek().text == "[":
+			p.next()
+			index, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			node = &indexNode{target: node, index: index}
+		default:
+			return node, nil
+		}
+	}
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokNumber:
+		return &literalNode{val: tok.num}, nil
+	case tokString:
+		return &literalNode{val: tok.text}, nil
+
+	case tokName:
+		switch tok.text {
+		case "true":
+			return &literalNode{val: true}, nil
+		case "false":
+			return &literalNode{val: false}, nil
+		case "null":
+			return &literalNode{val: nil}, nil
+		}
+		if _, ok := p.accept("("); ok {
+			return p.parseCall(tok)
+		}
+		return &rootNode{name: tok.text}, nil
+
+	case tokOp:
+		switch tok.text {
+		case "(":
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			return node, p.expect(")")
+		case "[":
+			list := &listNode{}
+			if _, ok := p.accept("]"); ok {
+				return list, nil
+			}
+			for {
+				item, err := p.parseOr()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+				if _, ok := p.accept("]"); ok {
+					return list, nil
+				}
+				if err := p.expect(","); err != nil {
+					return nil, err
+				}
+			}
+		case ".":
+			// .name is a field of the current element; a lone dot is the element
+			if next := p.peek(); next.kind == tokName {
+				p.next()
+				return &fieldNode{target: elemNode{}, name: next.text}, nil
+			}
+			return elemNode{}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %s at offset %d", tok, tok.pos)
+}
+
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	fn, ok := exprFunctions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %q at offset %d", name.text, name.pos)
+	}
+	call := &callNode{name: name.text, fn: fn}
+	if _, ok := p.accept(")"); !ok {
+		for {
+			arg, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			call.args = append(call.args, arg)
+			if _, ok := p.accept(")"); ok {
+				break
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(call.args) < fn.minArgs || len(call.args) > fn.maxArgs {
+		return nil, fmt.Errorf("%s() takes %s, got %d", name.text, fn.arity(), len(call.args))
+	}
+	return call, nil
+}
+
+// Nodes
+
+type literalNode struct{ val any }
+
+func (n *literalNode) eval(*exprEnv) any { return n.val }
+
+func (n *literalNode) value() any {
+	if n == nil {
+		return nil
+	}
+	return n.val
+}
+
+type rootNode struct{ name string }
+
+func (n *rootNode) eval(env *exprEnv) any { return env.root[n.name] }
+
+type elemNode struct{}
+
+func (elemNode) eval(env *exprEnv) any { return env.elem }
+
+type fieldNode struct {
+	target exprNode
+	name   string
+}
+
+func (n *fieldNode) eval(env *exprEnv) any {
+	if m, ok := n.target.eval(env).(map[string]any); ok {
+		return m[n.name]
+	}
+	return nil
+}
+
+type indexNode struct {
+	target, index exprNode
+}
+
+func (n *indexNode) eval(env *exprEnv) any {
+	switch target := n.target.eval(env).(type) {
+	case []any:
+		i, ok := n.index.eval(env).(float64)
+		if !ok || i != math.Trunc(i) {
+			return nil
+		}
+		if i < 0 {
+			i += float64(len(target))
+		}
+		if i < 0 || int(i) >= len(target) {
+			return nil
+		}
+		return target[int(i)]
+	case map[string]any:
+		if key, ok := n.index.eval(env).(string); ok {
+			return target[key]
+		}
+	}
+	return nil
+}
+
+type listNode struct{ items []exprNode }
+
+func (n *listNode) eval(env *exprEnv) any {
+	out := make([]any, len(n.items))
+	for i, item := range n.items {
+		out[i] = item.eval(env)
+	}
+	return out
+}
+
+type logicNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *logicNode) eval(env *exprEnv) any {
+	left := truthy(n.left.eval(env))
+	if n.op == "&&" {
+		return left && truthy(n.right.eval(env))
+	}
+	return left || truthy(n.right.eval(env))
+}
+
+type unaryNode struct {
+	op      string
+	operand exprNode
+}
+
+func (n *unaryNode) eval(env *exprEnv) any {
+	v := n.operand.eval(env)
+	if n.op == "!" {
+		return !truthy(v)
+	}
+	if f, ok := v.(float64); ok {
+		return -f
+	}
+	return nil
+}
+
+type matchNode struct {
+	left exprNode
+	re   *regexp.Regexp
+}
+
+func (n *matchNode) eval(env *exprEnv) any {
+	s, ok := n.left.eval(env).(string)
+	return ok && n.re.MatchString(s)
+}
+
+type binaryNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *binaryNode) eval(env *exprEnv) any {
+	left, right := n.left.eval(env), n.right.eval(env)
+	switch n.op {
+	case "==":
+		return valuesEqual(left, right)
+	case "!=":
+		return !valuesEqual(left, right)
+	case "in":
+		switch r := right.(type) {
+		case []any:
+			return slices.ContainsFunc(r, func(v any) bool { return valuesEqual(left, v) })
+		case string:
+			s, ok := left.(string)
+			return ok && strings.Contains(r, s)
+		case map[string]any:
+			s, ok := left.(string)
+			_, found := r[s]
+			return ok && found
+		}
+		return false
+	case "<", "<=", ">", ">=":
+		c, ok := compareValues(left, right)
+		if !ok {
+			return false
+		}
+		switch n.op {
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		}
+		return c >= 0
+	}
+
+	if n.op == "+" {
+		if l, ok := left.(string); ok {
+			if r, ok := right.(string); ok {
+				return l + r
+			}
+		}
+	}
+	l, lok := left.(float64)
+	r, rok := right.(float64)
+	if !lok || !rok {
+		return nil
+	}
+	switch n.op {
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "/":
+		if r == 0 {
+			return nil
+		}
+		return l / r
+	case "%":
+		if r == 0 {
+			return nil
+		}
+		return math.Mod(l, r)
+	}
+	return nil
+}
+
+type callNode struct {
+	name string
+	fn   exprFunction
+	args []exprNode
+}
+
+func (n *callNode) eval(env *exprEnv) any { return n.fn.call(env, n.args) }
+
+// nodeUses reports whether a node looks up the named top-level field.
+func nodeUses(node exprNode, name string) bool {
+	switch n := node.(type) {
+	case *rootNode:
+		return n.name == name
+	case *fieldNode:
+		return nodeUses(n.target, name)
+	case *indexNode:
+		return nodeUses(n.target, name) || nodeUses(n.index, name)
+	case *listNode:
+		return slices.ContainsFunc(n.items, func(item exprNode) bool { return nodeUses(item, name) })
+	case *logicNode:
+		return nodeUses(n.left, name) || nodeUses(n.right, name)
+	case *binaryNode:
+		return nodeUses(n.left, name) || nodeUses(n.right, name)
+	case *unaryNode:
+		return nodeUses(n.operand, name)
+	case *matchNode:
+		return nodeUses(n.left, name)
+	case *callNode:
+		return slices.ContainsFunc(n.args, func(arg exprNode) bool { return nodeUses(arg, name) })
+	}
+	return false
+}
+
+// Functions
+
+// exprFunction is a built-in function. Arguments are passed unevaluated so
+// that list functions can evaluate their second argument once per element.
+type exprFunction struct {
+	minArgs, maxArgs int
+	call             func(env *exprEnv, args []exprNode) any
+}
+
+func (f exprFunction) arity() string {
+	if f.minArgs == f.maxArgs {
+		return fmt.Sprintf("%d argument(s)", f.minArgs)
+	}
+	return fmt.Sprintf("%d to %d arguments", f.minArgs, f.maxArgs)
+}
+
+// exprFunctions are the built-in functions. The list functions take a list
+// and an expression evaluated for each element, which the expression refers
+// to with a leading dot.
+var exprFunctions map[string]exprFunction
+
+func init() {
+	exprFunctions = map[string]exprFunction{
+		"any": {2, 2, func(env *exprEnv, args []exprNode) any {
+			return slices.ContainsFunc(listArg(env, args[0]), func(v any) bool { return truthy(evalWith(env, args[1], v)) })
+		}},
+		"all": {2, 2, func(env *exprEnv, args []exprNode) any {
+			return !slices.ContainsFunc(listArg(env, args[0]), func(v any) bool { return !truthy(evalWith(env, args[1], v)) })
+		}},
+		"count": {1, 2, func(env *exprEnv, args []exprNode) any {
+			list := listArg(env, args[0])
+			if len(args) == 1 {
+				return float64(len(list))
+			}
+			n := 0
+			for _, v := range list {
+				if truthy(evalWith(env, args[1], v)) {
+					n++
+				}
+			}
+			return float64(n)
+		}},
+		"filter": {2, 2, func(env *exprEnv, args []exprNode) any {
+			out := []any{}
+			for _, v := range listArg(env, args[0]) {
+				if truthy(evalWith(env, args[1], v)) {
+					out = append(out, v)
+				}
+			}
+			return out
+		}},
+		"map": {2, 2, func(env *exprEnv, args []exprNode) any {
+			list := listArg(env, args[0])
+			out := make([]any, len(list))
+			for i, v := range list {
+				out[i] = evalWith(env, args[1], v)
+			}
+			return out
+		}},
+		"sum": {1, 2, func(env *exprEnv, args []exprNode) any {
+			total := 0.0
+			for _, v := range mappedNumbers(env, args) {
+				total += v
+			}
+			return total
+		}},
+		"min": {1, 2, func(env *exprEnv, args []exprNode) any {
+			if values := mappedNumbers(env, args); len(values) > 0 {
+				return slices.Min(values)
+			}
+			return nil
+		}},
+		"max": {1, 2, func(env *exprEnv, args []exprNode) any {
+			if values := mappedNumbers(env, args); len(values) > 0 {
+				return slices.Max(values)
+			}
+			return nil
+		}},
+		"len": {1, 1, func(env *exprEnv, args []exprNode) any {
+			switch v := args[0].eval(env).(type) {
+			case []any:
+				return float64(len(v))
+			case map[string]any:
+				return float64(len(v))
+			case string:
+				return float64(len(v))
+			}
+			return nil
+		}},
+		"abs": {1, 1, func(env *exprEnv, args []exprNode) any {
+			if f, ok := args[0].eval(env).(float64); ok {
+				return math.Abs(f)
+			}
+			return nil
+		}},
+		"length": {1, 1, func(env *exprEnv, args []exprNode) any {
+			if v, ok := vectorValue(args[0].eval(env)); ok {
+				return vectorNorm(v)
+			}
+			return nil
+		}},
+		"distance": {2, 2, func(env *exprEnv, args []exprNode) any {
+			a, aOK := vectorValue(args[0].eval(env))
+			b, bOK := vectorValue(args[1].eval(env))
+			if !aOK || !bOK {
+				return nil
+			}
+			return vectorNorm([3]float64{a[0] - b[0], a[1] - b[1], a[2] - b[2]})
+		}},
+		"lower": {1, 1, func(env *exprEnv, args []exprNode) any {
+			if s, ok := args[0].eval(env).(string); ok {
+				return strings.ToLower(s)
+			}
+			return nil
+		}},
+		"contains": {2, 2, func(env *exprEnv, args []exprNode) any {
+			s, sOK := args[0].eval(env).(string)
+			sub, subOK := args[1].eval(env).(string)
+			return sOK && subOK && strings.Contains(strings.ToLower(s), strings.ToLower(sub))
+		}},
+	}
+}
+
+// evalWith evaluates node with elem as the current element.
+func evalWith(env *exprEnv, node exprNode, elem any) any {
+	return node.eval(&exprEnv{root: env.root, elem: elem})
+}
+
+func listArg(env *exprEnv, node exprNode) []any {
+	list, _ := node.eval(env).([]any)
+	return list
+}
+
+// mappedNumbers evaluates args[0] as a list, maps it through args[1] if given,
+// and keeps the numbers.
+func mappedNumbers(env *exprEnv, args []exprNode) []float64 {
+	var out []float64
+	for _, v := range listArg(env, args[0]) {
+		if len(args) > 1 {
+			v = evalWith(env, args[1], v)
+		}
+		if f, ok := v.(float64); ok {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// vectorValue reads a position or velocity: a list [x, y, z] or an object
+// with x, y and z.
+func vectorValue(v any) ([3]float64, bool) {
+	var out [3]float64
+	switch v := v.(type) {
+	case []any:
+		if len(v) != 3 {
+			return out, false
+		}
+		for i, c := range v {
+			f, ok := c.(float64)
+			if !ok {
+				return out, false
+			}
+			out[i] = f
+		}
+		return out, true
+	case map[string]any:
+		for i, key := range []string{"x", "y", "z"} {
+			f, _ := v[key].(float64)
+			out[i] = f
+		}
+		return out, true
+	}
+	return out, false
+}
+
+func vectorNorm(v [3]float64) float64 {
+	return math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])
+}
+
+// Values
+
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	case []any:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	}
+	return true
+}
+
+func valuesEqual(a, b any) bool {
+	switch a := a.(type) {
+	case nil:
+		return b == nil
+	case bool:
+		b, ok := b.(bool)
+		return ok && a == b
+	case float64:
+		b, ok := b.(float64)
+		return ok && a == b
+	case string:
+		b, ok := b.(string)
+		return ok && strings.EqualFold(a, b)
+	case []any:
+		b, ok := b.([]any)
+		return ok && slices.EqualFunc(a, b, valuesEqual)
+	}
+	return false
+}
+
+// compareValues orders two numbers or two strings.
+func compareValues(a, b any) (int, bool) {
+	switch a := a.(type) {
+	case float64:
+		if b, ok := b.(float64); ok {
+			switch {
+			case a < b:
+				return -1, true
+			case a > b:
+				return 1, true
+			}
+			return 0, true
+		}
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testQueryView(t *testing.T) map[string]any {
+	t.Helper()
+	var view map[string]any
+	err := json.Unmarshal([]byte(`{
+		"game_status": "playing",
+		"game_clock_display": "04:12.33",
+		"disc": {"position": [1, 2, 3], "speed": 24.5},
+		"players": [
+			{"display_name": "Alpha", "team": "blue", "speed": 3.5, "stunned": false, "position": [0, 0, 0]},
+			{"display_name": "Bravo", "team": "orange", "speed": 6, "stunned": true, "position": [3, 4, 0]},
+			{"display_name": "Charlie", "team": "orange", "speed": 1, "stunned": true}
+		],
+		"event_types": ["DiscThrown"]
+	}`), &view)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return view
+}
+
+func TestExprEval(t *testing.T) {
+	view := testQueryView(t)
+	tests := []struct {
+		expr string
+		want any
+	}{
+		{`disc.speed > 20 && game_status == "playing"`, true},
+		{`disc.speed > 20 && game_status == "score"`, false},
+		{`game_status == "PLAYING"`, true},
+		{`any(players, .stunned)`, true},
+		{`all(players, .stunned)`, false},
+		{`count(players, .team == "orange" && .stunned)`, 2.0},
+		{`count(players)`, 3.0},
+		{`map(filter(players, .stunned), .display_name)`, []any{"Bravo", "Charlie"}},
+		{`max(players, .speed)`, 6.0},
+		{`sum(players, .speed) / 2`, 5.25},
+		{`min(filter(players, .team == "red"), .speed)`, nil},
+		{`players[1].display_name`, "Bravo"},
+		{`players[-1].display_name`, "Charlie"},
+		{`players[5].display_name`, nil},
+		{`disc.position[2] * 2 + 1`, 7.0},
+		{`-disc.position[0] % 2`, -1.0},
+		{`distance(players[0].position, players[1].position)`, 5.0},
+		{`length(players[1].position)`, 5.0},
+		{`game_status in ["score", "playing"]`, true},
+		{`"DiscThrown" in event_types`, true},
+		{`players[0].display_name =~ "^Al"`, true},
+		{`contains(players[2].display_name, "ARL")`, true},
+		{`lower(players[0].display_name) + "!"`, "alpha!"},
+		{`len(game_status)`, 7.0},
+		{`missing.field`, nil},
+		{`missing > 3 || !missing`, true},
+		{`disc.speed / 0`, nil},
+		{`1 + 2 * 3 == 7 && (1 + 2) * 3 == 9`, true},
+		{`abs(-2.5e1)`, 25.0},
+		{`'single' == "single"`, true},
+		{`null == missing`, true},
+	}
+	for _, tt := range tests {
+		expr, err := compileExpr(tt.expr)
+		if err != nil {
+			t.Errorf("compileExpr(%q): %v", tt.expr, err)
+			continue
+		}
+		if got := expr.Eval(view); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestCompileExpr_Errors(t *testing.T) {
+	tests := map[string]string{
+		`disc.speed >`:          "unexpected end of expression",
+		`(1 + 2`:                `expected ")"`,
+		`foo(players)`:          `unknown function "foo"`,
+		`any(players)`:          "any() takes 2 argument(s), got 1",
+		`"open`:                 "unterminated string",
+		`disc.speed # 3`:        "unexpected character",
+		`name =~ other`:         "=~ needs a string pattern",
+		`name =~ "("`:           "invalid pattern",
+		`disc.speed > 1 2`:      "unexpected \"2\" at offset 15",
+		`players.`:              "expected a field name",
+		`count(players, .a, 1)`: "count() takes 1 to 2 arguments, got 3",
+	}
+	for source, want := range tests {
+		_, err := compileExpr(source)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("compileExpr(%q) error = %v, want %q", source, err, want)
+		}
+	}
+}
+
+func TestExprUses(t *testing.T) {
+	expr, err := compileExpr(`any(players, .bones) || count(bones[0].x) > 0`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expr.Uses("bones") || !expr.Uses("players") || expr.Uses("disc") {
+		t.Error("Uses reported the wrong fields")
+	}
+
+	// .bones is a field of the element, not the top-level bones
+	expr, _ = compileExpr(`any(players, .bones)`)
+	if expr.Uses("bones") {
+		t.Error("Uses(bones) = true for an element field")
+	}
+}
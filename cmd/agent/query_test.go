@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseQuerySelect(t *testing.T) {
+	columns, err := parseQuerySelect(`frame, disc.speed as speed, map(filter(players, .stunned), .display_name) as stunned, "a,b"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range columns {
+		names = append(names, c.Name)
+	}
+	if got := strings.Join(names, "|"); got != `frame|speed|stunned|"a,b"` {
+		t.Errorf("column names = %s", got)
+	}
+
+	if _, err := parseQuerySelect(" , "); err == nil {
+		t.Error("empty select accepted")
+	}
+	if _, err := parseQuerySelect("frame, disc.speed >"); err == nil {
+		t.Error("invalid select expression accepted")
+	}
+}
+
+func TestQueryFrameView(t *testing.T) {
+	var doc map[string]any
+	err := json.Unmarshal([]byte(`{
+		"frame_index": 120,
+		"timestamp": "2025-03-01T12:00:00Z",
+		"session": {
+			"game_status": "playing",
+			"disc": {"position": [0, 1, 0], "velocity": [3, 4, 0]},
+			"teams": [
+				{"players": [{"display_name": "Alpha", "velocity": [0, 0, 2]}]},
+				{"players": [{"display_name": "Bravo", "stunned": true}]},
+				{}
+			]
+		}
+	}`), &doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := []map[string]any{queryEvent("GoalScored", map[string]any{"goal_scored": map[string]any{"player_name": "Alpha", "points": 2.0}})}
+
+	view := queryFrameView(doc, events, queryFrameInfo{File: "match.tape", Position: 7, Round: 2, Elapsed: 1.5})
+	query := func(source string) any {
+		t.Helper()
+		expr, err := compileExpr(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return expr.Eval(view)
+	}
+
+	checks := map[string]any{
+		`file`:                        "match.tape",
+		`frame`:                       7.0,
+		`frame_index`:                 120.0,
+		`round`:                       2.0,
+		`elapsed`:                     1.5,
+		`game_status`:                 "playing",
+		`session.game_status`:         "playing",
+		`disc.speed`:                  5.0,
+		`players[0].speed`:            2.0,
+		`players[1].team`:             "orange",
+		`players[1].speed`:            nil,
+		`count(players)`:              2.0,
+		`any(players, .stunned)`:      true,
+		`events[0].type`:              "GoalScored",
+		`events[0].player_name`:       "Alpha",
+		`"GoalScored" in event_types`: true,
+		`bones`:                       nil,
+	}
+	for source, want := range checks {
+		if got := query(source); got != want {
+			t.Errorf("%s = %#v, want %#v", source, got, want)
+		}
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for name, want := range map[string]string{
+		"GoalScored":            "goal_scored",
+		"DiscPossessionChanged": "disc_possession_changed",
+		"generic":               "generic",
+	} {
+		if got := snakeCase(name); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestQueryWriters(t *testing.T) {
+	names := []string{"frame", "status", "stunned", "speed"}
+	rows := [][]any{
+		{0.0, "playing", []any{"Bravo"}, 3.25},
+		{1.0, nil, []any{}, true},
+	}
+
+	var jsonl bytes.Buffer
+	w := newQueryWriter(&jsonl, "jsonl", names)
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Flush()
+	want := `{"frame":0,"status":"playing","stunned":["Bravo"],"speed":3.25}` + "\n" +
+		`{"frame":1,"status":null,"stunned":[],"speed":true}` + "\n"
+	if jsonl.String() != want {
+		t.Errorf("jsonl output:\n%s\nwant:\n%s", jsonl.String(), want)
+	}
+
+	var csvOut bytes.Buffer
+	w = newQueryWriter(&csvOut, "csv", names)
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want = "frame,status,stunned,speed\n0,playing,\"[\"\"Bravo\"\"]\",3.25\n1,,[],true\n"
+	if csvOut.String() != want {
+		t.Errorf("csv output:\n%s\nwant:\n%s", csvOut.String(), want)
+	}
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	enginev1 "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/engine/v1"
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Timestamp repair modes.
+const (
+	repairClamp       = "clamp"       // set to the previous frame's timestamp
+	repairInterpolate = "interpolate" // spread evenly up to the next good timestamp
+)
+
+// maxPendingRepairFrames bounds how many frames with bad timestamps are held
+// back waiting for a good one to interpolate towards. Longer runs are clamped.
+const maxPendingRepairFrames = 600
+
+// duplicateWindow is how many recent frames a frame is compared with when
+// looking for duplicates.
+const duplicateWindow = 64
+
+// maxReportedSkippedLines caps the skipped lines listed in a repair report.
+const maxReportedSkippedLines = 1000
+
+// echoReplayTimeLayouts are the timestamp formats found in echoreplay lines.
+var echoReplayTimeLayouts = []string{
+	"2006/01/02 15:04:05.000",
+	"2006/01/02 15:04:05",
+	time.RFC3339Nano,
+}
+
+var echoReplayUnmarshaler = protojson.UnmarshalOptions{DiscardUnknown: true}
+
+// RepairReport lists what --repair changed while converting one file. It is
+// written to <output>.repair.json when anything was repaired.
+type RepairReport struct {
+	Input                  string        `json:"input"`
+	Output                 string        `json:"output"`
+	FramesRead             int           `json:"frames_read"`
+	FramesWritten          int           `json:"frames_written"`
+	LinesSkipped           int           `json:"lines_skipped"`
+	SkippedLines           []SkippedLine `json:"skipped_lines,omitempty"`
+	Truncated              string        `json:"truncated,omitempty"` // where reading stopped early, and why
+	DuplicatesDropped      int           `json:"duplicates_dropped"`
+	TimestampsClamped      int           `json:"timestamps_clamped"`
+	TimestampsInterpolated int           `json:"timestamps_interpolated"`
+	SessionIDsFilled       int           `json:"session_ids_filled"`
+	BonesDropped           int           `json:"bones_dropped"` // frames kept without their undecodable bone data
+}
+
+// SkippedLine is an echoreplay line that could not be decoded.
+type SkippedLine struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+func (r *RepairReport) skipLine(line int, err error) {
+	r.LinesSkipped++
+	if len(r.SkippedLines) < maxReportedSkippedLines {
+		r.SkippedLines = append(r.SkippedLines, SkippedLine{Line: line, Error: err.Error()})
+	}
+}
+
+// Repaired reports whether anything in the input had to be fixed or dropped.
+func (r *RepairReport) Repaired() bool {
+	return r.LinesSkipped > 0 || r.Truncated != "" || r.DuplicatesDropped > 0 ||
+		r.TimestampsClamped > 0 || r.TimestampsInterpolated > 0 ||
+		r.SessionIDsFilled > 0 || r.BonesDropped > 0
+}
+
+func (r *RepairReport) Write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode repair report: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// String summarizes the report for the console.
+func (r *RepairReport) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Repaired %s: %d frames read, %d written\n", r.Input, r.FramesRead, r.FramesWritten)
+	if r.LinesSkipped > 0 {
+		var lines []string
+		for _, skipped := range r.SkippedLines[:min(len(r.SkippedLines), 10)] {
+			lines = append(lines, fmt.Sprint(skipped.Line))
+		}
+		more := ""
+		if r.LinesSkipped > len(lines) {
+			more = ", ..."
+		}
+		fmt.Fprintf(&b, "  undecodable lines skipped: %d (lines %s%s)\n", r.LinesSkipped, strings.Join(lines, ", "), more)
+	}
+	if r.Truncated != "" {
+		fmt.Fprintf(&b, "  input truncated: %s\n", r.Truncated)
+	}
+	if r.DuplicatesDropped > 0 {
+		fmt.Fprintf(&b, "  duplicate frames dropped: %d\n", r.DuplicatesDropped)
+	}
+	if r.TimestampsClamped+r.TimestampsInterpolated > 0 {
+		fmt.Fprintf(&b, "  timestamps fixed: %d clamped, %d interpolated\n", r.TimestampsClamped, r.TimestampsInterpolated)
+	}
+	if r.SessionIDsFilled > 0 {
+		fmt.Fprintf(&b, "  session IDs filled: %d\n", r.SessionIDsFilled)
+	}
+	if r.BonesDropped > 0 {
+		fmt.Fprintf(&b, "  undecodable bone data dropped: %d frames\n", r.BonesDropped)
+	}
+	return b.String()
+}
+
+// openLenientSource opens a file for --repair. Echoreplay lines are decoded
+// one by one so undecodable lines can be skipped; for the binary formats,
+// reading stops at the first corrupt frame and the frames before it are kept.
+func openLenientSource(filename string, report *RepairReport, lossReport *LossReport) (v1FrameSource, error) {
+	switch detectInputFormat(filename) {
+	case "echoreplay":
+		entry, err := openEchoReplayEntry(filename)
+		if err != nil {
+			return nil, err
+		}
+		return newEchoReplayLineSource(entry, report), nil
+
+	case echoReplayUncompressed:
+		file, err := os.Open(filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open echoreplay file: %w", err)
+		}
+		return newEchoReplayLineSource(file, report), nil
+	}
+
+	source, err := openV1FrameSource(filename, lossReport)
+	if err != nil {
+		return nil, err
+	}
+	return &truncatingSource{v1FrameSource: source, report: report}, nil
+}
+
+// echoReplayLineSource decodes echoreplay text lines, from the log inside an
+// archive or from an uncompressed file. With a repair report, lines that
+// cannot be decoded are skipped and a truncated end is tolerated; without one,
+// they are errors.
+type echoReplayLineSource struct {
+	file   io.ReadCloser
+	lines  *bufio.Reader
+	line   int
+	frames uint32
+	done   bool
+	report *RepairReport
+}
+
+func newEchoReplayLineSource(file io.ReadCloser, report *RepairReport) *echoReplayLineSource {
+	return &echoReplayLineSource{file: file, lines: bufio.NewReaderSize(file, 64*1024), report: report}
+}
+
+func (s *echoReplayLineSource) Header() *telemetry.TelemetryHeader { return nil }
+
+func (s *echoReplayLineSource) ReadFrame() (*telemetry.LobbySessionStateFrame, error) {
+	for !s.done {
+		raw, err := s.lines.ReadBytes('\n')
+		if err != nil {
+			s.done = true
+			if !errors.Is(err, io.EOF) {
+				if s.report == nil {
+					return nil, fmt.Errorf("line %d: %w", s.line+1, err)
+				}
+				s.report.Truncated = fmt.Sprintf("line %d: %v", s.line+1, err)
+			}
+			if len(raw) == 0 {
+				break
+			}
+		}
+		s.line++
+
+		raw = bytes.TrimRight(raw, "\r\n")
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		frame, err := decodeEchoReplayLine(raw, s.report)
+		if err != nil {
+			if s.report == nil {
+				return nil, fmt.Errorf("line %d: %w", s.line, err)
+			}
+			s.report.skipLine(s.line, err)
+			continue
+		}
+		frame.FrameIndex = s.frames
+		s.frames++
+		return frame, nil
+	}
+	return nil, io.EOF
+}
+
+func (s *echoReplayLineSource) Close() error { return s.file.Close() }
+
+// decodeEchoReplayLine decodes a tab-separated echoreplay line: timestamp,
+// session JSON and optional player bones JSON. A line whose session cannot be
+// decoded is an error. With a repair report, an unparseable timestamp is left
+// nil for the repair step to fill in and undecodable bone data is dropped;
+// without one, both are errors.
+func decodeEchoReplayLine(line []byte, report *RepairReport) (*telemetry.LobbySessionStateFrame, error) {
+	parts := bytes.SplitN(line, []byte("\t"), 3)
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("expected at least 2 tab-separated columns, got %d", len(parts))
+	}
+
+	frame := &telemetry.LobbySessionStateFrame{Session: &enginev1.SessionResponse{}}
+	if err := echoReplayUnmarshaler.Unmarshal(parts[1], frame.Session); err != nil {
+		return nil, fmt.Errorf("failed to parse session JSON: %w", err)
+	}
+
+	if ts, ok := parseEchoReplayTime(string(parts[0])); ok {
+		frame.Timestamp = timestamppb.New(ts)
+	} else if report == nil {
+		return nil, fmt.Errorf("invalid timestamp %q", parts[0])
+	}
+
+	if len(parts) == 3 {
+		if bones := bytes.TrimSpace(parts[2]); len(bones) > 0 {
+			frame.PlayerBones = &enginev1.PlayerBonesResponse{}
+			if err := echoReplayUnmarshaler.Unmarshal(bones, frame.PlayerBones); err != nil {
+				if report == nil {
+					return nil, fmt.Errorf("failed to parse bones JSON: %w", err)
+				}
+				frame.PlayerBones = nil
+				report.BonesDropped++
+			}
+		}
+	}
+	return frame, nil
+}
+
+func parseEchoReplayTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	for _, layout := range echoReplayTimeLayouts {
+		if ts, err := time.Parse(layout, s); err == nil {
+			return ts, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// truncatingSource ends a binary recording at its first unreadable frame.
+type truncatingSource struct {
+	v1FrameSource
+	frames int
+	done   bool
+	report *RepairReport
+}
+
+func (s *truncatingSource) ReadFrame() (*telemetry.LobbySessionStateFrame, error) {
+	if s.done {
+		return nil, io.EOF
+	}
+	frame, err := s.v1FrameSource.ReadFrame()
+	if err != nil {
+		s.done = true
+		if !errors.Is(err, io.EOF) {
+			s.report.Truncated = fmt.Sprintf("frame %d: %v", s.frames, err)
+		}
+		return nil, io.EOF
+	}
+	s.frames++
+	return frame, nil
+}
+
+// repairSource drops duplicate frames, fixes missing and backwards timestamps
+// and fills missing session IDs in the frames of another source. Output frames
+// are renumbered from zero.
+type repairSource struct {
+	source    v1FrameSource
+	mode      string
+	report    *RepairReport
+	sessionID string // capture ID from the header, then the last one seen
+
+	recent    [duplicateWindow][sha256.Size]byte
+	recentLen int
+	recentPos int
+
+	lastTime time.Time
+	haveTime bool
+	pending  []*telemetry.LobbySessionStateFrame // frames waiting for a timestamp
+	ready    []*telemetry.LobbySessionStateFrame // repaired frames not yet returned
+	eof      bool
+	index    uint32
+}
+
+func newRepairSource(source v1FrameSource, mode string, report *RepairReport) *repairSource {
+	return &repairSource{
+		source:    source,
+		mode:      mode,
+		report:    report,
+		sessionID: source.Header().GetCaptureId(),
+	}
+}
+
+func (s *repairSource) Header() *telemetry.TelemetryHeader { return s.source.Header() }
+
+func (s *repairSource) Close() error { return s.source.Close() }
+
+func (s *repairSource) ReadFrame() (*telemetry.LobbySessionStateFrame, error) {
+	for len(s.ready) == 0 {
+		if s.eof {
+			return nil, io.EOF
+		}
+		frame, err := s.source.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			s.eof = true
+			s.clampPending()
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.push(frame)
+	}
+
+	frame := s.ready[0]
+	s.ready = s.ready[1:]
+	frame.FrameIndex = s.index
+	s.index++
+	s.report.FramesWritten++
+	return frame, nil
+}
+
+func (s *repairSource) push(frame *telemetry.LobbySessionStateFrame) {
+	s.report.FramesRead++
+	if s.duplicate(frame) {
+		s.report.DuplicatesDropped++
+		return
+	}
+
+	if session := frame.GetSession(); session != nil {
+		if session.GetSessionId() == "" && s.sessionID != "" {
+			session.SessionId = s.sessionID
+			s.report.SessionIDsFilled++
+		}
+		s.sessionID = session.GetSessionId()
+	}
+
+	ts := frame.GetTimestamp()
+	if ts == nil || !ts.IsValid() || (s.haveTime && ts.AsTime().Before(s.lastTime)) {
+		if s.haveTime && s.mode == repairClamp {
+			frame.Timestamp = timestamppb.New(s.lastTime)
+			s.report.TimestampsClamped++
+			s.ready = append(s.ready, frame)
+			return
+		}
+		s.pending = append(s.pending, frame)
+		if len(s.pending) >= maxPendingRepairFrames {
+			s.clampPending()
+		}
+		return
+	}
+
+	current := ts.AsTime()
+	if s.haveTime {
+		// Spread the pending frames evenly between the surrounding good ones
+		step := current.Sub(s.lastTime) / time.Duration(len(s.pending)+1)
+		for i, p := range s.pending {
+			p.Timestamp = timestamppb.New(s.lastTime.Add(step * time.Duration(i+1)))
+		}
+		s.report.TimestampsInterpolated += len(s.pending)
+	} else {
+		// Frames before the first good timestamp take that timestamp
+		for _, p := range s.pending {
+			p.Timestamp = ts
+		}
+		s.report.TimestampsClamped += len(s.pending)
+	}
+	s.ready = append(s.ready, s.pending...)
+	s.ready = append(s.ready, frame)
+	s.pending = nil
+	s.lastTime, s.haveTime = current, true
+}
+
+// clampPending releases the pending frames with the last good timestamp. If
+// no frame had a timestamp yet, their timestamps are left empty.
+func (s *repairSource) clampPending() {
+	if s.haveTime {
+		for _, p := range s.pending {
+			p.Timestamp = timestamppb.New(s.lastTime)
+		}
+		s.report.TimestampsClamped += len(s.pending)
+	}
+	s.ready = append(s.ready, s.pending...)
+	s.pending = nil
+}
+
+// duplicate reports whether frame is identical to one of the recently read
+// frames, ignoring its frame index.
+func (s *repairSource) duplicate(frame *telemetry.LobbySessionStateFrame) bool {
+	index := frame.FrameIndex
+	frame.FrameIndex = 0
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(frame)
+	frame.FrameIndex = index
+	if err != nil {
+		return false
+	}
+
+	sum := sha256.Sum256(data)
+	for i := range s.recentLen {
+		if s.recent[i] == sum {
+			return true
+		}
+	}
+	s.recent[s.recentPos] = sum
+	s.recentPos = (s.recentPos + 1) % duplicateWindow
+	s.recentLen = min(s.recentLen+1, duplicateWindow)
+	return false
+}
+
+// convertViaV1 converts any input the v1 frame pipeline can read. With
+// --repair, a possibly malformed input is repaired as it is read instead of
+// aborting the conversion on the first bad frame.
+func convertViaV1(inputFile, outputFile, outputFormat string) (*ConversionStats, error) {
+	var lossReport *LossReport
+	if detectInputFormat(inputFile) == "tape" && outputFormat != "tape" {
+		lossReport = newLossReport(inputFile, outputFile)
+	}
+
+	var report *RepairReport
+	var source v1FrameSource
+	var err error
+	if cfg.Converter.Repair {
+		report = &RepairReport{Input: inputFile, Output: outputFile}
+		source, err = openRepairSource(inputFile, report, lossReport)
+	} else {
+		source, err = openV1FrameSource(inputFile, lossReport)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	sink, err := newV1FrameSink(outputFile, outputFormat, source.Header())
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		frame, err := source.ReadFrame()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			sink.Abort()
+			return nil, fmt.Errorf("failed to read frame: %w", err)
+		}
+		if cfg.Converter.ExcludeBones {
+			frame.PlayerBones = nil
+		}
+		if err := sink.WriteFrame(frame); err != nil {
+			sink.Abort()
+			return nil, err
+		}
+	}
+
+	if sink.Frames() == 0 {
+		return nil, fmt.Errorf("input contains no decodable frames")
+	}
+	if err := sink.Close(); err != nil {
+		return nil, err
+	}
+	if report != nil {
+		finishRepairReport(report, outputFile)
+	}
+	if lossReport != nil {
+		saveLossReport(lossReport, outputFile)
+	}
+
+	stats := &ConversionStats{FrameCount: sink.Frames(), Repair: report}
+	if inputInfo, err := os.Stat(inputFile); err == nil {
+		stats.InputSize = inputInfo.Size()
+	}
+	if outputInfo, err := os.Stat(outputFile); err == nil {
+		stats.OutputSize = outputInfo.Size()
+	}
+	return stats, nil
+}
+
+// openRepairSource opens inputFile leniently and repairs its frames.
+func openRepairSource(inputFile string, report *RepairReport, lossReport *LossReport) (v1FrameSource, error) {
+	source, err := openLenientSource(inputFile, report, lossReport)
+	if err != nil {
+		return nil, err
+	}
+	return newRepairSource(source, cfg.Converter.RepairTimestamps, report), nil
+}
+
+// finishRepairReport prints the report and saves it next to the output when
+// anything was repaired.
+func finishRepairReport(report *RepairReport, outputFile string) {
+	if !report.Repaired() {
+		if cfg.Converter.Verbose {
+			logger.Info("No repairs needed", zap.String("input", report.Input))
+		}
+		return
+	}
+
+	fmt.Fprint(consoleOutput(), report.String())
+	reportPath := outputFile + ".repair.json"
+	if err := report.Write(reportPath); err != nil {
+		logger.Warn("Failed to write repair report", zap.String("path", reportPath), zap.Error(err))
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+)
+
+// sliceSource is a v1FrameSource over frames held in memory.
+type sliceSource struct {
+	header *telemetry.TelemetryHeader
+	frames []*telemetry.LobbySessionStateFrame
+}
+
+func (s *sliceSource) Header() *telemetry.TelemetryHeader { return s.header }
+
+func (s *sliceSource) ReadFrame() (*telemetry.LobbySessionStateFrame, error) {
+	if len(s.frames) == 0 {
+		return nil, io.EOF
+	}
+	frame := s.frames[0]
+	s.frames = s.frames[1:]
+	return frame, nil
+}
+
+func (s *sliceSource) Close() error { return nil }
+
+func readRepaired(t *testing.T, source v1FrameSource) []*telemetry.LobbySessionStateFrame {
+	t.Helper()
+	var frames []*telemetry.LobbySessionStateFrame
+	for {
+		frame, err := source.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			return frames
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, frame)
+	}
+}
+
+// repairTestFrame returns a frame at base+ms milliseconds, or without a
+// timestamp if ms is negative.
+func repairTestFrame(ms int, sessionID, clock string) *telemetry.LobbySessionStateFrame {
+	return testV1Frames(1, withOffsetsMs(ms), withSessionID(sessionID), withGameClock(func(int) string { return clock }))[0]
+}
+
+func frameOffsets(frames []*telemetry.LobbySessionStateFrame) []int {
+	offsets := make([]int, len(frames))
+	for i, frame := range frames {
+		offsets[i] = int(frame.GetTimestamp().AsTime().Sub(testFrameBase) / time.Millisecond)
+	}
+	return offsets
+}
+
+func TestRepairSource_Timestamps(t *testing.T) {
+	tests := []struct {
+		name             string
+		mode             string
+		input            []int
+		want             []int
+		wantClamped      int
+		wantInterpolated int
+	}{
+		{"in order", repairInterpolate, []int{0, 100, 200}, []int{0, 100, 200}, 0, 0},
+		{"backwards interpolated", repairInterpolate, []int{0, 100, 50, 20, 400}, []int{0, 100, 200, 300, 400}, 0, 2},
+		{"backwards clamped", repairClamp, []int{0, 100, 50, 200}, []int{0, 100, 100, 200}, 1, 0},
+		{"missing interpolated", repairInterpolate, []int{0, -1, 200}, []int{0, 100, 200}, 0, 1},
+		{"leading missing", repairInterpolate, []int{-1, -1, 100, 200}, []int{100, 100, 100, 200}, 2, 0},
+		{"trailing backwards", repairInterpolate, []int{0, 100, 50}, []int{0, 100, 100}, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := &sliceSource{}
+			for i, ms := range tt.input {
+				source.frames = append(source.frames, repairTestFrame(ms, "s1", string(rune('a'+i))))
+			}
+
+			report := &RepairReport{}
+			frames := readRepaired(t, newRepairSource(source, tt.mode, report))
+
+			if got := frameOffsets(frames); !slices.Equal(got, tt.want) {
+				t.Errorf("timestamps = %v, want %v", got, tt.want)
+			}
+			for i, frame := range frames {
+				if frame.GetFrameIndex() != uint32(i) {
+					t.Errorf("frame %d has index %d", i, frame.GetFrameIndex())
+				}
+			}
+			if report.TimestampsClamped != tt.wantClamped || report.TimestampsInterpolated != tt.wantInterpolated {
+				t.Errorf("clamped %d, interpolated %d; want %d, %d",
+					report.TimestampsClamped, report.TimestampsInterpolated, tt.wantClamped, tt.wantInterpolated)
+			}
+		})
+	}
+}
+
+func TestRepairSource_DropsDuplicatesAndFillsSessionIDs(t *testing.T) {
+	source := &sliceSource{
+		header: &telemetry.TelemetryHeader{CaptureId: "from-header"},
+		frames: []*telemetry.LobbySessionStateFrame{
+			repairTestFrame(0, "", "a"),
+			repairTestFrame(100, "s1", "b"),
+			repairTestFrame(100, "s1", "b"), // duplicated line
+			repairTestFrame(200, "", "c"),
+		},
+	}
+
+	report := &RepairReport{}
+	frames := readRepaired(t, newRepairSource(source, repairInterpolate, report))
+
+	if len(frames) != 3 || report.DuplicatesDropped != 1 {
+		t.Fatalf("got %d frames with %d duplicates dropped, want 3 and 1", len(frames), report.DuplicatesDropped)
+	}
+	var ids []string
+	for _, frame := range frames {
+		ids = append(ids, frame.GetSession().GetSessionId())
+	}
+	if got := strings.Join(ids, ","); got != "from-header,s1,s1" {
+		t.Errorf("session IDs = %s, want from-header,s1,s1", got)
+	}
+	if report.SessionIDsFilled != 2 || report.FramesRead != 4 || report.FramesWritten != 3 {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestParseEchoReplayTime(t *testing.T) {
+	want := time.Date(2025, 6, 1, 12, 30, 5, 250_000_000, time.UTC)
+	for _, s := range []string{"2025/06/01 12:30:05.250", " 2025/06/01 12:30:05.250 ", "2025-06-01T12:30:05.25Z"} {
+		got, ok := parseEchoReplayTime(s)
+		if !ok || !got.Equal(want) {
+			t.Errorf("parseEchoReplayTime(%q) = %v, %v; want %v", s, got, ok, want)
+		}
+	}
+	if _, ok := parseEchoReplayTime("not a time"); ok {
+		t.Error("parseEchoReplayTime accepted garbage")
+	}
+}
+
+func TestRepairReport_String(t *testing.T) {
+	report := &RepairReport{Input: "old.echoreplay", FramesRead: 10, FramesWritten: 7}
+	if report.Repaired() {
+		t.Fatal("empty report claims repairs")
+	}
+	for _, line := range []int{3, 8} {
+		report.skipLine(line, errors.New("failed to parse session JSON"))
+	}
+	report.DuplicatesDropped = 1
+	report.Truncated = "line 12: unexpected EOF"
+
+	got := report.String()
+	for _, want := range []string{"undecodable lines skipped: 2 (lines 3, 8)", "duplicate frames dropped: 1", "input truncated: line 12"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("String() = %q, missing %q", got, want)
+		}
+	}
+}
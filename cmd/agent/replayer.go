@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -56,10 +57,13 @@ func newReplayerCommand() *cobra.Command {
 		Use:   "replay [replay-file...]",
 		Short: "Replay recorded sessions via HTTP server",
 		Long: `The replay command starts an HTTP server that plays back recorded 
-session data from .echoreplay files.`,
+session data from .echoreplay and .tape files.`,
 		Example: `  # Replay a single file
 	  agent replay game.echoreplay
 
+  # Replay a tape recording
+	  agent replay game.tape
+
   # Replay multiple files in sequence
 	  agent replay game1.echoreplay game2.echoreplay
 
@@ -170,7 +174,7 @@ func (rs *ReplayServer) playFile(filename string) error {
 	case ".echoreplay":
 		return rs.playEchoReplayFile(filename)
 	case ".tape":
-		return fmt.Errorf("replayer: .tape replay not yet supported — convert first: agent convert --input %s --format echoreplay", filepath.Base(filename))
+		return rs.playTapeFile(filename)
 	default:
 		return fmt.Errorf("unsupported file format: %s", ext)
 	}
@@ -194,27 +198,56 @@ func (rs *ReplayServer) playEchoReplayFile(filename string) error {
 			return fmt.Errorf("failed to read frame: %w", err)
 		}
 
-		// Calculate delay for 1x playback speed
-		if !lastTimestamp.IsZero() && frame.GetTimestamp() != nil {
-			delay := frame.GetTimestamp().AsTime().Sub(lastTimestamp)
-			if delay > 0 && delay < 10*time.Second { // Cap max delay
-				time.Sleep(delay)
+		rs.showFrame(frame, &lastTimestamp)
+	}
+
+	return nil
+}
+
+func (rs *ReplayServer) playTapeFile(filename string) error {
+	reader, err := newTapeV1Reader(filename, nil)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	var lastTimestamp time.Time
+
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
 			}
-		}
-		if frame.GetTimestamp() != nil {
-			lastTimestamp = frame.GetTimestamp().AsTime()
+			return fmt.Errorf("failed to read frame: %w", err)
 		}
 
-		// Update current frame
-		rs.mu.Lock()
-		rs.currentFrame = frame
-		rs.frameCount++
-		rs.mu.Unlock()
+		rs.showFrame(frame, &lastTimestamp)
 	}
 
 	return nil
 }
 
+// showFrame waits until the frame is due at 1x playback speed, then makes it the current frame.
+func (rs *ReplayServer) showFrame(frame *telemetry.LobbySessionStateFrame, lastTimestamp *time.Time) {
+	// Calculate delay for 1x playback speed
+	if !lastTimestamp.IsZero() && frame.GetTimestamp() != nil {
+		delay := frame.GetTimestamp().AsTime().Sub(*lastTimestamp)
+		if delay > 0 && delay < 10*time.Second { // Cap max delay
+			time.Sleep(delay)
+		}
+	}
+	if frame.GetTimestamp() != nil {
+		*lastTimestamp = frame.GetTimestamp().AsTime()
+	}
+
+	// Update current frame
+	rs.mu.Lock()
+	rs.currentFrame = frame
+	rs.frameCount++
+	rs.mu.Unlock()
+}
+
 func (rs *ReplayServer) handleRoot(w http.ResponseWriter, r *http.Request) {
 	rs.mu.RLock()
 	frame := rs.currentFrame
@@ -0,0 +1,547 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxInterpolationGap is the longest gap between two real frames that is
+// filled with interpolated frames. Longer gaps are pauses or dropouts and are
+// left as they are.
+const maxInterpolationGap = time.Second
+
+// frameResampler changes the frame rate of a recording. Downsampling drops
+// frames closer than the target interval to the previous output frame, but
+// always keeps frames that carry events, and the last frame. Upsampling, if
+// enabled, inserts frames between real frames by interpolating positions and
+// rotations.
+type frameResampler struct {
+	interval    time.Duration
+	interpolate bool
+	emit        func(read *eventFrame, interpolated bool) error
+
+	prev        *eventFrame // last real frame seen
+	prevEmitted bool
+	lastEmitted time.Time
+	outIndex    uint32
+
+	Dropped int
+}
+
+func newFrameResampler(fps int, interpolate bool, emit func(*eventFrame, bool) error) *frameResampler {
+	return &frameResampler{
+		interval:    time.Second / time.Duration(fps),
+		interpolate: interpolate,
+		emit:        emit,
+	}
+}
+
+// Push feeds the next real frame to the resampler.
+func (r *frameResampler) Push(read *eventFrame) error {
+	frame := read.Frame
+	ts := frame.GetTimestamp().AsTime()
+	prev := r.prev
+	r.prev = read
+	r.prevEmitted = false
+
+	if prev == nil {
+		return r.write(read, false)
+	}
+
+	prevTs := prev.Frame.GetTimestamp().AsTime()
+	gap := ts.Sub(prevTs)
+	if r.interpolate && gap > r.interval*3/2 && gap <= maxInterpolationGap &&
+		prev.Frame.GetSession().GetSessionId() == frame.GetSession().GetSessionId() {
+		for at := prevTs.Add(r.interval); ts.Sub(at) >= r.interval/2; at = at.Add(r.interval) {
+			t := float64(at.Sub(prevTs)) / float64(gap)
+			if err := r.write(&eventFrame{Frame: interpolateFrame(prev.Frame, frame, t, at)}, true); err != nil {
+				return err
+			}
+		}
+		return r.write(read, false)
+	}
+
+	// A quarter interval of tolerance absorbs polling jitter
+	if len(read.Events) > 0 || ts.Sub(r.lastEmitted) >= r.interval-r.interval/4 {
+		return r.write(read, false)
+	}
+	r.Dropped++
+	return nil
+}
+
+// Flush writes the last real frame if it was dropped, so the output covers
+// the full length of the recording.
+func (r *frameResampler) Flush() error {
+	if r.prev == nil || r.prevEmitted {
+		return nil
+	}
+	r.Dropped--
+	return r.write(r.prev, false)
+}
+
+func (r *frameResampler) write(read *eventFrame, interpolated bool) error {
+	if !interpolated {
+		r.prevEmitted = true
+	}
+	r.lastEmitted = read.Frame.GetTimestamp().AsTime()
+	read.Frame.FrameIndex = r.outIndex
+	r.outIndex++
+	return r.emit(read, interpolated)
+}
+
+// interpolateFrame returns a frame at position t (0..1) between a and b. The
+// session and bone data are interpolated; everything else, including the game
+// clock display, is taken from a. Interpolated frames carry no events.
+func interpolateFrame(a, b *telemetry.LobbySessionStateFrame, t float64, at time.Time) *telemetry.LobbySessionStateFrame {
+	frame := proto.Clone(a).(*telemetry.LobbySessionStateFrame)
+	frame.Timestamp = timestamppb.New(at)
+	frame.Events = nil
+	if a.GetSession() != nil && b.GetSession() != nil {
+		interpolateMessage(frame.Session.ProtoReflect(), a.GetSession().ProtoReflect(), b.GetSession().ProtoReflect(), t)
+	}
+	if a.GetPlayerBones() != nil && b.GetPlayerBones() != nil {
+		interpolateMessage(frame.PlayerBones.ProtoReflect(), a.GetPlayerBones().ProtoReflect(), b.GetPlayerBones().ProtoReflect(), t)
+	}
+	return frame
+}
+
+// interpolateMessage sets the floating point fields of dst, a copy of a, to
+// values between a and b. Vectors and rotations are recognised by field name
+// and shape: quaternions (x, y, z, w or 4 floats named *rot*, *orient* or
+// *quat*) are interpolated along the shorter arc and renormalized, direction
+// vectors named forward, left or up are renormalized. List elements are only
+// paired if they describe the same entity, see sameEntity.
+func interpolateMessage(dst, a, b protoreflect.Message, t float64) {
+	if isQuaternionMessage(a.Descriptor()) {
+		q := nlerp(messageFloats(a, "x", "y", "z", "w"), messageFloats(b, "x", "y", "z", "w"), t)
+		setMessageFloats(dst, q, "x", "y", "z", "w")
+		return
+	}
+
+	fields := a.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		// Zero-valued proto3 scalars are not "set" but still need interpolating
+		if fd.IsMap() || (fd.HasPresence() && (!a.Has(fd) || !b.Has(fd))) {
+			continue
+		}
+
+		switch {
+		case fd.IsList() && isFloatKind(fd.Kind()):
+			la, lb := a.Get(fd).List(), b.Get(fd).List()
+			if la.Len() != lb.Len() {
+				continue
+			}
+			values := lerpList(la, lb, t, rotationField(fd.Name()), directionField(fd.Name()))
+			dl := dst.Mutable(fd).List()
+			for j, v := range values {
+				dl.Set(j, floatValue(fd.Kind(), v))
+			}
+
+		case fd.IsList() && fd.Kind() == protoreflect.MessageKind:
+			la, lb := a.Get(fd).List(), b.Get(fd).List()
+			if la.Len() != lb.Len() {
+				continue
+			}
+			dl := dst.Mutable(fd).List()
+			for j := 0; j < la.Len(); j++ {
+				ma, mb := la.Get(j).Message(), lb.Get(j).Message()
+				if sameEntity(ma, mb) {
+					interpolateMessage(dl.Get(j).Message(), ma, mb, t)
+				}
+			}
+
+		case fd.Kind() == protoreflect.MessageKind:
+			interpolateMessage(dst.Mutable(fd).Message(), a.Get(fd).Message(), b.Get(fd).Message(), t)
+			if directionField(fd.Name()) && isVectorMessage(fd.Message()) {
+				v := normalize(messageFloats(dst.Get(fd).Message(), "x", "y", "z"))
+				setMessageFloats(dst.Mutable(fd).Message(), v, "x", "y", "z")
+			}
+
+		case isFloatKind(fd.Kind()):
+			va, vb := a.Get(fd).Float(), b.Get(fd).Float()
+			dst.Set(fd, floatValue(fd.Kind(), va+(vb-va)*t))
+		}
+	}
+}
+
+// sameEntity reports whether two list elements describe the same player or
+// object, by comparing their identifying fields (names containing "id",
+// "slot", "name" or "number").
+func sameEntity(a, b protoreflect.Message) bool {
+	fields := a.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.IsList() || fd.IsMap() || !identityField(fd) {
+			continue
+		}
+		if !a.Get(fd).Equal(b.Get(fd)) {
+			return false
+		}
+	}
+	return true
+}
+
+func identityField(fd protoreflect.FieldDescriptor) bool {
+	switch fd.Kind() {
+	case protoreflect.StringKind, protoreflect.Int32Kind, protoreflect.Int64Kind,
+		protoreflect.Uint32Kind, protoreflect.Uint64Kind, protoreflect.Sint32Kind, protoreflect.Sint64Kind:
+	default:
+		return false
+	}
+	name := string(fd.Name())
+	for _, key := range []string{"id", "slot", "name", "number"} {
+		if strings.Contains(name, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func rotationField(name protoreflect.Name) bool {
+	n := string(name)
+	return strings.Contains(n, "rot") || strings.Contains(n, "orient") || strings.Contains(n, "quat")
+}
+
+func directionField(name protoreflect.Name) bool {
+	n := string(name)
+	for _, dir := range []string{"forward", "left", "up"} {
+		if n == dir || strings.HasSuffix(n, "_"+dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func isFloatKind(k protoreflect.Kind) bool {
+	return k == protoreflect.FloatKind || k == protoreflect.DoubleKind
+}
+
+func floatValue(k protoreflect.Kind, v float64) protoreflect.Value {
+	if k == protoreflect.FloatKind {
+		return protoreflect.ValueOfFloat32(float32(v))
+	}
+	return protoreflect.ValueOfFloat64(v)
+}
+
+// hasFloatFields reports whether md has float fields with exactly the given names.
+func hasFloatFields(md protoreflect.MessageDescriptor, names ...string) bool {
+	if md.Fields().Len() != len(names) {
+		return false
+	}
+	for _, name := range names {
+		fd := md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil || fd.IsList() || !isFloatKind(fd.Kind()) {
+			return false
+		}
+	}
+	return true
+}
+
+func isQuaternionMessage(md protoreflect.MessageDescriptor) bool {
+	return hasFloatFields(md, "x", "y", "z", "w")
+}
+
+func isVectorMessage(md protoreflect.MessageDescriptor) bool {
+	return hasFloatFields(md, "x", "y", "z")
+}
+
+func messageFloats(m protoreflect.Message, names ...string) []float64 {
+	values := make([]float64, len(names))
+	for i, name := range names {
+		values[i] = m.Get(m.Descriptor().Fields().ByName(protoreflect.Name(name))).Float()
+	}
+	return values
+}
+
+func setMessageFloats(m protoreflect.Message, values []float64, names ...string) {
+	for i, name := range names {
+		fd := m.Descriptor().Fields().ByName(protoreflect.Name(name))
+		m.Set(fd, floatValue(fd.Kind(), values[i]))
+	}
+}
+
+// lerpList interpolates two equal-length float lists. Rotation lists are
+// treated as packed quaternions when their length is a multiple of four, and
+// direction lists are renormalized when they have three elements.
+func lerpList(a, b protoreflect.List, t float64, rotation, direction bool) []float64 {
+	va := make([]float64, a.Len())
+	vb := make([]float64, b.Len())
+	for i := range va {
+		va[i], vb[i] = a.Get(i).Float(), b.Get(i).Float()
+	}
+
+	switch {
+	case rotation && len(va) > 0 && len(va)%4 == 0:
+		out := make([]float64, 0, len(va))
+		for i := 0; i < len(va); i += 4 {
+			out = append(out, nlerp(va[i:i+4], vb[i:i+4], t)...)
+		}
+		return out
+	case direction && len(va) == 3:
+		return normalize(lerp(va, vb, t))
+	default:
+		return lerp(va, vb, t)
+	}
+}
+
+func lerp(a, b []float64, t float64) []float64 {
+	out := make([]float64, len(a))
+	for i := range a {
+		out[i] = a[i] + (b[i]-a[i])*t
+	}
+	return out
+}
+
+// nlerp interpolates two quaternions along the shorter arc and renormalizes.
+func nlerp(a, b []float64, t float64) []float64 {
+	var dot float64
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	if dot < 0 {
+		neg := make([]float64, len(b))
+		for i := range b {
+			neg[i] = -b[i]
+		}
+		b = neg
+	}
+	return normalize(lerp(a, b, t))
+}
+
+func normalize(v []float64) []float64 {
+	var sum float64
+	for _, x := range v {
+		sum += x * x
+	}
+	if sum == 0 {
+		return v
+	}
+	n := math.Sqrt(sum)
+	for i := range v {
+		v[i] /= n
+	}
+	return v
+}
+
+// ResampleReport is written to <output>.resample.json when frames were
+// interpolated. InterpolatedFrames lists inclusive output frame index ranges.
+type ResampleReport struct {
+	Input              string   `json:"input"`
+	Output             string   `json:"output"`
+	TargetFPS          int      `json:"target_fps"`
+	FramesRead         int      `json:"frames_read"`
+	FramesWritten      int      `json:"frames_written"`
+	FramesDropped      int      `json:"frames_dropped"`
+	InterpolatedFrames [][2]int `json:"interpolated_frames"`
+	interpolatedCount  int
+}
+
+func (r *ResampleReport) markInterpolated(index int) {
+	r.interpolatedCount++
+	if n := len(r.InterpolatedFrames); n > 0 && r.InterpolatedFrames[n-1][1] == index-1 {
+		r.InterpolatedFrames[n-1][1] = index
+		return
+	}
+	r.InterpolatedFrames = append(r.InterpolatedFrames, [2]int{index, index})
+}
+
+func (r *ResampleReport) Write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode resample report: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// openResampleSource opens inputFile, through the repair pipeline if
+// repairReport is set. Repaired .tape input is read in v1 form, so fields and
+// events without a v1 form do not survive --repair.
+func openResampleSource(inputFile string, repairReport *RepairReport, lossReport *LossReport) (*eventFrameSource, error) {
+	if repairReport == nil {
+		return openEventFrameSource(inputFile, lossReport)
+	}
+	source, err := openRepairSource(inputFile, repairReport, lossReport)
+	if err != nil {
+		return nil, err
+	}
+	return &eventFrameSource{source: source}, nil
+}
+
+// resampleFrames reads every frame of source through a resampler at fps and
+// passes the output frames to emit. It returns the number of frames read and
+// dropped.
+func resampleFrames(source *eventFrameSource, fps int, interpolate bool, emit func(*eventFrame, bool) error) (int, int, error) {
+	resampler := newFrameResampler(fps, interpolate, emit)
+	framesRead := 0
+	for {
+		read, err := source.ReadFrame()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return framesRead, resampler.Dropped, fmt.Errorf("failed to read frame: %w", err)
+		}
+		framesRead++
+
+		if cfg.Converter.ExcludeBones {
+			read.Frame.PlayerBones = nil
+		}
+		if err := resampler.Push(read); err != nil {
+			return framesRead, resampler.Dropped, err
+		}
+	}
+	if err := resampler.Flush(); err != nil {
+		return framesRead, resampler.Dropped, err
+	}
+	return framesRead, resampler.Dropped, nil
+}
+
+// planInterpolation runs the resampler over inputFile without writing
+// anything and returns the output frame ranges it interpolates. The header is
+// written before the first frame, so the ranges have to be known up front.
+func planInterpolation(inputFile string, fps int) ([][2]int, error) {
+	var repairReport *RepairReport
+	if cfg.Converter.Repair {
+		repairReport = &RepairReport{Input: inputFile}
+	}
+	source, err := openResampleSource(inputFile, repairReport, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	plan := &ResampleReport{}
+	_, _, err = resampleFrames(source, fps, true, func(read *eventFrame, interpolated bool) error {
+		if interpolated {
+			plan.markInterpolated(int(read.Frame.GetFrameIndex()))
+		}
+		return nil
+	})
+	return plan.InterpolatedFrames, err
+}
+
+// convertResampled converts between any two formats while changing the frame
+// rate to cfg.Converter.FPS. Interpolated frames are listed in the
+// "interpolated_frames" header metadata and in <output>.resample.json. The
+// report is the only record of them in .echoreplay output, which has no
+// header, so the conversion fails there if the report cannot be written.
+func convertResampled(inputFile, outputFile, outputFormat string) (*ConversionStats, error) {
+	fps := cfg.Converter.FPS
+	headerless := outputFormat == "echoreplay"
+	var interpolated [][2]int
+	if cfg.Converter.Interpolate && !headerless {
+		var err error
+		if interpolated, err = planInterpolation(inputFile, fps); err != nil {
+			return nil, err
+		}
+	}
+
+	// .tape frames are kept as stored in .tape output, unless --repair reads
+	// them in v1 form
+	var lossReport *LossReport
+	if detectInputFormat(inputFile) == "tape" && (outputFormat != "tape" || cfg.Converter.Repair) {
+		lossReport = newLossReport(inputFile, outputFile)
+	}
+	var repairReport *RepairReport
+	if cfg.Converter.Repair {
+		repairReport = &RepairReport{Input: inputFile, Output: outputFile}
+	}
+	source, err := openResampleSource(inputFile, repairReport, lossReport)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	header := source.Header()
+	if header == nil {
+		header = &telemetry.TelemetryHeader{}
+	}
+	if header.Metadata == nil {
+		header.Metadata = make(map[string]string)
+	}
+	header.Metadata["resampled_fps"] = strconv.Itoa(fps)
+	if cfg.Converter.Interpolate {
+		header.Metadata["interpolation"] = "linear"
+	}
+	if len(interpolated) > 0 {
+		ranges, err := json.Marshal(interpolated)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode interpolated frames: %w", err)
+		}
+		header.Metadata["interpolated_frames"] = string(ranges)
+	}
+
+	sink, err := newV1FrameSink(outputFile, outputFormat, header)
+	if err != nil {
+		return nil, err
+	}
+	sink.UseTapeHeader(source.TapeHeader())
+
+	report := &ResampleReport{Input: inputFile, Output: outputFile, TargetFPS: fps}
+	report.FramesRead, report.FramesDropped, err = resampleFrames(source, fps, cfg.Converter.Interpolate, func(read *eventFrame, interpolated bool) error {
+		if interpolated {
+			report.markInterpolated(int(read.Frame.GetFrameIndex()))
+		}
+		return sink.WriteEventFrame(read)
+	})
+	if err != nil {
+		sink.Abort()
+		return nil, err
+	}
+	if err := sink.Close(); err != nil {
+		return nil, err
+	}
+	report.FramesWritten = sink.Frames()
+
+	if cfg.Converter.Verbose {
+		logger.Info("Resampled recording",
+			zap.Int("fps", fps),
+			zap.Int("frames_read", report.FramesRead),
+			zap.Int("frames_written", report.FramesWritten),
+			zap.Int("frames_dropped", report.FramesDropped),
+			zap.Int("frames_interpolated", report.interpolatedCount))
+	}
+	if report.interpolatedCount > 0 {
+		reportPath := outputFile + ".resample.json"
+		if err := report.Write(reportPath); err != nil {
+			if headerless {
+				os.Remove(outputFile)
+				return nil, fmt.Errorf("%s output cannot mark interpolated frames and the resample report could not be written: %w", outputFormat, err)
+			}
+			logger.Warn("Failed to write resample report", zap.String("path", reportPath), zap.Error(err))
+		} else if headerless {
+			logger.Warn("Output format cannot mark interpolated frames; see the resample report",
+				zap.String("format", outputFormat),
+				zap.String("report", reportPath))
+		}
+	}
+	if repairReport != nil {
+		finishRepairReport(repairReport, outputFile)
+	}
+	if lossReport != nil {
+		saveLossReport(lossReport, outputFile)
+	}
+
+	stats := &ConversionStats{FrameCount: report.FramesWritten, Repair: repairReport}
+	if inputInfo, err := os.Stat(inputFile); err == nil {
+		stats.InputSize = inputInfo.Size()
+	}
+	if outputInfo, err := os.Stat(outputFile); err == nil {
+		stats.OutputSize = outputInfo.Size()
+	}
+	return stats, nil
+}
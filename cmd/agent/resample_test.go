@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	capturepb "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v2"
+	"github.com/echotools/tape/pkg/codec"
+	"github.com/echotools/tape/pkg/conversion"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// resampleTestFrames returns playing frames at the given millisecond offsets.
+func resampleTestFrames(offsetsMs ...int) []*telemetry.LobbySessionStateFrame {
+	return testV1Frames(len(offsetsMs), withOffsetsMs(offsetsMs...), withStatuses("playing"))
+}
+
+type resampledFrame struct {
+	offsetMs     int
+	interpolated bool
+}
+
+func runResampler(t *testing.T, fps int, interpolate bool, frames []*telemetry.LobbySessionStateFrame) []resampledFrame {
+	t.Helper()
+	base := frames[0].GetTimestamp().AsTime()
+
+	var out []resampledFrame
+	r := newFrameResampler(fps, interpolate, func(read *eventFrame, interpolated bool) error {
+		frame := read.Frame
+		if int(frame.GetFrameIndex()) != len(out) {
+			t.Errorf("frame index = %d, want %d", frame.GetFrameIndex(), len(out))
+		}
+		out = append(out, resampledFrame{int(frame.GetTimestamp().AsTime().Sub(base) / time.Millisecond), interpolated})
+		return nil
+	})
+	for _, frame := range frames {
+		if err := r.Push(testEventFrame(proto.Clone(frame).(*telemetry.LobbySessionStateFrame))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestFrameResampler_Downsample(t *testing.T) {
+	// 60 Hz with jitter, an event on frame 3 and a final frame that would be dropped
+	frames := resampleTestFrames(0, 17, 33, 50, 66, 84, 100, 117)
+	frames[3].Events = []*telemetry.LobbySessionEvent{{}}
+
+	got := runResampler(t, 20, false, frames)
+	want := []int{0, 50, 100, 117}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want offsets %v", got, want)
+	}
+	for i := range want {
+		if got[i].offsetMs != want[i] || got[i].interpolated {
+			t.Errorf("frame %d = %+v, want offset %d", i, got[i], want[i])
+		}
+	}
+
+	// The event frame is kept even when it falls between output slots
+	got = runResampler(t, 10, false, frames)
+	if len(got) != 3 || got[1].offsetMs != 50 {
+		t.Errorf("got %v, want the event frame at 50ms kept", got)
+	}
+}
+
+func TestFrameResampler_Upsample(t *testing.T) {
+	// 10 Hz, then a 2s dropout that must not be filled
+	frames := resampleTestFrames(0, 100, 200, 2200)
+
+	got := runResampler(t, 30, true, frames)
+	want := []resampledFrame{
+		{0, false}, {33, true}, {66, true}, {100, false},
+		{133, true}, {166, true}, {200, false},
+		{2200, false},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("frame %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// Without --interpolate, low-rate recordings pass through unchanged
+	if got := runResampler(t, 30, false, frames); len(got) != len(frames) {
+		t.Errorf("got %d frames, want %d", len(got), len(frames))
+	}
+}
+
+// interpolationTestDescriptor describes a player with a vector position, a
+// quaternion message, a packed rotation list and a forward direction.
+func interpolationTestDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+	float := descriptorpb.FieldDescriptorProto_TYPE_FLOAT.Enum()
+	repeated := descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	optional := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()
+	message := descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+
+	field := func(name string, number int32, typ *descriptorpb.FieldDescriptorProto_Type, label *descriptorpb.FieldDescriptorProto_Label, typeName string) *descriptorpb.FieldDescriptorProto {
+		f := &descriptorpb.FieldDescriptorProto{Name: proto.String(name), Number: proto.Int32(number), Type: typ, Label: label}
+		if typeName != "" {
+			f.TypeName = proto.String(typeName)
+		}
+		return f
+	}
+
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("interp_test.proto"),
+		Package: proto.String("interptest"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{Name: proto.String("Quat"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("x", 1, float, optional, ""), field("y", 2, float, optional, ""),
+				field("z", 3, float, optional, ""), field("w", 4, float, optional, ""),
+			}},
+			{Name: proto.String("Vec"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("x", 1, float, optional, ""), field("y", 2, float, optional, ""), field("z", 3, float, optional, ""),
+			}},
+			{Name: proto.String("Player"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("slot_number", 1, descriptorpb.FieldDescriptorProto_TYPE_INT32.Enum(), optional, ""),
+				field("position", 2, float, repeated, ""),
+				field("head", 3, message, optional, ".interptest.Quat"),
+				field("bone_rotations", 4, float, repeated, ""),
+				field("forward", 5, message, optional, ".interptest.Vec"),
+			}},
+			{Name: proto.String("Session"), Field: []*descriptorpb.FieldDescriptorProto{
+				field("game_clock", 1, descriptorpb.FieldDescriptorProto_TYPE_DOUBLE.Enum(), optional, ""),
+				field("players", 2, message, repeated, ".interptest.Player"),
+			}},
+		},
+	}
+	fd, err := protodesc.NewFile(file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fd.Messages().ByName("Session")
+}
+
+func TestInterpolateMessage(t *testing.T) {
+	md := interpolationTestDescriptor(t)
+	playerMD := md.Fields().ByName("players").Message()
+
+	newVec := func(fd protoreflect.FieldDescriptor, values ...float32) protoreflect.Message {
+		m := dynamicpb.NewMessage(fd.Message())
+		for i, name := range []string{"x", "y", "z", "w"}[:len(values)] {
+			m.Set(m.Descriptor().Fields().ByName(protoreflect.Name(name)), protoreflect.ValueOfFloat32(values[i]))
+		}
+		return m
+	}
+	newPlayer := func(slot int32, pos, head, rot, forward []float32) protoreflect.Message {
+		p := dynamicpb.NewMessage(playerMD)
+		fields := playerMD.Fields()
+		p.Set(fields.ByName("slot_number"), protoreflect.ValueOfInt32(slot))
+		for name, values := range map[string][]float32{"position": pos, "bone_rotations": rot} {
+			list := p.Mutable(fields.ByName(protoreflect.Name(name))).List()
+			for _, v := range values {
+				list.Append(protoreflect.ValueOfFloat32(v))
+			}
+		}
+		p.Set(fields.ByName("head"), protoreflect.ValueOfMessage(newVec(fields.ByName("head"), head...)))
+		p.Set(fields.ByName("forward"), protoreflect.ValueOfMessage(newVec(fields.ByName("forward"), forward...)))
+		return p
+	}
+	newSession := func(clock float64, players ...protoreflect.Message) protoreflect.Message {
+		s := dynamicpb.NewMessage(md)
+		s.Set(md.Fields().ByName("game_clock"), protoreflect.ValueOfFloat64(clock))
+		list := s.Mutable(md.Fields().ByName("players")).List()
+		for _, p := range players {
+			list.Append(protoreflect.ValueOfMessage(p))
+		}
+		return s
+	}
+
+	s := float32(math.Sqrt2 / 2)
+	a := newSession(300,
+		newPlayer(1, []float32{0, 0, 0}, []float32{0, 0, 0, 1}, []float32{0, 0, 0, 1}, []float32{1, 0, 0}),
+		newPlayer(2, []float32{5, 5, 5}, []float32{0, 0, 0, 1}, []float32{0, 0, 0, 1}, []float32{1, 0, 0}))
+	b := newSession(290,
+		newPlayer(1, []float32{10, 20, 30}, []float32{0, s, 0, s}, []float32{0, 0, 0, -1}, []float32{0, 1, 0}),
+		newPlayer(3, []float32{9, 9, 9}, []float32{0, 0, 0, 1}, []float32{0, 0, 0, 1}, []float32{1, 0, 0}))
+
+	dst := proto.Clone(a.Interface()).ProtoReflect()
+	interpolateMessage(dst, a, b, 0.5)
+
+	if clock := dst.Get(md.Fields().ByName("game_clock")).Float(); clock != 295 {
+		t.Errorf("game_clock = %v, want 295", clock)
+	}
+
+	players := dst.Get(md.Fields().ByName("players")).List()
+	p1 := players.Get(0).Message()
+	floats := func(m protoreflect.Message, name string) []float64 {
+		list := m.Get(playerMD.Fields().ByName(protoreflect.Name(name))).List()
+		out := make([]float64, list.Len())
+		for i := range out {
+			out[i] = list.Get(i).Float()
+		}
+		return out
+	}
+	approx := func(name string, got []float64, want ...float64) {
+		t.Helper()
+		for i := range want {
+			if math.Abs(got[i]-want[i]) > 1e-5 {
+				t.Errorf("%s = %v, want %v", name, got, want)
+				return
+			}
+		}
+	}
+
+	approx("position", floats(p1, "position"), 5, 10, 15)
+	// q and -q are the same rotation, so interpolating them must not pass through zero
+	approx("bone_rotations", floats(p1, "bone_rotations"), 0, 0, 0, 1)
+
+	half := math.Sin(math.Pi / 8)
+	head := p1.Get(playerMD.Fields().ByName("head")).Message()
+	approx("head", messageFloats(head, "x", "y", "z", "w"), 0, half, 0, math.Cos(math.Pi/8))
+
+	forward := p1.Get(playerMD.Fields().ByName("forward")).Message()
+	approx("forward", messageFloats(forward, "x", "y", "z"), math.Sqrt2/2, math.Sqrt2/2, 0)
+
+	// Slot 2 was replaced by slot 3, so it keeps its own values
+	approx("other player", floats(players.Get(1).Message(), "position"), 5, 5, 5)
+}
+
+func TestConvertResampled_TapeKeepsFramesAndMarksInterpolation(t *testing.T) {
+	useTestConfig(t)
+	cfg.Converter.FPS = 30
+	cfg.Converter.Interpolate = true
+	dir := t.TempDir()
+	input := filepath.Join(dir, "match.tape")
+
+	// 10 Hz with events and a player that have no v1 form on the third frame
+	frames := resampleTestFrames(0, 100, 200, 300)
+	var stored *capturepb.CaptureFrame
+	writer, err := codec.NewWriter(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteHeader(conversion.MapHeaderFromSession(&telemetry.TelemetryHeader{CreatedAt: frames[0].GetTimestamp()}, frames[0].GetSession())); err != nil {
+		t.Fatal(err)
+	}
+	mapper := conversion.FrameMapper{BaseTime: frames[0].GetTimestamp().AsTime()}
+	for i, frame := range frames {
+		native := mapper.MapFrame(frame)
+		if i == 2 {
+			arena := native.GetEchoArena()
+			arena.Events = []*capturepb.EchoEvent{
+				{Event: &capturepb.EchoEvent_PlayerGoal{PlayerGoal: &capturepb.PlayerGoal{PlayerSlot: 1, TotalGoals: 2}}},
+				{Event: &capturepb.EchoEvent_GenericEvent{GenericEvent: &capturepb.GenericEvent{Name: "custom"}}},
+			}
+			arena.Players = append(arena.Players, &capturepb.PlayerState{Slot: 9, DisplayName: "observer"})
+			stored = native
+		}
+		if err := writer.WriteFrame(native); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// echoreplay has no header, so the interpolated frames are only listed in
+	// the resample report
+	replay := filepath.Join(dir, "match.echoreplay")
+	if stats, err := convertResampled(input, replay, "echoreplay"); err != nil || stats.FrameCount != 10 {
+		t.Fatalf("convertResampled() to echoreplay = %+v, %v", stats, err)
+	}
+	data, err := os.ReadFile(replay + ".resample.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resampled ResampleReport
+	if err := json.Unmarshal(data, &resampled); err != nil || len(resampled.InterpolatedFrames) != 3 {
+		t.Errorf("report interpolated frames = %v (%v), want 3 ranges", resampled.InterpolatedFrames, err)
+	}
+
+	// Without the report they would be unmarked, so the conversion fails
+	blocked := filepath.Join(dir, "blocked.echoreplay")
+	if err := os.Mkdir(blocked+".resample.json", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := convertResampled(input, blocked, "echoreplay"); err == nil {
+		t.Error("convertResampled() to echoreplay succeeded without a resample report")
+	}
+	if _, err := os.Stat(blocked); !os.IsNotExist(err) {
+		t.Errorf("echoreplay output kept without a resample report: %v", err)
+	}
+
+	output := filepath.Join(dir, "resampled.tape")
+	stats, err := convertResampled(input, output, "tape")
+	if err != nil {
+		t.Fatalf("convertResampled() error = %v", err)
+	}
+	if stats.FrameCount != 10 {
+		t.Errorf("FrameCount = %d, want 10", stats.FrameCount)
+	}
+
+	reader, err := codec.NewReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	header, err := reader.ReadHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := header.GetMetadata()["interpolated_frames"]; got != "[[1,2],[4,5],[7,8]]" {
+		t.Errorf("interpolated_frames = %q, want [[1,2],[4,5],[7,8]]", got)
+	}
+
+	// Output frame 6 is input frame 2, as stored
+	for i := 0; i <= 6; i++ {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i != 6 {
+			if got := frame.GetEchoArena().GetEvents(); len(got) != 0 {
+				t.Errorf("frame %d has events %v, want none", i, got)
+			}
+			continue
+		}
+		want := proto.Clone(stored).(*capturepb.CaptureFrame)
+		want.FrameIndex = 6
+		if !proto.Equal(frame, want) {
+			t.Errorf("frame 6 = %v, want %v", frame, want)
+		}
+	}
+	if _, err := os.Stat(output + ".loss.json"); !os.IsNotExist(err) {
+		t.Errorf("tape → tape resample wrote a loss report: %v", err)
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	"github.com/echotools/nevr-agent/v4/internal/jsondiff"
+	"github.com/echotools/tape/pkg/conversion"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// maxReportedDifferences caps the differences listed for a failed validation.
+const maxReportedDifferences = 20
+
+// RoundTripError lists the fields that changed when a file was converted to
+// another format and back.
+type RoundTripError struct {
+	Via         string            `json:"via"`
+	Frames      int               `json:"frames"`      // frames with at least one difference
+	Total       int               `json:"differences"` // differences across all frames
+	Differences []FrameDifference `json:"first_differences"`
+}
+
+// FrameDifference is a field-level difference within one frame.
+type FrameDifference struct {
+	Frame int `json:"frame"`
+	jsondiff.Difference
+}
+
+func (e *RoundTripError) add(frame int, diffs []jsondiff.Difference) {
+	if len(diffs) == 0 {
+		return
+	}
+	e.Frames++
+	e.Total += len(diffs)
+	for _, d := range diffs {
+		if len(e.Differences) == maxReportedDifferences {
+			return
+		}
+		e.Differences = append(e.Differences, FrameDifference{Frame: frame, Difference: d})
+	}
+}
+
+func (e *RoundTripError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "round trip through %s changed %d field(s) in %d frame(s)", e.Via, e.Total, e.Frames)
+	for _, d := range e.Differences {
+		fmt.Fprintf(&b, "\n  frame %d: %s", d.Frame, d)
+	}
+	if more := e.Total - len(e.Differences); more > 0 {
+		fmt.Fprintf(&b, "\n  ... and %d more", more)
+	}
+	return b.String()
+}
+
+func (d FrameDifference) String() string {
+	switch d.Kind {
+	case jsondiff.KindMissing:
+		return fmt.Sprintf("%s: missing after round trip (original=%s)", d.Path, formatDiffValue(d.A))
+	case jsondiff.KindExtra:
+		return fmt.Sprintf("%s: added by round trip (round-trip=%s)", d.Path, formatDiffValue(d.B))
+	case jsondiff.KindLength:
+		return fmt.Sprintf("%s: array length original=%v round-trip=%v", d.Path, d.A, d.B)
+	}
+	return fmt.Sprintf("%s: original=%s round-trip=%s", d.Path, formatDiffValue(d.A), formatDiffValue(d.B))
+}
+
+// formatDiffValue renders a JSON value compactly, shortening large objects.
+func formatDiffValue(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	const maxLen = 80
+	if len(data) > maxLen {
+		return string(data[:maxLen]) + "..."
+	}
+	return string(data)
+}
+
+// roundTripOptions returns the float tolerances configured for validation.
+func roundTripOptions() jsondiff.Options {
+	return jsondiff.Options{
+		Tolerance:       cfg.Converter.Tolerance,
+		FieldTolerances: cfg.Converter.FieldTolerances,
+	}
+}
+
+// parseFieldTolerances parses --field-tolerance values of the form name=value.
+func parseFieldTolerances(values []string) (map[string]float64, error) {
+	tolerances := make(map[string]float64, len(values))
+	for _, v := range values {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid field tolerance %q, expected name=value", v)
+		}
+		tolerance, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid field tolerance %q: %w", v, err)
+		}
+		tolerances[name] = tolerance
+	}
+	return tolerances, nil
+}
+
+// validateRoundTrip converts inputFile to the via format and back, then
+// compares every frame of the result with the original field by field. via
+// defaults to tape; a failed validation returns a *RoundTripError.
+func validateRoundTrip(inputFile, via string) error {
+	format := detectInputFormat(inputFile)
+	if format != "echoreplay" && format != "nevrcap" {
+		return fmt.Errorf("validation only supports .echoreplay and .nevrcap files")
+	}
+	if via == "" || via == format {
+		via = "tape"
+	}
+
+	logger.Info("Starting round-trip validation",
+		zap.String("file", inputFile),
+		zap.String("via", via))
+
+	tempDir, err := os.MkdirTemp("", "nevr-validate-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tempVia := filepath.Join(tempDir, "roundtrip."+via)
+	tempBack := filepath.Join(tempDir, "roundtrip."+format)
+
+	logger.Info("Converting to "+via, zap.String("temp", tempVia))
+	if err := convertForValidation(inputFile, tempVia, format, via); err != nil {
+		return fmt.Errorf("failed to convert to %s: %w", via, err)
+	}
+
+	logger.Info("Converting back to "+format, zap.String("temp", tempBack))
+	if err := convertForValidation(tempVia, tempBack, via, format); err != nil {
+		return fmt.Errorf("failed to convert back to %s: %w", format, err)
+	}
+
+	var frames int
+	if format == "echoreplay" {
+		frames, err = compareEchoReplayFiles(inputFile, tempBack, via)
+	} else {
+		frames, err = compareV1Files(inputFile, tempBack, via)
+	}
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Round-trip validation successful",
+		zap.Int("frames_validated", frames))
+
+	return nil
+}
+
+// convertForValidation runs one leg of a round trip.
+func convertForValidation(inputFile, outputFile, from, to string) error {
+	var err error
+	switch {
+	case to == "tape":
+		_, err = conversion.ConvertFile(inputFile, outputFile)
+	case from == "tape":
+		_, err = convertTapeToV1(inputFile, outputFile, to)
+	case from == "echoreplay" && to == "nevrcap":
+		err = convertEchoReplayToNevrcap(inputFile, outputFile)
+	case from == "nevrcap" && to == "echoreplay":
+		err = conversion.ConvertNevrcapToEchoReplay(inputFile, outputFile)
+	default:
+		err = fmt.Errorf("%w from %s to %s", errUnsupportedConversion, from, to)
+	}
+	return err
+}
+
+// compareEchoReplayFiles compares the raw JSON of two echoreplay files, so
+// that anything the codec fails to parse also shows up as a difference.
+func compareEchoReplayFiles(original, roundtrip, via string) (int, error) {
+	originalFrames, err := readRawJSONFrames(original)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read original frames: %w", err)
+	}
+	roundtripFrames, err := readRawJSONFrames(roundtrip)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read round-trip frames: %w", err)
+	}
+
+	logger.Info("Comparing frames",
+		zap.Int("original_count", len(originalFrames)),
+		zap.Int("roundtrip_count", len(roundtripFrames)))
+
+	if len(originalFrames) != len(roundtripFrames) {
+		return 0, fmt.Errorf("frame count mismatch: original=%d, roundtrip=%d",
+			len(originalFrames), len(roundtripFrames))
+	}
+
+	result := &RoundTripError{Via: via}
+	for i := range originalFrames {
+		diffs, err := compareRawJSONFrames(originalFrames[i], roundtripFrames[i], roundTripOptions())
+		if err != nil {
+			return 0, fmt.Errorf("frame %d: %w", i, err)
+		}
+		result.add(i, diffs)
+	}
+	if result.Total > 0 {
+		return 0, result
+	}
+	return len(originalFrames), nil
+}
+
+func compareRawJSONFrames(original, roundtrip *rawJSONFrame, opts jsondiff.Options) ([]jsondiff.Difference, error) {
+	var diffs []jsondiff.Difference
+	if original.timestamp != roundtrip.timestamp {
+		diffs = append(diffs, jsondiff.Difference{Path: "timestamp", Kind: jsondiff.KindValue, A: original.timestamp, B: roundtrip.timestamp})
+	}
+
+	sessionDiffs, err := jsondiff.CompareJSON(original.sessionJSON, roundtrip.sessionJSON, "session", opts)
+	if err != nil {
+		return nil, err
+	}
+	diffs = append(diffs, sessionDiffs...)
+
+	switch {
+	case original.bonesJSON == nil && roundtrip.bonesJSON == nil:
+	case roundtrip.bonesJSON == nil:
+		diffs = append(diffs, jsondiff.Difference{Path: "bones", Kind: jsondiff.KindMissing, A: json.RawMessage(original.bonesJSON)})
+	case original.bonesJSON == nil:
+		diffs = append(diffs, jsondiff.Difference{Path: "bones", Kind: jsondiff.KindExtra, B: json.RawMessage(roundtrip.bonesJSON)})
+	default:
+		bonesDiffs, err := jsondiff.CompareJSON(original.bonesJSON, roundtrip.bonesJSON, "bones", opts)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, bonesDiffs...)
+	}
+	return diffs, nil
+}
+
+// roundTripMarshaler renders frames with the same field names as echoreplay
+// JSON so paths read the same for every format.
+var roundTripMarshaler = protojson.MarshalOptions{UseProtoNames: true}
+
+// compareV1Files reads two files frame by frame and compares each frame as
+// JSON.
+func compareV1Files(original, roundtrip, via string) (int, error) {
+	a, err := openV1FrameSource(original, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer a.Close()
+	b, err := openV1FrameSource(roundtrip, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer b.Close()
+
+	result := &RoundTripError{Via: via}
+	frames := 0
+	for {
+		aFrame, aErr := a.ReadFrame()
+		bFrame, bErr := b.ReadFrame()
+		aDone, bDone := errors.Is(aErr, io.EOF), errors.Is(bErr, io.EOF)
+		if aDone && bDone {
+			break
+		}
+		if aErr != nil && !aDone {
+			return 0, fmt.Errorf("failed to read original frame %d: %w", frames, aErr)
+		}
+		if bErr != nil && !bDone {
+			return 0, fmt.Errorf("failed to read round-trip frame %d: %w", frames, bErr)
+		}
+		if aDone != bDone {
+			return 0, fmt.Errorf("frame count mismatch after %d frames: original ended=%v, roundtrip ended=%v", frames, aDone, bDone)
+		}
+
+		diffs, err := compareV1Frames(aFrame, bFrame, roundTripOptions())
+		if err != nil {
+			return 0, fmt.Errorf("frame %d: %w", frames, err)
+		}
+		result.add(frames, diffs)
+		frames++
+	}
+
+	if result.Total > 0 {
+		return 0, result
+	}
+	return frames, nil
+}
+
+func compareV1Frames(a, b *telemetry.LobbySessionStateFrame, opts jsondiff.Options) ([]jsondiff.Difference, error) {
+	aJSON, err := roundTripMarshaler.Marshal(a)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal original frame: %w", err)
+	}
+	bJSON, err := roundTripMarshaler.Marshal(b)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal round-trip frame: %w", err)
+	}
+	return jsondiff.CompareJSON(aJSON, bJSON, "", opts)
+}
+
+type rawJSONFrame struct {
+	timestamp   string
+	sessionJSON []byte
+	bonesJSON   []byte
+}
+
+func readRawJSONFrames(filename string) ([]*rawJSONFrame, error) {
+	reader, err := openEchoReplayEntry(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	const maxScannerBuffer = 10 * 1024 * 1024
+	scanner.Buffer(make([]byte, 64*1024), maxScannerBuffer)
+
+	var frames []*rawJSONFrame
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		parts := bytes.Split(line, []byte("\t"))
+		if len(parts) < 2 {
+			continue
+		}
+
+		frame := &rawJSONFrame{
+			timestamp:   string(parts[0]),
+			sessionJSON: make([]byte, len(parts[1])),
+		}
+		copy(frame.sessionJSON, parts[1])
+
+		if len(parts) > 2 && len(parts[2]) > 0 {
+			bonesData := parts[2]
+			if bonesData[0] == ' ' {
+				bonesData = bonesData[1:]
+			}
+			if len(bonesData) > 0 {
+				frame.bonesJSON = make([]byte, len(bonesData))
+				copy(frame.bonesJSON, bonesData)
+			}
+		}
+
+		frames = append(frames, frame)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scanner error: %w", err)
+	}
+
+	return frames, nil
+}
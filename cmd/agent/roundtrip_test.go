@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/echotools/nevr-agent/v4/internal/jsondiff"
+)
+
+func TestCompareRawJSONFrames(t *testing.T) {
+	original := &rawJSONFrame{
+		timestamp:   "2025/06/01 12:00:00.000",
+		sessionJSON: []byte(`{"teams":[{"players":[{"name":"a","velocity":[1.25,0,0]}]}]}`),
+		bonesJSON:   []byte(`{"user_bones":[]}`),
+	}
+	roundtrip := &rawJSONFrame{
+		timestamp:   "2025/06/01 12:00:00.000",
+		sessionJSON: []byte(`{"teams":[{"players":[{"name":"a","velocity":[1.2500001,0,0.5]}]}]}`),
+	}
+
+	diffs, err := compareRawJSONFrames(original, roundtrip, jsondiff.Options{Tolerance: 1e-6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 {
+		t.Fatalf("got %v, want 2 differences", diffs)
+	}
+	if diffs[0].Path != "session.teams[0].players[0].velocity[2]" {
+		t.Errorf("path = %q", diffs[0].Path)
+	}
+	if diffs[1].Path != "bones" || diffs[1].Kind != jsondiff.KindMissing {
+		t.Errorf("bones difference = %+v", diffs[1])
+	}
+}
+
+func TestRoundTripError(t *testing.T) {
+	result := &RoundTripError{Via: "tape"}
+	result.add(0, nil)
+	for frame := 1; frame <= maxReportedDifferences+1; frame++ {
+		result.add(frame, []jsondiff.Difference{{Path: "session.game_clock", Kind: jsondiff.KindValue, A: 300.0, B: 299.5}})
+	}
+
+	if result.Frames != maxReportedDifferences+1 || len(result.Differences) != maxReportedDifferences {
+		t.Errorf("frames = %d, listed = %d", result.Frames, len(result.Differences))
+	}
+	msg := result.Error()
+	for _, want := range []string{
+		"round trip through tape changed 21 field(s) in 21 frame(s)",
+		"frame 1: session.game_clock: original=300 round-trip=299.5",
+		"... and 1 more",
+	} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q does not contain %q", msg, want)
+		}
+	}
+}
+
+func TestParseFieldTolerances(t *testing.T) {
+	got, err := parseFieldTolerances([]string{"position=1e-4", "game_clock=0.01"})
+	if err != nil || got["position"] != 1e-4 || got["game_clock"] != 0.01 {
+		t.Errorf("parseFieldTolerances() = %v, %v", got, err)
+	}
+	for _, in := range []string{"position", "=1", "position=abc"} {
+		if _, err := parseFieldTolerances([]string{in}); err == nil {
+			t.Errorf("parseFieldTolerances(%q) expected error", in)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	"github.com/echotools/tape/pkg/codec"
+	"github.com/echotools/tape/pkg/conversion"
+	"github.com/echotools/tape/pkg/events"
+	"github.com/echotools/tape/pkg/processing"
+)
+
+// exitEventsDiffer is the exit code of `agent show ... check` when the
+// detected events differ from the reference.
+const exitEventsDiffer = 2
+
+// eventRecord is an event reduced to what the check compares: its type and
+// the frame it was detected on.
+type eventRecord struct {
+	Type  string `json:"event_type"`
+	Frame int    `json:"frame_index"`
+}
+
+// ShiftedEvent is an event detected on a different frame than in the reference.
+type ShiftedEvent struct {
+	Type string `json:"event_type"`
+	From int    `json:"from_frame"`
+	To   int    `json:"to_frame"`
+}
+
+// EventCheck is the result of comparing re-detected events with a reference.
+type EventCheck struct {
+	Input     string         `json:"input"`
+	Reference string         `json:"reference"` // "stored" or the golden file
+	Expected  int            `json:"expected"`
+	Detected  int            `json:"detected"`
+	Matched   int            `json:"matched"`
+	Shifted   []ShiftedEvent `json:"shifted"`
+	Missing   []eventRecord  `json:"missing"` // In the reference, no longer detected
+	Added     []eventRecord  `json:"added"`   // Detected now, not in the reference
+}
+
+// Differs reports whether the detected events differ from the reference.
+func (c *EventCheck) Differs() bool {
+	return len(c.Shifted) > 0 || len(c.Missing) > 0 || len(c.Added) > 0
+}
+
+// recordingEvents reads a recording, returning the events stored in it at
+// record time and the events the current detector finds in its frames.
+// hasStored is false for formats that cannot store events (.echoreplay).
+func recordingEvents(filename string) (stored, detected []eventRecord, hasStored bool, err error) {
+	detector := processing.NewWithDetector(events.NewWithDefaultSensors(events.WithSynchronousProcessing()))
+	defer detector.Stop()
+
+	detect := func(frame *telemetry.LobbySessionStateFrame) []*telemetry.LobbySessionEvent {
+		frame.Events = nil
+		detector.DetectEvents(frame)
+		select {
+		case found := <-detector.EventsChan():
+			return found
+		default:
+			return nil
+		}
+	}
+
+	format := detectInputFormat(filename)
+	if format == "tape" {
+		reader, err := codec.NewReader(filename)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("failed to open tape file: %w", err)
+		}
+		defer reader.Close()
+		header, err := reader.ReadHeader()
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("failed to read tape header: %w", err)
+		}
+
+		mapper := newTapeFrameMapper(header, newLossReport(filename, ""))
+		v2Mapper := conversion.FrameMapper{BaseTime: header.GetCreatedAt().AsTime()}
+		for {
+			frame, err := reader.ReadFrame()
+			if errors.Is(err, io.EOF) {
+				return stored, detected, true, nil
+			}
+			if err != nil {
+				return nil, nil, false, fmt.Errorf("failed to read frame: %w", err)
+			}
+			index := int(frame.GetFrameIndex())
+			for _, event := range frame.GetEchoArena().GetEvents() {
+				stored = append(stored, eventRecord{Type: getV2EventTypeName(event), Frame: index})
+			}
+
+			// The detector finds v1 events. Map them the way they are recorded
+			// to tape, where a goal also yields a PlayerGoal, so both sides
+			// compare in the tape namespace.
+			v1Frame := mapper.mapFrame(frame)
+			found := detect(v1Frame)
+			if len(found) == 0 {
+				continue
+			}
+			mapped := v2Mapper.MapFrame(&telemetry.LobbySessionStateFrame{Session: v1Frame.GetSession(), Events: found})
+			for _, event := range mapped.GetEchoArena().GetEvents() {
+				detected = append(detected, eventRecord{Type: getV2EventTypeName(event), Frame: index})
+			}
+		}
+	}
+
+	source, err := openV1FrameSource(filename, nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	defer source.Close()
+	for {
+		frame, err := source.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("failed to read frame: %w", err)
+		}
+		index := int(frame.GetFrameIndex())
+		for _, event := range frame.GetEvents() {
+			stored = append(stored, eventRecord{Type: getEventTypeName(event), Frame: index})
+		}
+		for _, event := range detect(frame) {
+			detected = append(detected, eventRecord{Type: getEventTypeName(event), Frame: index})
+		}
+	}
+	hasStored = compressedFormat(format) == "nevrcap"
+	return stored, detected, hasStored, nil
+}
+
+// readGoldenEvents reads a golden event file: a JSON array or a stream of
+// JSON objects with event_type and frame_index, such as the output of
+// `agent show <file> jsonl` or `agent show <file> check --write-golden`.
+func readGoldenEvents(path string) ([]eventRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read golden file: %w", err)
+	}
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var records []eventRecord
+		if err := json.Unmarshal(trimmed, &records); err != nil {
+			return nil, fmt.Errorf("failed to parse golden file: %w", err)
+		}
+		return records, nil
+	}
+
+	var records []eventRecord
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var record eventRecord
+		if err := decoder.Decode(&record); errors.Is(err, io.EOF) {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse golden file event %d: %w", len(records)+1, err)
+		}
+		if record.Type == "" {
+			return nil, fmt.Errorf("golden file event %d has no event_type", len(records)+1)
+		}
+		records = append(records, record)
+	}
+}
+
+// writeGoldenEvents saves events as JSON lines.
+func writeGoldenEvents(path string, records []eventRecord) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create golden file: %w", err)
+	}
+	w := bufio.NewWriter(file)
+	encoder := json.NewEncoder(w)
+	for _, record := range records {
+		if err := encoder.Encode(record); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// compareEvents matches detected events against the reference, per event
+// type. Events on the same frame match exactly; the remaining ones are paired
+// with the nearest unmatched event of the same type within tolerance frames
+// and reported as shifted. Whatever is left is missing or added.
+func compareEvents(reference, detected []eventRecord, tolerance int) *EventCheck {
+	check := &EventCheck{
+		Expected: len(reference),
+		Detected: len(detected),
+		Shifted:  []ShiftedEvent{},
+		Missing:  []eventRecord{},
+		Added:    []eventRecord{},
+	}
+
+	byType := func(records []eventRecord) map[string][]int {
+		out := make(map[string][]int)
+		for _, r := range records {
+			out[r.Type] = append(out[r.Type], r.Frame)
+		}
+		return out
+	}
+	refs, dets := byType(reference), byType(detected)
+
+	types := make(map[string]bool)
+	for t := range refs {
+		types[t] = true
+	}
+	for t := range dets {
+		types[t] = true
+	}
+
+	for eventType := range types {
+		want, got := refs[eventType], dets[eventType]
+		slices.Sort(want)
+		slices.Sort(got)
+		wantUsed := make([]bool, len(want))
+		gotUsed := make([]bool, len(got))
+
+		// Exact matches, walking both sorted lists
+		for i, j := 0, 0; i < len(want) && j < len(got); {
+			switch {
+			case want[i] == got[j]:
+				wantUsed[i], gotUsed[j] = true, true
+				check.Matched++
+				i++
+				j++
+			case want[i] < got[j]:
+				i++
+			default:
+				j++
+			}
+		}
+
+		// Nearest unmatched event within tolerance
+		for i, frame := range want {
+			if wantUsed[i] {
+				continue
+			}
+			best := -1
+			for j, candidate := range got {
+				if gotUsed[j] || abs(candidate-frame) > tolerance {
+					continue
+				}
+				if best < 0 || abs(candidate-frame) < abs(got[best]-frame) {
+					best = j
+				}
+			}
+			if best < 0 {
+				check.Missing = append(check.Missing, eventRecord{Type: eventType, Frame: frame})
+				continue
+			}
+			wantUsed[i], gotUsed[best] = true, true
+			check.Shifted = append(check.Shifted, ShiftedEvent{Type: eventType, From: frame, To: got[best]})
+		}
+		for j, frame := range got {
+			if !gotUsed[j] {
+				check.Added = append(check.Added, eventRecord{Type: eventType, Frame: frame})
+			}
+		}
+	}
+
+	sortRecords := func(records []eventRecord) {
+		slices.SortFunc(records, func(a, b eventRecord) int {
+			if a.Frame != b.Frame {
+				return a.Frame - b.Frame
+			}
+			return strings.Compare(a.Type, b.Type)
+		})
+	}
+	sortRecords(check.Missing)
+	sortRecords(check.Added)
+	slices.SortFunc(check.Shifted, func(a, b ShiftedEvent) int {
+		if a.From != b.From {
+			return a.From - b.From
+		}
+		return strings.Compare(a.Type, b.Type)
+	})
+	return check
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// filterRecords keeps the events selected by the --type and --frames filters.
+func filterRecords(records []eventRecord, filter *eventFilter) []eventRecord {
+	return slices.DeleteFunc(records, func(r eventRecord) bool {
+		return !filter.match(showEvent{typeName: r.Type, frameIndex: r.Frame})
+	})
+}
+
+// runEventCheck re-detects the events of a recording and compares them with
+// the stored events or a golden file.
+func runEventCheck(filename string, filter *eventFilter, opts eventCheckOptions) error {
+	if filter.needsFrame() {
+		return fmt.Errorf("only --type and --frames apply to check output")
+	}
+	if opts.Tolerance < 0 {
+		return fmt.Errorf("tolerance must not be negative, got %d", opts.Tolerance)
+	}
+
+	stored, detected, hasStored, err := recordingEvents(filename)
+	if err != nil {
+		return err
+	}
+	detected = filterRecords(detected, filter)
+
+	if opts.WriteGolden != "" {
+		if err := writeGoldenEvents(opts.WriteGolden, detected); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %d events to %s\n", len(detected), opts.WriteGolden)
+		return nil
+	}
+
+	reference, source := stored, "stored"
+	switch {
+	case opts.Golden != "":
+		if reference, err = readGoldenEvents(opts.Golden); err != nil {
+			return err
+		}
+		source = opts.Golden
+	case !hasStored:
+		return fmt.Errorf("%s does not store events; compare with --golden instead", filepath.Base(filename))
+	}
+	reference = filterRecords(reference, filter)
+
+	check := compareEvents(reference, detected, opts.Tolerance)
+	check.Input = filepath.Base(filename)
+	check.Reference = source
+	if err := writeEventCheck(os.Stdout, check, opts.Format); err != nil {
+		return err
+	}
+	if check.Differs() {
+		return &exitCodeError{
+			code: exitEventsDiffer,
+			err:  fmt.Errorf("detected events differ from %s: %d shifted, %d missing, %d added", source, len(check.Shifted), len(check.Missing), len(check.Added)),
+		}
+	}
+	return nil
+}
+
+// eventCheckOptions are the flags of `agent show ... check`.
+type eventCheckOptions struct {
+	Golden      string
+	WriteGolden string
+	Tolerance   int
+	Format      string
+}
+
+// writeEventCheck prints the differences as text or JSON.
+func writeEventCheck(w io.Writer, check *EventCheck, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(check)
+	}
+
+	fmt.Fprintf(w, "=== Event check for %s against %s ===\n", check.Input, check.Reference)
+	fmt.Fprintf(w, "Expected %d, detected %d: %d matched, %d shifted, %d missing, %d added\n",
+		check.Expected, check.Detected, check.Matched, len(check.Shifted), len(check.Missing), len(check.Added))
+	if !check.Differs() {
+		return nil
+	}
+	fmt.Fprintln(w)
+	for _, e := range check.Missing {
+		fmt.Fprintf(w, "MISSING  frame %-8d %s\n", e.Frame, e.Type)
+	}
+	for _, e := range check.Added {
+		fmt.Fprintf(w, "ADDED    frame %-8d %s\n", e.Frame, e.Type)
+	}
+	for _, e := range check.Shifted {
+		fmt.Fprintf(w, "SHIFTED  frame %-8d %s → frame %d (%+d)\n", e.From, e.Type, e.To, e.To-e.From)
+	}
+	return nil
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	enginev1 "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/engine/v1"
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	capturepb "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v2"
+	"github.com/echotools/tape/pkg/codec"
+	"github.com/echotools/tape/pkg/conversion"
+)
+
+func TestCompareEvents(t *testing.T) {
+	reference := []eventRecord{
+		{"GoalScored", 100},
+		{"DiscThrown", 40},
+		{"DiscThrown", 60},
+		{"PlayerSave", 80},
+		{"PlayerStun", 10},
+	}
+	detected := []eventRecord{
+		{"DiscThrown", 62}, // Shifted by 2
+		{"DiscThrown", 40},
+		{"GoalScored", 100},
+		{"PlayerSave", 90}, // Beyond the tolerance
+		{"PlayerJoined", 0},
+	}
+
+	check := compareEvents(reference, detected, 3)
+	if check.Expected != 5 || check.Detected != 5 || check.Matched != 2 {
+		t.Errorf("expected %d, detected %d, matched %d; want 5, 5, 2", check.Expected, check.Detected, check.Matched)
+	}
+	if want := []ShiftedEvent{{"DiscThrown", 60, 62}}; !slices.Equal(check.Shifted, want) {
+		t.Errorf("shifted = %v, want %v", check.Shifted, want)
+	}
+	if want := []eventRecord{{"PlayerStun", 10}, {"PlayerSave", 80}}; !slices.Equal(check.Missing, want) {
+		t.Errorf("missing = %v, want %v", check.Missing, want)
+	}
+	if want := []eventRecord{{"PlayerJoined", 0}, {"PlayerSave", 90}}; !slices.Equal(check.Added, want) {
+		t.Errorf("added = %v, want %v", check.Added, want)
+	}
+	if !check.Differs() {
+		t.Error("Differs() = false")
+	}
+}
+
+func TestCompareEvents_PrefersExactAndNearest(t *testing.T) {
+	// The exact match at 50 must not be taken by the shifted event at 49
+	reference := []eventRecord{{"DiscCaught", 49}, {"DiscCaught", 50}}
+	detected := []eventRecord{{"DiscCaught", 50}, {"DiscCaught", 47}, {"DiscCaught", 52}}
+
+	check := compareEvents(reference, detected, 3)
+	if check.Matched != 1 {
+		t.Errorf("matched = %d, want 1", check.Matched)
+	}
+	if want := []ShiftedEvent{{"DiscCaught", 49, 47}}; !slices.Equal(check.Shifted, want) {
+		t.Errorf("shifted = %v, want %v", check.Shifted, want)
+	}
+	if want := []eventRecord{{"DiscCaught", 52}}; !slices.Equal(check.Added, want) {
+		t.Errorf("added = %v, want %v", check.Added, want)
+	}
+}
+
+func TestCompareEvents_Identical(t *testing.T) {
+	events := []eventRecord{{"GoalScored", 5}, {"GoalScored", 5}, {"RoundEnded", 9}}
+	check := compareEvents(events, slices.Clone(events), 0)
+	if check.Differs() || check.Matched != 3 {
+		t.Errorf("check = %+v, want 3 matched and no differences", check)
+	}
+}
+
+func TestReadGoldenEvents(t *testing.T) {
+	dir := t.TempDir()
+	want := []eventRecord{{"GoalScored", 12}, {"PlayerSave", 30}}
+
+	tests := map[string]string{
+		"array.json": `[{"event_type": "GoalScored", "frame_index": 12}, {"event_type": "PlayerSave", "frame_index": 30}]`,
+		"lines.jsonl": `{"event_type":"GoalScored","frame_index":12,"timestamp":"2025-01-01T00:00:00Z"}
+{"event_type":"PlayerSave","frame_index":30,"event":{"player_slot":3}}
+`,
+		"indented.json": "{\n  \"event_type\": \"GoalScored\",\n  \"frame_index\": 12\n}\n{\n  \"event_type\": \"PlayerSave\",\n  \"frame_index\": 30\n}\n",
+	}
+	for name, content := range tests {
+		path := filepath.Join(dir, name)
+		writeTestFile(t, path, content)
+		got, err := readGoldenEvents(path)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s: events = %v, want %v", name, got, want)
+		}
+	}
+
+	bad := filepath.Join(dir, "bad.jsonl")
+	writeTestFile(t, bad, `{"frame_index": 3}`)
+	if _, err := readGoldenEvents(bad); err == nil {
+		t.Error("event without event_type was accepted")
+	}
+}
+
+func TestWriteGoldenEvents_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golden.jsonl")
+	want := []eventRecord{{"DiscThrown", 1}, {"DiscCaught", 4}}
+	if err := writeGoldenEvents(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readGoldenEvents(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("round trip = %v, want %v", got, want)
+	}
+}
+
+func TestFilterRecords(t *testing.T) {
+	filter, err := newEventFilter(showFilterOptions{Types: []string{"GoalScored"}, Frames: "10:20"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []eventRecord{{"GoalScored", 5}, {"GoalScored", 15}, {"PlayerSave", 15}}
+	if got := filterRecords(records, filter); !slices.Equal(got, []eventRecord{{"GoalScored", 15}}) {
+		t.Errorf("filtered = %v", got)
+	}
+}
+
+func TestRunEventCheck_RejectsFrameFilters(t *testing.T) {
+	filter, err := newEventFilter(showFilterOptions{Team: "blue"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runEventCheck("game.tape", filter, eventCheckOptions{}); err == nil || !strings.Contains(err.Error(), "--type and --frames") {
+		t.Errorf("err = %v, want a filter error", err)
+	}
+}
+
+func TestWriteEventCheck_Text(t *testing.T) {
+	check := compareEvents(
+		[]eventRecord{{"GoalScored", 100}, {"PlayerSave", 80}},
+		[]eventRecord{{"GoalScored", 103}, {"PlayerStun", 7}},
+		5,
+	)
+	check.Input = "match.nevrcap"
+	check.Reference = "stored"
+
+	var out bytes.Buffer
+	if err := writeEventCheck(&out, check, "text"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"against stored",
+		"1 shifted, 1 missing, 1 added",
+		"MISSING  frame 80       PlayerSave",
+		"ADDED    frame 7        PlayerStun",
+		"SHIFTED  frame 100      GoalScored → frame 103 (+3)",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRecordingEvents_TapeComparesInTapeNamespace(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "match.tape")
+
+	// alpha scores on frame 2. The recorder stores the goal as GoalScored and
+	// PlayerGoal, which has no v1 form.
+	frames := resampleTestFrames(0, 100, 200, 300)
+	for i, frame := range frames {
+		frame.Session.Teams = rosterTestFrame().GetSession().GetTeams()
+		if i >= 2 {
+			frame.Session.BluePoints = 2
+			frame.Session.LastScore = &enginev1.LastScore{Team: "blue", PersonScored: "alpha", PointAmount: 2}
+		}
+	}
+	writer, err := codec.NewWriter(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteHeader(conversion.MapHeaderFromSession(&telemetry.TelemetryHeader{CreatedAt: frames[0].GetTimestamp()}, frames[0].GetSession())); err != nil {
+		t.Fatal(err)
+	}
+	mapper := conversion.FrameMapper{BaseTime: frames[0].GetTimestamp().AsTime()}
+	for i, frame := range frames {
+		native := mapper.MapFrame(frame)
+		if i == 2 {
+			native.GetEchoArena().Events = []*capturepb.EchoEvent{
+				{Event: &capturepb.EchoEvent_GoalScored{GoalScored: &capturepb.GoalScored{ScorerSlot: 0, AssistSlot: -1, Team: capturepb.Role_ROLE_BLUE_TEAM, PointAmount: 2}}},
+				{Event: &capturepb.EchoEvent_PlayerGoal{PlayerGoal: &capturepb.PlayerGoal{PlayerSlot: 0, TotalGoals: 1}}},
+			}
+		}
+		if err := writer.WriteFrame(native); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, detected, hasStored, err := recordingEvents(input)
+	if err != nil {
+		t.Fatalf("recordingEvents() error = %v", err)
+	}
+	if !hasStored {
+		t.Fatal("hasStored = false for a tape")
+	}
+	want := []eventRecord{{Type: "GoalScored", Frame: 2}, {Type: "PlayerGoal", Frame: 2}}
+	if !slices.Equal(stored, want) || !slices.Equal(detected, want) {
+		t.Errorf("stored = %v, detected = %v; want both %v", stored, detected, want)
+	}
+	if check := compareEvents(stored, detected, 0); check.Differs() {
+		t.Errorf("check differs: %+v", check)
+	}
+}
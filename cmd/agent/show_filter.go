@@ -0,0 +1,432 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	enginev1 "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/engine/v1"
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	capturepb "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// showEventTypes lists the event type names accepted by `show --type`, as
+// reported by getEventTypeName and getV2EventTypeName.
+var showEventTypes = []string{
+	"RoundStarted", "RoundPaused", "RoundUnpaused", "RoundEnded", "MatchEnded",
+	"ScoreboardUpdated", "PlayerJoined", "PlayerLeft", "PlayerSwitchedTeam",
+	"EmotePlayed", "DiscPossessionChanged", "DiscThrown", "DiscCaught",
+	"GoalScored", "PlayerGoal", "PlayerSave", "PlayerStun", "PlayerPass",
+	"PlayerSteal", "PlayerBlock", "PlayerInterception", "PlayerAssist",
+	"PlayerShotTaken", "GenericEvent",
+}
+
+// teamNames are the team filter values, by their index in the session's team list.
+var teamNames = []string{"blue", "orange", "spectator"}
+
+// showFilterOptions holds the raw filter flags of `agent show`.
+type showFilterOptions struct {
+	Types    []string
+	Player   string
+	Team     string
+	Round    int
+	Frames   string
+	Clock    string
+	Statuses []string
+}
+
+// eventFilter selects the events printed by `agent show`. An event is kept
+// only if it matches every filter that is set. v1 and tape inputs are
+// filtered the same way: tape frames are mapped to the v1 session view first.
+type eventFilter struct {
+	types      map[string]bool
+	player     string
+	team       string
+	round      int
+	firstFrame int
+	lastFrame  int // -1 = end of recording
+	clockHigh  float64
+	clockLow   float64
+	hasClock   bool
+	statuses   map[string]bool
+}
+
+// newEventFilter validates the filter flags.
+func newEventFilter(opts showFilterOptions) (*eventFilter, error) {
+	f := &eventFilter{
+		player: strings.TrimSpace(opts.Player),
+		round:  opts.Round,
+	}
+
+	for _, value := range splitList(opts.Types) {
+		i := slices.IndexFunc(showEventTypes, func(name string) bool { return strings.EqualFold(name, value) })
+		if i < 0 {
+			return nil, fmt.Errorf("unknown event type %q (valid types: %s)", value, strings.Join(showEventTypes, ", "))
+		}
+		if f.types == nil {
+			f.types = make(map[string]bool)
+		}
+		f.types[showEventTypes[i]] = true
+	}
+
+	if opts.Team != "" {
+		f.team = strings.ToLower(strings.TrimSpace(opts.Team))
+		if !slices.Contains(teamNames, f.team) {
+			return nil, fmt.Errorf("unknown team %q (valid teams: %s)", opts.Team, strings.Join(teamNames, ", "))
+		}
+	}
+
+	if f.round < 0 {
+		return nil, fmt.Errorf("round must be positive, got %d", f.round)
+	}
+
+	var err error
+	if f.firstFrame, f.lastFrame, err = parseFrameRange(opts.Frames); err != nil {
+		return nil, err
+	}
+	if f.firstFrame < 0 || (f.lastFrame >= 0 && f.lastFrame < f.firstFrame) {
+		return nil, fmt.Errorf("invalid frame range %q", opts.Frames)
+	}
+
+	if opts.Clock != "" {
+		if f.clockHigh, f.clockLow, err = parseClockWindow(opts.Clock); err != nil {
+			return nil, err
+		}
+		f.hasClock = true
+	}
+
+	for _, status := range splitList(opts.Statuses) {
+		if f.statuses == nil {
+			f.statuses = make(map[string]bool)
+		}
+		f.statuses[normalizeGameStatus(status)] = true
+	}
+
+	return f, nil
+}
+
+// splitList flattens repeated and comma-separated flag values.
+func splitList(values []string) []string {
+	var out []string
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				out = append(out, part)
+			}
+		}
+	}
+	return out
+}
+
+// normalizeGameStatus lowercases a game status and strips an enum prefix, so
+// "GAME_STATUS_ROUND_OVER", "round_over" and "Round_Over" compare equal.
+func normalizeGameStatus(status string) string {
+	status = strings.ToLower(strings.TrimSpace(status))
+	return strings.TrimPrefix(status, "game_status_")
+}
+
+// needsFrame reports whether the filter looks at frame state beyond the frame
+// index, so that tape frames have to be mapped to the v1 session view.
+func (f *eventFilter) needsFrame() bool {
+	return f.player != "" || f.team != "" || f.round != 0 || f.hasClock || f.statuses != nil
+}
+
+// showEvent is an event as seen by the filter.
+type showEvent struct {
+	typeName   string
+	event      proto.Message
+	frameIndex int
+	frame      *telemetry.LobbySessionStateFrame // nil if unknown
+	round      int                               // Round at the event's frame, counted like `agent slice`
+}
+
+// match reports whether an event passes every filter that is set.
+func (f *eventFilter) match(e showEvent) bool {
+	if f.types != nil && !f.types[e.typeName] {
+		return false
+	}
+	if !f.matchFrame(e.frameIndex, e.frame, e.round) {
+		return false
+	}
+	if f.player != "" || f.team != "" {
+		return f.matchPlayers(e)
+	}
+	return true
+}
+
+// matchFrame applies the frame range, game status, round and game clock
+// filters to a frame.
+func (f *eventFilter) matchFrame(frameIndex int, frame *telemetry.LobbySessionStateFrame, round int) bool {
+	if frameIndex < f.firstFrame || (f.lastFrame >= 0 && frameIndex > f.lastFrame) {
+		return false
+	}
+
+	session := frame.GetSession()
+	status := normalizeGameStatus(session.GetGameStatus())
+	if f.statuses != nil && !f.statuses[status] {
+		return false
+	}
+	if f.round != 0 && (round != f.round || !roundStatuses[status]) {
+		return false
+	}
+	if f.hasClock {
+		clock, err := parseGameClock(session.GetGameClockDisplay())
+		if err != nil || clock > f.clockHigh || clock < f.clockLow {
+			return false
+		}
+	}
+	return true
+}
+
+// matchPlayers applies the player and team filters. The players an event
+// refers to by slot, display name or account number are looked up in the
+// frame's team lists.
+func (f *eventFilter) matchPlayers(e showEvent) bool {
+	refs := newEventRefs(e.event)
+	involved := refs.resolve(sessionRoster(e.frame.GetSession()))
+	if f.player != "" && !slices.ContainsFunc(involved, func(p rosterPlayer) bool { return p.is(f.player) }) &&
+		!refs.mentions(f.player) {
+		return false
+	}
+	if f.team != "" && !slices.ContainsFunc(involved, func(p rosterPlayer) bool { return p.team == f.team }) &&
+		!slices.Contains(refs.teams, f.team) {
+		return false
+	}
+	return true
+}
+
+// rosterPlayer is a player listed in a frame's session.
+type rosterPlayer struct {
+	name   string
+	id     string // account number
+	slot   int32
+	team   string
+	member *enginev1.TeamMember
+}
+
+// is reports whether a --player value names this player or its account number.
+func (p rosterPlayer) is(value string) bool {
+	return strings.EqualFold(p.name, value) || (p.id != "" && p.id == value)
+}
+
+// sessionRoster lists the players of every team in the session, taking the
+// team from the position in the session's team list.
+func sessionRoster(session *enginev1.SessionResponse) []rosterPlayer {
+	var roster []rosterPlayer
+	for i, team := range session.GetTeams() {
+		teamName := ""
+		if i < len(teamNames) {
+			teamName = teamNames[i]
+		}
+		for _, member := range team.GetPlayers() {
+			if member.GetDisplayName() == "" && member.GetAccountNumber() == 0 {
+				continue
+			}
+			roster = append(roster, rosterPlayer{
+				name:   member.GetDisplayName(),
+				id:     accountID(member.GetAccountNumber()),
+				slot:   member.GetSlotNumber(),
+				team:   teamName,
+				member: member,
+			})
+		}
+	}
+	return roster
+}
+
+// eventPlayer is a player an event refers to, by slot, display name or
+// account number. role is the player's part in the event, e.g. "thrower".
+type eventPlayer struct {
+	role string
+	slot int32 // -1 if the event does not give the slot
+	name string
+	id   string
+}
+
+// find looks the player up in a roster.
+func (p eventPlayer) find(roster []rosterPlayer) (rosterPlayer, bool) {
+	for _, r := range roster {
+		if (p.slot >= 0 && p.slot == r.slot) || (p.name != "" && strings.EqualFold(p.name, r.name)) ||
+			(p.id != "" && p.id == r.id) {
+			return r, true
+		}
+	}
+	return rosterPlayer{}, false
+}
+
+// eventRefs are the players and teams an event refers to.
+type eventRefs struct {
+	players []eventPlayer
+	teams   []string // teamNames values
+}
+
+// newEventRefs returns the players and teams a v1 or capture event refers
+// to. Players referred to by a generic player_slot get the role of the event
+// type from eventRoles.
+func newEventRefs(event proto.Message) eventRefs {
+	var r eventRefs
+	switch e := event.(type) {
+	case *telemetry.LobbySessionEvent:
+		role := eventRole(getEventTypeName(e))
+		switch p := e.Event.(type) {
+		case *telemetry.LobbySessionEvent_RoundEnded:
+			r.addRole(int32(p.RoundEnded.GetWinningTeam()))
+		case *telemetry.LobbySessionEvent_MatchEnded:
+			r.addRole(int32(p.MatchEnded.GetWinningTeam()))
+		case *telemetry.LobbySessionEvent_PlayerJoined:
+			member := p.PlayerJoined.GetPlayer()
+			r.addPlayer(eventPlayer{role: role, slot: member.GetSlotNumber(), name: member.GetDisplayName(), id: accountID(member.GetAccountNumber())})
+			r.addRole(int32(p.PlayerJoined.GetRole()))
+		case *telemetry.LobbySessionEvent_PlayerLeft:
+			r.addPlayer(eventPlayer{role: role, slot: p.PlayerLeft.GetPlayerSlot(), name: p.PlayerLeft.GetDisplayName()})
+		case *telemetry.LobbySessionEvent_PlayerSwitchedTeam:
+			r.addSlot(role, p.PlayerSwitchedTeam.GetPlayerSlot())
+			r.addRole(int32(p.PlayerSwitchedTeam.GetNewRole()))
+		case *telemetry.LobbySessionEvent_EmotePlayed:
+			r.addSlot(role, p.EmotePlayed.GetPlayerSlot())
+		case *telemetry.LobbySessionEvent_DiscPossessionChanged:
+			r.addSlot(role, p.DiscPossessionChanged.GetPlayerSlot())
+			r.addSlot("previous", p.DiscPossessionChanged.GetPreviousSlot())
+		case *telemetry.LobbySessionEvent_DiscThrown:
+			r.addSlot(role, p.DiscThrown.GetPlayerSlot())
+		case *telemetry.LobbySessionEvent_DiscCaught:
+			r.addSlot(role, p.DiscCaught.GetPlayerSlot())
+		case *telemetry.LobbySessionEvent_GoalScored:
+			score := p.GoalScored.GetScoreDetails()
+			r.addPlayer(eventPlayer{role: "scorer", slot: -1, name: score.GetPersonScored()})
+			r.addPlayer(eventPlayer{role: "assist", slot: -1, name: score.GetAssistScored()})
+			if team := teamName(score.GetTeam()); team != "" {
+				r.teams = append(r.teams, team)
+			}
+		case *telemetry.LobbySessionEvent_PlayerSave:
+			r.addSlot(role, p.PlayerSave.GetPlayerSlot())
+		case *telemetry.LobbySessionEvent_PlayerStun:
+			r.addSlot(role, p.PlayerStun.GetPlayerSlot())
+		case *telemetry.LobbySessionEvent_PlayerPass:
+			r.addSlot(role, p.PlayerPass.GetPlayerSlot())
+		case *telemetry.LobbySessionEvent_PlayerSteal:
+			r.addSlot(role, p.PlayerSteal.GetPlayerSlot())
+		case *telemetry.LobbySessionEvent_PlayerBlock:
+			r.addSlot(role, p.PlayerBlock.GetPlayerSlot())
+		case *telemetry.LobbySessionEvent_PlayerInterception:
+			r.addSlot(role, p.PlayerInterception.GetPlayerSlot())
+		case *telemetry.LobbySessionEvent_PlayerAssist:
+			r.addSlot(role, p.PlayerAssist.GetPlayerSlot())
+		case *telemetry.LobbySessionEvent_PlayerShotTaken:
+			r.addSlot(role, p.PlayerShotTaken.GetPlayerSlot())
+		}
+
+	case *capturepb.EchoEvent:
+		role := eventRole(getV2EventTypeName(e))
+		switch p := e.Event.(type) {
+		case *capturepb.EchoEvent_RoundPaused:
+			r.addSlot(role, p.RoundPaused.GetPlayerSlot())
+		case *capturepb.EchoEvent_RoundUnpaused:
+			r.addSlot(role, p.RoundUnpaused.GetPlayerSlot())
+		case *capturepb.EchoEvent_RoundEnded:
+			r.addRole(int32(p.RoundEnded.GetWinningTeam()))
+		case *capturepb.EchoEvent_MatchEnded:
+			r.addRole(int32(p.MatchEnded.GetWinningTeam()))
+		case *capturepb.EchoEvent_PlayerJoined:
+			joined := p.PlayerJoined
+			r.addPlayer(eventPlayer{role: role, slot: joined.GetPlayerSlot(), name: joined.GetDisplayName(), id: accountID(joined.GetAccountNumber())})
+			r.addRole(int32(joined.GetRole()))
+		case *capturepb.EchoEvent_PlayerLeft:
+			r.addPlayer(eventPlayer{role: role, slot: p.PlayerLeft.GetPlayerSlot(), name: p.PlayerLeft.GetDisplayName()})
+		case *capturepb.EchoEvent_PlayerSwitchedTeam:
+			r.addSlot(role, p.PlayerSwitchedTeam.GetPlayerSlot())
+			r.addRole(int32(p.PlayerSwitchedTeam.GetNewRole()))
+		case *capturepb.EchoEvent_EmotePlayed:
+			r.addSlot(role, p.EmotePlayed.GetPlayerSlot())
+		case *capturepb.EchoEvent_DiscPossessionChanged:
+			r.addSlot(role, p.DiscPossessionChanged.GetPlayerSlot())
+			r.addSlot("previous", p.DiscPossessionChanged.GetPreviousSlot())
+		case *capturepb.EchoEvent_DiscThrown:
+			r.addSlot(role, p.DiscThrown.GetPlayerSlot())
+		case *capturepb.EchoEvent_DiscCaught:
+			r.addSlot(role, p.DiscCaught.GetPlayerSlot())
+		case *capturepb.EchoEvent_GoalScored:
+			r.addSlot("scorer", p.GoalScored.GetScorerSlot())
+			r.addSlot("assist", p.GoalScored.GetAssistSlot())
+			r.addRole(int32(p.GoalScored.GetTeam()))
+		case *capturepb.EchoEvent_PlayerGoal:
+			r.addSlot(role, p.PlayerGoal.GetPlayerSlot())
+		case *capturepb.EchoEvent_PlayerSave:
+			r.addSlot(role, p.PlayerSave.GetPlayerSlot())
+		case *capturepb.EchoEvent_PlayerStun:
+			r.addSlot(role, p.PlayerStun.GetPlayerSlot())
+		case *capturepb.EchoEvent_PlayerPass:
+			r.addSlot(role, p.PlayerPass.GetPlayerSlot())
+		case *capturepb.EchoEvent_PlayerSteal:
+			r.addSlot(role, p.PlayerSteal.GetPlayerSlot())
+		case *capturepb.EchoEvent_PlayerBlock:
+			r.addSlot(role, p.PlayerBlock.GetPlayerSlot())
+		case *capturepb.EchoEvent_PlayerInterception:
+			r.addSlot(role, p.PlayerInterception.GetPlayerSlot())
+		case *capturepb.EchoEvent_PlayerAssist:
+			r.addSlot(role, p.PlayerAssist.GetPlayerSlot())
+		case *capturepb.EchoEvent_PlayerShotTaken:
+			r.addSlot(role, p.PlayerShotTaken.GetPlayerSlot())
+		}
+	}
+	return r
+}
+
+// addSlot adds a player referred to by slot. A negative slot refers to no
+// player, e.g. a free disc.
+func (r *eventRefs) addSlot(role string, slot int32) {
+	if slot >= 0 {
+		r.addPlayer(eventPlayer{role: role, slot: slot})
+	}
+}
+
+func (r *eventRefs) addPlayer(p eventPlayer) {
+	if p.slot >= 0 || p.name != "" || p.id != "" {
+		r.players = append(r.players, p)
+	}
+}
+
+// addRole adds the team of a v1 or capture Role value, which share their numbering.
+func (r *eventRefs) addRole(role int32) {
+	if role >= 1 && int(role) <= len(teamNames) {
+		r.teams = append(r.teams, teamNames[role-1])
+	}
+}
+
+// resolve returns the roster entries of the players the event refers to.
+func (r *eventRefs) resolve(roster []rosterPlayer) []rosterPlayer {
+	var out []rosterPlayer
+	for _, p := range r.players {
+		if player, ok := p.find(roster); ok {
+			out = append(out, player)
+		}
+	}
+	return out
+}
+
+// mentions reports whether the event names a player or account number
+// directly, for players that are not in the frame's roster (e.g. one that
+// just left).
+func (r *eventRefs) mentions(value string) bool {
+	return slices.ContainsFunc(r.players, func(p eventPlayer) bool {
+		return (p.name != "" && strings.EqualFold(p.name, value)) || (p.id != "" && p.id == value)
+	})
+}
+
+// eventRole returns the role of the player an event type refers to by a
+// generic player slot.
+func eventRole(typeName string) string {
+	if role, ok := eventRoles[typeName]; ok {
+		return role
+	}
+	return "player"
+}
+
+func accountID(account uint64) string {
+	if account == 0 {
+		return ""
+	}
+	return strconv.FormatUint(account, 10)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	enginev1 "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/engine/v1"
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	capturepb "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// filterTestFrames runs one event of the given type per frame of
+// testMatchFrames through a filter and returns the frames whose event was kept.
+func filterTestFrames(t *testing.T, opts showFilterOptions, eventType string) []int {
+	t.Helper()
+	filter, err := newEventFilter(opts)
+	if err != nil {
+		t.Fatalf("newEventFilter() error = %v", err)
+	}
+
+	var rounds roundTracker
+	var kept []int
+	for i, frame := range testMatchFrames() {
+		rounds.track(frame.GetSession().GetGameStatus())
+		if filter.match(showEvent{typeName: eventType, frameIndex: i, frame: frame, round: rounds.round}) {
+			kept = append(kept, i)
+		}
+	}
+	return kept
+}
+
+func TestEventFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      showFilterOptions
+		eventType string
+		want      []int
+	}{
+		{"no filters", showFilterOptions{}, "GoalScored", []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17}},
+		{"type kept", showFilterOptions{Types: []string{"goalscored,PlayerSave"}}, "GoalScored", []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17}},
+		{"type dropped", showFilterOptions{Types: []string{"PlayerSave"}}, "GoalScored", nil},
+		{"frames", showFilterOptions{Frames: "3:5"}, "GoalScored", []int{3, 4, 5}},
+		{"open frames", showFilterOptions{Frames: "15:"}, "GoalScored", []int{15, 16, 17}},
+		{"round 2", showFilterOptions{Round: 2}, "GoalScored", []int{11, 12, 13, 14, 15, 16}},
+		{"status", showFilterOptions{Statuses: []string{"score", "ROUND_OVER"}}, "GoalScored", []int{7, 10, 15, 16}},
+		{"clock", showFilterOptions{Clock: "2:20-2:40"}, "GoalScored", []int{14, 15, 16}},
+		{"round and status", showFilterOptions{Round: 1, Statuses: []string{"score"}}, "GoalScored", []int{7}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filterTestFrames(t, tt.opts, tt.eventType); !slices.Equal(got, tt.want) {
+				t.Errorf("kept frames %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// rosterTestFrame is a frame with alpha (slot 0, blue) and bravo (slot 1, orange).
+func rosterTestFrame() *telemetry.LobbySessionStateFrame {
+	return &telemetry.LobbySessionStateFrame{Session: &enginev1.SessionResponse{
+		GameStatus: "playing",
+		Teams: []*enginev1.Team{
+			{Players: []*enginev1.TeamMember{{DisplayName: "alpha", SlotNumber: 0, AccountNumber: 111}}},
+			{Players: []*enginev1.TeamMember{{DisplayName: "bravo", SlotNumber: 1, AccountNumber: 222}}},
+		},
+	}}
+}
+
+func TestEventFilter_PlayersAndTeams(t *testing.T) {
+	v1Thrown := &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_DiscThrown{DiscThrown: &telemetry.DiscThrown{PlayerSlot: 0}}}
+	v1Goal := &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_GoalScored{
+		GoalScored: &telemetry.GoalScored{ScoreDetails: &enginev1.LastScore{Team: "orange", PersonScored: "bravo"}},
+	}}
+	v1Joined := &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_PlayerJoined{
+		PlayerJoined: &telemetry.PlayerJoined{Player: &enginev1.TeamMember{DisplayName: "delta", SlotNumber: 4, AccountNumber: 444}, Role: telemetry.Role_ROLE_ORANGE_TEAM},
+	}}
+	tapeGoal := &capturepb.EchoEvent{Event: &capturepb.EchoEvent_GoalScored{
+		GoalScored: &capturepb.GoalScored{ScorerSlot: 1, AssistSlot: -1, Team: capturepb.Role_ROLE_ORANGE_TEAM},
+	}}
+	tapePlayerGoal := &capturepb.EchoEvent{Event: &capturepb.EchoEvent_PlayerGoal{PlayerGoal: &capturepb.PlayerGoal{PlayerSlot: 0, TotalGoals: 1}}}
+	tapeLeft := &capturepb.EchoEvent{Event: &capturepb.EchoEvent_PlayerLeft{PlayerLeft: &capturepb.PlayerLeft{PlayerSlot: 5, DisplayName: "charlie"}}}
+
+	tests := []struct {
+		name   string
+		event  proto.Message
+		player string
+		team   string
+		want   bool
+	}{
+		{"v1 thrower by name", v1Thrown, "ALPHA", "", true},
+		{"v1 thrower by account", v1Thrown, "111", "", true},
+		{"v1 thrower other player", v1Thrown, "bravo", "", false},
+		{"v1 thrower team", v1Thrown, "", "blue", true},
+		{"v1 thrower other team", v1Thrown, "", "orange", false},
+		{"v1 scorer", v1Goal, "bravo", "orange", true},
+		{"v1 scoring team", v1Goal, "", "blue", false},
+		{"v1 joined player not in roster", v1Joined, "444", "orange", true},
+		{"tape scorer", tapeGoal, "bravo", "", true},
+		{"tape scoring team", tapeGoal, "", "orange", true},
+		{"tape goal other player", tapeGoal, "alpha", "", false},
+		{"tape player goal", tapePlayerGoal, "alpha", "blue", true},
+		{"tape player goal other team", tapePlayerGoal, "", "orange", false},
+		{"tape left player not in roster", tapeLeft, "charlie", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := newEventFilter(showFilterOptions{Player: tt.player, Team: tt.team})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filter.match(showEvent{event: tt.event, frame: rosterTestFrame()}); got != tt.want {
+				t.Errorf("match() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewEventRefs_Roles(t *testing.T) {
+	tests := []struct {
+		name  string
+		event proto.Message
+		want  []eventPlayer
+	}{
+		{"v1 throw", &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_DiscThrown{DiscThrown: &telemetry.DiscThrown{PlayerSlot: 3}}},
+			[]eventPlayer{{role: "thrower", slot: 3}}},
+		{"v1 possession to a free disc", &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_DiscPossessionChanged{
+			DiscPossessionChanged: &telemetry.DiscPossessionChanged{PlayerSlot: -1, PreviousSlot: 2},
+		}}, []eventPlayer{{role: "previous", slot: 2}}},
+		{"v1 goal", &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_GoalScored{
+			GoalScored: &telemetry.GoalScored{ScoreDetails: &enginev1.LastScore{PersonScored: "alpha", AssistScored: "bravo"}},
+		}}, []eventPlayer{{role: "scorer", slot: -1, name: "alpha"}, {role: "assist", slot: -1, name: "bravo"}}},
+		{"tape goal without assist", &capturepb.EchoEvent{Event: &capturepb.EchoEvent_GoalScored{
+			GoalScored: &capturepb.GoalScored{ScorerSlot: 1, AssistSlot: -1},
+		}}, []eventPlayer{{role: "scorer", slot: 1}}},
+		{"tape stun", &capturepb.EchoEvent{Event: &capturepb.EchoEvent_PlayerStun{PlayerStun: &capturepb.PlayerStun{PlayerSlot: 4}}},
+			[]eventPlayer{{role: "stunner", slot: 4}}},
+		{"tape generic event", &capturepb.EchoEvent{Event: &capturepb.EchoEvent_GenericEvent{GenericEvent: &capturepb.GenericEvent{Name: "custom"}}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newEventRefs(tt.event).players; !slices.Equal(got, tt.want) {
+				t.Errorf("players = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewEventFilter_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts showFilterOptions
+		want string
+	}{
+		{"unknown type", showFilterOptions{Types: []string{"GoalScored,Goals"}}, `unknown event type "Goals"`},
+		{"unknown team", showFilterOptions{Team: "green"}, `unknown team "green"`},
+		{"negative round", showFilterOptions{Round: -1}, "round must be positive"},
+		{"bad frame range", showFilterOptions{Frames: "10:5"}, "invalid frame range"},
+		{"bad clock", showFilterOptions{Clock: "5:00"}, "invalid clock window"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newEventFilter(tt.opts)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("newEventFilter() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeGameStatus(t *testing.T) {
+	for _, in := range []string{"round_over", "ROUND_OVER", "GAME_STATUS_ROUND_OVER", " Round_Over "} {
+		if got := normalizeGameStatus(in); got != "round_over" {
+			t.Errorf("normalizeGameStatus(%q) = %q, want round_over", in, got)
+		}
+	}
+}
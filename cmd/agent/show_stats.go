@@ -0,0 +1,416 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	enginev1 "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/engine/v1"
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+)
+
+// boxScoreCounters are the cumulative per-player stat fields read from each
+// frame, in box score column order.
+var boxScoreCounters = []string{
+	"goals", "assists", "saves", "stuns", "steals", "blocks", "interceptions", "passes", "shots_taken",
+}
+
+// playerStatFields are the stat fields read from each player: the counters and
+// the running possession time.
+var playerStatFields = append(slices.Clip(boxScoreCounters), "possession_time")
+
+// maxStatsGap caps the time credited for a single frame, so gaps in a
+// recording are not counted as time played or in possession.
+const maxStatsGap = time.Second
+
+// StatLine is the set of box score columns shared by players and teams.
+// Times are in seconds and speeds in meters per second.
+type StatLine struct {
+	Goals          int     `json:"goals"`
+	Assists        int     `json:"assists"`
+	Saves          int     `json:"saves"`
+	Stuns          int     `json:"stuns"`
+	Steals         int     `json:"steals"`
+	Blocks         int     `json:"blocks"`
+	Interceptions  int     `json:"interceptions"`
+	Passes         int     `json:"passes"`
+	ShotsTaken     int     `json:"shots_taken"`
+	ShootingPct    float64 `json:"shooting_pct"`
+	PossessionTime float64 `json:"possession_time"`
+	TimePlayed     float64 `json:"time_played"`
+	AvgSpeed       float64 `json:"avg_speed"`
+}
+
+// counts returns pointers to the counter columns, in boxScoreCounters order.
+func (s *StatLine) counts() []*int {
+	return []*int{&s.Goals, &s.Assists, &s.Saves, &s.Stuns, &s.Steals, &s.Blocks, &s.Interceptions, &s.Passes, &s.ShotsTaken}
+}
+
+func (s *StatLine) finish() {
+	if s.ShotsTaken > 0 {
+		s.ShootingPct = round2(float64(s.Goals) / float64(s.ShotsTaken) * 100)
+	}
+	s.PossessionTime = round2(s.PossessionTime)
+	s.TimePlayed = round2(s.TimePlayed)
+	s.AvgSpeed = round2(s.AvgSpeed)
+}
+
+func round2(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// PlayerStats is one player's row of the box score.
+type PlayerStats struct {
+	Name      string `json:"name"`
+	AccountID string `json:"account_id,omitempty"`
+	Team      string `json:"team"`
+	StatLine
+
+	last        map[string]float64 // Last cumulative value of each stat field
+	hasStats    bool               // Frames carried a possession_time counter
+	heldTime    float64            // Possession time from frames with the disc held
+	speedSum    float64
+	speedFrames int
+}
+
+// TeamStats is a team's row of the box score: the sum of its players' rows.
+type TeamStats struct {
+	Team    string `json:"team"`
+	Players int    `json:"players"`
+	StatLine
+}
+
+// BoxScore is the `agent show ... stats` output.
+type BoxScore struct {
+	Input       string         `json:"input"`
+	Frames      int            `json:"frames"`
+	FramesUsed  int            `json:"frames_used"`
+	PlayingTime float64        `json:"playing_time"`
+	Players     []*PlayerStats `json:"players"`
+	Teams       []*TeamStats   `json:"teams"`
+}
+
+// playerSample is one player's state in a single frame.
+type playerSample struct {
+	Name       string
+	AccountID  string
+	Team       string
+	Counters   map[string]float64 // Cumulative stat fields present in the frame
+	Possession bool
+	Speed      float64
+	HasSpeed   bool
+}
+
+// key identifies a player across frames: by account ID, or by name for
+// recordings without one.
+func (s playerSample) key() string {
+	if s.AccountID != "" && s.AccountID != "0" {
+		return "id:" + s.AccountID
+	}
+	return "name:" + strings.ToLower(s.Name)
+}
+
+// boxScoreBuilder accumulates player samples frame by frame.
+//
+// The stat fields in a frame are running totals, so the builder credits the
+// increase since the previous frame. A total that drops was reset (a new
+// match in the same recording) and counts from zero. Frames rejected by the
+// filters still update the running totals, so only increases inside the
+// selected frames are credited.
+type boxScoreBuilder struct {
+	score   *BoxScore
+	players map[string]*PlayerStats
+	lastTS  time.Time
+}
+
+func newBoxScoreBuilder(input string) *boxScoreBuilder {
+	return &boxScoreBuilder{
+		score:   &BoxScore{Input: filepath.Base(input)},
+		players: make(map[string]*PlayerStats),
+	}
+}
+
+// addFrame adds one frame. counted reports whether the frame passed the
+// filters; playing whether the round clock was running.
+func (b *boxScoreBuilder) addFrame(ts time.Time, counted, playing bool, samples []playerSample) {
+	b.score.Frames++
+	var dt float64
+	if !b.lastTS.IsZero() && ts.After(b.lastTS) {
+		dt = min(ts.Sub(b.lastTS), maxStatsGap).Seconds()
+	}
+	b.lastTS = ts
+
+	timed := counted && playing
+	if counted {
+		b.score.FramesUsed++
+	}
+	if timed {
+		b.score.PlayingTime += dt
+	}
+
+	for _, sample := range samples {
+		if sample.Team != "blue" && sample.Team != "orange" {
+			continue
+		}
+		p := b.player(sample)
+
+		for _, name := range playerStatFields {
+			value, ok := sample.Counters[name]
+			if !ok {
+				continue
+			}
+			if name == "possession_time" {
+				p.hasStats = true
+			}
+			delta := value - p.last[name]
+			if delta < 0 {
+				delta = value
+			}
+			p.last[name] = value
+			if !counted {
+				continue
+			}
+			if i := slices.Index(boxScoreCounters, name); i >= 0 {
+				*p.counts()[i] += int(math.Round(delta))
+			} else {
+				p.PossessionTime += delta
+			}
+		}
+
+		if timed {
+			p.TimePlayed += dt
+			if sample.Possession {
+				p.heldTime += dt
+			}
+			if sample.HasSpeed {
+				p.speedSum += sample.Speed
+				p.speedFrames++
+			}
+		}
+	}
+}
+
+func (b *boxScoreBuilder) player(sample playerSample) *PlayerStats {
+	key := sample.key()
+	p, ok := b.players[key]
+	if !ok {
+		p = &PlayerStats{last: make(map[string]float64)}
+		b.players[key] = p
+	}
+	p.Name = sample.Name
+	p.Team = sample.Team
+	if sample.AccountID != "0" {
+		p.AccountID = sample.AccountID
+	}
+	return p
+}
+
+// finish computes the derived columns and team rows. keep selects the
+// players listed; team rows sum the listed players only.
+func (b *boxScoreBuilder) finish(keep func(*PlayerStats) bool) *BoxScore {
+	score := b.score
+	score.PlayingTime = round2(score.PlayingTime)
+	score.Players = []*PlayerStats{}
+	score.Teams = []*TeamStats{}
+
+	for _, p := range b.players {
+		if !p.hasStats {
+			p.PossessionTime = p.heldTime
+		}
+		if p.speedFrames > 0 {
+			p.AvgSpeed = p.speedSum / float64(p.speedFrames)
+		}
+		p.finish()
+		if keep == nil || keep(p) {
+			score.Players = append(score.Players, p)
+		}
+	}
+	slices.SortFunc(score.Players, func(a, b *PlayerStats) int {
+		if a.Team != b.Team {
+			return strings.Compare(a.Team, b.Team)
+		}
+		if a.Goals != b.Goals {
+			return b.Goals - a.Goals
+		}
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	})
+
+	for _, team := range []string{"blue", "orange"} {
+		t := &TeamStats{Team: team}
+		var speedSum float64
+		for _, p := range score.Players {
+			if p.Team != team {
+				continue
+			}
+			t.Players++
+			for i, c := range t.counts() {
+				*c += *p.counts()[i]
+			}
+			t.PossessionTime += p.PossessionTime
+			t.TimePlayed += p.TimePlayed
+			speedSum += p.AvgSpeed * p.TimePlayed
+		}
+		if t.Players == 0 {
+			continue
+		}
+		if t.TimePlayed > 0 {
+			t.AvgSpeed = speedSum / t.TimePlayed
+		}
+		t.finish()
+		score.Teams = append(score.Teams, t)
+	}
+	return score
+}
+
+// framePlayerSamples extracts every player's state from a frame's session.
+func framePlayerSamples(frame *telemetry.LobbySessionStateFrame) []playerSample {
+	if frame.GetSession() == nil {
+		return nil
+	}
+	roster := sessionRoster(frame.GetSession())
+	samples := make([]playerSample, 0, len(roster))
+	for _, p := range roster {
+		sample := playerSample{Name: p.name, Team: p.team, AccountID: p.id, Counters: make(map[string]float64)}
+		readPlayerStats(p.member, &sample)
+		samples = append(samples, sample)
+	}
+	return samples
+}
+
+// readPlayerStats reads the stat counters, disc possession and speed of a
+// player. Players without a stats message have no counters.
+func readPlayerStats(member *enginev1.TeamMember, sample *playerSample) {
+	if stats := member.GetStats(); stats != nil {
+		sample.Counters["goals"] = float64(stats.GetGoals())
+		sample.Counters["assists"] = float64(stats.GetAssists())
+		sample.Counters["saves"] = float64(stats.GetSaves())
+		sample.Counters["stuns"] = float64(stats.GetStuns())
+		sample.Counters["steals"] = float64(stats.GetSteals())
+		sample.Counters["blocks"] = float64(stats.GetBlocks())
+		sample.Counters["interceptions"] = float64(stats.GetInterceptions())
+		sample.Counters["passes"] = float64(stats.GetPasses())
+		sample.Counters["shots_taken"] = float64(stats.GetShotsTaken())
+		sample.Counters["possession_time"] = float64(stats.GetPossessionTime())
+	}
+	sample.Possession = member.GetHasPossession()
+	if v := member.GetVelocity(); len(v) == 3 {
+		sample.Speed = math.Sqrt(float64(v[0]*v[0] + v[1]*v[1] + v[2]*v[2]))
+		sample.HasSpeed = true
+	}
+}
+
+// buildBoxScore reads a recording and builds its box score. The frame
+// filters select the frames counted; the player and team filters select the
+// rows listed.
+func buildBoxScore(filename string, filter *eventFilter) (*BoxScore, error) {
+	source, err := openV1FrameSource(filename, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	builder := newBoxScoreBuilder(filename)
+	var rounds roundTracker
+	for index := 0; ; index++ {
+		frame, err := source.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read frame: %w", err)
+		}
+
+		status := frame.GetSession().GetGameStatus()
+		rounds.track(status)
+		counted := filter.matchFrame(index, frame, rounds.round)
+		builder.addFrame(frame.GetTimestamp().AsTime(), counted, status == "playing", framePlayerSamples(frame))
+	}
+
+	return builder.finish(func(p *PlayerStats) bool {
+		if filter.team != "" && p.Team != filter.team {
+			return false
+		}
+		return filter.player == "" || strings.EqualFold(p.Name, filter.player) || p.AccountID == filter.player
+	}), nil
+}
+
+// writeBoxScore writes a box score as a text table, JSON or CSV.
+func writeBoxScore(w io.Writer, score *BoxScore, format string) error {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(score)
+	case "csv":
+		return writeBoxScoreCSV(w, score)
+	default:
+		writeBoxScoreText(w, score)
+		return nil
+	}
+}
+
+var boxScoreColumns = []string{"G", "A", "SV", "STN", "STL", "BLK", "INT", "PAS", "SH", "SH%", "POSS", "TIME", "SPD"}
+
+func statColumns(s StatLine) []string {
+	return []string{
+		strconv.Itoa(s.Goals), strconv.Itoa(s.Assists), strconv.Itoa(s.Saves), strconv.Itoa(s.Stuns),
+		strconv.Itoa(s.Steals), strconv.Itoa(s.Blocks), strconv.Itoa(s.Interceptions), strconv.Itoa(s.Passes),
+		strconv.Itoa(s.ShotsTaken), fmt.Sprintf("%.1f", s.ShootingPct),
+		formatStatTime(s.PossessionTime), formatStatTime(s.TimePlayed), fmt.Sprintf("%.2f", s.AvgSpeed),
+	}
+}
+
+func formatStatTime(seconds float64) string {
+	return fmt.Sprintf("%d:%02d", int(seconds)/60, int(seconds)%60)
+}
+
+func writeBoxScoreText(w io.Writer, score *BoxScore) {
+	fmt.Fprintf(w, "=== Box Score for %s ===\n", score.Input)
+	fmt.Fprintf(w, "Frames: %d (%d counted), playing time: %s\n\n", score.Frames, score.FramesUsed, formatStatTime(score.PlayingTime))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "PLAYER\tTEAM\t%s\t\n", strings.Join(boxScoreColumns, "\t"))
+	for _, p := range score.Players {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t\n", p.Name, p.Team, strings.Join(statColumns(p.StatLine), "\t"))
+	}
+	fmt.Fprintln(tw, "\t")
+	for _, t := range score.Teams {
+		fmt.Fprintf(tw, "%s\t%d players\t%s\t\n", strings.ToUpper(t.Team), t.Players, strings.Join(statColumns(t.StatLine), "\t"))
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w, "\nPOSS and TIME are min:sec of playing time; SPD is the average speed in m/s.")
+}
+
+func writeBoxScoreCSV(w io.Writer, score *BoxScore) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{
+		"scope", "name", "account_id", "team", "goals", "assists", "saves", "stuns", "steals", "blocks",
+		"interceptions", "passes", "shots_taken", "shooting_pct", "possession_time", "time_played", "avg_speed",
+	})
+	row := func(scope, name, id, team string, s StatLine) []string {
+		return append([]string{scope, name, id, team},
+			strconv.Itoa(s.Goals), strconv.Itoa(s.Assists), strconv.Itoa(s.Saves), strconv.Itoa(s.Stuns),
+			strconv.Itoa(s.Steals), strconv.Itoa(s.Blocks), strconv.Itoa(s.Interceptions), strconv.Itoa(s.Passes),
+			strconv.Itoa(s.ShotsTaken), strconv.FormatFloat(s.ShootingPct, 'f', -1, 64),
+			strconv.FormatFloat(s.PossessionTime, 'f', -1, 64), strconv.FormatFloat(s.TimePlayed, 'f', -1, 64),
+			strconv.FormatFloat(s.AvgSpeed, 'f', -1, 64))
+	}
+	for _, p := range score.Players {
+		cw.Write(row("player", p.Name, p.AccountID, p.Team, p.StatLine))
+	}
+	for _, t := range score.Teams {
+		cw.Write(row("team", t.Team, "", t.Team, t.StatLine))
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	enginev1 "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/engine/v1"
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	"github.com/echotools/tape/pkg/codec"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func statsSample(name, team string, goals, shots, possession float64, held bool, speed float64) playerSample {
+	return playerSample{
+		Name:       name,
+		AccountID:  "id-" + name,
+		Team:       team,
+		Counters:   map[string]float64{"goals": goals, "shots_taken": shots, "possession_time": possession},
+		Possession: held,
+		Speed:      speed,
+		HasSpeed:   true,
+	}
+}
+
+func TestBoxScoreBuilder(t *testing.T) {
+	base := testFrameBase
+	b := newBoxScoreBuilder("dir/match.echoreplay")
+
+	frames := [][]playerSample{
+		{statsSample("alpha", "blue", 1, 2, 10, true, 2), statsSample("bravo", "orange", 0, 0, 0, false, 4)},
+		{statsSample("alpha", "blue", 1, 2, 10.5, true, 4), statsSample("bravo", "orange", 0, 1, 0, false, 4)},
+		{statsSample("alpha", "blue", 2, 3, 11, false, 6), statsSample("bravo", "orange", 1, 2, 0.5, true, 4)},
+		// Stats reset for a new match: alpha's totals restart from zero
+		{statsSample("alpha", "blue", 1, 1, 0.5, true, 6), statsSample("bravo", "spectator", 1, 2, 0.5, false, 0)},
+	}
+	for i, samples := range frames {
+		b.addFrame(base.Add(time.Duration(i)*500*time.Millisecond), true, true, samples)
+	}
+	score := b.finish(nil)
+
+	if score.Input != "match.echoreplay" || score.Frames != 4 || score.PlayingTime != 1.5 {
+		t.Fatalf("score = %+v", score)
+	}
+	if len(score.Players) != 2 {
+		t.Fatalf("got %d players, want 2", len(score.Players))
+	}
+
+	alpha := score.Players[0]
+	if alpha.Name != "alpha" || alpha.Team != "blue" {
+		t.Fatalf("first row = %s (%s), want alpha (blue)", alpha.Name, alpha.Team)
+	}
+	if alpha.Goals != 3 || alpha.ShotsTaken != 4 || alpha.ShootingPct != 75 {
+		t.Errorf("alpha goals %d shots %d pct %v, want 3, 4, 75", alpha.Goals, alpha.ShotsTaken, alpha.ShootingPct)
+	}
+	if alpha.PossessionTime != 11.5 || alpha.TimePlayed != 1.5 || alpha.AvgSpeed != 4.5 {
+		t.Errorf("alpha possession %v time %v speed %v, want 11.5, 1.5, 4.5", alpha.PossessionTime, alpha.TimePlayed, alpha.AvgSpeed)
+	}
+
+	// Time as a spectator is not time played
+	bravo := score.Players[1]
+	if bravo.Team != "orange" || bravo.Goals != 1 || bravo.TimePlayed != 1 {
+		t.Errorf("bravo = %+v", bravo)
+	}
+
+	if len(score.Teams) != 2 || score.Teams[0].Team != "blue" || score.Teams[0].Goals != 3 || score.Teams[1].ShotsTaken != 2 {
+		t.Errorf("teams = %+v, %+v", score.Teams[0], score.Teams[1])
+	}
+}
+
+func TestBoxScoreBuilder_OnlyCountsSelectedFrames(t *testing.T) {
+	base := testFrameBase
+	b := newBoxScoreBuilder("match.tape")
+
+	// Goals scored before the selected frames are not credited
+	b.addFrame(base, false, true, []playerSample{statsSample("alpha", "blue", 2, 2, 0, false, 0)})
+	b.addFrame(base.Add(time.Second), true, true, []playerSample{statsSample("alpha", "blue", 3, 3, 0, true, 0)})
+	b.addFrame(base.Add(5*time.Second), true, false, []playerSample{statsSample("alpha", "blue", 3, 3, 0, true, 0)})
+	score := b.finish(nil)
+
+	alpha := score.Players[0]
+	if alpha.Goals != 1 || alpha.ShotsTaken != 1 {
+		t.Errorf("goals %d shots %d, want 1 and 1", alpha.Goals, alpha.ShotsTaken)
+	}
+	// The gap to the last frame is capped, and it is not playing time anyway
+	if alpha.TimePlayed != 1 || score.FramesUsed != 2 {
+		t.Errorf("time played %v, frames used %d; want 1 and 2", alpha.TimePlayed, score.FramesUsed)
+	}
+}
+
+func TestBoxScoreBuilder_PossessionFromFrames(t *testing.T) {
+	base := testFrameBase
+	b := newBoxScoreBuilder("match.tape")
+	for i, held := range []bool{false, true, true, false} {
+		sample := playerSample{Name: "alpha", Team: "blue", Possession: held}
+		b.addFrame(base.Add(time.Duration(i)*time.Second), true, true, []playerSample{sample})
+	}
+	if got := b.finish(nil).Players[0].PossessionTime; got != 2 {
+		t.Errorf("possession time = %v, want 2", got)
+	}
+}
+
+func TestBuildBoxScore_ReadsPlayerStats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "match.echoreplay")
+	base := testFrameBase
+
+	// alpha scores on the second frame; bravo holds the disc on both
+	writer, err := codec.NewEchoReplayWriter(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, goals := range []int32{1, 2} {
+		frame := &telemetry.LobbySessionStateFrame{
+			FrameIndex: uint32(i),
+			Timestamp:  timestamppb.New(base.Add(time.Duration(i) * time.Second)),
+			Session: &enginev1.SessionResponse{
+				GameStatus: "playing",
+				Teams: []*enginev1.Team{
+					{Players: []*enginev1.TeamMember{{
+						DisplayName: "alpha", SlotNumber: 0, AccountNumber: 111, Velocity: []float32{3, 4, 0},
+						Stats: &enginev1.PlayerStats{Goals: goals, ShotsTaken: 4, Saves: 1, PossessionTime: 2},
+					}}},
+					{Players: []*enginev1.TeamMember{{
+						DisplayName: "bravo", SlotNumber: 1, AccountNumber: 222, HasPossession: true,
+					}}},
+				},
+			},
+		}
+		if err := writer.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	filter, err := newEventFilter(showFilterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	score, err := buildBoxScore(path, filter)
+	if err != nil {
+		t.Fatalf("buildBoxScore() error = %v", err)
+	}
+	if len(score.Players) != 2 {
+		t.Fatalf("got %d players, want 2", len(score.Players))
+	}
+
+	alpha := score.Players[0]
+	if alpha.Name != "alpha" || alpha.AccountID != "111" || alpha.Team != "blue" {
+		t.Fatalf("first row = %+v, want alpha (111, blue)", alpha)
+	}
+	// Counters are running totals, so only the increase in view is credited
+	if alpha.Goals != 2 || alpha.ShotsTaken != 4 || alpha.Saves != 1 || alpha.ShootingPct != 50 {
+		t.Errorf("alpha goals %d shots %d saves %d pct %v, want 2, 4, 1, 50", alpha.Goals, alpha.ShotsTaken, alpha.Saves, alpha.ShootingPct)
+	}
+	if alpha.PossessionTime != 2 || alpha.AvgSpeed != 5 || alpha.TimePlayed != 1 {
+		t.Errorf("alpha possession %v speed %v time %v, want 2, 5, 1", alpha.PossessionTime, alpha.AvgSpeed, alpha.TimePlayed)
+	}
+
+	// Without a stats message, possession time comes from the frames with the disc held
+	bravo := score.Players[1]
+	if bravo.Name != "bravo" || bravo.Team != "orange" || bravo.PossessionTime != 1 {
+		t.Errorf("bravo = %+v, want 1s of possession for orange", bravo)
+	}
+}
+
+func TestWriteBoxScore(t *testing.T) {
+	base := testFrameBase
+	b := newBoxScoreBuilder("match.nevrcap")
+	b.addFrame(base, true, true, []playerSample{statsSample("alpha", "blue", 0, 0, 0, false, 0)})
+	b.addFrame(base.Add(time.Second), true, true, []playerSample{statsSample("alpha", "blue", 1, 2, 1, true, 3)})
+	score := b.finish(nil)
+
+	var text bytes.Buffer
+	if err := writeBoxScore(&text, score, "text"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Box Score for match.nevrcap", "PLAYER", "alpha", "BLUE", "50.0"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text output missing %q:\n%s", want, text.String())
+		}
+	}
+
+	var out bytes.Buffer
+	if err := writeBoxScore(&out, score, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[1][0] != "player" || records[1][1] != "alpha" || records[2][0] != "team" {
+		t.Errorf("csv records = %v", records)
+	}
+	if records[1][4] != "1" || records[1][13] != "50" {
+		t.Errorf("csv goals %q shooting %q, want 1 and 50", records[1][4], records[1][13])
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	capturepb "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+// Timeline is the `agent show ... timeline` output: a play-by-play of the
+// detected events, grouped by round.
+type Timeline struct {
+	Input  string           `json:"input"`
+	Rounds []*TimelineRound `json:"rounds"`
+	Result *MatchResult     `json:"result,omitempty"`
+}
+
+// TimelineRound holds the events of one round. Round 0 holds the events
+// before the first round started.
+type TimelineRound struct {
+	Round        int             `json:"round"`
+	Events       []TimelineEntry `json:"events"`
+	BluePoints   int             `json:"blue_points"`
+	OrangePoints int             `json:"orange_points"`
+	Winner       string          `json:"winner,omitempty"`
+}
+
+// TimelineEntry is one line of the play-by-play.
+type TimelineEntry struct {
+	FrameIndex   int              `json:"frame_index"`
+	GameClock    string           `json:"game_clock,omitempty"`
+	Event        string           `json:"event"`
+	Team         string           `json:"team,omitempty"`
+	Players      []TimelinePlayer `json:"players,omitempty"`
+	BluePoints   int              `json:"blue_points"`
+	OrangePoints int              `json:"orange_points"`
+	Details      map[string]any   `json:"details,omitempty"`
+}
+
+// TimelinePlayer is a player involved in an event, e.g. the thrower of a
+// throw or the scorer of a goal.
+type TimelinePlayer struct {
+	Role string `json:"role"`
+	Name string `json:"name"`
+	Team string `json:"team,omitempty"`
+}
+
+// MatchResult summarises the rounds won by each team.
+type MatchResult struct {
+	BlueRounds   int    `json:"blue_rounds"`
+	OrangeRounds int    `json:"orange_rounds"`
+	Winner       string `json:"winner,omitempty"`
+}
+
+// eventRoles is the role of a player referred to by a generic field such as
+// player_slot, by event type.
+var eventRoles = map[string]string{
+	"GoalScored":            "scorer",
+	"PlayerGoal":            "scorer",
+	"PlayerAssist":          "assist",
+	"PlayerSave":            "saver",
+	"PlayerStun":            "stunner",
+	"PlayerPass":            "passer",
+	"PlayerSteal":           "stealer",
+	"PlayerBlock":           "blocker",
+	"PlayerInterception":    "interceptor",
+	"PlayerShotTaken":       "shooter",
+	"DiscThrown":            "thrower",
+	"DiscCaught":            "catcher",
+	"DiscPossessionChanged": "holder",
+}
+
+// timelineBuilder collects events into a Timeline in recording order.
+type timelineBuilder struct {
+	timeline    *Timeline
+	matchWinner string
+}
+
+func newTimelineBuilder(input string) *timelineBuilder {
+	return &timelineBuilder{timeline: &Timeline{Input: filepath.Base(input)}}
+}
+
+// add appends an event seen at the given frame and round.
+func (b *timelineBuilder) add(typeName string, event proto.Message, frame *telemetry.LobbySessionStateFrame, round int) {
+	rounds := b.timeline.Rounds
+	if len(rounds) == 0 || rounds[len(rounds)-1].Round != round {
+		b.timeline.Rounds = append(rounds, &TimelineRound{Round: round})
+	}
+	current := b.timeline.Rounds[len(b.timeline.Rounds)-1]
+
+	entry := TimelineEntry{
+		FrameIndex: int(frame.GetFrameIndex()),
+		GameClock:  frame.GetSession().GetGameClockDisplay(),
+		Event:      typeName,
+	}
+	var roster []rosterPlayer
+	if session := frame.GetSession(); session != nil {
+		entry.BluePoints = int(session.GetBluePoints())
+		entry.OrangePoints = int(session.GetOrangePoints())
+		roster = sessionRoster(session)
+	}
+	if event != nil {
+		describeEvent(&entry, event, roster)
+	}
+	current.Events = append(current.Events, entry)
+	current.BluePoints, current.OrangePoints = entry.BluePoints, entry.OrangePoints
+
+	switch typeName {
+	case "RoundEnded":
+		current.Winner = entry.Team
+	case "MatchEnded":
+		b.matchWinner = entry.Team
+	}
+}
+
+// finish fills in round winners from the score where no RoundEnded event
+// named one, and the match result.
+func (b *timelineBuilder) finish() *Timeline {
+	t := b.timeline
+	if t.Rounds == nil {
+		t.Rounds = []*TimelineRound{}
+	}
+	result := &MatchResult{Winner: b.matchWinner}
+	for _, round := range t.Rounds {
+		if round.Round == 0 {
+			continue
+		}
+		if round.Winner == "" && hasEvent(round, "RoundEnded") {
+			round.Winner = leadingTeam(round.BluePoints, round.OrangePoints)
+		}
+		switch round.Winner {
+		case "blue":
+			result.BlueRounds++
+		case "orange":
+			result.OrangeRounds++
+		}
+	}
+	if result.Winner == "" && hasMatchEnded(t) {
+		result.Winner = leadingTeam(result.BlueRounds, result.OrangeRounds)
+	}
+	if result.BlueRounds > 0 || result.OrangeRounds > 0 || result.Winner != "" {
+		t.Result = result
+	}
+	return t
+}
+
+func hasEvent(round *TimelineRound, typeName string) bool {
+	return slices.ContainsFunc(round.Events, func(e TimelineEntry) bool { return e.Event == typeName })
+}
+
+func hasMatchEnded(t *Timeline) bool {
+	return slices.ContainsFunc(t.Rounds, func(r *TimelineRound) bool { return hasEvent(r, "MatchEnded") })
+}
+
+func leadingTeam(blue, orange int) string {
+	switch {
+	case blue > orange:
+		return "blue"
+	case orange > blue:
+		return "orange"
+	}
+	return ""
+}
+
+// teamName maps a team value such as "BLUE_TEAM" or "orange" to a team
+// filter name, or "" if it names neither team.
+func teamName(value string) string {
+	value = strings.ToLower(value)
+	for _, team := range teamNames {
+		if strings.Contains(value, team) {
+			return team
+		}
+	}
+	return ""
+}
+
+// describeEvent fills in the players, team and details of an entry. The
+// players and team come from newEventRefs; the other fields of the event
+// become details.
+func describeEvent(entry *TimelineEntry, event proto.Message, roster []rosterPlayer) {
+	refs := newEventRefs(event)
+	for _, ref := range refs.players {
+		player := TimelinePlayer{Role: ref.role}
+		switch p, ok := ref.find(roster); {
+		case ok:
+			player.Name, player.Team = p.name, p.team
+		case ref.name != "":
+			player.Name = ref.name
+		case ref.id != "":
+			player.Name = ref.id
+		default:
+			player.Name = fmt.Sprintf("slot %d", ref.slot)
+		}
+		if slices.Contains(entry.Players, player) {
+			continue
+		}
+		entry.Players = append(entry.Players, player)
+		if entry.Team == "" && player.Team != "spectator" {
+			entry.Team = player.Team
+		}
+	}
+	if len(refs.teams) > 0 {
+		entry.Team = refs.teams[0]
+	}
+
+	switch e := event.(type) {
+	case *telemetry.LobbySessionEvent:
+		describeV1Event(entry, e)
+	case *capturepb.EchoEvent:
+		describeCaptureEvent(entry, e)
+	}
+}
+
+// describeV1Event adds the details of a v1 event that are not player or team
+// references.
+func describeV1Event(entry *TimelineEntry, event *telemetry.LobbySessionEvent) {
+	switch p := event.Event.(type) {
+	case *telemetry.LobbySessionEvent_RoundStarted:
+		entry.addNumber("round_number", float64(p.RoundStarted.GetRoundNumber()))
+	case *telemetry.LobbySessionEvent_RoundEnded:
+		entry.addNumber("round_number", float64(p.RoundEnded.GetRoundNumber()))
+	case *telemetry.LobbySessionEvent_ScoreboardUpdated:
+		u := p.ScoreboardUpdated
+		entry.addScoreboard(u.GetBluePoints(), u.GetOrangePoints(), u.GetBlueRoundScore(), u.GetOrangeRoundScore(), u.GetGameClockDisplay())
+	case *telemetry.LobbySessionEvent_EmotePlayed:
+		entry.addNumber("emote", float64(p.EmotePlayed.GetEmote()))
+	case *telemetry.LobbySessionEvent_DiscThrown:
+		throw := p.DiscThrown.GetThrowDetails()
+		entry.addNumber("total_speed", float64(throw.GetTotalSpeed()))
+		entry.addNumber("arm_speed", float64(throw.GetArmSpeed()))
+		entry.addNumber("rot_per_sec", float64(throw.GetRotPerSec()))
+		entry.addNumber("off_axis_spin_deg", float64(throw.GetOffAxisSpinDeg()))
+	case *telemetry.LobbySessionEvent_GoalScored:
+		score := p.GoalScored.GetScoreDetails()
+		entry.addGoal(score.GetGoalType(), score.GetPointAmount(), score.GetDiscSpeed(), score.GetDistanceThrown())
+	case *telemetry.LobbySessionEvent_PlayerSave:
+		entry.addNumber("total_saves", float64(p.PlayerSave.GetTotalSaves()))
+	case *telemetry.LobbySessionEvent_PlayerStun:
+		entry.addNumber("total_stuns", float64(p.PlayerStun.GetTotalStuns()))
+	case *telemetry.LobbySessionEvent_PlayerPass:
+		entry.addNumber("total_passes", float64(p.PlayerPass.GetTotalPasses()))
+	case *telemetry.LobbySessionEvent_PlayerSteal:
+		entry.addNumber("total_steals", float64(p.PlayerSteal.GetTotalSteals()))
+	case *telemetry.LobbySessionEvent_PlayerBlock:
+		entry.addNumber("total_blocks", float64(p.PlayerBlock.GetTotalBlocks()))
+	case *telemetry.LobbySessionEvent_PlayerInterception:
+		entry.addNumber("total_interceptions", float64(p.PlayerInterception.GetTotalInterceptions()))
+	case *telemetry.LobbySessionEvent_PlayerAssist:
+		entry.addNumber("total_assists", float64(p.PlayerAssist.GetTotalAssists()))
+	case *telemetry.LobbySessionEvent_PlayerShotTaken:
+		entry.addNumber("total_shots", float64(p.PlayerShotTaken.GetTotalShots()))
+	}
+}
+
+// describeCaptureEvent adds the details of a capture event that are not
+// player or team references.
+func describeCaptureEvent(entry *TimelineEntry, event *capturepb.EchoEvent) {
+	switch p := event.Event.(type) {
+	case *capturepb.EchoEvent_RoundStarted:
+		entry.addNumber("round_number", float64(p.RoundStarted.GetRoundNumber()))
+	case *capturepb.EchoEvent_RoundEnded:
+		entry.addNumber("round_number", float64(p.RoundEnded.GetRoundNumber()))
+	case *capturepb.EchoEvent_ScoreboardUpdated:
+		u := p.ScoreboardUpdated
+		entry.addScoreboard(u.GetBluePoints(), u.GetOrangePoints(), u.GetBlueRoundScore(), u.GetOrangeRoundScore(), u.GetGameClockDisplay())
+	case *capturepb.EchoEvent_EmotePlayed:
+		entry.addNumber("emote", float64(p.EmotePlayed.GetEmote()))
+	case *capturepb.EchoEvent_GoalScored:
+		goal := p.GoalScored
+		entry.addGoal(goal.GetGoalType(), goal.GetPointAmount(), goal.GetDiscSpeed(), goal.GetDistanceThrown())
+	case *capturepb.EchoEvent_PlayerGoal:
+		entry.addNumber("total_goals", float64(p.PlayerGoal.GetTotalGoals()))
+	case *capturepb.EchoEvent_PlayerSave:
+		entry.addNumber("total_saves", float64(p.PlayerSave.GetTotalSaves()))
+	case *capturepb.EchoEvent_PlayerStun:
+		entry.addNumber("total_stuns", float64(p.PlayerStun.GetTotalStuns()))
+	case *capturepb.EchoEvent_PlayerPass:
+		entry.addNumber("total_passes", float64(p.PlayerPass.GetTotalPasses()))
+	case *capturepb.EchoEvent_PlayerSteal:
+		entry.addNumber("total_steals", float64(p.PlayerSteal.GetTotalSteals()))
+	case *capturepb.EchoEvent_PlayerBlock:
+		entry.addNumber("total_blocks", float64(p.PlayerBlock.GetTotalBlocks()))
+	case *capturepb.EchoEvent_PlayerInterception:
+		entry.addNumber("total_interceptions", float64(p.PlayerInterception.GetTotalInterceptions()))
+	case *capturepb.EchoEvent_PlayerAssist:
+		entry.addNumber("total_assists", float64(p.PlayerAssist.GetTotalAssists()))
+	case *capturepb.EchoEvent_PlayerShotTaken:
+		entry.addNumber("total_shots", float64(p.PlayerShotTaken.GetTotalShots()))
+	case *capturepb.EchoEvent_GenericEvent:
+		entry.addText("name", p.GenericEvent.GetName())
+		for key, value := range p.GenericEvent.GetFields() {
+			entry.addText(key, value)
+		}
+	}
+}
+
+func (e *TimelineEntry) addScoreboard(bluePoints, orangePoints, blueRounds, orangeRounds int32, clock string) {
+	e.addNumber("blue_points", float64(bluePoints))
+	e.addNumber("orange_points", float64(orangePoints))
+	e.addNumber("blue_round_score", float64(blueRounds))
+	e.addNumber("orange_round_score", float64(orangeRounds))
+	e.addText("game_clock_display", clock)
+}
+
+func (e *TimelineEntry) addGoal(goalType string, points int32, discSpeed, distance float32) {
+	e.addText("goal_type", goalType)
+	e.addNumber("point_amount", float64(points))
+	e.addNumber("disc_speed", float64(discSpeed))
+	e.addNumber("distance_thrown", float64(distance))
+}
+
+// addNumber records a detail rounded to two decimals. Zero values are
+// skipped, like unset fields.
+func (e *TimelineEntry) addNumber(name string, value float64) {
+	if value != 0 {
+		e.setDetail(name, round2(value))
+	}
+}
+
+// addText records a text detail unless it is empty.
+func (e *TimelineEntry) addText(name, value string) {
+	if value != "" {
+		e.setDetail(name, value)
+	}
+}
+
+func (e *TimelineEntry) setDetail(name string, value any) {
+	if e.Details == nil {
+		e.Details = make(map[string]any)
+	}
+	e.Details[name] = value
+}
+
+// writeTimeline writes a timeline as a printable play-by-play or as JSON.
+func writeTimeline(w io.Writer, t *Timeline, format string) error {
+	if format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(t)
+	}
+
+	fmt.Fprintf(w, "=== Timeline for %s ===\n", t.Input)
+	for _, round := range t.Rounds {
+		if round.Round == 0 {
+			fmt.Fprintln(w, "\nBefore round 1")
+		} else {
+			fmt.Fprintf(w, "\nRound %d\n", round.Round)
+		}
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, e := range round.Events {
+			clock := e.GameClock
+			if clock == "" {
+				clock = "frame " + strconv.Itoa(e.FrameIndex)
+			}
+			fmt.Fprintf(tw, "  %s\t%d-%d\t%s\t%s\t%s\n", clock, e.BluePoints, e.OrangePoints,
+				strings.ToUpper(e.Team), e.Event, describeEntry(e))
+		}
+		tw.Flush()
+
+		if round.Round != 0 {
+			fmt.Fprintf(w, "  Round %d result: Blue %d - %d Orange%s\n", round.Round, round.BluePoints, round.OrangePoints, winnerSuffix(round.Winner))
+		}
+	}
+
+	if t.Result != nil {
+		fmt.Fprintf(w, "\nMatch result: Blue %d - %d Orange in rounds%s\n", t.Result.BlueRounds, t.Result.OrangeRounds, winnerSuffix(t.Result.Winner))
+	}
+	return nil
+}
+
+func winnerSuffix(winner string) string {
+	if winner == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (winner: %s)", winner)
+}
+
+// describeEntry formats the players and details of an entry, e.g.
+// "thrower alpha (blue), speed=12.5".
+func describeEntry(e TimelineEntry) string {
+	var parts []string
+	for _, p := range e.Players {
+		part := p.Role + " " + p.Name
+		if p.Team != "" && p.Team != e.Team {
+			part += " (" + p.Team + ")"
+		}
+		parts = append(parts, part)
+	}
+	for _, key := range slices.Sorted(maps.Keys(e.Details)) {
+		parts = append(parts, fmt.Sprintf("%s=%v", key, e.Details[key]))
+	}
+	return strings.Join(parts, ", ")
+}
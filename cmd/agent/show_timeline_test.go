@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	enginev1 "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/engine/v1"
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	capturepb "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestTimelineBuilder_DescribesEvents(t *testing.T) {
+	tests := []struct {
+		name    string
+		typ     string
+		event   proto.Message
+		team    string
+		players []TimelinePlayer
+		details map[string]any
+	}{
+		{"v1 throw", "DiscThrown", &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_DiscThrown{
+			DiscThrown: &telemetry.DiscThrown{PlayerSlot: 0, ThrowDetails: &enginev1.LastThrow{TotalSpeed: 12.5}},
+		}}, "blue", []TimelinePlayer{{Role: "thrower", Name: "alpha", Team: "blue"}}, map[string]any{"total_speed": 12.5}},
+		{"v1 goal", "GoalScored", &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_GoalScored{
+			GoalScored: &telemetry.GoalScored{ScoreDetails: &enginev1.LastScore{Team: "orange", PersonScored: "bravo", PointAmount: 2, DiscSpeed: 15.25}},
+		}}, "orange", []TimelinePlayer{{Role: "scorer", Name: "bravo", Team: "orange"}}, map[string]any{"point_amount": 2.0, "disc_speed": 15.25}},
+		{"tape throw", "DiscThrown", &capturepb.EchoEvent{Event: &capturepb.EchoEvent_DiscThrown{DiscThrown: &capturepb.DiscThrown{PlayerSlot: 1}}},
+			"orange", []TimelinePlayer{{Role: "thrower", Name: "bravo", Team: "orange"}}, nil},
+		{"tape goal", "GoalScored", &capturepb.EchoEvent{Event: &capturepb.EchoEvent_GoalScored{
+			GoalScored: &capturepb.GoalScored{ScorerSlot: 0, AssistSlot: 1, Team: capturepb.Role_ROLE_BLUE_TEAM, PointAmount: 3, GoalType: "INSIDE SHOT"},
+		}}, "blue", []TimelinePlayer{{Role: "scorer", Name: "alpha", Team: "blue"}, {Role: "assist", Name: "bravo", Team: "orange"}},
+			map[string]any{"point_amount": 3.0, "goal_type": "INSIDE SHOT"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := rosterTestFrame()
+			frame.Session.BluePoints = 2
+			b := newTimelineBuilder("match.tape")
+			b.add(tt.typ, tt.event, frame, 1)
+
+			entry := b.timeline.Rounds[0].Events[0]
+			if entry.Team != tt.team || entry.BluePoints != 2 {
+				t.Errorf("team %q, blue points %d; want %q, 2", entry.Team, entry.BluePoints, tt.team)
+			}
+			if !slices.Equal(entry.Players, tt.players) {
+				t.Errorf("players = %+v, want %+v", entry.Players, tt.players)
+			}
+			if !maps.Equal(entry.Details, tt.details) {
+				t.Errorf("details = %v, want %v", entry.Details, tt.details)
+			}
+		})
+	}
+}
+
+func TestTimelineBuilder_Finish(t *testing.T) {
+	b := newTimelineBuilder("dir/match.tape")
+	b.timeline.Rounds = []*TimelineRound{
+		{Round: 0, Events: []TimelineEntry{{Event: "PlayerJoined"}}},
+		{Round: 1, BluePoints: 2, OrangePoints: 1, Events: []TimelineEntry{{Event: "GoalScored"}, {Event: "RoundEnded"}}},
+		{Round: 2, BluePoints: 0, OrangePoints: 3, Winner: "orange", Events: []TimelineEntry{{Event: "RoundEnded"}}},
+		{Round: 3, BluePoints: 4, OrangePoints: 0, Events: []TimelineEntry{{Event: "RoundEnded"}, {Event: "MatchEnded"}}},
+	}
+
+	timeline := b.finish()
+	if timeline.Input != "match.tape" {
+		t.Errorf("input = %q", timeline.Input)
+	}
+	if got := timeline.Rounds[1].Winner; got != "blue" {
+		t.Errorf("round 1 winner from the score = %q, want blue", got)
+	}
+	if r := timeline.Result; r == nil || r.BlueRounds != 2 || r.OrangeRounds != 1 || r.Winner != "blue" {
+		t.Errorf("result = %+v", r)
+	}
+}
+
+func TestTimelineBuilder_UnfinishedRoundHasNoWinner(t *testing.T) {
+	b := newTimelineBuilder("clip.echoreplay")
+	b.timeline.Rounds = []*TimelineRound{{Round: 1, BluePoints: 1, Events: []TimelineEntry{{Event: "GoalScored"}}}}
+
+	timeline := b.finish()
+	if timeline.Rounds[0].Winner != "" || timeline.Result != nil {
+		t.Errorf("round winner %q, result %+v; want none for an unfinished round", timeline.Rounds[0].Winner, timeline.Result)
+	}
+}
+
+func TestWriteTimeline_Text(t *testing.T) {
+	timeline := &Timeline{
+		Input: "match.echoreplay",
+		Rounds: []*TimelineRound{{
+			Round:        1,
+			BluePoints:   1,
+			OrangePoints: 0,
+			Winner:       "blue",
+			Events: []TimelineEntry{{
+				FrameIndex: 420,
+				GameClock:  "04:12.50",
+				Event:      "DiscThrown",
+				Team:       "blue",
+				Players:    []TimelinePlayer{{Role: "thrower", Name: "alpha", Team: "blue"}},
+				Details:    map[string]any{"speed": 12.5},
+			}, {
+				FrameIndex:   510,
+				Event:        "PlayerStun",
+				Team:         "orange",
+				BluePoints:   1,
+				OrangePoints: 0,
+				Players:      []TimelinePlayer{{Role: "stunner", Name: "bravo", Team: "orange"}, {Role: "stunned", Name: "alpha", Team: "blue"}},
+			}},
+		}},
+		Result: &MatchResult{BlueRounds: 1, Winner: "blue"},
+	}
+
+	var out bytes.Buffer
+	if err := writeTimeline(&out, timeline, "text"); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"Round 1\n",
+		"04:12.50", "thrower alpha, speed=12.5",
+		"frame 510", "stunner bravo, stunned alpha (blue)",
+		"Round 1 result: Blue 1 - 0 Orange (winner: blue)",
+		"Match result: Blue 1 - 0 Orange in rounds (winner: blue)",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("timeline missing %q:\n%s", want, out.String())
+		}
+	}
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap"
+)
+
+var (
+	sliceOutputFile  string
+	sliceFrom        time.Duration
+	sliceTo          time.Duration
+	sliceFrames      string
+	sliceRound       int
+	sliceClock       string
+	sliceAroundGoals time.Duration
+	sliceOverwrite   bool
+)
+
+func newSliceCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "slice <input-file>",
+		Short: "Extract part of a recording into a new file",
+		Long: `The slice command copies a sub-range of a recording into a new file.
+Input and output may be any of .echoreplay, .nevrcap or .tape; the output
+format is taken from the output file extension.
+
+Selectors can be combined and a frame is kept only if it matches all of them:
+  --from/--to       Offset from the first frame of the recording (e.g. 5m, 90s)
+  --frames          Zero-based frame range, inclusive (e.g. 1200:4800, 1200:, :4800)
+  --round           Round number, counted from 1 by round starts in the recording
+  --clock           Game clock window, e.g. 5:00-2:30 (the clock counts down)
+  --around-goals    Keep this much time before and after every goal, found by
+                    the GoalScored events stored in the recording
+
+Frame indices in the output start at 0. Frame timestamps are kept, and the
+header creation time and .tape base time are set to the first frame kept.
+Events are kept with their frames; .tape events are written unchanged to
+.tape output.`,
+		Example: `  # Keep the second round of a match as a tape
+  agent slice scrim.echoreplay --round 2 -o round2.tape
+
+  # Keep minutes 5 to 12 of a recording
+  agent slice scrim.nevrcap --from 5m --to 12m -o clip.nevrcap
+
+  # Keep 10 seconds either side of every goal
+  agent slice scrim.tape --around-goals 10s -o goals.echoreplay
+
+  # Keep the last two minutes of game clock in round 1
+  agent slice scrim.echoreplay --round 1 --clock 2:00-0:00 -o ending.echoreplay`,
+		Args: cobra.ExactArgs(1),
+		RunE: runSlice,
+	}
+
+	cmd.Flags().StringVarP(&sliceOutputFile, "output", "o", "", "Output file path; the format is taken from the extension (required)")
+	cmd.Flags().DurationVar(&sliceFrom, "from", 0, "Start offset from the first frame")
+	cmd.Flags().DurationVar(&sliceTo, "to", 0, "End offset from the first frame (0 = end of recording)")
+	cmd.Flags().StringVar(&sliceFrames, "frames", "", "Frame range START:END, zero-based and inclusive")
+	cmd.Flags().IntVar(&sliceRound, "round", 0, "Round number to keep (1-based)")
+	cmd.Flags().StringVar(&sliceClock, "clock", "", "Game clock window START-END, e.g. 5:00-2:30")
+	cmd.Flags().DurationVar(&sliceAroundGoals, "around-goals", 0, "Keep this much time before and after each goal")
+	cmd.Flags().BoolVar(&sliceOverwrite, "overwrite", false, "Overwrite the output file if it exists")
+
+	cmd.MarkFlagRequired("output")
+
+	return cmd
+}
+
+// sliceSpec selects the frames kept by a slice. Unset selectors keep every
+// frame; LastFrame must be -1 for an open-ended frame range.
+type sliceSpec struct {
+	From, To    time.Duration
+	FirstFrame  int
+	LastFrame   int // -1 = end of recording
+	Round       int
+	ClockHigh   float64
+	ClockLow    float64
+	HasClock    bool
+	AroundGoals time.Duration
+}
+
+// IsEmpty reports whether no selector is set.
+func (s sliceSpec) IsEmpty() bool {
+	return s.From == 0 && s.To == 0 && s.FirstFrame == 0 && s.LastFrame < 0 &&
+		s.Round == 0 && !s.HasClock && s.AroundGoals == 0
+}
+
+// String describes the selection; it is stored in the output header metadata.
+func (s sliceSpec) String() string {
+	var parts []string
+	if s.From != 0 || s.To != 0 {
+		to := "end"
+		if s.To != 0 {
+			to = s.To.String()
+		}
+		parts = append(parts, fmt.Sprintf("time=%s-%s", s.From, to))
+	}
+	if s.FirstFrame != 0 || s.LastFrame >= 0 {
+		last := ""
+		if s.LastFrame >= 0 {
+			last = strconv.Itoa(s.LastFrame)
+		}
+		parts = append(parts, fmt.Sprintf("frames=%d:%s", s.FirstFrame, last))
+	}
+	if s.Round != 0 {
+		parts = append(parts, fmt.Sprintf("round=%d", s.Round))
+	}
+	if s.HasClock {
+		parts = append(parts, fmt.Sprintf("clock=%s-%s", formatGameClock(s.ClockHigh), formatGameClock(s.ClockLow)))
+	}
+	if s.AroundGoals != 0 {
+		parts = append(parts, fmt.Sprintf("around_goals=%s", s.AroundGoals))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (s sliceSpec) Validate() error {
+	if s.From < 0 || s.To < 0 || s.AroundGoals < 0 {
+		return fmt.Errorf("time offsets must not be negative")
+	}
+	if s.To != 0 && s.To <= s.From {
+		return fmt.Errorf("--to (%s) must be after --from (%s)", s.To, s.From)
+	}
+	if s.FirstFrame < 0 || (s.LastFrame >= 0 && s.LastFrame < s.FirstFrame) {
+		return fmt.Errorf("invalid frame range %d:%d", s.FirstFrame, s.LastFrame)
+	}
+	if s.Round < 0 {
+		return fmt.Errorf("round must be positive, got %d", s.Round)
+	}
+	return nil
+}
+
+// parseFrameRange parses START:END where either side may be empty.
+func parseFrameRange(s string) (first, last int, err error) {
+	last = -1
+	if s == "" {
+		return 0, -1, nil
+	}
+	start, end, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid frame range %q: expected START:END", s)
+	}
+	if start != "" {
+		if first, err = strconv.Atoi(start); err != nil {
+			return 0, 0, fmt.Errorf("invalid frame range start %q: %w", start, err)
+		}
+	}
+	if end != "" {
+		if last, err = strconv.Atoi(end); err != nil {
+			return 0, 0, fmt.Errorf("invalid frame range end %q: %w", end, err)
+		}
+	}
+	return first, last, nil
+}
+
+// parseGameClock parses a game clock value such as "04:32.15", "5:00" or "90"
+// into seconds.
+func parseGameClock(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty game clock")
+	}
+	var seconds float64
+	for _, part := range strings.Split(s, ":") {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid game clock %q", s)
+		}
+		seconds = seconds*60 + v
+	}
+	return seconds, nil
+}
+
+// parseClockWindow parses START-END into the high and low clock bounds.
+func parseClockWindow(s string) (high, low float64, err error) {
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid clock window %q: expected START-END", s)
+	}
+	if high, err = parseGameClock(start); err != nil {
+		return 0, 0, err
+	}
+	if low, err = parseGameClock(end); err != nil {
+		return 0, 0, err
+	}
+	if high < low {
+		high, low = low, high
+	}
+	return high, low, nil
+}
+
+func formatGameClock(seconds float64) string {
+	return fmt.Sprintf("%d:%05.2f", int(seconds)/60, seconds-float64(int(seconds)/60*60))
+}
+
+// roundStatuses are the game statuses that belong to a round.
+var roundStatuses = map[string]bool{
+	"round_start":       true,
+	"playing":           true,
+	"score":             true,
+	"round_over":        true,
+	"pre_sudden_death":  true,
+	"sudden_death":      true,
+	"post_sudden_death": true,
+}
+
+// frameSlicer applies a sliceSpec to frames in recording order and passes the
+// selected frames, renumbered from 0, to emit. Goals are found by the
+// GoalScored events stored with the frames.
+type frameSlicer struct {
+	spec sliceSpec
+	emit func(*eventFrame) error
+
+	position int
+	start    time.Time
+	rounds   roundTracker
+	outIndex uint32
+
+	// Look-behind buffer of matching frames for --around-goals
+	pending   []*eventFrame
+	emitUntil time.Time
+	goals     int
+}
+
+func newFrameSlicer(spec sliceSpec, emit func(*eventFrame) error) *frameSlicer {
+	return &frameSlicer{spec: spec, emit: emit}
+}
+
+// Push feeds the next frame of the recording to the slicer.
+func (s *frameSlicer) Push(read *eventFrame) error {
+	frame := read.Frame
+	position := s.position
+	s.position++
+
+	ts := frame.GetTimestamp().AsTime()
+	if position == 0 {
+		s.start = ts
+	}
+
+	s.rounds.track(frame.GetSession().GetGameStatus())
+
+	if !s.matches(position, ts, frame) {
+		return nil
+	}
+	if s.spec.AroundGoals == 0 {
+		return s.write(read)
+	}
+
+	window := s.spec.AroundGoals
+	if slices.Contains(read.Types, "GoalScored") {
+		s.goals++
+		for _, f := range s.pending {
+			if !f.Frame.GetTimestamp().AsTime().Before(ts.Add(-window)) {
+				if err := s.write(f); err != nil {
+					return err
+				}
+			}
+		}
+		s.pending = s.pending[:0]
+		s.emitUntil = ts.Add(window)
+	}
+
+	if !s.emitUntil.IsZero() && !ts.After(s.emitUntil) {
+		return s.write(read)
+	}
+
+	s.pending = append(s.pending, read)
+	drop := 0
+	for drop < len(s.pending) && s.pending[drop].Frame.GetTimestamp().AsTime().Before(ts.Add(-window)) {
+		drop++
+	}
+	s.pending = s.pending[drop:]
+	return nil
+}
+
+// roundTracker numbers rounds from the game status of consecutive frames.
+type roundTracker struct {
+	round      int
+	lastStatus string
+}
+
+// track counts round starts. A recording that begins mid-round starts in round 1.
+func (s *roundTracker) track(status string) {
+	switch {
+	case status == "round_start" || status == "pre_sudden_death":
+		if s.lastStatus != status {
+			s.round++
+		}
+	case status == "playing" && s.lastStatus == "round_over":
+		// The round_start frames were not captured
+		s.round++
+	case roundStatuses[status] && s.round == 0:
+		s.round = 1
+	}
+	s.lastStatus = status
+}
+
+func (s *frameSlicer) matches(position int, ts time.Time, frame *telemetry.LobbySessionStateFrame) bool {
+	spec := s.spec
+
+	if position < spec.FirstFrame || (spec.LastFrame >= 0 && position > spec.LastFrame) {
+		return false
+	}
+
+	offset := ts.Sub(s.start)
+	if offset < spec.From || (spec.To != 0 && offset > spec.To) {
+		return false
+	}
+
+	if spec.Round != 0 && (s.rounds.round != spec.Round || !roundStatuses[frame.GetSession().GetGameStatus()]) {
+		return false
+	}
+
+	if spec.HasClock {
+		clock, err := parseGameClock(frame.GetSession().GetGameClockDisplay())
+		if err != nil || clock > spec.ClockHigh || clock < spec.ClockLow {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (s *frameSlicer) write(read *eventFrame) error {
+	read.Frame.FrameIndex = s.outIndex
+	s.outIndex++
+	return s.emit(read)
+}
+
+func runSlice(cmd *cobra.Command, args []string) error {
+	inputFile := args[0]
+
+	first, last, err := parseFrameRange(sliceFrames)
+	if err != nil {
+		return err
+	}
+	spec := sliceSpec{
+		From:        sliceFrom,
+		To:          sliceTo,
+		FirstFrame:  first,
+		LastFrame:   last,
+		Round:       sliceRound,
+		AroundGoals: sliceAroundGoals,
+	}
+	if sliceClock != "" {
+		if spec.ClockHigh, spec.ClockLow, err = parseClockWindow(sliceClock); err != nil {
+			return err
+		}
+		spec.HasClock = true
+	}
+	if err := spec.Validate(); err != nil {
+		return err
+	}
+	if spec.IsEmpty() {
+		return fmt.Errorf("no selection given: use --from/--to, --frames, --round, --clock or --around-goals")
+	}
+
+	if _, err := os.Stat(inputFile); err != nil {
+		return fmt.Errorf("cannot access input file: %w", err)
+	}
+	outputFormat := getFileFormat(sliceOutputFile)
+	if outputFormat == "unknown" {
+		return fmt.Errorf("output file must have a .echoreplay, .nevrcap or .tape extension: %s", sliceOutputFile)
+	}
+	if filepath.Clean(inputFile) == filepath.Clean(sliceOutputFile) {
+		return fmt.Errorf("output file must differ from the input file")
+	}
+	if _, err := os.Stat(sliceOutputFile); err == nil && !sliceOverwrite {
+		return fmt.Errorf("output file already exists (use --overwrite to replace it): %s", sliceOutputFile)
+	}
+
+	stats, err := sliceFile(inputFile, sliceOutputFile, outputFormat, spec)
+	if err != nil {
+		return err
+	}
+
+	logger.Info("Slice written",
+		zap.String("output", sliceOutputFile),
+		zap.String("selection", spec.String()),
+		zap.Int("frames_read", stats.FramesRead),
+		zap.Int("frames_written", stats.FramesWritten),
+		zap.Duration("duration", stats.End.Sub(stats.Start)))
+	return nil
+}
+
+// SliceStats summarizes a slice operation.
+type SliceStats struct {
+	FramesRead    int
+	FramesWritten int
+	Goals         int
+	Start, End    time.Time
+}
+
+// sliceFile copies the frames of inputFile selected by spec to outputFile.
+// Events are kept with their frames. A .tape input sliced to .tape output
+// keeps its frames as stored, rebased to the first frame written.
+func sliceFile(inputFile, outputFile, outputFormat string, spec sliceSpec) (*SliceStats, error) {
+	var report *LossReport
+	if detectInputFormat(inputFile) == "tape" && outputFormat != "tape" {
+		report = newLossReport(inputFile, outputFile)
+	}
+
+	source, err := openEventFrameSource(inputFile, report)
+	if err != nil {
+		return nil, err
+	}
+	defer source.Close()
+
+	header := source.Header()
+	if header == nil {
+		header = &telemetry.TelemetryHeader{}
+	}
+	if header.Metadata == nil {
+		header.Metadata = make(map[string]string)
+	}
+	header.Metadata["sliced_from"] = filepath.Base(inputFile)
+	header.Metadata["slice"] = spec.String()
+
+	sink, err := newV1FrameSink(outputFile, outputFormat, header)
+	if err != nil {
+		return nil, err
+	}
+	sink.UseTapeHeader(source.TapeHeader())
+
+	stats := &SliceStats{}
+	slicer := newFrameSlicer(spec, func(read *eventFrame) error {
+		ts := read.Frame.GetTimestamp().AsTime()
+		if stats.FramesWritten == 0 {
+			stats.Start = ts
+		}
+		stats.End = ts
+		stats.FramesWritten++
+		return sink.WriteEventFrame(read)
+	})
+
+	for {
+		read, err := source.ReadFrame()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			sink.Abort()
+			return nil, fmt.Errorf("failed to read frame %d: %w", stats.FramesRead, err)
+		}
+		stats.FramesRead++
+
+		if err := slicer.Push(read); err != nil {
+			sink.Abort()
+			return nil, err
+		}
+	}
+	stats.Goals = slicer.goals
+
+	if err := sink.Close(); err != nil {
+		return nil, err
+	}
+	if stats.FramesWritten == 0 {
+		return nil, fmt.Errorf("no frames matched the selection (%s) in %d frames", spec, stats.FramesRead)
+	}
+	if report != nil {
+		saveLossReport(report, outputFile)
+	}
+
+	return stats, nil
+}
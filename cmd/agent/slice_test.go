@@ -0,0 +1,354 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	enginev1 "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/engine/v1"
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	capturepb "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v2"
+	"github.com/echotools/tape/pkg/codec"
+	"github.com/echotools/tape/pkg/conversion"
+	"google.golang.org/protobuf/proto"
+)
+
+// testMatchFrames builds a one-frame-per-second match with two rounds and a
+// goal in each, stored as a GoalScored event on the first score frame:
+//
+//	0-1 pre_match, 2 round_start, 3-6 playing, 7 score, 8-9 playing, 10 round_over,
+//	11 round_start, 12-14 playing, 15 score, 16 round_over, 17 post_match
+func testMatchFrames() []*telemetry.LobbySessionStateFrame {
+	statuses := []string{
+		"pre_match", "pre_match", "round_start", "playing", "playing", "playing", "playing", "score",
+		"playing", "playing", "round_over", "round_start", "playing", "playing", "playing", "score",
+		"round_over", "post_match",
+	}
+	frames := testV1Frames(len(statuses), withInterval(time.Second), withStatuses(statuses...),
+		withGameClock(func(i int) string { return formatGameClock(float64(300 - i*10)) }))
+	for i, status := range statuses {
+		if status == "score" {
+			frames[i].Events = []*telemetry.LobbySessionEvent{{Event: &telemetry.LobbySessionEvent_GoalScored{
+				GoalScored: &telemetry.GoalScored{ScoreDetails: &enginev1.LastScore{Team: "blue", PointAmount: 2}},
+			}}}
+		}
+	}
+	return frames
+}
+
+// testEventFrame moves the events of a v1 frame out of it, as eventFrameSource does.
+func testEventFrame(frame *telemetry.LobbySessionStateFrame) *eventFrame {
+	read := &eventFrame{Frame: frame, V1Events: frame.Events}
+	for _, event := range frame.Events {
+		read.Events = append(read.Events, event)
+		read.Types = append(read.Types, getEventTypeName(event))
+	}
+	frame.Events = nil
+	return read
+}
+
+// sliceTestFrames runs frames through a slicer and returns the original
+// positions of the frames it kept.
+func sliceTestFrames(t *testing.T, spec sliceSpec) []int {
+	t.Helper()
+	frames := testMatchFrames()
+	base := frames[0].GetTimestamp().AsTime()
+
+	var kept []int
+	slicer := newFrameSlicer(spec, func(read *eventFrame) error {
+		if int(read.Frame.GetFrameIndex()) != len(kept) {
+			t.Errorf("output frame index = %d, want %d", read.Frame.GetFrameIndex(), len(kept))
+		}
+		kept = append(kept, int(read.Frame.GetTimestamp().AsTime().Sub(base)/time.Second))
+		return nil
+	})
+	for _, frame := range frames {
+		if err := slicer.Push(testEventFrame(frame)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return kept
+}
+
+func TestFrameSlicer(t *testing.T) {
+	tests := []struct {
+		name string
+		spec sliceSpec
+		want []int
+	}{
+		{"time window", sliceSpec{From: 3 * time.Second, To: 5 * time.Second, LastFrame: -1}, []int{3, 4, 5}},
+		{"open time window", sliceSpec{From: 15 * time.Second, LastFrame: -1}, []int{15, 16, 17}},
+		{"frame range", sliceSpec{FirstFrame: 8, LastFrame: 10}, []int{8, 9, 10}},
+		{"round 1", sliceSpec{Round: 1, LastFrame: -1}, []int{2, 3, 4, 5, 6, 7, 8, 9, 10}},
+		{"round 2", sliceSpec{Round: 2, LastFrame: -1}, []int{11, 12, 13, 14, 15, 16}},
+		{"round and frames", sliceSpec{Round: 2, FirstFrame: 14, LastFrame: -1}, []int{14, 15, 16}},
+		{"clock window", sliceSpec{HasClock: true, ClockHigh: 250, ClockLow: 230, LastFrame: -1}, []int{5, 6, 7}},
+		{"around goals", sliceSpec{AroundGoals: 1 * time.Second, LastFrame: -1}, []int{6, 7, 8, 14, 15, 16}},
+		{"around goals in round 2", sliceSpec{Round: 2, AroundGoals: 2 * time.Second, LastFrame: -1}, []int{13, 14, 15, 16}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sliceTestFrames(t, tt.spec); !slices.Equal(got, tt.want) {
+				t.Errorf("kept frames %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrameSlicer_RecordingStartsMidRound(t *testing.T) {
+	frames := testMatchFrames()[4:]
+
+	var kept int
+	slicer := newFrameSlicer(sliceSpec{Round: 1, LastFrame: -1}, func(*eventFrame) error {
+		kept++
+		return nil
+	})
+	for _, frame := range frames {
+		slicer.Push(testEventFrame(frame))
+	}
+	// Frames 4-10 of the match belong to the first round in the recording
+	if kept != 7 {
+		t.Errorf("kept %d frames, want 7", kept)
+	}
+}
+
+func TestFrameSlicer_GoalsFromEvents(t *testing.T) {
+	frames := testMatchFrames()
+	base := frames[0].GetTimestamp().AsTime()
+	frames[7].Events = nil // a score status alone is not a goal
+
+	var kept []int
+	slicer := newFrameSlicer(sliceSpec{AroundGoals: time.Second, LastFrame: -1}, func(read *eventFrame) error {
+		kept = append(kept, int(read.Frame.GetTimestamp().AsTime().Sub(base)/time.Second))
+		return nil
+	})
+	for _, frame := range frames {
+		if err := slicer.Push(testEventFrame(frame)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !slices.Equal(kept, []int{14, 15, 16}) || slicer.goals != 1 {
+		t.Errorf("kept frames %v around %d goals, want [14 15 16] around 1", kept, slicer.goals)
+	}
+}
+
+func TestParseFrameRange(t *testing.T) {
+	tests := []struct {
+		in          string
+		first, last int
+		wantErr     bool
+	}{
+		{"", 0, -1, false},
+		{"100:500", 100, 500, false},
+		{"100:", 100, -1, false},
+		{":500", 0, 500, false},
+		{"100", 0, 0, true},
+		{"a:b", 0, 0, true},
+	}
+	for _, tt := range tests {
+		first, last, err := parseFrameRange(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseFrameRange(%q) error = %v", tt.in, err)
+			continue
+		}
+		if !tt.wantErr && (first != tt.first || last != tt.last) {
+			t.Errorf("parseFrameRange(%q) = %d, %d, want %d, %d", tt.in, first, last, tt.first, tt.last)
+		}
+	}
+}
+
+func TestParseGameClock(t *testing.T) {
+	tests := map[string]float64{
+		"04:32.15": 272.15,
+		"5:00":     300,
+		"90":       90,
+		"00:00.00": 0,
+	}
+	for in, want := range tests {
+		got, err := parseGameClock(in)
+		if err != nil || got != want {
+			t.Errorf("parseGameClock(%q) = %v, %v, want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "ab:cd", "-1"} {
+		if _, err := parseGameClock(in); err == nil {
+			t.Errorf("parseGameClock(%q) expected error", in)
+		}
+	}
+
+	high, low, err := parseClockWindow("2:30-5:00")
+	if err != nil || high != 300 || low != 150 {
+		t.Errorf("parseClockWindow() = %v, %v, %v", high, low, err)
+	}
+}
+
+func TestSliceFile_RoundToNevrcap(t *testing.T) {
+	useTestConfig(t)
+	dir := t.TempDir()
+	input := filepath.Join(dir, "match.echoreplay")
+	output := filepath.Join(dir, "round2.nevrcap")
+
+	writer, err := codec.NewEchoReplayWriter(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, frame := range testMatchFrames() {
+		if err := writer.WriteFrame(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := sliceFile(input, output, "nevrcap", sliceSpec{Round: 2, LastFrame: -1})
+	if err != nil {
+		t.Fatalf("sliceFile() error = %v", err)
+	}
+	if stats.FramesRead != 18 || stats.FramesWritten != 6 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	reader, err := codec.NewLegacyReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	header, err := reader.ReadHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !header.GetCreatedAt().AsTime().Equal(stats.Start) {
+		t.Errorf("header created at %v, want first kept frame %v", header.GetCreatedAt().AsTime(), stats.Start)
+	}
+	if header.GetMetadata()["slice"] != "round=2" {
+		t.Errorf("slice metadata = %q", header.GetMetadata()["slice"])
+	}
+
+	for i := 0; ; i++ {
+		frame, err := reader.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			if i != 6 {
+				t.Errorf("read %d frames, want 6", i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.GetFrameIndex() != uint32(i) {
+			t.Errorf("frame %d has index %d", i, frame.GetFrameIndex())
+		}
+	}
+}
+
+func TestSliceFile_NoMatch(t *testing.T) {
+	useTestConfig(t)
+	dir := t.TempDir()
+	input := filepath.Join(dir, "match.echoreplay")
+
+	writer, err := codec.NewEchoReplayWriter(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, frame := range testMatchFrames() {
+		writer.WriteFrame(frame)
+	}
+	writer.Close()
+
+	if _, err := sliceFile(input, filepath.Join(dir, "out.tape"), "tape", sliceSpec{Round: 5, LastFrame: -1}); err == nil {
+		t.Error("expected an error when no frames match")
+	}
+}
+
+func TestSliceFile_TapeKeepsNativeFrames(t *testing.T) {
+	useTestConfig(t)
+	dir := t.TempDir()
+	input := filepath.Join(dir, "match.tape")
+	output := filepath.Join(dir, "goal.tape")
+
+	// Events and players without a v1 form must survive a tape → tape slice
+	frames := testMatchFrames()
+	header := conversion.MapHeaderFromSession(&telemetry.TelemetryHeader{CreatedAt: frames[0].GetTimestamp()}, frames[0].GetSession())
+	header.GetEchoArena().ClientName = "recorder"
+	writer, err := codec.NewWriter(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteHeader(header); err != nil {
+		t.Fatal(err)
+	}
+	mapper := conversion.FrameMapper{BaseTime: frames[0].GetTimestamp().AsTime()}
+	var natives []*capturepb.CaptureFrame
+	for _, frame := range frames {
+		native := mapper.MapFrame(frame)
+		if frame.GetFrameIndex() == 7 {
+			arena := native.GetEchoArena()
+			arena.Events = []*capturepb.EchoEvent{
+				{Event: &capturepb.EchoEvent_GoalScored{GoalScored: &capturepb.GoalScored{ScorerSlot: 2, AssistSlot: -1, Team: capturepb.Role_ROLE_BLUE_TEAM, PointAmount: 2}}},
+				{Event: &capturepb.EchoEvent_PlayerGoal{PlayerGoal: &capturepb.PlayerGoal{PlayerSlot: 2, TotalGoals: 1}}},
+				{Event: &capturepb.EchoEvent_GenericEvent{GenericEvent: &capturepb.GenericEvent{Name: "custom", Fields: map[string]string{"k": "v"}}}},
+			}
+			// A player without a team role has no place in a v1 frame
+			arena.Players = append(arena.Players, &capturepb.PlayerState{Slot: 9, DisplayName: "observer"})
+		}
+		natives = append(natives, native)
+		if err := writer.WriteFrame(native); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := sliceFile(input, output, "tape", sliceSpec{AroundGoals: time.Second, LastFrame: -1})
+	if err != nil {
+		t.Fatalf("sliceFile() error = %v", err)
+	}
+	if stats.Goals != 2 || stats.FramesWritten != 6 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if _, err := os.Stat(output + ".loss.json"); !os.IsNotExist(err) {
+		t.Errorf("tape → tape slice wrote a loss report: %v", err)
+	}
+
+	reader, err := codec.NewReader(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	gotHeader, err := reader.ReadHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gotHeader.GetCreatedAt().AsTime().Equal(frames[6].GetTimestamp().AsTime()) {
+		t.Errorf("header created_at = %v, want the first sliced frame %v", gotHeader.GetCreatedAt().AsTime(), frames[6].GetTimestamp().AsTime())
+	}
+	if got := gotHeader.GetEchoArena().GetClientName(); got != "recorder" {
+		t.Errorf("header client name = %q, want recorder", got)
+	}
+	if md := gotHeader.GetMetadata(); md["sliced_from"] != "match.tape" || md["converted_from"] != "" {
+		t.Errorf("header metadata = %v", md)
+	}
+
+	// Output frames are input frames 6 and 7, renumbered and rebased to the
+	// start of the slice
+	for i, offset := range []uint32{0, 1000} {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := proto.Clone(natives[6+i]).(*capturepb.CaptureFrame)
+		want.FrameIndex = uint32(i)
+		want.TimestampOffsetMs = offset
+		if !proto.Equal(frame, want) {
+			t.Errorf("frame %d = %v, want %v", i, frame, want)
+		}
+	}
+}
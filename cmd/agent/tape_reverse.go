@@ -0,0 +1,646 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	enginev1 "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/engine/v1"
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	capturepb "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v2"
+	"github.com/echotools/nevr-agent/v4/internal/agent"
+	"github.com/echotools/tape/pkg/codec"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// LossReport lists the capture v2 data that could not be carried over to the
+// v1 frame format during a tape → echoreplay/nevrcap conversion.
+type LossReport struct {
+	Input     string         `json:"input"`
+	Output    string         `json:"output"`
+	Frames    int            `json:"frames"`
+	Unmapped  map[string]int `json:"unmapped,omitempty"`  // Field path → number of values dropped
+	Converted map[string]int `json:"converted,omitempty"` // Field path → number of values whose representation changed
+}
+
+func newLossReport(input, output string) *LossReport {
+	return &LossReport{
+		Input:     input,
+		Output:    output,
+		Unmapped:  make(map[string]int),
+		Converted: make(map[string]int),
+	}
+}
+
+// Lossless reports whether every field was mapped without conversion.
+func (r *LossReport) Lossless() bool {
+	return len(r.Unmapped) == 0 && len(r.Converted) == 0
+}
+
+// Write saves the report as indented JSON.
+func (r *LossReport) Write(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// tapeFrameMapper maps capture v2 frames back to v1 LobbySessionStateFrames.
+//
+// The tape library only maps v1 → v2, so this is its inverse: session fields
+// move from the capture header back into every frame, players are regrouped
+// into teams by role, and events are mapped to their LobbySessionEvent
+// counterparts. Anything the v1 format cannot carry is recorded in the loss
+// report.
+type tapeFrameMapper struct {
+	baseTime  time.Time
+	session   *enginev1.SessionResponse // Session fields seeded from the capture header
+	lastScore *enginev1.LastScore       // Most recent goal, kept in every following frame as in v1
+	report    *LossReport
+}
+
+// v1TeamNames are the team names used by the game API, by team index.
+var v1TeamNames = []string{"BLUE TEAM", "ORANGE TEAM", "SPECTATORS"}
+
+// newTapeFrameMapper creates a mapper for frames following the given header.
+func newTapeFrameMapper(header *capturepb.CaptureHeader, report *LossReport) *tapeFrameMapper {
+	m := &tapeFrameMapper{
+		baseTime: header.GetCreatedAt().AsTime(),
+		session:  &enginev1.SessionResponse{},
+		report:   report,
+	}
+
+	// Session identity lives in the header in v2 but in every frame in v1
+	if arena := header.GetEchoArena(); arena != nil {
+		m.session.SessionId = arena.GetSessionId()
+		m.session.MapName = arena.GetMapName()
+		m.session.MatchType = v1MatchType(arena.GetMatchType(), arena.GetPrivateMatch())
+		m.session.PrivateMatch = arena.GetPrivateMatch()
+		m.session.TournamentMatch = arena.GetTournamentMatch()
+		m.session.ClientName = arena.GetClientName()
+		m.session.TotalRoundCount = arena.GetTotalRoundCount()
+	}
+	return m
+}
+
+// v1Header builds the nevrcap header for the converted capture.
+func (m *tapeFrameMapper) v1Header(header *capturepb.CaptureHeader) *telemetry.TelemetryHeader {
+	metadata := make(map[string]string, len(header.GetMetadata())+1)
+	for k, v := range header.GetMetadata() {
+		metadata[k] = v
+	}
+	metadata["converted_from"] = "tape"
+
+	return &telemetry.TelemetryHeader{
+		CaptureId: header.GetCaptureId(),
+		CreatedAt: header.GetCreatedAt(),
+		Metadata:  metadata,
+	}
+}
+
+// mapFrame converts one capture v2 frame.
+func (m *tapeFrameMapper) mapFrame(src *capturepb.CaptureFrame) *telemetry.LobbySessionStateFrame {
+	frame := &telemetry.LobbySessionStateFrame{
+		FrameIndex: src.GetFrameIndex(),
+		Timestamp:  timestamppb.New(m.baseTime.Add(time.Duration(src.GetTimestampOffsetMs()) * time.Millisecond)),
+		Session:    proto.Clone(m.session).(*enginev1.SessionResponse),
+	}
+	m.report.Frames++
+
+	arena := src.GetEchoArena()
+	if arena == nil {
+		return frame
+	}
+
+	session := frame.Session
+	session.GameStatus = v1GameStatus(arena.GetGameStatus())
+	session.GameClock = arena.GetGameClock()
+	session.GameClockDisplay = arena.GetGameClockDisplay()
+	session.BluePoints = arena.GetBluePoints()
+	session.OrangePoints = arena.GetOrangePoints()
+	session.BlueRoundScore = arena.GetBlueRoundScore()
+	session.OrangeRoundScore = arena.GetOrangeRoundScore()
+	session.Disc = m.mapDisc(arena.GetDisc())
+	session.Teams = m.mapTeams(arena.GetPlayers())
+	frame.PlayerBones = mapBones(arena.GetBones())
+
+	players := make(map[int32]*enginev1.TeamMember)
+	for _, team := range session.Teams {
+		for _, player := range team.GetPlayers() {
+			players[player.GetSlotNumber()] = player
+		}
+	}
+	for _, event := range arena.GetEvents() {
+		if mapped := m.mapEvent(event, players); mapped != nil {
+			frame.Events = append(frame.Events, mapped)
+		}
+	}
+
+	// v1 frames repeat the last goal until the next one is scored
+	if m.lastScore != nil {
+		session.LastScore = proto.Clone(m.lastScore).(*enginev1.LastScore)
+	}
+	return frame
+}
+
+func (m *tapeFrameMapper) mapDisc(disc *capturepb.DiscState) *enginev1.Disc {
+	if disc == nil {
+		return nil
+	}
+	pose := disc.GetPose()
+	return &enginev1.Disc{
+		Position:    v1Vector(pose.GetPosition()),
+		Forward:     v1Vector(pose.GetForward()),
+		Left:        v1Vector(pose.GetLeft()),
+		Up:          v1Vector(pose.GetUp()),
+		Velocity:    v1Vector(disc.GetVelocity()),
+		BounceCount: disc.GetBounceCount(),
+	}
+}
+
+// mapTeams groups players into the blue, orange and spectator teams. Only as
+// many teams as needed are created.
+func (m *tapeFrameMapper) mapTeams(players []*capturepb.PlayerState) []*enginev1.Team {
+	var teams []*enginev1.Team
+	for _, player := range players {
+		index := v1TeamIndex(player.GetRole())
+		if index < 0 {
+			m.report.Unmapped["players.role"]++
+			continue
+		}
+		for len(teams) <= index {
+			teams = append(teams, &enginev1.Team{TeamName: v1TeamNames[len(teams)]})
+		}
+		member := mapPlayer(player)
+		teams[index].Players = append(teams[index].Players, member)
+		if member.HasPossession {
+			teams[index].HasPossession = true
+		}
+	}
+	return teams
+}
+
+func mapPlayer(player *capturepb.PlayerState) *enginev1.TeamMember {
+	member := &enginev1.TeamMember{
+		DisplayName:     player.GetDisplayName(),
+		SlotNumber:      player.GetSlot(),
+		AccountNumber:   player.GetAccountNumber(),
+		JerseyNumber:    player.GetJerseyNumber(),
+		Level:           player.GetLevel(),
+		IsStunned:       player.GetIsStunned(),
+		Ping:            player.GetPing(),
+		PacketLossRatio: player.GetPacketLossRatio(),
+		IsInvulnerable:  player.GetIsInvulnerable(),
+		HasPossession:   player.GetHasPossession(),
+		IsBlocking:      player.GetIsBlocking(),
+		Velocity:        v1Vector(player.GetVelocity()),
+		Head:            v1Transform(player.GetHead()),
+		Body:            v1Transform(player.GetBody()),
+		LeftHand:        v1Transform(player.GetLeftHand()),
+		RightHand:       v1Transform(player.GetRightHand()),
+	}
+	if stats := player.GetStats(); stats != nil {
+		member.Stats = &enginev1.PlayerStats{
+			PossessionTime: stats.GetPossessionTime(),
+			Points:         stats.GetPoints(),
+			Saves:          stats.GetSaves(),
+			Goals:          stats.GetGoals(),
+			Stuns:          stats.GetStuns(),
+			Passes:         stats.GetPasses(),
+			Catches:        stats.GetCatches(),
+			Steals:         stats.GetSteals(),
+			Blocks:         stats.GetBlocks(),
+			Interceptions:  stats.GetInterceptions(),
+			Assists:        stats.GetAssists(),
+			ShotsTaken:     stats.GetShotsTaken(),
+		}
+	}
+	return member
+}
+
+// mapBones places each player's bones at the index of their slot, as in the
+// v1 bones response.
+func mapBones(bones []*capturepb.PlayerBones) *enginev1.PlayerBonesResponse {
+	if len(bones) == 0 {
+		return nil
+	}
+	response := &enginev1.PlayerBonesResponse{}
+	for _, b := range bones {
+		slot := int(b.GetSlot())
+		if slot < 0 {
+			continue
+		}
+		for len(response.UserBones) <= slot {
+			response.UserBones = append(response.UserBones, &enginev1.UserBones{})
+		}
+		response.UserBones[slot] = &enginev1.UserBones{
+			BoneT: b.GetTranslations(),
+			BoneO: b.GetOrientations(),
+		}
+	}
+	return response
+}
+
+// mapEvent converts one capture v2 event. players holds the frame's players
+// by slot, used to restore the names v1 events refer to players by. It returns
+// nil for events v1 has no counterpart for.
+func (m *tapeFrameMapper) mapEvent(event *capturepb.EchoEvent, players map[int32]*enginev1.TeamMember) *telemetry.LobbySessionEvent {
+	switch e := event.GetEvent().(type) {
+	case *capturepb.EchoEvent_RoundStarted:
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_RoundStarted{RoundStarted: &telemetry.RoundStarted{
+			RoundNumber: e.RoundStarted.GetRoundNumber(),
+		}}}
+	case *capturepb.EchoEvent_RoundPaused:
+		if e.RoundPaused.GetPlayerSlot() != 0 {
+			m.report.Unmapped["events.round_paused.player_slot"]++
+		}
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_RoundPaused{RoundPaused: &telemetry.RoundPaused{}}}
+	case *capturepb.EchoEvent_RoundUnpaused:
+		if e.RoundUnpaused.GetPlayerSlot() != 0 {
+			m.report.Unmapped["events.round_unpaused.player_slot"]++
+		}
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_RoundUnpaused{RoundUnpaused: &telemetry.RoundUnpaused{}}}
+	case *capturepb.EchoEvent_RoundEnded:
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_RoundEnded{RoundEnded: &telemetry.RoundEnded{
+			RoundNumber: e.RoundEnded.GetRoundNumber(),
+			WinningTeam: v1Role(e.RoundEnded.GetWinningTeam()),
+		}}}
+	case *capturepb.EchoEvent_MatchEnded:
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_MatchEnded{MatchEnded: &telemetry.MatchEnded{
+			WinningTeam: v1Role(e.MatchEnded.GetWinningTeam()),
+		}}}
+	case *capturepb.EchoEvent_ScoreboardUpdated:
+		u := e.ScoreboardUpdated
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_ScoreboardUpdated{ScoreboardUpdated: &telemetry.ScoreboardUpdated{
+			BluePoints:       u.GetBluePoints(),
+			OrangePoints:     u.GetOrangePoints(),
+			BlueRoundScore:   u.GetBlueRoundScore(),
+			OrangeRoundScore: u.GetOrangeRoundScore(),
+			GameClockDisplay: u.GetGameClockDisplay(),
+		}}}
+	case *capturepb.EchoEvent_PlayerJoined:
+		j := e.PlayerJoined
+		player := &enginev1.TeamMember{
+			SlotNumber:    j.GetPlayerSlot(),
+			DisplayName:   j.GetDisplayName(),
+			AccountNumber: j.GetAccountNumber(),
+		}
+		if p, ok := players[j.GetPlayerSlot()]; ok {
+			player = proto.Clone(p).(*enginev1.TeamMember)
+		}
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_PlayerJoined{PlayerJoined: &telemetry.PlayerJoined{
+			Player: player,
+			Role:   v1Role(j.GetRole()),
+		}}}
+	case *capturepb.EchoEvent_PlayerLeft:
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_PlayerLeft{PlayerLeft: &telemetry.PlayerLeft{
+			PlayerSlot:  e.PlayerLeft.GetPlayerSlot(),
+			DisplayName: e.PlayerLeft.GetDisplayName(),
+		}}}
+	case *capturepb.EchoEvent_PlayerSwitchedTeam:
+		s := e.PlayerSwitchedTeam
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_PlayerSwitchedTeam{PlayerSwitchedTeam: &telemetry.PlayerSwitchedTeam{
+			PlayerSlot: s.GetPlayerSlot(),
+			NewRole:    v1Role(s.GetNewRole()),
+			PrevRole:   v1Role(s.GetPrevRole()),
+		}}}
+	case *capturepb.EchoEvent_EmotePlayed:
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_EmotePlayed{EmotePlayed: &telemetry.EmotePlayed{
+			PlayerSlot: e.EmotePlayed.GetPlayerSlot(),
+			Emote:      e.EmotePlayed.GetEmote(),
+		}}}
+	case *capturepb.EchoEvent_DiscPossessionChanged:
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_DiscPossessionChanged{DiscPossessionChanged: &telemetry.DiscPossessionChanged{
+			PlayerSlot:   e.DiscPossessionChanged.GetPlayerSlot(),
+			PreviousSlot: e.DiscPossessionChanged.GetPreviousSlot(),
+		}}}
+	case *capturepb.EchoEvent_DiscThrown:
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_DiscThrown{DiscThrown: &telemetry.DiscThrown{
+			PlayerSlot: e.DiscThrown.GetPlayerSlot(),
+		}}}
+	case *capturepb.EchoEvent_DiscCaught:
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_DiscCaught{DiscCaught: &telemetry.DiscCaught{
+			PlayerSlot: e.DiscCaught.GetPlayerSlot(),
+		}}}
+	case *capturepb.EchoEvent_GoalScored:
+		g := e.GoalScored
+		m.lastScore = &enginev1.LastScore{
+			DiscSpeed:      g.GetDiscSpeed(),
+			Team:           v1ScoreTeam(g.GetTeam()),
+			GoalType:       g.GetGoalType(),
+			PointAmount:    g.GetPointAmount(),
+			DistanceThrown: g.GetDistanceThrown(),
+			PersonScored:   players[g.GetScorerSlot()].GetDisplayName(),
+			AssistScored:   players[g.GetAssistSlot()].GetDisplayName(),
+		}
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_GoalScored{GoalScored: &telemetry.GoalScored{
+			ScoreDetails: proto.Clone(m.lastScore).(*enginev1.LastScore),
+		}}}
+	case *capturepb.EchoEvent_PlayerGoal:
+		// Derived from GoalScored in v1, which carries the scorer
+		return nil
+	case *capturepb.EchoEvent_PlayerSave:
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_PlayerSave{PlayerSave: &telemetry.PlayerSave{
+			PlayerSlot: e.PlayerSave.GetPlayerSlot(),
+			TotalSaves: e.PlayerSave.GetTotalSaves(),
+		}}}
+	case *capturepb.EchoEvent_PlayerStun:
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_PlayerStun{PlayerStun: &telemetry.PlayerStun{
+			PlayerSlot: e.PlayerStun.GetPlayerSlot(),
+			TotalStuns: e.PlayerStun.GetTotalStuns(),
+		}}}
+	case *capturepb.EchoEvent_PlayerPass:
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_PlayerPass{PlayerPass: &telemetry.PlayerPass{
+			PlayerSlot:  e.PlayerPass.GetPlayerSlot(),
+			TotalPasses: e.PlayerPass.GetTotalPasses(),
+		}}}
+	case *capturepb.EchoEvent_PlayerSteal:
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_PlayerSteal{PlayerSteal: &telemetry.PlayerSteal{
+			PlayerSlot:  e.PlayerSteal.GetPlayerSlot(),
+			TotalSteals: e.PlayerSteal.GetTotalSteals(),
+		}}}
+	case *capturepb.EchoEvent_PlayerBlock:
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_PlayerBlock{PlayerBlock: &telemetry.PlayerBlock{
+			PlayerSlot:  e.PlayerBlock.GetPlayerSlot(),
+			TotalBlocks: e.PlayerBlock.GetTotalBlocks(),
+		}}}
+	case *capturepb.EchoEvent_PlayerInterception:
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_PlayerInterception{PlayerInterception: &telemetry.PlayerInterception{
+			PlayerSlot:         e.PlayerInterception.GetPlayerSlot(),
+			TotalInterceptions: e.PlayerInterception.GetTotalInterceptions(),
+		}}}
+	case *capturepb.EchoEvent_PlayerAssist:
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_PlayerAssist{PlayerAssist: &telemetry.PlayerAssist{
+			PlayerSlot:   e.PlayerAssist.GetPlayerSlot(),
+			TotalAssists: e.PlayerAssist.GetTotalAssists(),
+		}}}
+	case *capturepb.EchoEvent_PlayerShotTaken:
+		return &telemetry.LobbySessionEvent{Event: &telemetry.LobbySessionEvent_PlayerShotTaken{PlayerShotTaken: &telemetry.PlayerShotTaken{
+			PlayerSlot: e.PlayerShotTaken.GetPlayerSlot(),
+			TotalShots: e.PlayerShotTaken.GetTotalShots(),
+		}}}
+	case *capturepb.EchoEvent_GenericEvent:
+		m.report.Unmapped["events.generic_event"]++
+		return nil
+	}
+	m.report.Unmapped["events"]++
+	return nil
+}
+
+// v1Vector converts a vector to the [x, y, z] list used by v1.
+func v1Vector(v *capturepb.Vec3) []float32 {
+	if v == nil {
+		return nil
+	}
+	return []float32{v.GetX(), v.GetY(), v.GetZ()}
+}
+
+func v1Transform(pose *capturepb.Pose) *enginev1.Transform {
+	if pose == nil {
+		return nil
+	}
+	return &enginev1.Transform{
+		Position: v1Vector(pose.GetPosition()),
+		Forward:  v1Vector(pose.GetForward()),
+		Left:     v1Vector(pose.GetLeft()),
+		Up:       v1Vector(pose.GetUp()),
+	}
+}
+
+// v1GameStatus returns the game API status string, e.g. "round_over".
+func v1GameStatus(status capturepb.GameStatus) string {
+	if status == capturepb.GameStatus_GAME_STATUS_UNSPECIFIED {
+		return ""
+	}
+	return strings.ToLower(strings.TrimPrefix(status.String(), "GAME_STATUS_"))
+}
+
+// v1MatchType returns the game API match type string.
+func v1MatchType(matchType capturepb.MatchType, private bool) string {
+	switch matchType {
+	case capturepb.MatchType_MATCH_TYPE_ARENA:
+		if private {
+			return "Echo_Arena_Private"
+		}
+		return "Echo_Arena"
+	case capturepb.MatchType_MATCH_TYPE_COMBAT:
+		if private {
+			return "Echo_Combat_Private"
+		}
+		return "Echo_Combat"
+	case capturepb.MatchType_MATCH_TYPE_SOCIAL:
+		return "Social_2.0"
+	}
+	return ""
+}
+
+func v1Role(role capturepb.Role) telemetry.Role {
+	switch role {
+	case capturepb.Role_ROLE_BLUE_TEAM:
+		return telemetry.Role_ROLE_BLUE_TEAM
+	case capturepb.Role_ROLE_ORANGE_TEAM:
+		return telemetry.Role_ROLE_ORANGE_TEAM
+	case capturepb.Role_ROLE_SPECTATOR:
+		return telemetry.Role_ROLE_SPECTATOR
+	}
+	return telemetry.Role_ROLE_UNSPECIFIED
+}
+
+// v1TeamIndex returns the index in the session's team list for a role, or -1.
+func v1TeamIndex(role capturepb.Role) int {
+	switch role {
+	case capturepb.Role_ROLE_BLUE_TEAM:
+		return 0
+	case capturepb.Role_ROLE_ORANGE_TEAM:
+		return 1
+	case capturepb.Role_ROLE_SPECTATOR:
+		return 2
+	}
+	return -1
+}
+
+// v1ScoreTeam returns the team name used in v1 goal details.
+func v1ScoreTeam(role capturepb.Role) string {
+	switch role {
+	case capturepb.Role_ROLE_BLUE_TEAM:
+		return "blue"
+	case capturepb.Role_ROLE_ORANGE_TEAM:
+		return "orange"
+	}
+	return ""
+}
+
+// tapeV1Reader reads a .tape file as v1 frames.
+type tapeV1Reader struct {
+	reader *codec.Reader
+	header *capturepb.CaptureHeader
+	mapper *tapeFrameMapper
+	report *LossReport
+}
+
+// newTapeV1Reader opens a .tape file and reads its header.
+func newTapeV1Reader(filename string, report *LossReport) (*tapeV1Reader, error) {
+	reader, err := codec.NewReader(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tape file: %w", err)
+	}
+
+	header, err := reader.ReadHeader()
+	if err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("failed to read tape header: %w", err)
+	}
+
+	if report == nil {
+		report = newLossReport(filename, "")
+	}
+	return &tapeV1Reader{
+		reader: reader,
+		header: header,
+		mapper: newTapeFrameMapper(header, report),
+		report: report,
+	}, nil
+}
+
+// Header returns the capture header mapped to the v1 format.
+func (r *tapeV1Reader) Header() *telemetry.TelemetryHeader {
+	return r.mapper.v1Header(r.header)
+}
+
+// ReadFrame reads the next frame. It returns io.EOF at the end of the tape.
+func (r *tapeV1Reader) ReadFrame() (*telemetry.LobbySessionStateFrame, error) {
+	frame, err := r.reader.ReadFrame()
+	if err != nil {
+		return nil, err
+	}
+	return r.mapper.mapFrame(frame), nil
+}
+
+func (r *tapeV1Reader) Close() error {
+	return r.reader.Close()
+}
+
+// convertTapeToV1 converts a .tape file to .echoreplay or .nevrcap. Fields that
+// could not be represented are logged and written to <output>.loss.json.
+func convertTapeToV1(inputFile, outputFile, outputFormat string) (*ConversionStats, error) {
+	report := newLossReport(inputFile, outputFile)
+
+	reader, err := newTapeV1Reader(inputFile, report)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var (
+		writeFrame func(*telemetry.LobbySessionStateFrame) error
+		closeFn    func() error
+	)
+	switch outputFormat {
+	case "echoreplay":
+		writer, err := codec.NewEchoReplayWriter(outputFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create output file: %w", err)
+		}
+		writeFrame, closeFn = writer.WriteFrame, writer.Close
+	case "nevrcap":
+		writer, err := agent.NewLegacyWriter(outputFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create output file: %w", err)
+		}
+		if err := writer.WriteHeader(reader.Header()); err != nil {
+			writer.Close()
+			return nil, fmt.Errorf("failed to write header: %w", err)
+		}
+		writeFrame, closeFn = writer.WriteFrame, writer.Close
+	default:
+		return nil, fmt.Errorf("%w from tape to %s", errUnsupportedConversion, outputFormat)
+	}
+
+	stats := &ConversionStats{}
+	if inputInfo, err := os.Stat(inputFile); err == nil {
+		stats.InputSize = inputInfo.Size()
+	}
+
+	for {
+		frame, err := reader.ReadFrame()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			closeFn()
+			return nil, fmt.Errorf("failed to read frame: %w", err)
+		}
+
+		if cfg.Converter.ExcludeBones {
+			frame.PlayerBones = nil
+		}
+
+		if err := writeFrame(frame); err != nil {
+			closeFn()
+			return nil, fmt.Errorf("failed to write frame: %w", err)
+		}
+		stats.FrameCount++
+	}
+
+	if err := closeFn(); err != nil {
+		return nil, fmt.Errorf("failed to close output file: %w", err)
+	}
+	if outputInfo, err := os.Stat(outputFile); err == nil {
+		stats.OutputSize = outputInfo.Size()
+	}
+
+	saveLossReport(report, outputFile)
+
+	return stats, nil
+}
+
+// saveLossReport logs the report and, if anything was lost, writes it to
+// <output>.loss.json.
+func saveLossReport(report *LossReport, outputFile string) {
+	logLossReport(report)
+	if report.Lossless() {
+		return
+	}
+	reportPath := outputFile + ".loss.json"
+	if err := report.Write(reportPath); err != nil {
+		logger.Warn("Failed to write loss report", zap.String("path", reportPath), zap.Error(err))
+	} else {
+		logger.Info("Loss report written", zap.String("path", reportPath))
+	}
+}
+
+// logLossReport logs the fields that were dropped or converted.
+func logLossReport(report *LossReport) {
+	if report.Lossless() {
+		logger.Info("Tape conversion was lossless", zap.Int("frames", report.Frames))
+		return
+	}
+
+	for _, path := range sortedKeys(report.Unmapped) {
+		logger.Warn("Field not representable in v1 format",
+			zap.String("field", path),
+			zap.Int("values_dropped", report.Unmapped[path]))
+	}
+	for _, path := range sortedKeys(report.Converted) {
+		logger.Info("Field converted to v1 representation",
+			zap.String("field", path),
+			zap.Int("values", report.Converted[path]))
+	}
+}
+
+func sortedKeys(m map[string]int) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	enginev1 "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/engine/v1"
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	capturepb "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v2"
+	"github.com/echotools/nevr-agent/v4/internal/config"
+	"github.com/echotools/tape/pkg/codec"
+	"github.com/echotools/tape/pkg/conversion"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// useTestConfig installs a default config and a no-op logger for the test.
+func useTestConfig(t *testing.T) {
+	t.Helper()
+	prevCfg, prevLogger := cfg, logger
+	cfg, logger = config.DefaultConfig(), zap.NewNop()
+	t.Cleanup(func() { cfg, logger = prevCfg, prevLogger })
+}
+
+// testFrameBase and testSessionID are the start time and session of the
+// test frames.
+var testFrameBase = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+const testSessionID = "B0D4C4A0-7E5B-4C4F-9A55-3C7B6F1D2E11"
+
+// testFrameSpec describes the frames built by testV1Frames.
+type testFrameSpec struct {
+	interval  time.Duration
+	offsetsMs []int
+	statuses  []string
+	sessionID string
+	clock     func(i int) string
+}
+
+type testFrameOption func(*testFrameSpec)
+
+// withOffsetsMs places frame i at offsetsMs[i] milliseconds from
+// testFrameBase, or leaves it without a timestamp if the offset is negative.
+func withOffsetsMs(offsetsMs ...int) testFrameOption {
+	return func(spec *testFrameSpec) { spec.offsetsMs = offsetsMs }
+}
+
+// withInterval spaces the frames by interval instead of 33ms.
+func withInterval(interval time.Duration) testFrameOption {
+	return func(spec *testFrameSpec) { spec.interval = interval }
+}
+
+// withStatuses cycles the game status of the frames through statuses.
+func withStatuses(statuses ...string) testFrameOption {
+	return func(spec *testFrameSpec) { spec.statuses = statuses }
+}
+
+func withSessionID(sessionID string) testFrameOption {
+	return func(spec *testFrameSpec) { spec.sessionID = sessionID }
+}
+
+// withGameClock sets the game clock display of frame i to clock(i).
+func withGameClock(clock func(i int) string) testFrameOption {
+	return func(spec *testFrameSpec) { spec.clock = clock }
+}
+
+// testV1Frames builds count frames of testSessionID, 33ms apart and cycling
+// through the phases of a round, unless changed by opts.
+func testV1Frames(count int, opts ...testFrameOption) []*telemetry.LobbySessionStateFrame {
+	spec := testFrameSpec{
+		interval:  33 * time.Millisecond,
+		statuses:  []string{"pre_match", "playing", "score", "playing", "round_over"},
+		sessionID: testSessionID,
+	}
+	for _, opt := range opts {
+		opt(&spec)
+	}
+
+	frames := make([]*telemetry.LobbySessionStateFrame, count)
+	for i := range frames {
+		offset := time.Duration(i) * spec.interval
+		if spec.offsetsMs != nil {
+			offset = time.Duration(spec.offsetsMs[i]) * time.Millisecond
+		}
+		frames[i] = &telemetry.LobbySessionStateFrame{
+			FrameIndex: uint32(i),
+			Session: &enginev1.SessionResponse{
+				SessionId:  spec.sessionID,
+				GameStatus: spec.statuses[i%len(spec.statuses)],
+			},
+		}
+		if offset >= 0 {
+			frames[i].Timestamp = timestamppb.New(testFrameBase.Add(offset))
+		}
+		if spec.clock != nil {
+			frames[i].Session.GameClockDisplay = spec.clock(i)
+		}
+	}
+	return frames
+}
+
+// writeTestTape writes v1 frames to a .tape file the same way the agent's tape writer does.
+func writeTestTape(t *testing.T, path string, frames []*telemetry.LobbySessionStateFrame) {
+	t.Helper()
+
+	writer, err := codec.NewWriter(path)
+	if err != nil {
+		t.Fatalf("failed to create tape writer: %v", err)
+	}
+	header := conversion.MapHeaderFromSession(&telemetry.TelemetryHeader{
+		CaptureId: frames[0].GetSession().GetSessionId(),
+		CreatedAt: frames[0].GetTimestamp(),
+	}, frames[0].GetSession())
+	if err := writer.WriteHeader(header); err != nil {
+		t.Fatalf("failed to write header: %v", err)
+	}
+
+	mapper := conversion.FrameMapper{BaseTime: frames[0].GetTimestamp().AsTime()}
+	for _, frame := range frames {
+		if err := writer.WriteFrame(mapper.MapFrame(frame)); err != nil {
+			t.Fatalf("failed to write frame: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close tape writer: %v", err)
+	}
+}
+
+func TestConvertTapeToNevrcap_RoundTrip(t *testing.T) {
+	useTestConfig(t)
+
+	dir := t.TempDir()
+	tapePath := filepath.Join(dir, "match.tape")
+	nevrcapPath := filepath.Join(dir, "match.nevrcap")
+
+	original := testV1Frames(25)
+	writeTestTape(t, tapePath, original)
+
+	stats, err := convertTapeToV1(tapePath, nevrcapPath, "nevrcap")
+	if err != nil {
+		t.Fatalf("convertTapeToV1() error = %v", err)
+	}
+	if stats.FrameCount != len(original) {
+		t.Errorf("FrameCount = %d, want %d", stats.FrameCount, len(original))
+	}
+
+	reader, err := codec.NewLegacyReader(nevrcapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	header, err := reader.ReadHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.GetCaptureId() != original[0].GetSession().GetSessionId() {
+		t.Errorf("header capture ID = %q", header.GetCaptureId())
+	}
+
+	for i, want := range original {
+		got, err := reader.ReadFrame()
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if got.GetFrameIndex() != want.GetFrameIndex() {
+			t.Errorf("frame %d: index = %d, want %d", i, got.GetFrameIndex(), want.GetFrameIndex())
+		}
+		if !got.GetTimestamp().AsTime().Equal(want.GetTimestamp().AsTime()) {
+			t.Errorf("frame %d: timestamp = %v, want %v", i, got.GetTimestamp().AsTime(), want.GetTimestamp().AsTime())
+		}
+		if got.GetSession().GetSessionId() != want.GetSession().GetSessionId() {
+			t.Errorf("frame %d: session ID = %q, want %q", i, got.GetSession().GetSessionId(), want.GetSession().GetSessionId())
+		}
+		if got.GetSession().GetGameStatus() != want.GetSession().GetGameStatus() {
+			t.Errorf("frame %d: game status = %q, want %q", i, got.GetSession().GetGameStatus(), want.GetSession().GetGameStatus())
+		}
+	}
+	if _, err := reader.ReadFrame(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected EOF after %d frames, got %v", len(original), err)
+	}
+}
+
+func TestConvertTapeToEchoReplay_RoundTrip(t *testing.T) {
+	useTestConfig(t)
+
+	dir := t.TempDir()
+	tapePath := filepath.Join(dir, "match.tape")
+	replayPath := filepath.Join(dir, "match.echoreplay")
+	backPath := filepath.Join(dir, "back.tape")
+
+	original := testV1Frames(10)
+	writeTestTape(t, tapePath, original)
+
+	if _, err := convertTapeToV1(tapePath, replayPath, "echoreplay"); err != nil {
+		t.Fatalf("tape → echoreplay failed: %v", err)
+	}
+	if _, err := conversion.ConvertFile(replayPath, backPath); err != nil {
+		t.Fatalf("echoreplay → tape failed: %v", err)
+	}
+
+	// Frames must survive tape → echoreplay → tape unchanged
+	first, err := newTapeV1Reader(tapePath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	second, err := newTapeV1Reader(backPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	for i := range original {
+		a, err := first.ReadFrame()
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		b, err := second.ReadFrame()
+		if err != nil {
+			t.Fatalf("frame %d: %v", i, err)
+		}
+		if a.GetSession().GetGameStatus() != b.GetSession().GetGameStatus() ||
+			!a.GetTimestamp().AsTime().Equal(b.GetTimestamp().AsTime()) {
+			t.Errorf("frame %d differs after round trip", i)
+		}
+	}
+}
+
+func TestTapeFrameMapper_MapFrame(t *testing.T) {
+	base := testFrameBase
+	transform := func(x float32) *enginev1.Transform {
+		return &enginev1.Transform{Position: []float32{x, 1, 2}, Forward: []float32{0, 0, 1}, Left: []float32{1, 0, 0}, Up: []float32{0, 1, 0}}
+	}
+	blue := &enginev1.TeamMember{
+		DisplayName: "alpha", SlotNumber: 0, AccountNumber: 11, JerseyNumber: 7, Level: 30,
+		HasPossession: true, Ping: 40, Velocity: []float32{1, 0, 0},
+		Head: transform(1), Body: transform(2), LeftHand: transform(3), RightHand: transform(4),
+		Stats: &enginev1.PlayerStats{Points: 2, Goals: 1, Saves: 3, ShotsTaken: 4, PossessionTime: 12.5},
+	}
+	orange := &enginev1.TeamMember{
+		DisplayName: "bravo", SlotNumber: 1, AccountNumber: 22, IsStunned: true,
+		Head: transform(5), Body: transform(6), LeftHand: transform(7), RightHand: transform(8),
+		Stats: &enginev1.PlayerStats{Stuns: 5},
+	}
+	score := &enginev1.LastScore{Team: "blue", GoalType: "INSIDE SHOT", PointAmount: 2, DiscSpeed: 14, DistanceThrown: 9, PersonScored: "alpha", AssistScored: "bravo"}
+	original := &telemetry.LobbySessionStateFrame{
+		FrameIndex: 4,
+		Timestamp:  timestamppb.New(base.Add(500 * time.Millisecond)),
+		Session: &enginev1.SessionResponse{
+			SessionId: testSessionID, MatchType: "Echo_Arena", MapName: "mpl_arena_a",
+			GameStatus: "score", GameClock: 120.5, GameClockDisplay: "02:00.50", BluePoints: 2,
+			Disc: &enginev1.Disc{Position: []float32{0, 1, 2}, Forward: []float32{0, 0, 1}, Left: []float32{1, 0, 0}, Up: []float32{0, 1, 0}, Velocity: []float32{3, 0, 0}, BounceCount: 2},
+			Teams: []*enginev1.Team{
+				{TeamName: "BLUE TEAM", Players: []*enginev1.TeamMember{blue}, HasPossession: true},
+				{TeamName: "ORANGE TEAM", Players: []*enginev1.TeamMember{orange}},
+			},
+		},
+		PlayerBones: &enginev1.PlayerBonesResponse{UserBones: []*enginev1.UserBones{
+			{BoneT: []float32{1, 2, 3}, BoneO: []float32{0, 0, 0, 1}},
+			{BoneT: []float32{4, 5, 6}, BoneO: []float32{0, 1, 0, 0}},
+		}},
+		Events: []*telemetry.LobbySessionEvent{
+			{Event: &telemetry.LobbySessionEvent_GoalScored{GoalScored: &telemetry.GoalScored{ScoreDetails: score}}},
+			{Event: &telemetry.LobbySessionEvent_PlayerJoined{PlayerJoined: &telemetry.PlayerJoined{Player: orange, Role: telemetry.Role_ROLE_ORANGE_TEAM}}},
+			{Event: &telemetry.LobbySessionEvent_DiscThrown{DiscThrown: &telemetry.DiscThrown{PlayerSlot: 0}}},
+			{Event: &telemetry.LobbySessionEvent_PlayerSave{PlayerSave: &telemetry.PlayerSave{PlayerSlot: 1, TotalSaves: 3}}},
+			{Event: &telemetry.LobbySessionEvent_RoundEnded{RoundEnded: &telemetry.RoundEnded{RoundNumber: 1, WinningTeam: telemetry.Role_ROLE_BLUE_TEAM}}},
+		},
+	}
+
+	header := conversion.MapHeaderFromSession(&telemetry.TelemetryHeader{CreatedAt: timestamppb.New(base)}, original.GetSession())
+	mapper := conversion.FrameMapper{BaseTime: base}
+	native := mapper.MapFrame(original)
+
+	report := newLossReport("in", "out")
+	got := newTapeFrameMapper(header, report).mapFrame(native)
+
+	want := proto.Clone(original).(*telemetry.LobbySessionStateFrame)
+	want.Session.LastScore = score
+	if !proto.Equal(want, got) {
+		t.Errorf("mapped frame = %v\nwant %v", got, want)
+	}
+	if !report.Lossless() {
+		t.Errorf("unexpected losses: %+v", report)
+	}
+}
+
+func TestTapeFrameMapper_ReportsUnmappedEvents(t *testing.T) {
+	report := newLossReport("in", "out")
+	m := newTapeFrameMapper(&capturepb.CaptureHeader{}, report)
+
+	frame := m.mapFrame(&capturepb.CaptureFrame{Payload: &capturepb.CaptureFrame_EchoArena{EchoArena: &capturepb.EchoArenaFrame{
+		Players: []*capturepb.PlayerState{{Slot: 3, DisplayName: "unassigned"}},
+		Events: []*capturepb.EchoEvent{
+			{Event: &capturepb.EchoEvent_PlayerGoal{PlayerGoal: &capturepb.PlayerGoal{PlayerSlot: 0}}},
+			{Event: &capturepb.EchoEvent_GenericEvent{GenericEvent: &capturepb.GenericEvent{Name: "custom"}}},
+			{Event: &capturepb.EchoEvent_RoundPaused{RoundPaused: &capturepb.RoundPaused{PlayerSlot: 2}}},
+		},
+	}}})
+
+	// PlayerGoal is implied by GoalScored in v1; the others cannot be carried
+	if len(frame.GetEvents()) != 1 || frame.GetEvents()[0].GetRoundPaused() == nil {
+		t.Errorf("events = %v, want only the round pause", frame.GetEvents())
+	}
+	if len(frame.GetSession().GetTeams()) != 0 {
+		t.Errorf("player without a role was mapped: %v", frame.GetSession().GetTeams())
+	}
+	want := map[string]int{"events.generic_event": 1, "events.round_paused.player_slot": 1, "players.role": 1}
+	if !maps.Equal(report.Unmapped, want) {
+		t.Errorf("Unmapped = %v, want %v", report.Unmapped, want)
+	}
+}
+
+func TestDetermineOutputFileForTape(t *testing.T) {
+	useTestConfig(t)
+	cfg.Converter.OutputDir = t.TempDir()
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"auto", "match.echoreplay"},
+		{"nevrcap", "match.nevrcap"},
+		{"tape", "match_converted.tape"},
+	}
+	for _, tt := range tests {
+		cfg.Converter.Format = tt.format
+		got, err := determineOutputFileForInput(filepath.Join("recordings", "match.tape"))
+		if err != nil {
+			t.Fatalf("format %s: %v", tt.format, err)
+		}
+		if filepath.Base(got) != tt.want {
+			t.Errorf("format %s: output = %s, want %s", tt.format, filepath.Base(got), tt.want)
+		}
+	}
+
+	if _, err := os.Stat(cfg.Converter.OutputDir); err != nil {
+		t.Error(err)
+	}
+}
@@ -75,6 +75,13 @@ func getLatestRelease() (*GitHubRelease, error) {
 	client := &http.Client{
 		Timeout: 10 * time.Second,
 	}
+	if cfg != nil {
+		transportClient, err := cfg.Transport.HTTPClient(10 * time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("invalid transport configuration: %w", err)
+		}
+		client = transportClient
+	}
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
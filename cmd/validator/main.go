@@ -12,11 +12,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"math"
 	"os"
 	"path/filepath"
-	"reflect"
 
+	"github.com/echotools/nevr-agent/v4/internal/jsondiff"
 	"github.com/echotools/tape/pkg/codec"
 	apigamev1 "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/engine/v1"
 	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
@@ -174,8 +173,8 @@ func validateEchoReplayFile(filename string) error {
 
 		// Step 3: Compare control vs codec output
 		// Standard tolerance-based comparison
-		sessionDiffs := compareWithTolerance(controlSession, codecSession, "session", 1e-6)
-		bonesDiffs := compareWithTolerance(controlBones, codecBones, "user_bones", 1e-6)
+		sessionDiffs := jsondiff.Compare(controlSession, codecSession, "session", jsondiff.Options{Tolerance: 1e-6})
+		bonesDiffs := jsondiff.Compare(controlBones, codecBones, "user_bones", jsondiff.Options{Tolerance: 1e-6})
 
 		// Additional comparison using cmp.Diff for deep structural differences
 		cmpSessionDiff := cmp.Diff(controlSession, codecSession)
@@ -351,181 +350,3 @@ func reEncodeTheFrameWithJsonPackage(frame *telemetry.LobbySessionStateFrame) (s
 
 	return session, bones, nil
 }
-
-// compareWithTolerance compares two maps, ignoring trivial floating point differences
-func compareWithTolerance(a, b map[string]any, prefix string, tolerance float64) []string {
-	var diffs []string
-	compareRecursive(a, b, prefix, tolerance, &diffs)
-	return diffs
-}
-
-// compareRecursive recursively compares two values
-func compareRecursive(a, b any, path string, tolerance float64, diffs *[]string) {
-	if a == nil && b == nil {
-		return
-	}
-	if a == nil || b == nil {
-		*diffs = append(*diffs, fmt.Sprintf("%s: one is nil (a=%v, b=%v)", path, a, b))
-		return
-	}
-
-	aType := reflect.TypeOf(a)
-	bType := reflect.TypeOf(b)
-
-	// Handle type differences, but allow float64/int conversions and string/number conversions
-	// (protojson encodes uint64/int64 as strings)
-	if aType != bType {
-		// Try to convert to comparable numbers
-		aNum, aIsNum := toFloat64(a)
-		bNum, bIsNum := toFloat64(b)
-		if aIsNum && bIsNum {
-			if !floatEquals(aNum, bNum, tolerance) {
-				*diffs = append(*diffs, fmt.Sprintf("%s: numeric mismatch (a=%v, b=%v)", path, a, b))
-			}
-			return
-		}
-
-		*diffs = append(*diffs, fmt.Sprintf("%s: type mismatch (a=%T [%v], b=%T [%v])", path, a, a, b, b))
-		return
-	}
-
-	switch aVal := a.(type) {
-	case map[string]any:
-		bVal := b.(map[string]any)
-		compareMapWithTolerance(aVal, bVal, path, tolerance, diffs)
-
-	case []any:
-		bVal := b.([]any)
-		if len(aVal) != len(bVal) {
-			*diffs = append(*diffs, fmt.Sprintf("%s: slice length mismatch (a=%d, b=%d)", path, len(aVal), len(bVal)))
-			return
-		}
-		for i := range aVal {
-			compareRecursive(aVal[i], bVal[i], fmt.Sprintf("%s[%d]", path, i), tolerance, diffs)
-		}
-
-	case float64:
-		bVal := b.(float64)
-		if !floatEquals(aVal, bVal, tolerance) {
-			*diffs = append(*diffs, fmt.Sprintf("%s: float mismatch (a=%v, b=%v, diff=%v)", path, aVal, bVal, math.Abs(aVal-bVal)))
-		}
-
-	case string:
-		bVal := b.(string)
-		if aVal != bVal {
-			*diffs = append(*diffs, fmt.Sprintf("%s: string mismatch (a=%q, b=%q)", path, aVal, bVal))
-		}
-
-	case bool:
-		bVal := b.(bool)
-		if aVal != bVal {
-			*diffs = append(*diffs, fmt.Sprintf("%s: bool mismatch (a=%v, b=%v)", path, aVal, bVal))
-		}
-
-	default:
-		if !reflect.DeepEqual(a, b) {
-			*diffs = append(*diffs, fmt.Sprintf("%s: value mismatch (a=%v, b=%v)", path, a, b))
-		}
-	}
-}
-
-// compareMapWithTolerance compares two maps
-func compareMapWithTolerance(a, b map[string]any, path string, tolerance float64, diffs *[]string) {
-	// Check all keys in a
-	for k, av := range a {
-		bv, exists := b[k]
-		keyPath := path + "." + k
-		if !exists {
-			// Check if value is zero/empty - those might be omitted
-			if isZeroValue(av) {
-				continue
-			}
-			*diffs = append(*diffs, fmt.Sprintf("%s: key missing in b", keyPath))
-			continue
-		}
-		compareRecursive(av, bv, keyPath, tolerance, diffs)
-	}
-
-	// Check for extra keys in b
-	for k, bv := range b {
-		if _, exists := a[k]; !exists {
-			// Check if value is zero/empty - those might be omitted
-			if isZeroValue(bv) {
-				continue
-			}
-			*diffs = append(*diffs, fmt.Sprintf("%s.%s: key missing in a", path, k))
-		}
-	}
-}
-
-// isZeroValue checks if a value is a zero/default value that might be omitted
-func isZeroValue(v any) bool {
-	if v == nil {
-		return true
-	}
-	switch val := v.(type) {
-	case float64:
-		return val == 0
-	case int:
-		return val == 0
-	case string:
-		return val == ""
-	case bool:
-		return !val
-	case []any:
-		return len(val) == 0
-	case map[string]any:
-		return len(val) == 0
-	}
-	return false
-}
-
-// toFloat64 tries to convert a value to float64
-func toFloat64(v any) (float64, bool) {
-	switch val := v.(type) {
-	case float64:
-		return val, true
-	case int:
-		return float64(val), true
-	case int64:
-		return float64(val), true
-	case int32:
-		return float64(val), true
-	case float32:
-		return float64(val), true
-	}
-	return 0, false
-}
-
-// floatEquals compares two floats with tolerance for rounding errors
-func floatEquals(a, b, tolerance float64) bool {
-	// Handle special cases
-	if math.IsNaN(a) && math.IsNaN(b) {
-		return true
-	}
-	if math.IsInf(a, 1) && math.IsInf(b, 1) {
-		return true
-	}
-	if math.IsInf(a, -1) && math.IsInf(b, -1) {
-		return true
-	}
-
-	// For zero values
-	if a == 0 && b == 0 {
-		return true
-	}
-
-	// Absolute difference check for small numbers
-	diff := math.Abs(a - b)
-	if diff <= tolerance {
-		return true
-	}
-
-	// Relative difference check for larger numbers
-	maxAbs := math.Max(math.Abs(a), math.Abs(b))
-	if maxAbs > 0 && diff/maxAbs <= tolerance {
-		return true
-	}
-
-	return false
-}
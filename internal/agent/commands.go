@@ -0,0 +1,360 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Message types exchanged on the events WebSocket command channel.
+const (
+	MessageTypeCommand    = "command"
+	MessageTypeCommandAck = "command_ack"
+)
+
+// Commands the server may send to the agent over the events WebSocket.
+const (
+	CommandSetFPS         = "set_fps"
+	CommandSetIdleFPS     = "set_idle_fps"
+	CommandSetBones       = "set_bones"
+	CommandStartRecording = "start_recording"
+	CommandStopRecording  = "stop_recording"
+	CommandSnapshot       = "snapshot"
+	CommandStatus         = "status"
+)
+
+// maxCommandFPS caps the frame rates a remote command may request.
+const maxCommandFPS = 120
+
+var (
+	ErrUnknownCommand   = errors.New("unknown command")
+	ErrInvalidArguments = errors.New("invalid command arguments")
+)
+
+// ServerCommand is a command sent by the server over the events WebSocket.
+//
+//	{"type":"command","id":"42","command":"set_fps","args":{"fps":60}}
+type ServerCommand struct {
+	Type    string          `json:"type"`
+	ID      string          `json:"id"`
+	Command string          `json:"command"`
+	Args    json.RawMessage `json:"args,omitempty"`
+}
+
+// CommandAck is the agent's reply to a ServerCommand. It echoes the command ID
+// so the server can correlate replies with requests.
+type CommandAck struct {
+	Type    string `json:"type"`
+	ID      string `json:"id"`
+	Command string `json:"command"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	Result  any    `json:"result,omitempty"`
+}
+
+// CommandHandler validates and applies server commands.
+type CommandHandler interface {
+	HandleCommand(cmd ServerCommand) CommandAck
+}
+
+// RecorderFactory creates a local file writer for the given format and returns
+// it together with the path it writes to. The writer must already be running.
+type RecorderFactory func(format string) (FrameWriter, string, error)
+
+// SessionController holds the runtime-adjustable settings of a polling session
+// and applies commands received from the server. The poller reads the current
+// rates and bone setting from it, and feeds it every processed frame so that
+// snapshots and command-started recordings see the full frame stream.
+type SessionController struct {
+	mu     sync.Mutex
+	logger *zap.Logger
+
+	sessionID    string
+	fps          int
+	idleFPS      int
+	excludeBones bool
+
+	newRecorder  RecorderFactory
+	recorder     FrameWriter
+	recorderPath string
+
+	lastFrame      *telemetry.LobbySessionStateFrame
+	framesObserved uint64
+	startedAt      time.Time
+
+	changedCh chan struct{}
+}
+
+// NewSessionController creates a controller seeded from the poller configuration.
+// newRecorder may be nil, in which case start_recording is rejected.
+func NewSessionController(logger *zap.Logger, sessionID string, pollerCfg PollerConfig, newRecorder RecorderFactory) *SessionController {
+	return &SessionController{
+		logger:       logger.With(zap.String("component", "session_controller")),
+		sessionID:    sessionID,
+		fps:          pollerCfg.FPS,
+		idleFPS:      pollerCfg.IdleFPS,
+		excludeBones: pollerCfg.ExcludeBones,
+		newRecorder:  newRecorder,
+		startedAt:    time.Now(),
+		changedCh:    make(chan struct{}, 1),
+	}
+}
+
+// Rates returns the current active and idle frame rates.
+func (c *SessionController) Rates() (fps, idleFPS int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.fps, c.idleFPS
+}
+
+// ExcludeBones reports whether bone data should be stripped from streamed frames.
+func (c *SessionController) ExcludeBones() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.excludeBones
+}
+
+// Changed is signalled whenever a command changes the frame rates.
+func (c *SessionController) Changed() <-chan struct{} {
+	return c.changedCh
+}
+
+// ObserveFrame records the frame as the current snapshot and forwards it to a
+// command-started recording, if any. It must be called before the frame is
+// modified by stream filters. The controller keeps its own copy, since the
+// poller goes on to modify the frame it passed in.
+func (c *SessionController) ObserveFrame(frame *telemetry.LobbySessionStateFrame) {
+	frame = proto.Clone(frame).(*telemetry.LobbySessionStateFrame)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastFrame = frame
+	c.framesObserved++
+
+	if c.recorder == nil {
+		return
+	}
+	if c.recorder.IsStopped() {
+		c.logger.Info("Command recording stopped", zap.String("file_path", c.recorderPath))
+		c.recorder = nil
+		c.recorderPath = ""
+		return
+	}
+
+	if err := c.recorder.WriteFrame(frame); err != nil {
+		c.logger.Warn("Failed to write frame to command recording", zap.Error(err))
+	}
+}
+
+// Close stops any recording started by a command.
+func (c *SessionController) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stopRecordingLocked()
+}
+
+// HandleCommand validates and applies a server command.
+func (c *SessionController) HandleCommand(cmd ServerCommand) CommandAck {
+	ack := CommandAck{
+		Type:    MessageTypeCommandAck,
+		ID:      cmd.ID,
+		Command: cmd.Command,
+	}
+
+	result, err := c.apply(cmd)
+	if err != nil {
+		ack.Error = err.Error()
+		c.logger.Warn("Rejected server command",
+			zap.String("command", cmd.Command),
+			zap.String("id", cmd.ID),
+			zap.Error(err))
+		return ack
+	}
+
+	ack.Success = true
+	ack.Result = result
+	c.logger.Info("Applied server command",
+		zap.String("command", cmd.Command),
+		zap.String("id", cmd.ID))
+	return ack
+}
+
+func (c *SessionController) apply(cmd ServerCommand) (any, error) {
+	switch cmd.Command {
+	case CommandSetFPS:
+		var args struct {
+			FPS *int `json:"fps"`
+		}
+		if err := decodeCommandArgs(cmd.Args, &args); err != nil {
+			return nil, err
+		}
+		if args.FPS == nil || *args.FPS < 1 || *args.FPS > maxCommandFPS {
+			return nil, fmt.Errorf("%w: fps must be between 1 and %d", ErrInvalidArguments, maxCommandFPS)
+		}
+		c.mu.Lock()
+		c.fps = *args.FPS
+		c.mu.Unlock()
+		c.notifyChanged()
+		return map[string]any{"fps": *args.FPS}, nil
+
+	case CommandSetIdleFPS:
+		var args struct {
+			IdleFPS *int `json:"idle_fps"`
+		}
+		if err := decodeCommandArgs(cmd.Args, &args); err != nil {
+			return nil, err
+		}
+		if args.IdleFPS == nil || *args.IdleFPS < 0 || *args.IdleFPS > maxCommandFPS {
+			return nil, fmt.Errorf("%w: idle_fps must be between 0 and %d", ErrInvalidArguments, maxCommandFPS)
+		}
+		c.mu.Lock()
+		c.idleFPS = *args.IdleFPS
+		c.mu.Unlock()
+		c.notifyChanged()
+		return map[string]any{"idle_fps": *args.IdleFPS}, nil
+
+	case CommandSetBones:
+		var args struct {
+			Enabled *bool `json:"enabled"`
+		}
+		if err := decodeCommandArgs(cmd.Args, &args); err != nil {
+			return nil, err
+		}
+		if args.Enabled == nil {
+			return nil, fmt.Errorf("%w: enabled is required", ErrInvalidArguments)
+		}
+		c.mu.Lock()
+		c.excludeBones = !*args.Enabled
+		c.mu.Unlock()
+		return map[string]any{"enabled": *args.Enabled}, nil
+
+	case CommandStartRecording:
+		var args struct {
+			Format string `json:"format"`
+		}
+		if err := decodeCommandArgs(cmd.Args, &args); err != nil {
+			return nil, err
+		}
+		format := strings.ToLower(strings.TrimSpace(args.Format))
+		if format == "" {
+			format = "tape"
+		}
+		switch format {
+		case "tape", "nevrcap", "echoreplay", "replay":
+		default:
+			return nil, fmt.Errorf("%w: unsupported recording format %q", ErrInvalidArguments, args.Format)
+		}
+		return c.startRecording(format)
+
+	case CommandStopRecording:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.recorder == nil {
+			return nil, errors.New("no recording in progress")
+		}
+		path := c.recorderPath
+		c.stopRecordingLocked()
+		return map[string]any{"file_path": path}, nil
+
+	case CommandSnapshot:
+		c.mu.Lock()
+		frame := c.lastFrame
+		c.mu.Unlock()
+		if frame == nil {
+			return nil, errors.New("no frame received yet")
+		}
+		data, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(frame)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal frame: %w", err)
+		}
+		return json.RawMessage(data), nil
+
+	case CommandStatus:
+		return c.Status(), nil
+
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownCommand, cmd.Command)
+	}
+}
+
+// Status returns a report of the session's current settings and activity.
+func (c *SessionController) Status() map[string]any {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := map[string]any{
+		"session_id":      c.sessionID,
+		"fps":             c.fps,
+		"idle_fps":        c.idleFPS,
+		"exclude_bones":   c.excludeBones,
+		"frames_observed": c.framesObserved,
+		"uptime":          time.Since(c.startedAt).Round(time.Second).String(),
+		"recording":       c.recorder != nil && !c.recorder.IsStopped(),
+	}
+	if c.recorder != nil {
+		status["recording_path"] = c.recorderPath
+	}
+	if c.lastFrame != nil {
+		status["game_status"] = c.lastFrame.GetSession().GetGameStatus()
+		status["last_frame_index"] = c.lastFrame.GetFrameIndex()
+	}
+	return status
+}
+
+func (c *SessionController) startRecording(format string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.newRecorder == nil {
+		return nil, errors.New("local recording is not available for this session")
+	}
+	if c.recorder != nil && !c.recorder.IsStopped() {
+		return nil, fmt.Errorf("recording already in progress: %s", c.recorderPath)
+	}
+
+	recorder, path, err := c.newRecorder(format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start recording: %w", err)
+	}
+	c.recorder = recorder
+	c.recorderPath = path
+	return map[string]any{"format": format, "file_path": path}, nil
+}
+
+// stopRecordingLocked closes the command recording (must be called with lock held)
+func (c *SessionController) stopRecordingLocked() {
+	if c.recorder == nil {
+		return
+	}
+	c.recorder.Close()
+	c.logger.Info("Command recording stopped", zap.String("file_path", c.recorderPath))
+	c.recorder = nil
+	c.recorderPath = ""
+}
+
+func (c *SessionController) notifyChanged() {
+	select {
+	case c.changedCh <- struct{}{}:
+	default:
+		// Change already pending
+	}
+}
+
+func decodeCommandArgs(raw json.RawMessage, v any) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidArguments, err)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	enginev1 "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/engine/v1"
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+)
+
+type recordingWriter struct {
+	frames  []*telemetry.LobbySessionStateFrame
+	stopped bool
+}
+
+func (r *recordingWriter) Context() context.Context { return context.Background() }
+func (r *recordingWriter) WriteFrame(frame *telemetry.LobbySessionStateFrame) error {
+	r.frames = append(r.frames, frame)
+	return nil
+}
+func (r *recordingWriter) Close()          { r.stopped = true }
+func (r *recordingWriter) IsStopped() bool { return r.stopped }
+
+func command(name, args string) ServerCommand {
+	cmd := ServerCommand{Type: MessageTypeCommand, ID: "1", Command: name}
+	if args != "" {
+		cmd.Args = json.RawMessage(args)
+	}
+	return cmd
+}
+
+func TestSessionController_SetRates(t *testing.T) {
+	c := NewSessionController(testLogger(t), "session", PollerConfig{FPS: 10, IdleFPS: 1}, nil)
+
+	tests := []struct {
+		name    string
+		cmd     ServerCommand
+		success bool
+	}{
+		{"set fps", command(CommandSetFPS, `{"fps":60}`), true},
+		{"fps too high", command(CommandSetFPS, `{"fps":1000}`), false},
+		{"fps zero", command(CommandSetFPS, `{"fps":0}`), false},
+		{"fps missing", command(CommandSetFPS, `{}`), false},
+		{"fps wrong type", command(CommandSetFPS, `{"fps":"fast"}`), false},
+		{"set idle fps", command(CommandSetIdleFPS, `{"idle_fps":0}`), true},
+		{"idle fps negative", command(CommandSetIdleFPS, `{"idle_fps":-1}`), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ack := c.HandleCommand(tt.cmd)
+			if ack.Success != tt.success {
+				t.Errorf("HandleCommand(%s) success = %v, want %v (error: %s)", tt.cmd.Args, ack.Success, tt.success, ack.Error)
+			}
+			if ack.ID != tt.cmd.ID || ack.Type != MessageTypeCommandAck {
+				t.Errorf("ack does not echo command: %+v", ack)
+			}
+		})
+	}
+
+	fps, idleFPS := c.Rates()
+	if fps != 60 || idleFPS != 0 {
+		t.Errorf("Rates() = %d, %d, want 60, 0", fps, idleFPS)
+	}
+
+	select {
+	case <-c.Changed():
+	default:
+		t.Error("expected rate change to be signalled")
+	}
+}
+
+func TestSessionController_SetBones(t *testing.T) {
+	c := NewSessionController(testLogger(t), "session", PollerConfig{ExcludeBones: true}, nil)
+
+	if ack := c.HandleCommand(command(CommandSetBones, `{"enabled":true}`)); !ack.Success {
+		t.Fatalf("set_bones failed: %s", ack.Error)
+	}
+	if c.ExcludeBones() {
+		t.Error("ExcludeBones() = true after enabling bones")
+	}
+
+	if ack := c.HandleCommand(command(CommandSetBones, `{}`)); ack.Success {
+		t.Error("set_bones without enabled should fail")
+	}
+}
+
+func TestSessionController_Recording(t *testing.T) {
+	writer := &recordingWriter{}
+	var gotFormat string
+	factory := func(format string) (FrameWriter, string, error) {
+		gotFormat = format
+		return writer, "/tmp/rec." + format, nil
+	}
+	c := NewSessionController(testLogger(t), "session", PollerConfig{}, factory)
+
+	if ack := c.HandleCommand(command(CommandStopRecording, "")); ack.Success {
+		t.Error("stop_recording without a recording should fail")
+	}
+	if ack := c.HandleCommand(command(CommandStartRecording, `{"format":"zip"}`)); ack.Success {
+		t.Error("start_recording with unsupported format should fail")
+	}
+
+	ack := c.HandleCommand(command(CommandStartRecording, `{"format":"nevrcap"}`))
+	if !ack.Success {
+		t.Fatalf("start_recording failed: %s", ack.Error)
+	}
+	if gotFormat != "nevrcap" {
+		t.Errorf("factory format = %q, want nevrcap", gotFormat)
+	}
+	if ack := c.HandleCommand(command(CommandStartRecording, "")); ack.Success {
+		t.Error("second start_recording should fail while recording")
+	}
+
+	frame := &telemetry.LobbySessionStateFrame{FrameIndex: 7, PlayerBones: &enginev1.PlayerBonesResponse{}}
+	c.ObserveFrame(frame)
+	if len(writer.frames) != 1 {
+		t.Fatalf("recorder received %d frames, want 1", len(writer.frames))
+	}
+
+	// The poller strips bones from its frame after observing it
+	frame.PlayerBones = nil
+	if writer.frames[0] == frame || writer.frames[0].GetPlayerBones() == nil {
+		t.Error("recorder shares the poller's frame")
+	}
+	ack = c.HandleCommand(command(CommandSnapshot, ""))
+	if !ack.Success || !strings.Contains(string(ack.Result.(json.RawMessage)), "player_bones") {
+		t.Errorf("snapshot lost the observed bones: %+v", ack)
+	}
+
+	if ack := c.HandleCommand(command(CommandStopRecording, "")); !ack.Success {
+		t.Fatalf("stop_recording failed: %s", ack.Error)
+	}
+	if !writer.stopped {
+		t.Error("recorder was not closed")
+	}
+
+	c.ObserveFrame(&telemetry.LobbySessionStateFrame{FrameIndex: 8})
+	if len(writer.frames) != 1 {
+		t.Errorf("recorder received frames after stop")
+	}
+}
+
+func TestSessionController_RecordingFactoryError(t *testing.T) {
+	factory := func(format string) (FrameWriter, string, error) {
+		return nil, "", errors.New("disk full")
+	}
+	c := NewSessionController(testLogger(t), "session", PollerConfig{}, factory)
+
+	ack := c.HandleCommand(command(CommandStartRecording, `{"format":"tape"}`))
+	if ack.Success || !strings.Contains(ack.Error, "disk full") {
+		t.Errorf("expected factory error in ack, got %+v", ack)
+	}
+}
+
+func TestSessionController_StatusAndUnknown(t *testing.T) {
+	c := NewSessionController(testLogger(t), "session-abc", PollerConfig{FPS: 30}, nil)
+
+	if ack := c.HandleCommand(command(CommandSnapshot, "")); ack.Success {
+		t.Error("snapshot before any frame should fail")
+	}
+
+	c.ObserveFrame(&telemetry.LobbySessionStateFrame{FrameIndex: 3})
+
+	ack := c.HandleCommand(command(CommandStatus, ""))
+	if !ack.Success {
+		t.Fatalf("status failed: %s", ack.Error)
+	}
+	status, ok := ack.Result.(map[string]any)
+	if !ok {
+		t.Fatalf("status result has type %T", ack.Result)
+	}
+	if status["session_id"] != "session-abc" || status["fps"] != 30 || status["frames_observed"] != uint64(1) {
+		t.Errorf("unexpected status: %v", status)
+	}
+
+	if ack := c.HandleCommand(command("reboot", "")); ack.Success || !strings.Contains(ack.Error, ErrUnknownCommand.Error()) {
+		t.Errorf("expected unknown command error, got %+v", ack)
+	}
+}
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	"github.com/echotools/tape/pkg/codec"
+)
+
+// EchoReplayStreamWriter writes an .echoreplay archive to a non-seekable
+// stream such as stdout. The zip entry uses data descriptors, so nothing is
+// buffered beyond the current chunk.
+type EchoReplayStreamWriter struct {
+	zw    *zip.Writer
+	entry io.Writer
+	buf   *bytes.Buffer
+
+	// formatter only renders replay lines; its file is never written to
+	formatter *codec.EchoReplay
+	tempDir   string
+}
+
+// NewEchoReplayStreamWriter creates an .echoreplay writer on w. name is the
+// file name of the replay entry inside the archive. Close finishes the
+// archive but does not close w.
+func NewEchoReplayStreamWriter(w io.Writer, name string) (*EchoReplayStreamWriter, error) {
+	tempDir, err := os.MkdirTemp("", "echoreplay-stream-")
+	if err != nil {
+		return nil, err
+	}
+	formatter, err := codec.NewEchoReplayWriter(filepath.Join(tempDir, name))
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return nil, fmt.Errorf("failed to create EchoReplayCodecWriter: %w", err)
+	}
+
+	zw := zip.NewWriter(w)
+	zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, flate.BestCompression)
+	})
+	entry, err := zw.Create(name)
+	if err != nil {
+		os.RemoveAll(tempDir)
+		return nil, err
+	}
+
+	return &EchoReplayStreamWriter{
+		zw:        zw,
+		entry:     entry,
+		buf:       bytes.NewBuffer(make([]byte, 0, 64*1024)),
+		formatter: formatter,
+		tempDir:   tempDir,
+	}, nil
+}
+
+// WriteFrame appends a frame as a replay line.
+func (w *EchoReplayStreamWriter) WriteFrame(frame *telemetry.LobbySessionStateFrame) error {
+	w.formatter.WriteReplayFrame(w.buf, frame)
+	if w.buf.Len() >= zipFileChunkSize {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *EchoReplayStreamWriter) flush() error {
+	if _, err := w.entry.Write(w.buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write data to zip stream: %w", err)
+	}
+	w.buf.Reset()
+	return nil
+}
+
+// Close writes any buffered lines and the zip central directory.
+func (w *EchoReplayStreamWriter) Close() error {
+	var flushErr error
+	if w.buf.Len() > 0 {
+		flushErr = w.flush()
+	}
+	zipErr := w.zw.Close()
+	w.formatter.Close()
+	os.RemoveAll(w.tempDir)
+	return errors.Join(flushErr, zipErr)
+}
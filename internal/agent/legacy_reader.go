@@ -0,0 +1,105 @@
+package agent
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxLegacyMessageSize bounds a single delimited message so that a corrupt
+// length prefix cannot trigger a huge allocation.
+const maxLegacyMessageSize = 64 * 1024 * 1024
+
+// LegacyStreamReader reads the legacy nevrcap format written by LegacyWriter
+// from an arbitrary stream, such as stdin. The stream is read sequentially and
+// never seeked.
+type LegacyStreamReader struct {
+	decoder *zstd.Decoder
+	r       *bufio.Reader
+}
+
+// NewLegacyStreamReader creates a nevrcap reader on r. Close releases the
+// decoder but does not close r.
+func NewLegacyStreamReader(r io.Reader) (*LegacyStreamReader, error) {
+	decoder, err := zstd.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &LegacyStreamReader{
+		decoder: decoder,
+		r:       bufio.NewReaderSize(decoder, 64*1024),
+	}, nil
+}
+
+// NewUncompressedLegacyStreamReader reads nevrcap data that was stored
+// without zstd compression, as in .nevrcap.uncompressed files.
+func NewUncompressedLegacyStreamReader(r io.Reader) *LegacyStreamReader {
+	return &LegacyStreamReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// ReadHeader reads the telemetry header. It must be called before the first
+// ReadFrame.
+func (r *LegacyStreamReader) ReadHeader() (*telemetry.TelemetryHeader, error) {
+	data, err := r.readDelimitedMessage()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	header := &telemetry.TelemetryHeader{}
+	if err := proto.Unmarshal(data, header); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal header: %w", err)
+	}
+	return header, nil
+}
+
+// ReadFrame reads the next frame, returning io.EOF after the last one.
+func (r *LegacyStreamReader) ReadFrame() (*telemetry.LobbySessionStateFrame, error) {
+	data, err := r.readDelimitedMessage()
+	if err != nil {
+		return nil, err
+	}
+	frame := &telemetry.LobbySessionStateFrame{}
+	if err := proto.Unmarshal(data, frame); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal frame: %w", err)
+	}
+	return frame, nil
+}
+
+func (r *LegacyStreamReader) readDelimitedMessage() ([]byte, error) {
+	length, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		// A clean end of stream only happens between messages
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to read message length: %w", err)
+	}
+	if length > maxLegacyMessageSize {
+		return nil, fmt.Errorf("message length %d exceeds limit", length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("failed to read message: %w", err)
+	}
+	return data, nil
+}
+
+// Close releases the zstd decoder, if any.
+func (r *LegacyStreamReader) Close() error {
+	if r.decoder != nil {
+		r.decoder.Close()
+	}
+	return nil
+}
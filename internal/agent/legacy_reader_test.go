@@ -0,0 +1,141 @@
+package agent
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestLegacyStream_RoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	writer, err := NewLegacyStreamWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteHeader(&telemetry.TelemetryHeader{CaptureId: "test-session"}); err != nil {
+		t.Fatal(err)
+	}
+	baseTime := time.Date(2026, 6, 24, 15, 30, 45, 0, time.UTC)
+	for i := uint32(0); i < 3; i++ {
+		if err := writer.WriteFrame(makeFrame(t, "test-session", i, baseTime.Add(time.Duration(i)*time.Second))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewLegacyStreamReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	header, err := reader.ReadHeader()
+	if err != nil {
+		t.Fatalf("ReadHeader: %v", err)
+	}
+	if header.GetCaptureId() != "test-session" {
+		t.Errorf("capture ID = %q", header.GetCaptureId())
+	}
+	for i := uint32(0); ; i++ {
+		frame, err := reader.ReadFrame()
+		if errors.Is(err, io.EOF) {
+			if i != 3 {
+				t.Errorf("read %d frames, want 3", i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadFrame(%d): %v", i, err)
+		}
+		if frame.GetFrameIndex() != i {
+			t.Errorf("frame %d has index %d", i, frame.GetFrameIndex())
+		}
+	}
+}
+
+func TestUncompressedLegacyStreamReader(t *testing.T) {
+	var compressed bytes.Buffer
+	writer, err := NewLegacyStreamWriter(&compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.WriteHeader(&telemetry.TelemetryHeader{CaptureId: "test-session"}); err != nil {
+		t.Fatal(err)
+	}
+	baseTime := time.Date(2026, 6, 24, 15, 30, 45, 0, time.UTC)
+	if err := writer.WriteFrame(makeFrame(t, "test-session", 0, baseTime)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	decoder, err := zstd.NewReader(&compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := io.ReadAll(decoder)
+	decoder.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := NewUncompressedLegacyStreamReader(bytes.NewReader(raw))
+	defer reader.Close()
+	header, err := reader.ReadHeader()
+	if err != nil || header.GetCaptureId() != "test-session" {
+		t.Fatalf("ReadHeader() = %v, %v", header, err)
+	}
+	if _, err := reader.ReadFrame(); err != nil {
+		t.Fatalf("ReadFrame: %v", err)
+	}
+	if _, err := reader.ReadFrame(); !errors.Is(err, io.EOF) {
+		t.Errorf("ReadFrame after the last frame = %v, want io.EOF", err)
+	}
+}
+
+func TestEchoReplayStreamWriter(t *testing.T) {
+	// Hide bytes.Buffer's other methods so the writer only sees an io.Writer
+	var buf bytes.Buffer
+	writer, err := NewEchoReplayStreamWriter(struct{ io.Writer }{&buf}, "stream.echoreplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseTime := time.Date(2026, 6, 24, 15, 30, 45, 0, time.UTC)
+	for i := uint32(0); i < 3; i++ {
+		if err := writer.WriteFrame(makeFrame(t, "test-session", i, baseTime.Add(time.Duration(i)*time.Second))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("output is not a valid zip archive: %v", err)
+	}
+	if len(archive.File) != 1 || archive.File[0].Name != "stream.echoreplay" {
+		t.Fatalf("unexpected archive entries: %v", archive.File)
+	}
+	entry, err := archive.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer entry.Close()
+	data, err := io.ReadAll(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(data, []byte("\n")); lines != 3 {
+		t.Errorf("entry has %d lines, want 3", lines)
+	}
+}
@@ -2,6 +2,7 @@ package agent
 
 import (
 	"errors"
+	"io"
 	"os"
 
 	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
@@ -12,7 +13,7 @@ import (
 // LegacyWriter writes v1 telemetry data in the legacy nevrcap format:
 // zstd-compressed, varint-length-delimited protobuf messages.
 type LegacyWriter struct {
-	file    *os.File
+	file    io.Closer
 	encoder *zstd.Encoder
 }
 
@@ -23,13 +24,23 @@ func NewLegacyWriter(filename string) (*LegacyWriter, error) {
 		return nil, err
 	}
 
-	encoder, err := zstd.NewWriter(file, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	w, err := NewLegacyStreamWriter(file)
 	if err != nil {
 		return nil, errors.Join(err, file.Close())
 	}
+	w.file = file
+	return w, nil
+}
+
+// NewLegacyStreamWriter creates a nevrcap writer on an arbitrary stream, such
+// as stdout. Close flushes the stream but does not close it.
+func NewLegacyStreamWriter(w io.Writer) (*LegacyWriter, error) {
+	encoder, err := zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	if err != nil {
+		return nil, err
+	}
 
 	return &LegacyWriter{
-		file:    file,
 		encoder: encoder,
 	}, nil
 }
@@ -71,7 +82,7 @@ func (w *LegacyWriter) writeDelimitedMessage(data []byte) error {
 	return err
 }
 
-// Close closes the zstd encoder and underlying file.
+// Close closes the zstd encoder and, for file writers, the underlying file.
 func (w *LegacyWriter) Close() error {
 	var encErr error
 	if w.encoder != nil {
@@ -24,6 +24,10 @@ type PollerConfig struct {
 	ActiveOnly    bool     // Only stream frames during active gameplay
 	ExcludePaused bool     // Exclude paused frames (only with ActiveOnly)
 	IdleFPS       int      // Frame rate for non-gametime frames
+
+	// Controller, if set, supplies runtime overrides for FPS, IdleFPS and
+	// ExcludeBones and receives every processed frame.
+	Controller *SessionController
 }
 
 // shouldStreamMode checks if the given match_type should be streamed based on include/exclude filters
@@ -76,19 +80,39 @@ func NewHTTPFramePoller(ctx context.Context, logger *zap.Logger, client *http.Cl
 
 	// Start a goroutine to fetch data from the URLs at the specified interval
 
-	// Use FPS override if specified
-	if pollerCfg.FPS > 0 {
-		interval = time.Second / time.Duration(pollerCfg.FPS)
+	var (
+		baseInterval = interval
+		fps          = pollerCfg.FPS
+		idleFPS      = pollerCfg.IdleFPS
+		idleInterval time.Duration
+		changedCh    <-chan struct{}
+	)
+
+	controller := pollerCfg.Controller
+	if controller != nil {
+		fps, idleFPS = controller.Rates()
+		changedCh = controller.Changed()
+		defer controller.Close()
 	}
 
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+	// computeIntervals derives the active and idle polling intervals from the current rates
+	computeIntervals := func() {
+		// Use FPS override if specified
+		interval = baseInterval
+		if fps > 0 {
+			interval = time.Second / time.Duration(fps)
+		}
 
-	// Calculate idle interval for non-gametime frames
-	idleInterval := interval
-	if pollerCfg.IdleFPS > 0 {
-		idleInterval = time.Second / time.Duration(pollerCfg.IdleFPS)
+		// Calculate idle interval for non-gametime frames
+		idleInterval = interval
+		if idleFPS > 0 {
+			idleInterval = time.Second / time.Duration(idleFPS)
+		}
 	}
+	computeIntervals()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
 	var (
 		wg                sync.WaitGroup
@@ -121,6 +145,18 @@ func NewHTTPFramePoller(ctx context.Context, logger *zap.Logger, client *http.Cl
 		case <-timeoutTimer.C:
 			logger.Debug("HTTP frame poller timeout, stopping", zap.Int("request_count", requestCount), zap.Int("data_written", dataWritten))
 			return
+		case <-changedCh:
+			fps, idleFPS = controller.Rates()
+			computeIntervals()
+			if isIdle && idleFPS > 0 && idleFPS != fps {
+				ticker.Reset(idleInterval)
+			} else {
+				ticker.Reset(interval)
+			}
+			logger.Info("Polling rate changed by server command",
+				zap.Int("fps", fps),
+				zap.Int("idle_fps", idleFPS))
+			continue
 		case <-ticker.C:
 		}
 
@@ -203,6 +239,10 @@ func NewHTTPFramePoller(ctx context.Context, logger *zap.Logger, client *http.Cl
 			// No events detected
 		}
 
+		if controller != nil {
+			controller.ObserveFrame(frame)
+		}
+
 		// Apply frame filtering based on PollerConfig
 		var gameStatus string
 		var matchType string
@@ -236,7 +276,11 @@ func NewHTTPFramePoller(ctx context.Context, logger *zap.Logger, client *http.Cl
 		}
 
 		// Exclude bones if configured
-		if pollerCfg.ExcludeBones {
+		excludeBones := pollerCfg.ExcludeBones
+		if controller != nil {
+			excludeBones = controller.ExcludeBones()
+		}
+		if excludeBones {
 			frame.PlayerBones = nil
 		}
 
@@ -244,7 +288,7 @@ func NewHTTPFramePoller(ctx context.Context, logger *zap.Logger, client *http.Cl
 		newIsIdle := !isActiveGameplay(gameStatus)
 		if newIsIdle != isIdle {
 			isIdle = newIsIdle
-			if isIdle && pollerCfg.IdleFPS > 0 && pollerCfg.IdleFPS != pollerCfg.FPS {
+			if isIdle && idleFPS > 0 && idleFPS != fps {
 				ticker.Reset(idleInterval)
 				logger.Debug("Switched to idle polling rate", zap.Duration("interval", idleInterval))
 			} else if !isIdle {
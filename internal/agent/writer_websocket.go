@@ -2,18 +2,24 @@ package agent
 
 import (
 	"bufio"
+	"bytes"
+	"compress/flate"
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
 	"github.com/gorilla/websocket"
+	"github.com/klauspost/compress/zstd"
 	"go.uber.org/zap"
 	"google.golang.org/protobuf/encoding/protojson"
 )
@@ -26,11 +32,20 @@ const (
 
 	// Buffer settings
 	memoryBufferSize     = 1000                  // Max frames to keep in memory
+	controlBufferSize    = 16                    // Max pending control messages (command acks)
 	diskBufferThreshold  = 3 * time.Second       // Start disk buffering after this duration
 	catchUpBatchSize     = 100                   // Frames to send per batch when catching up
 	catchUpBatchInterval = 10 * time.Millisecond // Delay between catch-up batches
+	closeFlushTimeout    = 5 * time.Second       // Max time Close waits for the write loop to send pending frames
 )
 
+// outgoingMessage is an entry of the outgoing stream: a frame, or a marker
+// that is sent as-is at its position between the frames.
+type outgoingMessage struct {
+	frame  *telemetry.LobbySessionStateFrame
+	marker []byte
+}
+
 // WebSocketWriter implements FrameWriter and streams frames to the API server over WebSocket.
 type WebSocketWriter struct {
 	logger     *zap.Logger
@@ -38,11 +53,33 @@ type WebSocketWriter struct {
 	jwtToken   string
 	ctx        context.Context
 	cancel     context.CancelFunc
+	dialer     *websocket.Dialer
 	conn       *websocket.Conn
 	mu         sync.Mutex
-	outgoingCh chan *telemetry.LobbySessionStateFrame
+	writeMu    sync.Mutex // Serializes writes from the write loop and disk buffer drain
+	outgoingCh chan outgoingMessage
+	controlCh  chan []byte
 	stopped    bool
 	connected  bool
+	writeDone  chan struct{} // Closed when the current write loop exits
+
+	// Server command handling
+	commandHandler CommandHandler
+
+	// Batching and compression
+	batch       BatchConfig
+	zstdEncoder *zstd.Encoder
+
+	// Adaptive streaming rate
+	adaptive      AdaptiveRateConfig
+	rateLevel     int // Index into adaptive.Levels, -1 = full rate
+	lastAdmitted  time.Time
+	framesSkipped uint64
+	sendLatency   atomic.Int64 // Moving average of frame write durations (ns)
+
+	// Markers that did not fit into outgoingCh, queued ahead of the next frame
+	markerMu       sync.Mutex
+	pendingMarkers [][]byte
 
 	// Reconnection state
 	reconnectCh    chan struct{}
@@ -54,6 +91,7 @@ type WebSocketWriter struct {
 	diskBufferPath  string
 	usingDiskBuffer bool
 	diskFrameCount  int64
+	diskBufferSent  int64 // Bytes of the file already delivered by a drain
 }
 
 // NewWebSocketWriter creates a new WebSocketWriter.
@@ -66,14 +104,64 @@ func NewWebSocketWriter(logger *zap.Logger, socketURL, jwtToken string) *WebSock
 		jwtToken:    jwtToken,
 		ctx:         ctx,
 		cancel:      cancel,
-		outgoingCh:  make(chan *telemetry.LobbySessionStateFrame, memoryBufferSize),
+		dialer:      websocket.DefaultDialer,
+		outgoingCh:  make(chan outgoingMessage, memoryBufferSize),
+		controlCh:   make(chan []byte, controlBufferSize),
 		stopped:     false,
+		rateLevel:   -1,
 		reconnectCh: make(chan struct{}, 1),
 	}
 
 	return w
 }
 
+// NewWebSocketDialer creates a WebSocket dialer using the given TLS configuration
+// and proxy function. A nil tlsConfig keeps the Go defaults.
+func NewWebSocketDialer(tlsConfig *tls.Config, proxy func(*http.Request) (*url.URL, error)) *websocket.Dialer {
+	return &websocket.Dialer{
+		Proxy:            proxy,
+		TLSClientConfig:  tlsConfig,
+		HandshakeTimeout: 45 * time.Second,
+	}
+}
+
+// SetDialer replaces the dialer used to establish the connection.
+// It must be called before Connect.
+func (w *WebSocketWriter) SetDialer(dialer *websocket.Dialer) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.dialer = dialer
+}
+
+// SetCommandHandler registers the handler for commands sent by the server.
+// Without a handler, commands are acknowledged with an error.
+func (w *WebSocketWriter) SetCommandHandler(handler CommandHandler) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.commandHandler = handler
+}
+
+// SetBatching configures frame batching, compression and fast catch-up.
+// It must be called before Connect.
+func (w *WebSocketWriter) SetBatching(cfg BatchConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.batch = cfg
+	if cfg.Compression == CompressionZstd || (cfg.FastCatchUp && cfg.Compression != CompressionDeflate) {
+		encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		if err != nil {
+			return fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		w.zstdEncoder = encoder
+	}
+	return nil
+}
+
 // Connect establishes the WebSocket connection.
 func (w *WebSocketWriter) Connect() error {
 	w.mu.Lock()
@@ -108,10 +196,20 @@ func (w *WebSocketWriter) connectLocked() error {
 
 	w.logger.Info("Connecting to WebSocket", zap.String("url", u.String()))
 
-	conn, _, err := websocket.DefaultDialer.DialContext(w.ctx, u.String(), header)
+	dialer := *w.dialer
+	dialer.EnableCompression = w.batch.Compression == CompressionDeflate
+
+	conn, _, err := dialer.DialContext(w.ctx, u.String(), header)
 	if err != nil {
 		return fmt.Errorf("failed to dial websocket: %w", err)
 	}
+	if dialer.EnableCompression {
+		// No-op unless the server accepted permessage-deflate
+		conn.EnableWriteCompression(true)
+		if err := conn.SetCompressionLevel(flate.BestSpeed); err != nil {
+			w.logger.Warn("Failed to set compression level", zap.Error(err))
+		}
+	}
 
 	w.conn = conn
 	w.connected = true
@@ -119,8 +217,9 @@ func (w *WebSocketWriter) connectLocked() error {
 	w.logger.Debug("WebSocket connection established, starting background routines", zap.String("url", u.String()))
 
 	// Start background routines
+	w.writeDone = make(chan struct{})
 	go w.readLoop()
-	go w.writeLoop()
+	go w.writeLoop(w.writeDone)
 	go w.reconnectLoop()
 
 	return nil
@@ -204,8 +303,21 @@ func (w *WebSocketWriter) WriteFrame(frame *telemetry.LobbySessionStateFrame) er
 		return fmt.Errorf("writer is stopped")
 	}
 
+	// Thin out frames while the adaptive rate is lowered
+	if !w.admitFrame() {
+		return nil
+	}
+
+	// Held markers go first, so a frame never overtakes a rate change
+	w.markerMu.Lock()
+	defer w.markerMu.Unlock()
+	if !w.flushMarkersLocked() {
+		w.logger.Warn("Outgoing channel full, dropping frame")
+		return fmt.Errorf("outgoing channel full")
+	}
+
 	select {
-	case w.outgoingCh <- frame:
+	case w.outgoingCh <- outgoingMessage{frame: frame}:
 		return nil
 	case <-w.ctx.Done():
 		return w.ctx.Err()
@@ -215,21 +327,34 @@ func (w *WebSocketWriter) WriteFrame(frame *telemetry.LobbySessionStateFrame) er
 	}
 }
 
-// Close stops the writer and closes the connection.
+// Close stops the writer and closes the connection. Frames still pending in
+// a batch are sent first.
 func (w *WebSocketWriter) Close() {
 	w.mu.Lock()
-	defer w.mu.Unlock()
-
 	if w.stopped {
+		w.mu.Unlock()
 		return
 	}
-
 	w.stopped = true
 	w.cancel()
+	writeDone := w.writeDone
+	w.mu.Unlock()
 
+	// The write loop flushes its pending batch on cancellation, so keep the
+	// connection open until it is done
+	if writeDone != nil {
+		select {
+		case <-writeDone:
+		case <-time.After(closeFlushTimeout):
+			w.logger.Warn("Timed out waiting for pending frames to be sent")
+		}
+	}
+
+	w.mu.Lock()
 	if w.conn != nil {
 		w.conn.Close()
 	}
+	w.mu.Unlock()
 
 	// Clean up disk buffer
 	go w.cleanupDiskBuffer()
@@ -283,6 +408,10 @@ func (w *WebSocketWriter) readLoop() {
 		// Parse response (optional, mostly for acks/errors)
 		var response map[string]interface{}
 		if err := json.Unmarshal(message, &response); err == nil {
+			if msgType, _ := response["type"].(string); msgType == MessageTypeCommand {
+				w.handleCommand(message)
+				continue
+			}
 			if success, ok := response["success"].(bool); ok && !success {
 				if errMsg, ok := response["error"].(string); ok {
 					w.logger.Error("Server returned error", zap.String("error", errMsg))
@@ -292,11 +421,138 @@ func (w *WebSocketWriter) readLoop() {
 	}
 }
 
-func (w *WebSocketWriter) writeLoop() {
+// handleCommand decodes a server command, applies it and queues the acknowledgement.
+func (w *WebSocketWriter) handleCommand(message []byte) {
+	var cmd ServerCommand
+	if err := json.Unmarshal(message, &cmd); err != nil {
+		w.logger.Warn("Failed to decode server command", zap.Error(err))
+		return
+	}
+
+	w.mu.Lock()
+	handler := w.commandHandler
+	w.mu.Unlock()
+
+	var ack CommandAck
+	if handler == nil {
+		ack = CommandAck{
+			Type:    MessageTypeCommandAck,
+			ID:      cmd.ID,
+			Command: cmd.Command,
+			Error:   "commands are not supported by this session",
+		}
+	} else {
+		ack = handler.HandleCommand(cmd)
+	}
+
+	if cmd.Command == CommandStatus && ack.Success {
+		if status, ok := ack.Result.(map[string]any); ok {
+			status["stream"] = w.streamStatus()
+		}
+	}
+
+	data, err := json.Marshal(ack)
+	if err != nil {
+		w.logger.Error("Failed to marshal command ack", zap.Error(err))
+		return
+	}
+	w.sendControl(data)
+}
+
+// enqueueMarker queues a marker in the frame stream, so it is delivered in
+// order with the frames around it, including from the disk buffer. A marker
+// that does not fit is held and queued ahead of the next frame.
+func (w *WebSocketWriter) enqueueMarker(data []byte) {
+	w.markerMu.Lock()
+	defer w.markerMu.Unlock()
+	w.pendingMarkers = append(w.pendingMarkers, data)
+	if !w.flushMarkersLocked() {
+		w.logger.Debug("Outgoing channel full, holding marker", zap.Int("held", len(w.pendingMarkers)))
+	}
+}
+
+// flushMarkersLocked queues the held markers in order and reports whether all
+// of them fit. w.markerMu must be held.
+func (w *WebSocketWriter) flushMarkersLocked() bool {
+	for len(w.pendingMarkers) > 0 {
+		select {
+		case w.outgoingCh <- outgoingMessage{marker: w.pendingMarkers[0]}:
+			w.pendingMarkers = w.pendingMarkers[1:]
+		default:
+			return false
+		}
+	}
+	w.pendingMarkers = nil
+	return true
+}
+
+// sendControl queues a control message to be written by the write loop.
+func (w *WebSocketWriter) sendControl(data []byte) {
+	select {
+	case w.controlCh <- data:
+	default:
+		w.logger.Warn("Control channel full, dropping message")
+	}
+}
+
+// streamStatus reports the state of the outgoing stream.
+func (w *WebSocketWriter) streamStatus() map[string]any {
+	w.mu.Lock()
+	connected := w.connected
+	batch := w.batch
+	adaptive := w.adaptive.Enabled()
+	streamFPS := w.streamFPSLocked()
+	framesSkipped := w.framesSkipped
+	w.mu.Unlock()
+
+	w.diskBufferMu.Lock()
+	usingDisk := w.usingDiskBuffer
+	diskFrames := w.diskFrameCount
+	w.diskBufferMu.Unlock()
+
+	return map[string]any{
+		"connected":          connected,
+		"queue_depth":        len(w.outgoingCh),
+		"queue_capacity":     cap(w.outgoingCh),
+		"disk_buffering":     usingDisk,
+		"disk_frames_queued": diskFrames,
+		"batch_window":       batch.Window.String(),
+		"compression":        batch.Compression,
+		"fast_catch_up":      batch.FastCatchUp,
+		"adaptive_fps":       adaptive,
+		"stream_fps":         streamFPS,
+		"frames_skipped":     framesSkipped,
+		"send_latency_ms":    time.Duration(w.sendLatency.Load()).Milliseconds(),
+	}
+}
+
+// writeMessage writes a message with a deadline. Writes are serialized because
+// the disk buffer drain runs alongside the write loop.
+func (w *WebSocketWriter) writeMessage(conn *websocket.Conn, messageType int, data []byte) error {
+	w.writeMu.Lock()
+	defer w.writeMu.Unlock()
+
+	conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return conn.WriteMessage(messageType, data)
+}
+
+// catchUpCompression returns the compression used for fast catch-up batches.
+// Without permessage-deflate, catch-up batches are always zstd-compressed.
+func (w *WebSocketWriter) catchUpCompression() string {
+	if w.batch.Compression == CompressionDeflate {
+		return CompressionDeflate
+	}
+	return CompressionZstd
+}
+
+// writeLoop sends queued frames and control messages until the writer is
+// closed or a write fails. After a failed write, frames that could not be sent
+// stay in the disk buffer for the reconnected loop; done is closed on exit.
+func (w *WebSocketWriter) writeLoop(done chan struct{}) {
 	ticker := time.NewTicker(50 * time.Second) // Keep-alive ping
 	defer func() {
 		ticker.Stop()
-		w.cleanupDiskBuffer()
+		close(done)
 		w.logger.Debug("Write loop stopped")
 	}()
 
@@ -306,9 +562,29 @@ func (w *WebSocketWriter) writeLoop() {
 		EmitUnpopulated: false,
 	}
 
+	w.mu.Lock()
+	batchCfg := w.batch
+	w.mu.Unlock()
+
+	// Pending frames are sent when the batch window expires or a limit is reached
+	var (
+		batch      *frameBatch
+		flushTimer *time.Timer
+		flushC     <-chan time.Time
+	)
+	if batchCfg.Enabled() {
+		batch = newFrameBatch(batchCfg.MaxFrames, batchCfg.MaxBytes)
+		flushTimer = time.NewTimer(batchCfg.Window)
+		flushTimer.Stop()
+		defer flushTimer.Stop()
+	}
+
 	for {
 		select {
 		case <-w.ctx.Done():
+			if batch != nil {
+				w.flushBatch(batch)
+			}
 			return
 
 		case <-ticker.C:
@@ -321,7 +597,7 @@ func (w *WebSocketWriter) writeLoop() {
 				continue
 			}
 
-			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			if err := w.writeMessage(conn, websocket.PingMessage, nil); err != nil {
 				w.logger.Warn("Failed to send ping, triggering reconnect", zap.Error(err))
 				w.mu.Lock()
 				w.connected = false
@@ -331,7 +607,35 @@ func (w *WebSocketWriter) writeLoop() {
 				return
 			}
 
-		case frame := <-w.outgoingCh:
+		case data := <-w.controlCh:
+			w.mu.Lock()
+			conn := w.conn
+			connected := w.connected
+			w.mu.Unlock()
+
+			if !connected || conn == nil {
+				// The server re-sends unacknowledged commands after reconnecting
+				w.logger.Debug("Dropping control message while disconnected")
+				continue
+			}
+
+			if err := w.writeMessage(conn, websocket.TextMessage, data); err != nil {
+				w.logger.Warn("Failed to write control message, triggering reconnect", zap.Error(err))
+				w.mu.Lock()
+				w.connected = false
+				w.disconnectedAt = time.Now()
+				w.mu.Unlock()
+				w.triggerReconnect()
+				return
+			}
+
+		case <-flushC:
+			flushC = nil
+			if !w.flushBatch(batch) {
+				return
+			}
+
+		case msg := <-w.outgoingCh:
 			w.mu.Lock()
 			conn := w.conn
 			connected := w.connected
@@ -341,15 +645,19 @@ func (w *WebSocketWriter) writeLoop() {
 			if !connected || conn == nil {
 				// Check if we should switch to disk buffering
 				if !disconnectedAt.IsZero() && time.Since(disconnectedAt) > diskBufferThreshold {
-					if err := w.bufferToDisk(frame, &marshaler); err != nil {
+					if err := w.bufferToDisk(msg, &marshaler); err != nil {
 						w.logger.Warn("Failed to buffer frame to disk", zap.Error(err))
 					}
 				} else {
 					// Still in memory buffer phase, re-queue the frame
 					select {
-					case w.outgoingCh <- frame:
+					case w.outgoingCh <- msg:
 					default:
-						w.logger.Warn("Dropping frame while disconnected, buffer full")
+						if msg.marker != nil {
+							w.enqueueMarker(msg.marker)
+						} else {
+							w.logger.Warn("Dropping frame while disconnected, buffer full")
+						}
 					}
 				}
 				time.Sleep(100 * time.Millisecond)
@@ -357,30 +665,54 @@ func (w *WebSocketWriter) writeLoop() {
 			}
 
 			// Log event count for debugging
-			if len(frame.Events) > 0 {
+			if frame := msg.frame; frame != nil && len(frame.Events) > 0 {
 				w.logger.Debug("Sending frame with events",
 					zap.Int("event_count", len(frame.Events)),
 					zap.Uint32("frame_index", frame.FrameIndex))
 			}
 
-			// Wrap frame in Envelope
-			envelope := &telemetry.Envelope{
-				Message: &telemetry.Envelope_Frame{
-					Frame: frame,
-				},
-			}
-
-			data, err := marshaler.Marshal(envelope)
+			data, err := w.marshalOutgoing(msg, &marshaler)
 			if err != nil {
 				w.logger.Error("Failed to marshal envelope", zap.Error(err))
 				continue
 			}
 
-			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			err = conn.WriteMessage(websocket.TextMessage, data)
+			if batch != nil {
+				if msg.marker == nil {
+					batch.add(data)
+					if batch.full() {
+						flushTimer.Stop()
+						flushC = nil
+						if !w.flushBatch(batch) {
+							return
+						}
+					} else if flushC == nil {
+						flushTimer.Reset(batchCfg.Window)
+						flushC = flushTimer.C
+					}
+					continue
+				}
+
+				// A marker is sent on its own, after the frames that preceded it
+				flushTimer.Stop()
+				flushC = nil
+				if !w.flushBatch(batch) {
+					w.spillToDisk([][]byte{data})
+					return
+				}
+			}
+
+			sendStart := time.Now()
+			err = w.writeMessage(conn, websocket.TextMessage, data)
+			if msg.frame != nil {
+				w.recordSendLatency(time.Since(sendStart))
+			}
 
 			if err != nil {
 				w.logger.Warn("Failed to write message, triggering reconnect", zap.Error(err))
+				if msg.marker != nil {
+					w.spillToDisk([][]byte{data})
+				}
 				w.mu.Lock()
 				w.connected = false
 				w.disconnectedAt = time.Now()
@@ -392,11 +724,108 @@ func (w *WebSocketWriter) writeLoop() {
 	}
 }
 
-// bufferToDisk writes a frame to the disk buffer file
-func (w *WebSocketWriter) bufferToDisk(frame *telemetry.LobbySessionStateFrame, marshaler *protojson.MarshalOptions) error {
+// flushBatch sends the pending frames as a single message. If the connection
+// is down or the write fails, the frames are moved to the disk buffer so they
+// are delivered after reconnecting. It returns false if the write loop must exit.
+func (w *WebSocketWriter) flushBatch(batch *frameBatch) bool {
+	if batch.len() == 0 {
+		return true
+	}
+	defer batch.reset()
+
+	w.mu.Lock()
+	conn := w.conn
+	connected := w.connected
+	compression := w.batch.Compression
+	w.mu.Unlock()
+
+	if !connected || conn == nil {
+		w.spillToDisk(batch.frames)
+		return true
+	}
+
+	messageType, payload, err := encodeFrameBatch(batch.frames, compression, w.zstdEncoder)
+	if err != nil {
+		w.logger.Error("Failed to encode frame batch", zap.Error(err))
+		return true
+	}
+
+	sendStart := time.Now()
+	err = w.writeMessage(conn, messageType, payload)
+	w.recordSendLatency(time.Since(sendStart))
+	if err != nil {
+		w.logger.Warn("Failed to write frame batch, triggering reconnect", zap.Error(err))
+		w.spillToDisk(batch.frames)
+		w.mu.Lock()
+		w.connected = false
+		w.disconnectedAt = time.Now()
+		w.mu.Unlock()
+		w.triggerReconnect()
+		return false
+	}
+
+	w.logger.Debug("Sent frame batch",
+		zap.Int("frames", batch.len()),
+		zap.Int("bytes", len(payload)),
+		zap.String("compression", compression))
+	return true
+}
+
+// spillToDisk appends marshaled envelopes to the disk buffer.
+func (w *WebSocketWriter) spillToDisk(frames [][]byte) {
+	for _, data := range frames {
+		if err := w.appendToDiskBuffer(data); err != nil {
+			w.logger.Warn("Failed to buffer frame to disk", zap.Error(err))
+			return
+		}
+	}
+}
+
+// bufferToDisk writes a frame or marker to the disk buffer file
+func (w *WebSocketWriter) bufferToDisk(msg outgoingMessage, marshaler *protojson.MarshalOptions) error {
+	data, err := w.marshalOutgoing(msg, marshaler)
+	if err != nil {
+		return fmt.Errorf("failed to marshal envelope: %w", err)
+	}
+
+	return w.appendToDiskBuffer(data)
+}
+
+// marshalOutgoing returns the wire form of a stream entry: a frame wrapped in
+// an Envelope, or the marker itself.
+func (w *WebSocketWriter) marshalOutgoing(msg outgoingMessage, marshaler *protojson.MarshalOptions) ([]byte, error) {
+	if msg.marker != nil {
+		return msg.marker, nil
+	}
+	envelope := &telemetry.Envelope{
+		Message: &telemetry.Envelope_Frame{
+			Frame: msg.frame,
+		},
+	}
+	return marshaler.Marshal(envelope)
+}
+
+// isStreamMarker reports whether a disk buffer line holds a marker rather
+// than a frame envelope. Markers are JSON objects led by their "type".
+func isStreamMarker(line []byte) bool {
+	return bytes.HasPrefix(line, []byte(`{"type":`))
+}
+
+// appendToDiskBuffer writes a marshaled envelope as a line of the disk buffer file
+func (w *WebSocketWriter) appendToDiskBuffer(data []byte) error {
 	w.diskBufferMu.Lock()
 	defer w.diskBufferMu.Unlock()
 
+	// Reopen a buffer that is still being drained, so undelivered lines stay
+	if w.diskBufferFile == nil && w.diskBufferPath != "" {
+		f, err := os.OpenFile(w.diskBufferPath, os.O_WRONLY|os.O_APPEND, 0)
+		if err != nil {
+			return fmt.Errorf("failed to reopen disk buffer file: %w", err)
+		}
+		w.diskBufferFile = f
+		w.logger.Info("Resumed disk buffering", zap.String("path", w.diskBufferPath))
+	}
+
 	// Create disk buffer file if not exists
 	if w.diskBufferFile == nil {
 		f, err := os.CreateTemp("", "nevr-frame-buffer-*.jsonl")
@@ -407,21 +836,10 @@ func (w *WebSocketWriter) bufferToDisk(frame *telemetry.LobbySessionStateFrame,
 		w.diskBufferPath = f.Name()
 		w.usingDiskBuffer = true
 		w.diskFrameCount = 0
+		w.diskBufferSent = 0
 		w.logger.Info("Started disk buffering", zap.String("path", w.diskBufferPath))
 	}
 
-	// Wrap frame in Envelope and marshal
-	envelope := &telemetry.Envelope{
-		Message: &telemetry.Envelope_Frame{
-			Frame: frame,
-		},
-	}
-
-	data, err := marshaler.Marshal(envelope)
-	if err != nil {
-		return fmt.Errorf("failed to marshal envelope: %w", err)
-	}
-
 	// Write as a line (JSONL format)
 	if _, err := w.diskBufferFile.Write(data); err != nil {
 		return fmt.Errorf("failed to write to disk buffer: %w", err)
@@ -438,29 +856,76 @@ func (w *WebSocketWriter) bufferToDisk(frame *telemetry.LobbySessionStateFrame,
 	return nil
 }
 
-// drainDiskBuffer reads and sends all buffered frames after reconnection
+// drainDiskBuffer reads and sends all buffered frames after reconnection. A
+// drain that is cut short resumes after the last delivered line.
 func (w *WebSocketWriter) drainDiskBuffer() {
-	w.diskBufferMu.Lock()
-	if !w.usingDiskBuffer || w.diskBufferFile == nil {
+	for {
+		w.diskBufferMu.Lock()
+		if !w.usingDiskBuffer || w.diskBufferPath == "" {
+			w.diskBufferMu.Unlock()
+			return
+		}
+
+		// Close the write handle; appends during the drain reopen the file
+		if w.diskBufferFile != nil {
+			w.diskBufferFile.Close()
+			w.diskBufferFile = nil
+		}
+		path := w.diskBufferPath
+		offset := w.diskBufferSent
+		frameCount := w.diskFrameCount
+		w.diskBufferMu.Unlock()
+
+		if !w.sendDiskBuffer(path, offset, frameCount) {
+			return
+		}
+
+		// Lines appended while draining are sent in another pass
+		w.diskBufferMu.Lock()
+		if info, err := os.Stat(path); err == nil && info.Size() > w.diskBufferSent {
+			w.diskBufferMu.Unlock()
+			continue
+		}
+		w.cleanupDiskBufferLocked()
 		w.diskBufferMu.Unlock()
 		return
 	}
+}
 
-	// Close the write handle and reopen for reading
-	w.diskBufferFile.Close()
-	path := w.diskBufferPath
-	frameCount := w.diskFrameCount
-	w.diskBufferMu.Unlock()
+// sendDiskBuffer sends the lines of the disk buffer file from offset on,
+// recording the delivered offset as it goes. It reports whether the end of
+// the file was reached.
+func (w *WebSocketWriter) sendDiskBuffer(path string, offset, frameCount int64) bool {
+	w.mu.Lock()
+	fastCatchUp := w.batch.FastCatchUp
+	w.mu.Unlock()
 
-	w.logger.Info("Draining disk buffer", zap.String("path", path), zap.Int64("frames", frameCount))
+	w.logger.Info("Draining disk buffer",
+		zap.String("path", path),
+		zap.Int64("frames", frameCount),
+		zap.Int64("offset", offset),
+		zap.Bool("fast_catch_up", fastCatchUp))
 
 	f, err := os.Open(path)
 	if err != nil {
 		w.logger.Error("Failed to open disk buffer for reading", zap.Error(err))
 		w.cleanupDiskBuffer()
-		return
+		return false
 	}
 	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		w.logger.Error("Failed to seek disk buffer", zap.Error(err))
+		return false
+	}
+
+	// read is the offset after the current line; pendingEnd after the last
+	// line of the pending batch
+	read, pendingEnd := offset, offset
+	delivered := func(end int64) {
+		w.diskBufferMu.Lock()
+		w.diskBufferSent = end
+		w.diskBufferMu.Unlock()
+	}
 
 	scanner := bufio.NewScanner(f)
 	// Increase buffer size for potentially large JSON lines
@@ -469,15 +934,14 @@ func (w *WebSocketWriter) drainDiskBuffer() {
 	sentCount := int64(0)
 	batchCount := 0
 
-	for scanner.Scan() {
-		select {
-		case <-w.ctx.Done():
-			w.logger.Warn("Context cancelled during disk buffer drain")
-			w.cleanupDiskBuffer()
-			return
-		default:
-		}
+	// In fast catch-up mode, lines are grouped into large compressed batches
+	// and sent without throttling.
+	var pending *frameBatch
+	if fastCatchUp {
+		pending = newFrameBatch(fastCatchUpMaxFrames, fastCatchUpMaxBytes)
+	}
 
+	send := func(messageType int, data []byte) bool {
 		w.mu.Lock()
 		conn := w.conn
 		connected := w.connected
@@ -486,20 +950,68 @@ func (w *WebSocketWriter) drainDiskBuffer() {
 		if !connected || conn == nil {
 			w.logger.Warn("Connection lost during disk buffer drain, aborting")
 			// Don't clean up - keep the buffer for next reconnect
-			return
+			return false
 		}
 
-		data := scanner.Bytes()
-		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-		if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		if err := w.writeMessage(conn, messageType, data); err != nil {
 			w.logger.Warn("Failed to send buffered frame, will retry on next reconnect", zap.Error(err))
 			w.mu.Lock()
 			w.connected = false
 			w.disconnectedAt = time.Now()
 			w.mu.Unlock()
 			w.triggerReconnect()
-			return
+			return false
 		}
+		return true
+	}
+
+	sendPending := func() bool {
+		if pending.len() == 0 {
+			return true
+		}
+		messageType, payload, err := encodeFrameBatch(pending.frames, w.catchUpCompression(), w.zstdEncoder)
+		if err != nil {
+			w.logger.Error("Failed to encode catch-up batch", zap.Error(err))
+			return false
+		}
+		if !send(messageType, payload) {
+			return false
+		}
+		sentCount += int64(pending.len())
+		pending.reset()
+		delivered(pendingEnd)
+		return true
+	}
+
+	for scanner.Scan() {
+		select {
+		case <-w.ctx.Done():
+			w.logger.Warn("Context cancelled during disk buffer drain")
+			w.cleanupDiskBuffer()
+			return false
+		default:
+		}
+
+		line := scanner.Bytes()
+		read += int64(len(line)) + 1
+
+		if pending != nil && !isStreamMarker(line) {
+			// The scanner reuses its buffer, so keep a copy of the line
+			pending.add(append([]byte(nil), line...))
+			pendingEnd = read
+			if pending.full() && !sendPending() {
+				return false
+			}
+			continue
+		}
+		if pending != nil && !sendPending() {
+			return false
+		}
+
+		if !send(websocket.TextMessage, line) {
+			return false
+		}
+		delivered(read)
 
 		sentCount++
 		batchCount++
@@ -515,15 +1027,23 @@ func (w *WebSocketWriter) drainDiskBuffer() {
 		w.logger.Error("Error reading disk buffer", zap.Error(err))
 	}
 
+	if pending != nil && !sendPending() {
+		return false
+	}
+
 	w.logger.Info("Disk buffer drained successfully", zap.Int64("frames_sent", sentCount))
-	w.cleanupDiskBuffer()
+	return true
 }
 
 // cleanupDiskBuffer removes the disk buffer file and resets state
 func (w *WebSocketWriter) cleanupDiskBuffer() {
 	w.diskBufferMu.Lock()
 	defer w.diskBufferMu.Unlock()
+	w.cleanupDiskBufferLocked()
+}
 
+// cleanupDiskBufferLocked is cleanupDiskBuffer with w.diskBufferMu held.
+func (w *WebSocketWriter) cleanupDiskBufferLocked() {
 	if w.diskBufferFile != nil {
 		w.diskBufferFile.Close()
 		w.diskBufferFile = nil
@@ -540,4 +1060,5 @@ func (w *WebSocketWriter) cleanupDiskBuffer() {
 
 	w.usingDiskBuffer = false
 	w.diskFrameCount = 0
+	w.diskBufferSent = 0
 }
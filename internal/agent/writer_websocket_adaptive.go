@@ -0,0 +1,243 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// MessageTypeRateChange marks a change of the effective streaming frame rate.
+const MessageTypeRateChange = "rate_change"
+
+const (
+	defaultAdaptiveHighWatermark = 0.5
+	defaultAdaptiveLowWatermark  = 0.1
+	defaultAdaptiveMaxLatency    = 500 * time.Millisecond
+	defaultAdaptiveStepUpAfter   = 10 * time.Second
+	defaultAdaptiveCheckInterval = time.Second
+
+	// Weight of the newest sample in the send latency moving average
+	sendLatencySmoothing = 0.2
+)
+
+// AdaptiveRateConfig controls how the WebSocket writer lowers its streaming
+// frame rate when the link falls behind. Only frames sent over the WebSocket
+// are thinned out; the poller and local file writers keep their full rate.
+type AdaptiveRateConfig struct {
+	Levels        []int         // Frame rate caps to step through, highest first (e.g. 30,15,5)
+	HighWatermark float64       // Step down when the queue is at least this full (0-1)
+	LowWatermark  float64       // Step up only while the queue is at most this full (0-1)
+	MaxLatency    time.Duration // Step down when the average send time exceeds this
+	StepUpAfter   time.Duration // How long the link must stay healthy before stepping up
+	CheckInterval time.Duration // How often the backlog is evaluated
+}
+
+// Enabled reports whether adaptive streaming is configured.
+func (c AdaptiveRateConfig) Enabled() bool {
+	return len(c.Levels) > 0
+}
+
+// Validate checks the adaptive rate configuration and fills in defaults.
+// Levels are sorted from highest to lowest rate.
+func (c *AdaptiveRateConfig) Validate() error {
+	for _, level := range c.Levels {
+		if level < 1 || level > maxCommandFPS {
+			return fmt.Errorf("adaptive FPS level %d must be between 1 and %d", level, maxCommandFPS)
+		}
+	}
+	c.Levels = slices.Clone(c.Levels)
+	slices.Sort(c.Levels)
+	slices.Reverse(c.Levels)
+	c.Levels = slices.Compact(c.Levels)
+
+	if c.HighWatermark <= 0 {
+		c.HighWatermark = defaultAdaptiveHighWatermark
+	}
+	if c.LowWatermark <= 0 {
+		c.LowWatermark = defaultAdaptiveLowWatermark
+	}
+	if c.HighWatermark > 1 || c.LowWatermark >= c.HighWatermark {
+		return fmt.Errorf("adaptive watermarks must satisfy 0 < low < high <= 1")
+	}
+	if c.MaxLatency <= 0 {
+		c.MaxLatency = defaultAdaptiveMaxLatency
+	}
+	if c.StepUpAfter <= 0 {
+		c.StepUpAfter = defaultAdaptiveStepUpAfter
+	}
+	if c.CheckInterval <= 0 {
+		c.CheckInterval = defaultAdaptiveCheckInterval
+	}
+	return nil
+}
+
+// RateChange is sent on the stream whenever the adaptive frame rate changes.
+//
+//	{"type":"rate_change","fps":15,"previous_fps":30,"reason":"backlog",...}
+//
+// An FPS of 0 means frames are streamed at the full polling rate.
+type RateChange struct {
+	Type          string    `json:"type"`
+	Timestamp     time.Time `json:"timestamp"`
+	FPS           int       `json:"fps"`
+	PreviousFPS   int       `json:"previous_fps"`
+	Reason        string    `json:"reason"`
+	QueueDepth    int       `json:"queue_depth"`
+	SendLatencyMs int64     `json:"send_latency_ms"`
+	FramesSkipped uint64    `json:"frames_skipped"`
+}
+
+// SetAdaptiveRate enables adaptive streaming. It must be called before Connect.
+func (w *WebSocketWriter) SetAdaptiveRate(cfg AdaptiveRateConfig) error {
+	if !cfg.Enabled() {
+		return nil
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.adaptive = cfg
+	w.rateLevel = -1
+	go w.adaptLoop()
+	return nil
+}
+
+// streamFPSLocked returns the current frame rate cap, or 0 for the full rate
+// (must be called with lock held)
+func (w *WebSocketWriter) streamFPSLocked() int {
+	if w.rateLevel < 0 {
+		return 0
+	}
+	return w.adaptive.Levels[w.rateLevel]
+}
+
+// admitFrame reports whether a frame may be queued under the current rate cap.
+func (w *WebSocketWriter) admitFrame() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	fps := w.streamFPSLocked()
+	if fps == 0 {
+		return true
+	}
+
+	now := time.Now()
+	if now.Sub(w.lastAdmitted) < time.Second/time.Duration(fps) {
+		w.framesSkipped++
+		return false
+	}
+	w.lastAdmitted = now
+	return true
+}
+
+// recordSendLatency updates the moving average of frame write durations.
+func (w *WebSocketWriter) recordSendLatency(d time.Duration) {
+	for {
+		old := w.sendLatency.Load()
+		next := int64(d)
+		if old != 0 {
+			next = int64(float64(old)*(1-sendLatencySmoothing) + float64(d)*sendLatencySmoothing)
+		}
+		if w.sendLatency.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+// adaptLoop periodically compares the backlog with the configured thresholds
+// and steps the streaming frame rate down or up.
+func (w *WebSocketWriter) adaptLoop() {
+	w.mu.Lock()
+	cfg := w.adaptive
+	w.mu.Unlock()
+
+	ticker := time.NewTicker(cfg.CheckInterval)
+	defer ticker.Stop()
+
+	var healthySince time.Time
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		w.mu.Lock()
+		connected := w.connected
+		w.mu.Unlock()
+		if !connected {
+			// Frames go to the disk buffer; the backlog says nothing about the link
+			healthySince = time.Time{}
+			continue
+		}
+
+		depth := len(w.outgoingCh)
+		fill := float64(depth) / float64(cap(w.outgoingCh))
+		latency := time.Duration(w.sendLatency.Load())
+
+		switch {
+		case fill >= cfg.HighWatermark || latency >= cfg.MaxLatency:
+			healthySince = time.Time{}
+			reason := "backlog"
+			if fill < cfg.HighWatermark {
+				reason = "latency"
+			}
+			w.stepRate(1, reason, depth, latency)
+
+		case fill <= cfg.LowWatermark && latency < cfg.MaxLatency/2:
+			if healthySince.IsZero() {
+				healthySince = time.Now()
+			} else if time.Since(healthySince) >= cfg.StepUpAfter {
+				healthySince = time.Now()
+				w.stepRate(-1, "recovered", depth, latency)
+			}
+
+		default:
+			healthySince = time.Time{}
+		}
+	}
+}
+
+// stepRate moves the rate level by delta (positive = lower rate) and records
+// the change as a marker on the stream.
+func (w *WebSocketWriter) stepRate(delta int, reason string, depth int, latency time.Duration) {
+	w.mu.Lock()
+	level := max(-1, min(w.rateLevel+delta, len(w.adaptive.Levels)-1))
+	if level == w.rateLevel {
+		w.mu.Unlock()
+		return
+	}
+	previous := w.streamFPSLocked()
+	w.rateLevel = level
+	change := RateChange{
+		Type:          MessageTypeRateChange,
+		Timestamp:     time.Now().UTC(),
+		FPS:           w.streamFPSLocked(),
+		PreviousFPS:   previous,
+		Reason:        reason,
+		QueueDepth:    depth,
+		SendLatencyMs: latency.Milliseconds(),
+		FramesSkipped: w.framesSkipped,
+	}
+	w.mu.Unlock()
+
+	w.logger.Info("Streaming frame rate changed",
+		zap.Int("fps", change.FPS),
+		zap.Int("previous_fps", change.PreviousFPS),
+		zap.String("reason", reason),
+		zap.Int("queue_depth", depth),
+		zap.Duration("send_latency", latency))
+
+	data, err := json.Marshal(change)
+	if err != nil {
+		w.logger.Error("Failed to marshal rate change", zap.Error(err))
+		return
+	}
+	w.enqueueMarker(data)
+}
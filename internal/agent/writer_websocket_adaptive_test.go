@@ -0,0 +1,239 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func TestAdaptiveRateConfig_Validate(t *testing.T) {
+	cfg := AdaptiveRateConfig{Levels: []int{5, 30, 15, 30}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(cfg.Levels, []int{30, 15, 5}) {
+		t.Errorf("Levels = %v, want [30 15 5]", cfg.Levels)
+	}
+	if cfg.MaxLatency != defaultAdaptiveMaxLatency || cfg.CheckInterval != defaultAdaptiveCheckInterval {
+		t.Errorf("defaults not applied: %+v", cfg)
+	}
+
+	for name, invalid := range map[string]AdaptiveRateConfig{
+		"level zero":         {Levels: []int{0}},
+		"level too high":     {Levels: []int{500}},
+		"inverted watermark": {Levels: []int{10}, HighWatermark: 0.2, LowWatermark: 0.4},
+	} {
+		if err := invalid.Validate(); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestWebSocketWriter_StepRate(t *testing.T) {
+	w := NewWebSocketWriter(testLogger(t), "ws://localhost:0", "")
+	defer w.Close()
+	if err := w.SetAdaptiveRate(AdaptiveRateConfig{Levels: []int{20, 5}, CheckInterval: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	readMarker := func() RateChange {
+		t.Helper()
+		select {
+		case msg := <-w.outgoingCh:
+			var change RateChange
+			if err := json.Unmarshal(msg.marker, &change); err != nil {
+				t.Fatalf("invalid marker: %v", err)
+			}
+			return change
+		default:
+			t.Fatal("no rate change marker queued")
+			return RateChange{}
+		}
+	}
+
+	w.stepRate(1, "backlog", 800, 0)
+	if change := readMarker(); change.Type != MessageTypeRateChange || change.FPS != 20 || change.PreviousFPS != 0 || change.Reason != "backlog" {
+		t.Errorf("unexpected marker: %+v", change)
+	}
+
+	// Only one frame per 50ms passes at 20 FPS
+	if !w.admitFrame() {
+		t.Error("first frame should be admitted")
+	}
+	if w.admitFrame() {
+		t.Error("second immediate frame should be skipped")
+	}
+
+	w.stepRate(1, "latency", 0, time.Second)
+	if change := readMarker(); change.FPS != 5 || change.PreviousFPS != 20 || change.FramesSkipped != 1 {
+		t.Errorf("unexpected marker: %+v", change)
+	}
+
+	// Already at the lowest level: no change, no marker
+	w.stepRate(1, "backlog", 0, 0)
+	if len(w.outgoingCh) != 0 {
+		t.Error("marker queued without a rate change")
+	}
+
+	w.stepRate(-1, "recovered", 0, 0)
+	w.stepRate(-1, "recovered", 0, 0)
+	readMarker()
+	if change := readMarker(); change.FPS != 0 || change.PreviousFPS != 20 {
+		t.Errorf("unexpected marker: %+v", change)
+	}
+	if !w.admitFrame() || !w.admitFrame() {
+		t.Error("frames should not be skipped at full rate")
+	}
+}
+
+func TestWebSocketWriter_MarkerHeldWhileQueueFull(t *testing.T) {
+	w := NewWebSocketWriter(testLogger(t), "ws://localhost:0", "")
+	defer w.Close()
+
+	for i := range cap(w.outgoingCh) {
+		w.outgoingCh <- outgoingMessage{frame: &telemetry.LobbySessionStateFrame{FrameIndex: uint32(i)}}
+	}
+	w.enqueueMarker([]byte(`{"type":"rate_change","fps":20}`))
+
+	// The frame cannot overtake the held marker, so both wait for room
+	if err := w.WriteFrame(&telemetry.LobbySessionStateFrame{FrameIndex: 9999}); err == nil {
+		t.Error("expected an error while the queue is full")
+	}
+	for range cap(w.outgoingCh) {
+		<-w.outgoingCh
+	}
+
+	if err := w.WriteFrame(&telemetry.LobbySessionStateFrame{FrameIndex: 9999}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-w.outgoingCh; msg.marker == nil {
+		t.Fatalf("expected the held marker first, got frame %v", msg.frame.GetFrameIndex())
+	}
+	if msg := <-w.outgoingCh; msg.frame.GetFrameIndex() != 9999 {
+		t.Errorf("expected frame 9999 after the marker, got %+v", msg)
+	}
+	if len(w.pendingMarkers) != 0 {
+		t.Errorf("%d markers still held", len(w.pendingMarkers))
+	}
+}
+
+// streamRecorder is a server that records the messages of a stream as
+// "frame", "rate_change" or "frame_batch:<count>".
+func streamRecorder(t *testing.T) (*httptest.Server, chan string) {
+	t.Helper()
+	received := make(chan string, 16)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg batchMessage
+			switch {
+			case json.Unmarshal(data, &msg) != nil:
+				received <- "invalid"
+			case msg.Type == MessageTypeFrameBatch:
+				received <- fmt.Sprintf("%s:%d", msg.Type, msg.Count)
+			case msg.Type != "":
+				received <- msg.Type
+			default:
+				received <- "frame"
+			}
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, received
+}
+
+func expectStream(t *testing.T, received chan string, want ...string) {
+	t.Helper()
+	for i, expected := range want {
+		select {
+		case got := <-received:
+			if got != expected {
+				t.Fatalf("message %d = %q, want %q", i, got, expected)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("message %d (%q) not received", i, expected)
+		}
+	}
+}
+
+func TestWebSocketWriter_RateChangeKeepsBatchOrder(t *testing.T) {
+	srv, received := streamRecorder(t)
+
+	w := NewWebSocketWriter(testLogger(t), "ws"+strings.TrimPrefix(srv.URL, "http"), "")
+	if err := w.SetBatching(BatchConfig{Window: time.Minute, MaxFrames: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetAdaptiveRate(AdaptiveRateConfig{Levels: []int{20}, CheckInterval: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The marker closes the pending batch and goes out before later frames
+	for i := range 2 {
+		if err := w.WriteFrame(&telemetry.LobbySessionStateFrame{FrameIndex: uint32(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.stepRate(1, "backlog", 0, 0)
+	if err := w.WriteFrame(&telemetry.LobbySessionStateFrame{FrameIndex: 2}); err != nil {
+		t.Fatal(err)
+	}
+	expectStream(t, received, "frame_batch:2", MessageTypeRateChange)
+
+	// The last frame stays pending until Close flushes it
+	for len(w.outgoingCh) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	w.Close()
+	expectStream(t, received, "frame_batch:1")
+}
+
+func TestWebSocketWriter_RateChangeSurvivesDiskBuffer(t *testing.T) {
+	srv, received := streamRecorder(t)
+
+	w := NewWebSocketWriter(testLogger(t), "ws"+strings.TrimPrefix(srv.URL, "http"), "")
+	if err := w.SetBatching(BatchConfig{FastCatchUp: true, Compression: CompressionDeflate}); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// Frames and the marker are buffered to disk while disconnected
+	marshaler := protojson.MarshalOptions{}
+	for _, msg := range []outgoingMessage{
+		{frame: &telemetry.LobbySessionStateFrame{FrameIndex: 0}},
+		{frame: &telemetry.LobbySessionStateFrame{FrameIndex: 1}},
+		{marker: []byte(`{"type":"rate_change","fps":20}`)},
+		{frame: &telemetry.LobbySessionStateFrame{FrameIndex: 2}},
+	} {
+		if err := w.bufferToDisk(msg, &marshaler); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := w.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	w.drainDiskBuffer()
+
+	expectStream(t, received, "frame_batch:2", MessageTypeRateChange, "frame_batch:1")
+}
@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/klauspost/compress/zstd"
+)
+
+// MessageTypeFrameBatch identifies a message carrying several frame envelopes.
+const MessageTypeFrameBatch = "frame_batch"
+
+// Compression modes for frame delivery.
+const (
+	CompressionNone    = "none"
+	CompressionDeflate = "deflate" // permessage-deflate negotiated during the handshake
+	CompressionZstd    = "zstd"    // zstd-compressed batch sent as a binary message
+)
+
+const (
+	defaultBatchMaxFrames = 50
+	defaultBatchMaxBytes  = 1024 * 1024
+
+	// Fast catch-up sends much larger batches, without throttling, while
+	// draining the disk buffer.
+	fastCatchUpMaxFrames = 1000
+	fastCatchUpMaxBytes  = 8 * 1024 * 1024
+)
+
+// BatchConfig controls how frames are grouped and compressed on the events WebSocket.
+type BatchConfig struct {
+	Window      time.Duration // Group frames for this long before sending (0 = one message per frame)
+	MaxFrames   int           // Send early once this many frames are pending
+	MaxBytes    int           // Send early once the pending envelopes reach this size
+	Compression string        // none, deflate or zstd
+	FastCatchUp bool          // Drain the disk buffer in large compressed batches
+}
+
+// Enabled reports whether live frames are batched.
+func (c BatchConfig) Enabled() bool {
+	return c.Window > 0
+}
+
+// Validate checks the batch configuration and fills in default limits.
+func (c *BatchConfig) Validate() error {
+	c.Compression = strings.ToLower(strings.TrimSpace(c.Compression))
+	switch c.Compression {
+	case "":
+		c.Compression = CompressionNone
+	case CompressionNone, CompressionDeflate, CompressionZstd:
+	default:
+		return fmt.Errorf("unsupported compression %q (use none, deflate or zstd)", c.Compression)
+	}
+	if c.Window < 0 {
+		return fmt.Errorf("batch window must not be negative")
+	}
+	if c.Compression == CompressionZstd && !c.Enabled() && !c.FastCatchUp {
+		return fmt.Errorf("zstd compression requires a batch window or fast catch-up")
+	}
+	if c.MaxFrames <= 0 {
+		c.MaxFrames = defaultBatchMaxFrames
+	}
+	if c.MaxBytes <= 0 {
+		c.MaxBytes = defaultBatchMaxBytes
+	}
+	return nil
+}
+
+// frameBatch collects marshaled frame envelopes until a size limit is reached.
+type frameBatch struct {
+	frames    [][]byte
+	size      int
+	maxFrames int
+	maxBytes  int
+}
+
+func newFrameBatch(maxFrames, maxBytes int) *frameBatch {
+	return &frameBatch{
+		frames:    make([][]byte, 0, maxFrames),
+		maxFrames: maxFrames,
+		maxBytes:  maxBytes,
+	}
+}
+
+func (b *frameBatch) add(envelope []byte) {
+	b.frames = append(b.frames, envelope)
+	b.size += len(envelope)
+}
+
+func (b *frameBatch) len() int {
+	return len(b.frames)
+}
+
+func (b *frameBatch) full() bool {
+	return len(b.frames) >= b.maxFrames || b.size >= b.maxBytes
+}
+
+func (b *frameBatch) reset() {
+	b.frames = b.frames[:0]
+	b.size = 0
+}
+
+// encodeFrameBatch builds a frame_batch message from marshaled envelopes:
+//
+//	{"type":"frame_batch","count":2,"frames":[<envelope>,<envelope>]}
+//
+// With zstd compression the document is compressed and sent as a binary message.
+func encodeFrameBatch(frames [][]byte, compression string, encoder *zstd.Encoder) (int, []byte, error) {
+	size := 64
+	for _, f := range frames {
+		size += len(f) + 1
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(size)
+	buf.WriteString(`{"type":"` + MessageTypeFrameBatch + `","count":`)
+	buf.WriteString(strconv.Itoa(len(frames)))
+	buf.WriteString(`,"frames":[`)
+	for i, f := range frames {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(f)
+	}
+	buf.WriteString("]}")
+
+	if compression != CompressionZstd {
+		return websocket.TextMessage, buf.Bytes(), nil
+	}
+	if encoder == nil {
+		return 0, nil, fmt.Errorf("zstd encoder not initialized")
+	}
+	return websocket.BinaryMessage, encoder.EncodeAll(buf.Bytes(), make([]byte, 0, buf.Len()/4)), nil
+}
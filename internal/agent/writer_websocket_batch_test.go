@@ -0,0 +1,408 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	telemetry "buf.build/gen/go/echotools/nevr-api/protocolbuffers/go/telemetry/v1"
+	"github.com/gorilla/websocket"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+type batchMessage struct {
+	Type   string            `json:"type"`
+	Count  int               `json:"count"`
+	Frames []json.RawMessage `json:"frames"`
+}
+
+func TestBatchConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     BatchConfig
+		wantErr bool
+	}{
+		{"disabled", BatchConfig{}, false},
+		{"window", BatchConfig{Window: 100 * time.Millisecond}, false},
+		{"deflate without batching", BatchConfig{Compression: "Deflate"}, false},
+		{"zstd with window", BatchConfig{Window: time.Second, Compression: "zstd"}, false},
+		{"zstd with fast catch-up", BatchConfig{Compression: "zstd", FastCatchUp: true}, false},
+		{"zstd alone", BatchConfig{Compression: "zstd"}, true},
+		{"unknown compression", BatchConfig{Compression: "gzip"}, true},
+		{"negative window", BatchConfig{Window: -time.Second}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			err := cfg.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (cfg.MaxFrames != defaultBatchMaxFrames || cfg.MaxBytes != defaultBatchMaxBytes) {
+				t.Errorf("defaults not applied: %+v", cfg)
+			}
+		})
+	}
+}
+
+func TestFrameBatch_Limits(t *testing.T) {
+	b := newFrameBatch(3, 10)
+	b.add([]byte(`{}`))
+	b.add([]byte(`{}`))
+	if b.full() {
+		t.Fatal("batch full after 2 of 3 frames")
+	}
+	b.add([]byte(`{}`))
+	if !b.full() {
+		t.Fatal("batch not full at frame limit")
+	}
+
+	b.reset()
+	b.add([]byte(`{"a":"0123456789"}`))
+	if !b.full() {
+		t.Fatal("batch not full at byte limit")
+	}
+}
+
+func TestEncodeFrameBatch(t *testing.T) {
+	frames := [][]byte{[]byte(`{"frame":{"frame_index":1}}`), []byte(`{"frame":{"frame_index":2}}`)}
+
+	messageType, payload, err := encodeFrameBatch(frames, CompressionNone, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messageType != websocket.TextMessage {
+		t.Errorf("message type = %d, want text", messageType)
+	}
+	var msg batchMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		t.Fatalf("batch is not valid JSON: %v\n%s", err, payload)
+	}
+	if msg.Type != MessageTypeFrameBatch || msg.Count != 2 || len(msg.Frames) != 2 {
+		t.Errorf("unexpected batch: %+v", msg)
+	}
+
+	encoder, _ := zstd.NewWriter(nil)
+	decoder, _ := zstd.NewReader(nil)
+	defer decoder.Close()
+
+	messageType, compressed, err := encodeFrameBatch(frames, CompressionZstd, encoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if messageType != websocket.BinaryMessage {
+		t.Errorf("message type = %d, want binary", messageType)
+	}
+	decoded, err := decoder.DecodeAll(compressed, nil)
+	if err != nil {
+		t.Fatalf("failed to decompress batch: %v", err)
+	}
+	if string(decoded) != string(payload) {
+		t.Errorf("decompressed batch differs:\n%s\n%s", decoded, payload)
+	}
+
+	if _, _, err := encodeFrameBatch(frames, CompressionZstd, nil); err == nil {
+		t.Error("expected error without zstd encoder")
+	}
+}
+
+func TestWebSocketWriter_BatchedDelivery(t *testing.T) {
+	received := make(chan batchMessage, 4)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		decoder, _ := zstd.NewReader(nil)
+		defer decoder.Close()
+
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if messageType == websocket.BinaryMessage {
+				if data, err = decoder.DecodeAll(data, nil); err != nil {
+					t.Errorf("failed to decompress batch: %v", err)
+					return
+				}
+			}
+			var msg batchMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.Errorf("invalid message: %v", err)
+				return
+			}
+			received <- msg
+		}
+	}))
+	defer srv.Close()
+
+	w := NewWebSocketWriter(testLogger(t), "ws"+strings.TrimPrefix(srv.URL, "http"), "")
+	if err := w.SetBatching(BatchConfig{Window: 50 * time.Millisecond, MaxFrames: 4, Compression: CompressionZstd}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	// Four frames fill the batch; the fifth is sent when the window expires
+	for i := range 5 {
+		if err := w.WriteFrame(&telemetry.LobbySessionStateFrame{FrameIndex: uint32(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var counts []int
+	for len(counts) < 2 {
+		select {
+		case msg := <-received:
+			if msg.Type != MessageTypeFrameBatch || msg.Count != len(msg.Frames) {
+				t.Fatalf("unexpected batch: %+v", msg)
+			}
+			counts = append(counts, msg.Count)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for batches, got %v", counts)
+		}
+	}
+	if counts[0] != 4 || counts[1] != 1 {
+		t.Errorf("batch sizes = %v, want [4 1]", counts)
+	}
+}
+
+// failingConn fails every write once fail is set, while reads keep working.
+type failingConn struct {
+	net.Conn
+	fail *atomic.Bool
+}
+
+func (c *failingConn) Write(p []byte) (int, error) {
+	if c.fail.Load() {
+		return 0, errors.New("injected write failure")
+	}
+	return c.Conn.Write(p)
+}
+
+func TestWebSocketWriter_FailedBatchIsKeptOnDisk(t *testing.T) {
+	var connections atomic.Int32
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Refuse reconnects so the spilled frames stay on disk
+		if connections.Add(1) > 1 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	var failWrites atomic.Bool
+	w := NewWebSocketWriter(testLogger(t), "ws"+strings.TrimPrefix(srv.URL, "http"), "")
+	w.SetDialer(&websocket.Dialer{
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &failingConn{Conn: conn, fail: &failWrites}, nil
+		},
+	})
+	if err := w.SetBatching(BatchConfig{Window: time.Minute, MaxFrames: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	w.mu.Lock()
+	writeDone := w.writeDone
+	w.mu.Unlock()
+
+	// The full batch is written, fails, and is spilled before the write loop exits
+	failWrites.Store(true)
+	for i := range 3 {
+		if err := w.WriteFrame(&telemetry.LobbySessionStateFrame{FrameIndex: uint32(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-writeDone:
+	case <-time.After(2 * time.Second):
+		t.Fatal("write loop did not exit after the failed write")
+	}
+
+	w.diskBufferMu.Lock()
+	path, count := w.diskBufferPath, w.diskFrameCount
+	w.diskBufferMu.Unlock()
+	if path == "" || count != 3 {
+		t.Fatalf("disk buffer %q holds %d frames, want 3", path, count)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("disk buffer was removed: %v", err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 3 {
+		t.Errorf("disk buffer has %d lines, want 3", lines)
+	}
+}
+
+func TestWebSocketWriter_CloseFlushesPendingBatch(t *testing.T) {
+	received := make(chan batchMessage, 1)
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg batchMessage
+			if json.Unmarshal(data, &msg) == nil && msg.Type == MessageTypeFrameBatch {
+				received <- msg
+			}
+		}
+	}))
+	defer srv.Close()
+
+	w := NewWebSocketWriter(testLogger(t), "ws"+strings.TrimPrefix(srv.URL, "http"), "")
+	if err := w.SetBatching(BatchConfig{Window: time.Minute, MaxFrames: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	for i := range 2 {
+		if err := w.WriteFrame(&telemetry.LobbySessionStateFrame{FrameIndex: uint32(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Give the write loop time to take both frames into its batch
+	time.Sleep(50 * time.Millisecond)
+	w.Close()
+
+	select {
+	case msg := <-received:
+		if msg.Count != 2 {
+			t.Errorf("final batch has %d frames, want 2", msg.Count)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pending batch was not sent on close")
+	}
+}
+
+// limitedConn fails every write once its budget of writes is used up.
+type limitedConn struct {
+	net.Conn
+	left *atomic.Int32
+}
+
+func (c *limitedConn) Write(p []byte) (int, error) {
+	if c.left.Add(-1) < 0 {
+		return 0, errors.New("injected write failure")
+	}
+	return c.Conn.Write(p)
+}
+
+func TestWebSocketWriter_InterruptedDrainResumes(t *testing.T) {
+	srv, received := streamRecorder(t)
+
+	// Connections are set up by hand, so no reconnect loop drains behind the test
+	var left atomic.Int32
+	w := NewWebSocketWriter(testLogger(t), "ws"+strings.TrimPrefix(srv.URL, "http"), "")
+	defer w.Close()
+	connect := func() {
+		t.Helper()
+		dialer := &websocket.Dialer{
+			NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				conn, err := (&net.Dialer{}).DialContext(ctx, network, addr)
+				if err != nil {
+					return nil, err
+				}
+				return &limitedConn{Conn: conn, left: &left}, nil
+			},
+		}
+		left.Store(1 << 20)
+		conn, _, err := dialer.Dial(w.socketURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		w.mu.Lock()
+		w.conn, w.connected = conn, true
+		w.mu.Unlock()
+	}
+
+	// Markers are sent one by one and recorded by their type
+	marshaler := protojson.MarshalOptions{}
+	buffer := func(name string) {
+		t.Helper()
+		if err := w.bufferToDisk(outgoingMessage{marker: []byte(`{"type":"` + name + `"}`)}, &marshaler); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, name := range []string{"line0", "line1", "line2", "line3"} {
+		buffer(name)
+	}
+
+	// The connection fails after two lines
+	connect()
+	left.Store(2)
+	w.drainDiskBuffer()
+	expectStream(t, received, "line0", "line1")
+
+	w.diskBufferMu.Lock()
+	file, sent := w.diskBufferFile, w.diskBufferSent
+	w.diskBufferMu.Unlock()
+	if file != nil {
+		t.Error("closed disk buffer handle was kept")
+	}
+	if want := int64(2 * (len(`{"type":"line0"}`) + 1)); sent != want {
+		t.Errorf("delivered offset = %d, want %d", sent, want)
+	}
+
+	// Frames spilled before the reconnect are appended to the same buffer
+	buffer("line4")
+
+	// The next drain resumes after the delivered lines
+	connect()
+	w.drainDiskBuffer()
+	expectStream(t, received, "line2", "line3", "line4")
+	select {
+	case got := <-received:
+		t.Errorf("unexpected message %q after the drain", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	w.diskBufferMu.Lock()
+	defer w.diskBufferMu.Unlock()
+	if w.usingDiskBuffer || w.diskBufferPath != "" {
+		t.Errorf("disk buffer %q was not cleaned up", w.diskBufferPath)
+	}
+}
@@ -3,9 +3,11 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
@@ -21,6 +23,10 @@ type Config struct {
 	LogFile    string `yaml:"log_file"`
 	ConfigFile string `yaml:"-"` // Not loaded from yaml
 
+	// LogToStderr sends console logging to stderr; set by commands that
+	// write data to stdout
+	LogToStderr bool `yaml:"-"`
+
 	// Agent configuration
 	Agent AgentConfig `yaml:"agent"`
 
@@ -32,6 +38,9 @@ type Config struct {
 
 	// Replayer configuration
 	Replayer ReplayerConfig `yaml:"replayer"`
+
+	// Outbound connection configuration (TLS, proxy)
+	Transport TransportConfig `yaml:"transport"`
 }
 
 // AgentConfig holds configuration for the agent subcommand
@@ -76,6 +85,7 @@ type APIServerConfig struct {
 // ConverterConfig holds configuration for the converter subcommand
 type ConverterConfig struct {
 	InputFile    string `yaml:"input_file"`
+	InputFormat  string `yaml:"input_format"`
 	OutputFile   string `yaml:"output_file"`
 	OutputDir    string `yaml:"output_dir"`
 	Format       string `yaml:"format"`
@@ -85,6 +95,31 @@ type ConverterConfig struct {
 	Recursive    bool   `yaml:"recursive"`
 	Glob         string `yaml:"glob"`
 	Validate     bool   `yaml:"validate"`
+	Jobs         int    `yaml:"jobs"`
+	FPS          int    `yaml:"fps"`
+	Interpolate  bool   `yaml:"interpolate"`
+	Report       string `yaml:"report"`      // text or json
+	ReportFile   string `yaml:"report_file"` // JSON report path
+	Incremental  bool   `yaml:"incremental"`
+	Prune        bool   `yaml:"prune"`
+
+	// Lenient conversion of malformed inputs; RepairTimestamps is
+	// interpolate or clamp
+	Repair           bool   `yaml:"repair"`
+	RepairTimestamps string `yaml:"repair_timestamps"`
+
+	// Watch-folder mode: convert files dropped into Watch once they have
+	// stopped growing for Settle, then keep, move or delete the source
+	Watch        string        `yaml:"watch"`
+	PollInterval time.Duration `yaml:"poll_interval"`
+	Settle       time.Duration `yaml:"settle"`
+	AfterConvert string        `yaml:"after_convert"`
+	ProcessedDir string        `yaml:"processed_dir"`
+
+	// Float tolerances for --validate: a default, and overrides keyed by
+	// field name (e.g. "position")
+	Tolerance       float64            `yaml:"tolerance"`
+	FieldTolerances map[string]float64 `yaml:"field_tolerances"`
 }
 
 // ReplayerConfig holds configuration for the replayer subcommand
@@ -123,6 +158,15 @@ func DefaultConfig() *Config {
 		Converter: ConverterConfig{
 			OutputDir: "./",
 			Format:    "auto",
+			Jobs:      1,
+			Tolerance: 1e-6,
+			Report:    "text",
+
+			PollInterval: 2 * time.Second,
+			Settle:       5 * time.Second,
+			AfterConvert: "keep",
+
+			RepairTimestamps: "interpolate",
 		},
 		Replayer: ReplayerConfig{
 			BindAddress: "127.0.0.1:6721",
@@ -226,6 +270,26 @@ func applyEnvOverrides(c *Config) {
 	if v := getEnv("APISERVER_AMQP_QUEUE_NAME"); v != "" {
 		c.APIServer.AMQPQueueName = v
 	}
+
+	// Outbound transport
+	if v := getEnv("TRANSPORT_CA_FILE"); v != "" {
+		c.Transport.CAFile = v
+	}
+	if v := getEnv("TRANSPORT_CERT_FILE"); v != "" {
+		c.Transport.CertFile = v
+	}
+	if v := getEnv("TRANSPORT_KEY_FILE"); v != "" {
+		c.Transport.KeyFile = v
+	}
+	if v := getEnv("TRANSPORT_SERVER_NAME"); v != "" {
+		c.Transport.ServerName = v
+	}
+	if v := getEnv("TRANSPORT_MIN_TLS_VERSION"); v != "" {
+		c.Transport.MinTLSVersion = v
+	}
+	if v := getEnv("TRANSPORT_PROXY_URL"); v != "" {
+		c.Transport.ProxyURL = v
+	}
 }
 
 // NewLogger creates a zap logger based on the configuration
@@ -255,12 +319,17 @@ func (c *Config) NewLogger() (*zap.Logger, error) {
 	// Include caller info in log messages (relative path and line number)
 	cfg.EncoderConfig.EncodeCaller = zapcore.ShortCallerEncoder
 
+	console := "stdout"
+	if c.LogToStderr {
+		console = "stderr"
+	}
+
 	if c.LogFile != "" {
 		// Log to file and console
-		cfg.OutputPaths = []string{c.LogFile, "stdout"}
+		cfg.OutputPaths = []string{c.LogFile, console}
 		cfg.ErrorOutputPaths = []string{c.LogFile, "stderr"}
 	} else {
-		cfg.OutputPaths = []string{"stdout"}
+		cfg.OutputPaths = []string{console}
 		cfg.ErrorOutputPaths = []string{"stderr"}
 	}
 
@@ -314,12 +383,103 @@ func (c *Config) ValidateAPIServerConfig() error {
 
 // ValidateConverterConfig validates converter configuration
 func (c *Config) ValidateConverterConfig() error {
-	if c.Converter.InputFile == "" {
+	if c.Converter.Watch != "" {
+		if err := c.validateWatchConfig(); err != nil {
+			return err
+		}
+	} else if c.Converter.InputFile == "" {
 		return fmt.Errorf("input file must be specified")
-	}
-	if _, err := os.Stat(c.Converter.InputFile); os.IsNotExist(err) {
+	} else if c.Converter.InputFile == "-" {
+		if c.Converter.InputFormat == "" || c.Converter.InputFormat == "auto" {
+			return fmt.Errorf("reading from stdin requires --input-format")
+		}
+	} else if _, err := os.Stat(c.Converter.InputFile); os.IsNotExist(err) {
 		return fmt.Errorf("input file does not exist: %s", c.Converter.InputFile)
 	}
+	switch c.Converter.InputFormat {
+	case "", "auto", "echoreplay", "nevrcap", "tape":
+	default:
+		return fmt.Errorf("unsupported input format: %s", c.Converter.InputFormat)
+	}
+	if c.Converter.OutputFile == "-" && (c.Converter.Format == "" || c.Converter.Format == "auto") {
+		return fmt.Errorf("writing to stdout requires --format")
+	}
+	switch c.Converter.Report {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("unsupported report format: %s (want text or json)", c.Converter.Report)
+	}
+	if c.Converter.Report == "json" && c.Converter.OutputFile == "-" {
+		return fmt.Errorf("--report json cannot be used when writing output to stdout (use --report-file)")
+	}
+	switch c.Converter.RepairTimestamps {
+	case "", "interpolate", "clamp":
+	default:
+		return fmt.Errorf("unsupported timestamp repair: %s (want interpolate or clamp)", c.Converter.RepairTimestamps)
+	}
+	if c.Converter.Prune && !c.Converter.Incremental {
+		return fmt.Errorf("--prune requires --incremental")
+	}
+	if c.Converter.Tolerance < 0 {
+		return fmt.Errorf("tolerance must not be negative, got %g", c.Converter.Tolerance)
+	}
+	for field, tolerance := range c.Converter.FieldTolerances {
+		if tolerance < 0 {
+			return fmt.Errorf("tolerance for %s must not be negative, got %g", field, tolerance)
+		}
+	}
+	if c.Converter.Jobs < 0 {
+		return fmt.Errorf("jobs must be zero (one per CPU) or positive, got %d", c.Converter.Jobs)
+	}
+	if c.Converter.FPS < 0 || c.Converter.FPS > 1000 {
+		return fmt.Errorf("fps must be between 0 and 1000, got %d", c.Converter.FPS)
+	}
+	if c.Converter.Interpolate && c.Converter.FPS == 0 {
+		return fmt.Errorf("interpolation requires a target fps")
+	}
+	return nil
+}
+
+// validateWatchConfig validates the watch-folder settings of the converter
+func (c *Config) validateWatchConfig() error {
+	if c.Converter.InputFile != "" {
+		return fmt.Errorf("--input and --watch cannot be used together")
+	}
+	if c.Converter.OutputFile != "" {
+		return fmt.Errorf("--output cannot be used with --watch (use --output-dir)")
+	}
+	if c.Converter.Prune {
+		return fmt.Errorf("--prune cannot be used with --watch")
+	}
+	info, err := os.Stat(c.Converter.Watch)
+	if err != nil {
+		return fmt.Errorf("watch directory does not exist: %s", c.Converter.Watch)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("watch path is not a directory: %s", c.Converter.Watch)
+	}
+	// Outputs written into the watched directory would be picked up and
+	// converted again
+	watchDir, _ := filepath.Abs(c.Converter.Watch)
+	outputDir, _ := filepath.Abs(c.Converter.OutputDir)
+	if watchDir == outputDir {
+		return fmt.Errorf("output directory must differ from the watched directory")
+	}
+	if c.Converter.PollInterval <= 0 {
+		return fmt.Errorf("poll interval must be positive")
+	}
+	if c.Converter.Settle < 0 {
+		return fmt.Errorf("settle time must not be negative")
+	}
+	switch c.Converter.AfterConvert {
+	case "", "keep", "delete":
+	case "move":
+		if c.Converter.ProcessedDir == "" {
+			return fmt.Errorf("moving converted sources requires a processed directory")
+		}
+	default:
+		return fmt.Errorf("unsupported after-convert action: %s (want keep, move or delete)", c.Converter.AfterConvert)
+	}
 	return nil
 }
 
@@ -0,0 +1,156 @@
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// TransportConfig holds TLS and proxy settings shared by all outbound
+// connections to remote services (events WebSocket, update checks).
+// Polling of the local game API is not affected.
+type TransportConfig struct {
+	CAFile        string `yaml:"ca_file"`         // PEM bundle of additional trusted CAs
+	CertFile      string `yaml:"cert_file"`       // Client certificate for mutual TLS
+	KeyFile       string `yaml:"key_file"`        // Client private key for mutual TLS
+	ServerName    string `yaml:"server_name"`     // Override the server name used for TLS verification
+	MinTLSVersion string `yaml:"min_tls_version"` // Minimum TLS version: 1.0, 1.1, 1.2 or 1.3
+	ProxyURL      string `yaml:"proxy_url"`       // http://, https:// or socks5:// proxy (default: environment)
+}
+
+// ValidateTransportConfig validates the outbound transport configuration
+func (c *Config) ValidateTransportConfig() error {
+	if _, err := c.Transport.TLSConfig(); err != nil {
+		return err
+	}
+	if _, err := c.Transport.Proxy(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// TLSConfig builds the TLS client configuration. It returns nil when no TLS
+// settings are configured, so callers keep the Go defaults.
+func (t TransportConfig) TLSConfig() (*tls.Config, error) {
+	if t.CAFile == "" && t.CertFile == "" && t.KeyFile == "" && t.ServerName == "" && t.MinTLSVersion == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName: t.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if t.MinTLSVersion != "" {
+		version, err := ParseTLSVersion(t.MinTLSVersion)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.MinVersion = version
+	}
+
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file: %s", t.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, fmt.Errorf("cert_file and key_file must be specified together")
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// Proxy returns the proxy selection function for outbound requests. Without a
+// configured proxy URL it honours the HTTP_PROXY/HTTPS_PROXY/NO_PROXY variables.
+func (t TransportConfig) Proxy() (func(*http.Request) (*url.URL, error), error) {
+	if t.ProxyURL == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	proxyURL, err := url.Parse(t.ProxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q (use http, https or socks5)", proxyURL.Scheme)
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("proxy URL must include a host: %s", t.ProxyURL)
+	}
+
+	return http.ProxyURL(proxyURL), nil
+}
+
+// HTTPClient returns an HTTP client for remote services using the configured
+// TLS and proxy settings.
+func (t TransportConfig) HTTPClient(timeout time.Duration) (*http.Client, error) {
+	tlsConfig, err := t.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := t.Proxy()
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:                 proxy,
+			TLSClientConfig:       tlsConfig,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       90 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: 1 * time.Second,
+			DialContext: (&net.Dialer{
+				Timeout:   10 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+		},
+	}, nil
+}
+
+// ParseTLSVersion parses a TLS version string such as "1.2" or "TLS1.3".
+func ParseTLSVersion(s string) (uint16, error) {
+	v := strings.TrimPrefix(strings.ToLower(strings.TrimSpace(s)), "tls")
+	v = strings.TrimPrefix(v, "v")
+	switch v {
+	case "1.0", "10":
+		return tls.VersionTLS10, nil
+	case "1.1", "11":
+		return tls.VersionTLS11, nil
+	case "1.2", "12":
+		return tls.VersionTLS12, nil
+	case "1.3", "13":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("invalid TLS version: %q (use 1.0, 1.1, 1.2 or 1.3)", s)
+	}
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCertificate writes a self-signed certificate and its key as PEM files.
+func writeTestCertificate(t *testing.T, dir string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "nevr-test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certFile = filepath.Join(dir, "client.crt")
+	keyFile = filepath.Join(dir, "client.key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected uint16
+		wantErr  bool
+	}{
+		{"1.2", tls.VersionTLS12, false},
+		{"1.3", tls.VersionTLS13, false},
+		{"TLS1.3", tls.VersionTLS13, false},
+		{"tlsv1.1", tls.VersionTLS11, false},
+		{" 1.0 ", tls.VersionTLS10, false},
+		{"1.4", 0, true},
+		{"", 0, true},
+		{"ssl3", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, err := ParseTLSVersion(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseTLSVersion(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && result != tt.expected {
+				t.Errorf("ParseTLSVersion(%q) = %x, want %x", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTransportTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeTestCertificate(t, dir)
+
+	t.Run("empty", func(t *testing.T) {
+		tlsConfig, err := TransportConfig{}.TLSConfig()
+		if err != nil || tlsConfig != nil {
+			t.Errorf("TLSConfig() = %v, %v, want nil, nil", tlsConfig, err)
+		}
+	})
+
+	t.Run("full", func(t *testing.T) {
+		tlsConfig, err := TransportConfig{
+			CAFile:        certFile,
+			CertFile:      certFile,
+			KeyFile:       keyFile,
+			ServerName:    "events.example.com",
+			MinTLSVersion: "1.3",
+		}.TLSConfig()
+		if err != nil {
+			t.Fatalf("TLSConfig() error = %v", err)
+		}
+		if tlsConfig.RootCAs == nil {
+			t.Error("RootCAs not set")
+		}
+		if len(tlsConfig.Certificates) != 1 {
+			t.Errorf("len(Certificates) = %d, want 1", len(tlsConfig.Certificates))
+		}
+		if tlsConfig.ServerName != "events.example.com" {
+			t.Errorf("ServerName = %q", tlsConfig.ServerName)
+		}
+		if tlsConfig.MinVersion != tls.VersionTLS13 {
+			t.Errorf("MinVersion = %x, want %x", tlsConfig.MinVersion, tls.VersionTLS13)
+		}
+	})
+
+	errorCases := map[string]TransportConfig{
+		"cert without key": {CertFile: certFile},
+		"missing CA file":  {CAFile: filepath.Join(dir, "missing.pem")},
+		"CA file not PEM":  {CAFile: keyFile + ".none"},
+		"invalid version":  {MinTLSVersion: "2.0"},
+		"key is not cert":  {CAFile: keyFile},
+	}
+	if err := os.WriteFile(keyFile+".none", []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for name, transport := range errorCases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := transport.TLSConfig(); err == nil {
+				t.Error("expected error, got nil")
+			}
+		})
+	}
+}
+
+func TestTransportProxy(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://events.example.com/ws", nil)
+
+	proxy, err := TransportConfig{ProxyURL: "socks5://proxy.local:1080"}.Proxy()
+	if err != nil {
+		t.Fatalf("Proxy() error = %v", err)
+	}
+	proxyURL, err := proxy(req)
+	if err != nil || proxyURL == nil || proxyURL.Host != "proxy.local:1080" {
+		t.Errorf("proxy(req) = %v, %v", proxyURL, err)
+	}
+
+	for _, invalid := range []string{"ftp://proxy.local", "http://", "://bad"} {
+		if _, err := (TransportConfig{ProxyURL: invalid}).Proxy(); err == nil {
+			t.Errorf("Proxy() with %q: expected error", invalid)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+// Package jsondiff compares decoded JSON documents field by field, ignoring
+// floating point differences within a tolerance and keys that only one side
+// omits because they hold a zero value.
+package jsondiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+)
+
+// Kinds of difference reported by Compare.
+const (
+	KindMissing = "missing" // key present in a, absent in b
+	KindExtra   = "extra"   // key present in b, absent in a
+	KindNil     = "nil"     // one side is null
+	KindType    = "type"    // values have different JSON types
+	KindLength  = "length"  // arrays have different lengths; A and B hold the lengths
+	KindValue   = "value"   // values differ
+)
+
+// Difference is a single mismatch between two documents.
+type Difference struct {
+	Path string `json:"path"`
+	Kind string `json:"kind"`
+	A    any    `json:"a,omitempty"`
+	B    any    `json:"b,omitempty"`
+}
+
+func (d Difference) String() string {
+	switch d.Kind {
+	case KindMissing:
+		return fmt.Sprintf("%s: key missing in b", d.Path)
+	case KindExtra:
+		return fmt.Sprintf("%s: key missing in a", d.Path)
+	case KindNil:
+		return fmt.Sprintf("%s: one is nil (a=%v, b=%v)", d.Path, d.A, d.B)
+	case KindType:
+		return fmt.Sprintf("%s: type mismatch (a=%T [%v], b=%T [%v])", d.Path, d.A, d.A, d.B, d.B)
+	case KindLength:
+		return fmt.Sprintf("%s: slice length mismatch (a=%v, b=%v)", d.Path, d.A, d.B)
+	}
+
+	aNum, aIsNum := toFloat64(d.A)
+	bNum, bIsNum := toFloat64(d.B)
+	if aIsNum && bIsNum {
+		return fmt.Sprintf("%s: numeric mismatch (a=%v, b=%v, diff=%v)", d.Path, d.A, d.B, math.Abs(aNum-bNum))
+	}
+	if _, ok := d.A.(string); ok {
+		return fmt.Sprintf("%s: string mismatch (a=%q, b=%q)", d.Path, d.A, d.B)
+	}
+	return fmt.Sprintf("%s: value mismatch (a=%v, b=%v)", d.Path, d.A, d.B)
+}
+
+// Options controls how numbers are compared.
+type Options struct {
+	// Tolerance is the absolute or relative difference allowed between numbers.
+	Tolerance float64
+
+	// FieldTolerances overrides Tolerance for fields with the given key name,
+	// wherever they appear. Array elements use the tolerance of their field.
+	FieldTolerances map[string]float64
+}
+
+// Compare returns the differences between two decoded JSON values, with paths
+// rooted at prefix.
+func Compare(a, b any, prefix string, opts Options) []Difference {
+	var diffs []Difference
+	compareRecursive(a, b, prefix, opts.Tolerance, opts, &diffs)
+	return diffs
+}
+
+// CompareJSON decodes two JSON documents and compares them.
+func CompareJSON(a, b []byte, prefix string, opts Options) ([]Difference, error) {
+	var aVal, bVal any
+	if err := json.Unmarshal(a, &aVal); err != nil {
+		return nil, fmt.Errorf("failed to parse %s (a): %w", prefix, err)
+	}
+	if err := json.Unmarshal(b, &bVal); err != nil {
+		return nil, fmt.Errorf("failed to parse %s (b): %w", prefix, err)
+	}
+	return Compare(aVal, bVal, prefix, opts), nil
+}
+
+// compareRecursive recursively compares two values
+func compareRecursive(a, b any, path string, tolerance float64, opts Options, diffs *[]Difference) {
+	if a == nil && b == nil {
+		return
+	}
+	if a == nil || b == nil {
+		*diffs = append(*diffs, Difference{Path: path, Kind: KindNil, A: a, B: b})
+		return
+	}
+
+	aType := reflect.TypeOf(a)
+	bType := reflect.TypeOf(b)
+
+	// Handle type differences, but allow float64/int conversions
+	if aType != bType {
+		aNum, aIsNum := toFloat64(a)
+		bNum, bIsNum := toFloat64(b)
+		if aIsNum && bIsNum {
+			if !FloatEquals(aNum, bNum, tolerance) {
+				*diffs = append(*diffs, Difference{Path: path, Kind: KindValue, A: a, B: b})
+			}
+			return
+		}
+
+		*diffs = append(*diffs, Difference{Path: path, Kind: KindType, A: a, B: b})
+		return
+	}
+
+	switch aVal := a.(type) {
+	case map[string]any:
+		compareMaps(aVal, b.(map[string]any), path, opts, diffs)
+
+	case []any:
+		bVal := b.([]any)
+		if len(aVal) != len(bVal) {
+			*diffs = append(*diffs, Difference{Path: path, Kind: KindLength, A: len(aVal), B: len(bVal)})
+			return
+		}
+		for i := range aVal {
+			compareRecursive(aVal[i], bVal[i], fmt.Sprintf("%s[%d]", path, i), tolerance, opts, diffs)
+		}
+
+	case float64:
+		if !FloatEquals(aVal, b.(float64), tolerance) {
+			*diffs = append(*diffs, Difference{Path: path, Kind: KindValue, A: a, B: b})
+		}
+
+	default:
+		if !reflect.DeepEqual(a, b) {
+			*diffs = append(*diffs, Difference{Path: path, Kind: KindValue, A: a, B: b})
+		}
+	}
+}
+
+// compareMaps compares two objects, skipping zero values that one side omits
+func compareMaps(a, b map[string]any, path string, opts Options, diffs *[]Difference) {
+	for _, k := range slices.Sorted(maps.Keys(a)) {
+		keyPath := joinPath(path, k)
+		bv, exists := b[k]
+		if !exists {
+			if !isZeroValue(a[k]) {
+				*diffs = append(*diffs, Difference{Path: keyPath, Kind: KindMissing, A: a[k]})
+			}
+			continue
+		}
+		compareRecursive(a[k], bv, keyPath, opts.tolerance(k), opts, diffs)
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(b)) {
+		if _, exists := a[k]; !exists && !isZeroValue(b[k]) {
+			*diffs = append(*diffs, Difference{Path: joinPath(path, k), Kind: KindExtra, B: b[k]})
+		}
+	}
+}
+
+func (o Options) tolerance(key string) float64 {
+	if t, ok := o.FieldTolerances[key]; ok {
+		return t
+	}
+	return o.Tolerance
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// isZeroValue checks if a value is a zero/default value that might be omitted
+func isZeroValue(v any) bool {
+	if v == nil {
+		return true
+	}
+	switch val := v.(type) {
+	case float64:
+		return val == 0
+	case int:
+		return val == 0
+	case string:
+		return val == ""
+	case bool:
+		return !val
+	case []any:
+		return len(val) == 0
+	case map[string]any:
+		return len(val) == 0
+	}
+	return false
+}
+
+// toFloat64 tries to convert a value to float64
+func toFloat64(v any) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case int:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case int32:
+		return float64(val), true
+	case float32:
+		return float64(val), true
+	}
+	return 0, false
+}
+
+// FloatEquals compares two floats with tolerance for rounding errors. The
+// tolerance applies as an absolute difference for small numbers and as a
+// relative difference for large ones.
+func FloatEquals(a, b, tolerance float64) bool {
+	// Handle special cases
+	if math.IsNaN(a) && math.IsNaN(b) {
+		return true
+	}
+	if math.IsInf(a, 1) && math.IsInf(b, 1) {
+		return true
+	}
+	if math.IsInf(a, -1) && math.IsInf(b, -1) {
+		return true
+	}
+
+	// For zero values
+	if a == 0 && b == 0 {
+		return true
+	}
+
+	// Absolute difference check for small numbers
+	diff := math.Abs(a - b)
+	if diff <= tolerance {
+		return true
+	}
+
+	// Relative difference check for larger numbers
+	maxAbs := math.Max(math.Abs(a), math.Abs(b))
+	if maxAbs > 0 && diff/maxAbs <= tolerance {
+		return true
+	}
+
+	return false
+}
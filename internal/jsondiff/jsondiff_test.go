@@ -0,0 +1,64 @@
+package jsondiff
+
+import (
+	"testing"
+)
+
+func TestCompareJSON(t *testing.T) {
+	tests := []struct {
+		name  string
+		a, b  string
+		opts  Options
+		paths []string
+	}{
+		{"equal", `{"x":1,"y":[1,2]}`, `{"y":[1,2],"x":1}`, Options{}, nil},
+		{"within tolerance", `{"x":1.0000001}`, `{"x":1}`, Options{Tolerance: 1e-6}, nil},
+		{"outside tolerance", `{"p":{"x":1.1}}`, `{"p":{"x":1}}`, Options{Tolerance: 1e-6}, []string{"s.p.x"}},
+		{"field tolerance", `{"position":[1.01,2],"speed":1.01}`, `{"position":[1,2],"speed":1}`,
+			Options{Tolerance: 1e-6, FieldTolerances: map[string]float64{"position": 0.1}}, []string{"s.speed"}},
+		{"omitted zero values", `{"a":0,"b":"","c":[]}`, `{}`, Options{}, nil},
+		{"missing and extra", `{"a":1}`, `{"b":2}`, Options{}, []string{"s.a", "s.b"}},
+		{"length", `{"a":[1,2]}`, `{"a":[1]}`, Options{}, []string{"s.a"}},
+		{"element", `{"a":[{"id":1},{"id":2}]}`, `{"a":[{"id":1},{"id":3}]}`, Options{}, []string{"s.a[1].id"}},
+		{"type", `{"a":"1"}`, `{"a":1}`, Options{}, []string{"s.a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diffs, err := CompareJSON([]byte(tt.a), []byte(tt.b), "s", tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(diffs) != len(tt.paths) {
+				t.Fatalf("got %v, want paths %v", diffs, tt.paths)
+			}
+			for i, d := range diffs {
+				if d.Path != tt.paths[i] {
+					t.Errorf("diff %d path = %q, want %q (%s)", i, d.Path, tt.paths[i], d)
+				}
+			}
+		})
+	}
+}
+
+func TestDifferenceString(t *testing.T) {
+	tests := map[string]Difference{
+		"s.x: numeric mismatch (a=1.5, b=1, diff=0.5)": {Path: "s.x", Kind: KindValue, A: 1.5, B: 1.0},
+		`s.n: string mismatch (a="a", b="b")`:          {Path: "s.n", Kind: KindValue, A: "a", B: "b"},
+		"s.k: key missing in b":                        {Path: "s.k", Kind: KindMissing, A: 1.0},
+		"s.l: slice length mismatch (a=2, b=1)":        {Path: "s.l", Kind: KindLength, A: 2, B: 1},
+	}
+	for want, d := range tests {
+		if got := d.String(); got != want {
+			t.Errorf("String() = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestFloatEquals(t *testing.T) {
+	if !FloatEquals(1e9, 1e9+1, 1e-6) {
+		t.Error("large numbers should compare relatively")
+	}
+	if FloatEquals(0.001, 0.002, 1e-6) {
+		t.Error("small numbers should compare absolutely")
+	}
+}